@@ -8,10 +8,25 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
+	"github.com/pedro-gutierrez/form3/pkg/accounts"
 	"github.com/pedro-gutierrez/form3/pkg/admin"
+	"github.com/pedro-gutierrez/form3/pkg/apikeys"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/batches"
+	"github.com/pedro-gutierrez/form3/pkg/beneficiaries"
+	"github.com/pedro-gutierrez/form3/pkg/calendars"
+	"github.com/pedro-gutierrez/form3/pkg/cop"
+	"github.com/pedro-gutierrez/form3/pkg/events"
+	"github.com/pedro-gutierrez/form3/pkg/fx"
 	"github.com/pedro-gutierrez/form3/pkg/health"
 	"github.com/pedro-gutierrez/form3/pkg/logger"
+	"github.com/pedro-gutierrez/form3/pkg/mandates"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
 	"github.com/pedro-gutierrez/form3/pkg/payments"
+	"github.com/pedro-gutierrez/form3/pkg/risk"
+	"github.com/pedro-gutierrez/form3/pkg/schedules"
+	"github.com/pedro-gutierrez/form3/pkg/screening"
+	"github.com/pedro-gutierrez/form3/pkg/subscriptions"
 	"github.com/pedro-gutierrez/form3/pkg/util"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -33,13 +48,65 @@ var (
 	repoUri            *string
 	repoMigrations     *string
 	repoSchemaPayments *string
+	repoSchemaOrgs     *string
+	repoSchemaAccounts *string
+	repoSchemaLedger   *string
+	repoSchemaReturns  *string
+	repoSchemaRevs     *string
+	repoSchemaRecalls  *string
+	repoSchemaMandates *string
+	repoSchemaQuotes   *string
+	repoSchemaFprints  *string
+	repoSchemaBenefs   *string
+	repoSchemaPayees   *string
+	repoSchemaUsage    *string
+	repoSchemaRisk     *string
+	repoSchemaScheds   *string
+	repoSchemaBatches  *string
+	repoSchemaSubs     *string
+	repoSchemaKeys     *string
+	repoSchemaDelivs   *string
+	repoSchemaOutbox   *string
+	repoEventSourced   *bool
+	repoSnapshotEvery  *int
 	enableCors         *bool
 	timeout            *int
 	adminRoutes        *bool
+	adminKey           *string
+	adminListen        *string
+	adminConfirmTTL    *time.Duration
+	authRequired       *bool
+	authRootKey        *string
+	authJWKS           *string
+	authJWKSTTL        *time.Duration
+	authIssuer         *string
+	authAudience       *string
+	authOrgsClaim      *string
+	authRolesClaim     *string
+	authSignatureSkew  *time.Duration
 	profiling          *bool
 	apiVersion         *string
 	externalUrl        *string
 	maxResults         *int
+	webhooksWorkers    *int
+	webhooksAttempts   *int
+	webhooksBackoff    *time.Duration
+	webhooksAllowHttp  *bool
+	eventsFile         *string
+	eventsUrl          *string
+	eventsInterval     *time.Duration
+	schedulerInterval  *time.Duration
+	batchesInterval    *time.Duration
+	calendarsDir       *string
+	fxRates            *string
+	fxQuoteTTL         *time.Duration
+	sanctionsDir       *string
+	sanctionsThreshold *float64
+	riskRules          *string
+	riskCallout        *string
+	riskThreshold      *int
+	payeeDirectory     *string
+	payeeThreshold     *float64
 )
 
 func init() {
@@ -53,11 +120,63 @@ func init() {
 	repoUri = flag.String("repo-uri", "", "repo specific connection string")
 	repoMigrations = flag.String("repo-migrations", "./schema", "path to database migrations")
 	repoSchemaPayments = flag.String("repo-schema-payments", "payments", "the table or schema where we store payments")
+	repoSchemaOrgs = flag.String("repo-schema-organisations", "organisations", "the table or schema where we store organisations")
+	repoSchemaAccounts = flag.String("repo-schema-accounts", "accounts", "the table or schema where we store accounts")
+	repoSchemaLedger = flag.String("repo-schema-ledger", "ledger", "the prefix of the tables where we store ledger entries and balances")
+	repoSchemaReturns = flag.String("repo-schema-returns", "returns", "the table or schema where we store payment returns")
+	repoSchemaRevs = flag.String("repo-schema-reversals", "reversals", "the table or schema where we store payment reversals")
+	repoSchemaRecalls = flag.String("repo-schema-recalls", "recalls", "the table or schema where we store payment recalls")
+	repoSchemaMandates = flag.String("repo-schema-mandates", "mandates", "the table or schema where we store direct debit mandates")
+	repoSchemaQuotes = flag.String("repo-schema-fx-quotes", "fx_quotes", "the table or schema where we store fx quotes")
+	repoSchemaFprints = flag.String("repo-schema-fingerprints", "fingerprints", "the table or schema where we store the fingerprints of recent payments")
+	repoSchemaBenefs = flag.String("repo-schema-beneficiaries", "beneficiaries", "the table or schema where we store the address books of organisations")
+	repoSchemaPayees = flag.String("repo-schema-payees", "payees", "the table or schema where we store the bank accounts each organisation paid before")
+	repoSchemaRisk = flag.String("repo-schema-risk", "risk", "the table or schema where we store the recent payments risk rules look at")
+	repoSchemaUsage = flag.String("repo-schema-usage", "usage", "the table or schema where we store what organisations used of their limits")
+	repoSchemaScheds = flag.String("repo-schema-schedules", "schedules", "the table or schema where we store scheduled and recurring payments")
+	repoSchemaBatches = flag.String("repo-schema-payment-batches", "payment_batches", "the table or schema where we store payment batches, along with their files")
+	repoSchemaSubs = flag.String("repo-schema-subscriptions", "subscriptions", "the table or schema where we store webhook subscriptions")
+	repoSchemaDelivs = flag.String("repo-schema-deliveries", "deliveries", "the table or schema where we store webhook deliveries")
+	repoSchemaKeys = flag.String("repo-schema-api-keys", "api_keys", "the table or schema where we store api keys")
+	repoSchemaOutbox = flag.String("repo-schema-outbox", "outbox", "the table or schema where we store events before they are published")
+	repoEventSourced = flag.Bool("repo-event-sourced", false, "store payments as an append-only log of events")
+	repoSnapshotEvery = flag.Int("repo-snapshot-every", 10, "when event sourced, snapshot payments every this number of events")
 	adminRoutes = flag.Bool("admin", false, "enable admin endpoints")
+	adminKey = flag.String("admin-key", "", "the key admin requests are authenticated with, in the X-Admin-Key header. Required if admin endpoints are enabled")
+	adminListen = flag.String("admin-listen", "", "a separate http interface to serve the admin endpoints at, eg. :8081. They are served along with the api if empty")
+	adminConfirmTTL = flag.Duration("admin-confirmation-ttl", time.Minute, "how long the tokens that confirm destructive admin operations are valid for")
+	authRequired = flag.Bool("auth", false, "require every api request to be authenticated")
+	authRootKey = flag.String("auth-root-key", "", "an api key with the admin permission on all organisations, to create the first api keys with")
+	authJWKS = flag.String("auth-jwks", "", "path or url to the key set bearer tokens are signed with. Bearer tokens are not accepted if empty")
+	authJWKSTTL = flag.Duration("auth-jwks-ttl", 5*time.Minute, "how long we cache the key set bearer tokens are signed with")
+	authIssuer = flag.String("auth-issuer", "", "the issuer bearer tokens must be issued by")
+	authAudience = flag.String("auth-audience", "", "the audience bearer tokens must be issued for")
+	authOrgsClaim = flag.String("auth-organisations-claim", "organisations", "the claim of bearer tokens that tells the organisations their subject can access")
+	authRolesClaim = flag.String("auth-roles-claim", "roles", "the claim of bearer tokens that tells the roles of their subject, eg. read, write or admin")
+	authSignatureSkew = flag.Duration("auth-signature-skew", 5*time.Minute, "how far apart from now the date of signed requests can be, so that they cannot be replayed later on")
 	profiling = flag.Bool("profiling", false, "enable profiling")
 	apiVersion = flag.String("api-version", "v1", "api version to expose our services at")
 	externalUrl = flag.String("external-url", "http://localhost:8080", "url to access our microservice from the outside")
 	maxResults = flag.Int("max-results", 20, "Maximum number of results when listing items (eg. payments)")
+	webhooksWorkers = flag.Int("webhooks-workers", 4, "number of concurrent webhook delivery workers")
+	webhooksAttempts = flag.Int("webhooks-max-attempts", 8, "maximum number of webhook delivery attempts before giving up")
+	webhooksBackoff = flag.Duration("webhooks-backoff", 5*time.Second, "delay before retrying a failed webhook delivery, doubled on every retry")
+	webhooksAllowHttp = flag.Bool("webhooks-allow-http", false, "accept plain http webhook callbacks (eg. for testing)")
+	eventsFile = flag.String("events-file", "", "also publish payment events to this file, as json lines")
+	eventsUrl = flag.String("events-url", "", "also publish payment events to this url, as json")
+	eventsInterval = flag.Duration("events-interval", 500*time.Millisecond, "how often we poll the outbox for events to publish")
+	calendarsDir = flag.String("calendars", "./calendars", "path to the business day calendars of payment schemes")
+	fxRates = flag.String("fx-rates", "./fx/rates.json", "path to the exchange rates fx quotes are given at")
+	fxQuoteTTL = flag.Duration("fx-quote-ttl", time.Minute, "how long the rate of a fx quote is locked for")
+	sanctionsDir = flag.String("sanctions", "./sanctions", "path to the sanctions lists payment parties are screened against, as csv files")
+	sanctionsThreshold = flag.Float64("sanctions-threshold", screening.DefaultThreshold, "similarity, from 0 to 1, above which a party matches a sanctions list")
+	riskRules = flag.String("risk-rules", "./risk/rules.json", "path to the rules payments are scored for fraud with")
+	riskCallout = flag.String("risk-callout", "", "url of an external service to score payments for fraud with, instead of our rules")
+	riskThreshold = flag.Int("risk-threshold", risk.DefaultThreshold, "fraud risk score, from 0 to 100, above which payments are held")
+	payeeDirectory = flag.String("payee-directory", "./cop/directory.csv", "path to the account directory the beneficiary names of UK payments are checked against, as a csv file")
+	payeeThreshold = flag.Float64("payee-threshold", cop.DefaultThreshold, "similarity, from 0 to 1, above which a beneficiary name is a close match of its account name")
+	schedulerInterval = flag.Duration("scheduler-interval", time.Minute, "how often we check for scheduled payments that are due")
+	batchesInterval = flag.Duration("batches-interval", 5*time.Second, "how often we check for payment batches to parse or approve, besides when they are uploaded or approved")
 }
 
 // Main entry point to the program. Connects to the database, configures
@@ -69,33 +188,208 @@ func main() {
 	baseUrl := fmt.Sprintf("%s/%s", *externalUrl, *apiVersion)
 
 	// Setup our persistence. We do this first, since we want to exit
-	// the program, in case the database is not available
-	paymentsRepo, err := util.NewRepo(util.RepoConfig{
-		Driver:     *repoDriver,
-		Uri:        *repoUri,
-		Migrations: *repoMigrations,
-		Schema:     *repoSchemaPayments,
+	// the program, in case the database is not available. Make
+	// sure we close all databases on exit
+	paymentsRepo := newRepo(util.RepoConfig{
+		Schema:        *repoSchemaPayments,
+		Outbox:        *repoSchemaOutbox,
+		Versioned:     true,
+		EventSourced:  *repoEventSourced,
+		SnapshotEvery: *repoSnapshotEvery,
 	})
+	defer paymentsRepo.Close()
+
+	organisationsRepo := newRepo(util.RepoConfig{Schema: *repoSchemaOrgs})
+	defer organisationsRepo.Close()
 
+	accountsRepo := newRepo(util.RepoConfig{Schema: *repoSchemaAccounts})
+	defer accountsRepo.Close()
+
+	// The ledger shares the accounts database
+	ledger, err := util.NewLedger(accountsRepo, *repoSchemaLedger)
+	if err == nil {
+		err = ledger.Init()
+	}
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "Could not create repo"))
+		log.Fatal(errors.Wrap(err, "Could not create ledger"))
 	}
 
-	// Initialize the repo. The implementation
-	// can perform prep work here
-	err = paymentsRepo.Init()
+	returnsRepo := newRepo(util.RepoConfig{Schema: *repoSchemaReturns})
+	defer returnsRepo.Close()
+
+	reversalsRepo := newRepo(util.RepoConfig{Schema: *repoSchemaRevs})
+	defer reversalsRepo.Close()
+
+	recallsRepo := newRepo(util.RepoConfig{Schema: *repoSchemaRecalls})
+	defer recallsRepo.Close()
+
+	schedulesRepo := newRepo(util.RepoConfig{Schema: *repoSchemaScheds})
+	defer schedulesRepo.Close()
+
+	batchesRepo := newRepo(util.RepoConfig{Schema: *repoSchemaBatches})
+	defer batchesRepo.Close()
+
+	mandatesRepo := newRepo(util.RepoConfig{Schema: *repoSchemaMandates})
+	defer mandatesRepo.Close()
+
+	quotesRepo := newRepo(util.RepoConfig{Schema: *repoSchemaQuotes})
+	defer quotesRepo.Close()
+
+	fingerprintsRepo := newRepo(util.RepoConfig{Schema: *repoSchemaFprints})
+	defer fingerprintsRepo.Close()
+
+	beneficiariesRepo := newRepo(util.RepoConfig{Schema: *repoSchemaBenefs})
+	defer beneficiariesRepo.Close()
+
+	payeesRepo := newRepo(util.RepoConfig{Schema: *repoSchemaPayees})
+	defer payeesRepo.Close()
+
+	usageRepo := newRepo(util.RepoConfig{Schema: *repoSchemaUsage})
+	defer usageRepo.Close()
+
+	riskRepo := newRepo(util.RepoConfig{Schema: *repoSchemaRisk})
+	defer riskRepo.Close()
+
+	apiKeysRepo := newRepo(util.RepoConfig{Schema: *repoSchemaKeys})
+	defer apiKeysRepo.Close()
+
+	// Payments are checked against the limits of their
+	// organisation, as they are created
+	limits := organisations.NewLimits(usageRepo)
+
+	subscriptionsRepo := newRepo(util.RepoConfig{Schema: *repoSchemaSubs})
+	defer subscriptionsRepo.Close()
+
+	deliveriesRepo := newRepo(util.RepoConfig{Schema: *repoSchemaDelivs})
+	defer deliveriesRepo.Close()
+
+	// Start delivering events to webhook subscribers
+	dispatcher := subscriptions.NewDispatcher(subscriptionsRepo, deliveriesRepo, subscriptions.DispatcherConfig{
+		Workers:     *webhooksWorkers,
+		MaxAttempts: *webhooksAttempts,
+		Backoff:     *webhooksBackoff,
+		MaxBackoff:  time.Hour,
+		Timeout:     time.Duration(*timeout) * time.Second,
+	})
+
+	if err := dispatcher.Start(); err != nil {
+		log.Fatal(errors.Wrap(err, "Could not start webhooks dispatcher"))
+	}
+
+	defer dispatcher.Stop()
+
+	// Events written to the payments outbox are relayed to
+	// the webhooks dispatcher, and maybe to a file or a url
+	publisher := events.NewInProcessPublisher()
+	publisher.Subscribe(dispatcher)
+
+	if *eventsFile != "" {
+		filePublisher, err := events.NewFilePublisher(*eventsFile)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Could not create events file publisher"))
+		}
+		defer filePublisher.Close()
+		publisher.Subscribe(filePublisher)
+	}
+
+	if *eventsUrl != "" {
+		publisher.Subscribe(events.NewHttpPublisher(*eventsUrl, time.Duration(*timeout)*time.Second))
+	}
+
+	relay := events.NewRelay(paymentsRepo, publisher, *eventsInterval, *maxResults)
+	relay.Start()
+	defer relay.Stop()
+
+	// Business day calendars are read once, at startup
+	schemeCalendars, err := calendars.Load(*calendarsDir)
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "Could not init repo"))
+		log.Fatal(errors.Wrap(err, "Could not load calendars"))
 	}
 
-	// Make sure we close the database on exit
-	defer paymentsRepo.Close()
+	rates, err := fx.LoadRates(*fxRates)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Could not load fx rates"))
+	}
 
-	// Stop here if the repo is not ready
-	if err := paymentsRepo.Check(); err != nil {
-		log.Fatal(errors.Wrap(err, "Could connect to the repo"))
+	screener, err := screening.Load(*sanctionsDir, *sanctionsThreshold)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Could not load sanctions lists"))
+	}
+
+	directory, err := cop.Load(*payeeDirectory, *payeeThreshold)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Could not load account directory"))
+	}
+
+	// Requests are authenticated with api keys, with signatures made
+	// with the private keys of api keys, and with bearer tokens, if we
+	// were told which keys they are signed with
+	authenticators := []auth.Authenticator{
+		apikeys.NewAuthenticator(apiKeysRepo, *authRootKey),
+		apikeys.NewSignatureAuthenticator(apiKeysRepo, *authSignatureSkew),
+	}
+	if *authJWKS != "" {
+		if *authIssuer == "" || *authAudience == "" {
+			log.Fatal("Bearer tokens need an issuer and an audience")
+		}
+
+		keys, err := auth.NewJWKS(*authJWKS, *authJWKSTTL, time.Duration(*timeout)*time.Second)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Could not load bearer token keys"))
+		}
+		authenticators = append(authenticators, auth.NewJWTAuthenticator(keys, *authIssuer, *authAudience, *authOrgsClaim, *authRolesClaim))
 	}
 
+	// Payments are scored for fraud by an external service, if
+	// any, or by our own rules, if there are any
+	var scorer risk.RiskScorer
+	if *riskCallout != "" {
+		scorer = risk.NewCallout(*riskCallout, time.Duration(*timeout)*time.Second)
+	} else {
+		rules, err := risk.LoadRules(*riskRules)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Could not load risk rules"))
+		}
+		if len(rules) > 0 {
+			scorer = risk.NewEngine(rules, riskRepo)
+		}
+	}
+
+	paymentsService := payments.New(payments.Config{
+		Repo:          paymentsRepo,
+		Organisations: organisationsRepo,
+		Accounts:      accountsRepo,
+		Ledger:        ledger,
+		Returns:       returnsRepo,
+		Reversals:     reversalsRepo,
+		Recalls:       recallsRepo,
+		Calendars:     schemeCalendars,
+		Mandates:      mandatesRepo,
+		Quotes:        quotesRepo,
+		Fingerprints:  fingerprintsRepo,
+		Beneficiaries: beneficiariesRepo,
+		Payees:        payeesRepo,
+		Directory:     directory,
+		Screener:      screener,
+		Limits:        limits,
+		Scorer:        scorer,
+		RiskThreshold: *riskThreshold,
+		BaseUrl:       baseUrl,
+		MaxResults:    *maxResults,
+	})
+
+	// Scheduled and recurring payments are created
+	// through the payments service, once they are due
+	scheduler := schedules.NewScheduler(schedulesRepo, paymentsService, schemeCalendars, *schedulerInterval)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	// Payment batches are parsed and validated, and their
+	// payments created, in the background too
+	batchProcessor := batches.NewProcessor(batchesRepo, organisationsRepo, paymentsService, *batchesInterval)
+	batchProcessor.Start()
+	defer batchProcessor.Stop()
+
 	router := chi.NewRouter()
 
 	// Enable default middleware. Please move the ones you'd wish
@@ -144,7 +438,7 @@ func main() {
 		cors := cors.New(cors.Options{
 			AllowedOrigins:   []string{"*"},
 			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", util.UserHeader, apikeys.Header, "Signature", apikeys.DigestHeader},
 			ExposedHeaders:   []string{"Link"},
 			AllowCredentials: true,
 			MaxAge:           300,
@@ -169,18 +463,83 @@ func main() {
 
 	// Admin features
 	// (useful for testing, for example, but use with care in a production
-	// environment
+	// environment). They have their own key, and can be served on their
+	// own interface, so that they are not exposed along with the api
 	if *adminRoutes {
-		router.Route("/admin", func(adminRouter chi.Router) {
-			adminRouter.Mount("/", admin.New(paymentsRepo).Routes())
-		})
+		if *adminKey == "" {
+			log.Fatal("Admin endpoints require an admin key")
+		}
+
+		adminService := admin.New(*adminKey, *adminConfirmTTL, paymentsRepo, organisationsRepo, accountsRepo, ledger, returnsRepo, reversalsRepo, recallsRepo, schedulesRepo, batchesRepo, mandatesRepo, quotesRepo, fingerprintsRepo, beneficiariesRepo, payeesRepo, usageRepo, riskRepo, subscriptionsRepo, deliveriesRepo, apiKeysRepo)
+
+		if *adminListen == "" {
+			router.Mount("/admin", adminService.Routes())
+		} else {
+			adminRouter := chi.NewRouter()
+			adminRouter.Use(
+				render.SetContentType(render.ContentTypeJSON),
+				middleware.Timeout(time.Duration(*timeout)*time.Second),
+				middleware.Recoverer,
+				middleware.RequestID,
+				middleware.RealIP,
+				logger.NewHttpLogger(),
+			)
+			adminRouter.Mount("/admin", adminService.Routes())
+
+			logger.Info("Started admin server", &ServerInfo{
+				Interface: *adminListen,
+			})
+			go func() {
+				log.Fatal(http.ListenAndServe(*adminListen, adminRouter))
+			}()
+		}
 	}
 
 	// mount application logic
 	router.Route("/v1", func(v1Router chi.Router) {
 
+		// Find out who requests are made by, and check
+		// they are allowed to read, or write
+		v1Router.Use(
+			auth.Authenticate(*authRequired, authenticators...),
+			auth.Authorize,
+		)
+
 		// payments api
-		v1Router.Mount("/", payments.New(paymentsRepo, baseUrl, *maxResults).Routes())
+		v1Router.Mount("/", paymentsService.Routes())
+
+		// organisations api
+		v1Router.Mount("/organisations", organisations.New(organisationsRepo, limits, baseUrl, *maxResults).Routes())
+
+		// accounts api
+		v1Router.Mount("/accounts", accounts.New(accountsRepo, organisationsRepo, ledger, baseUrl, *maxResults).Routes())
+
+		// scheduled payments api
+		v1Router.Mount("/schedules", schedules.New(schedulesRepo, organisationsRepo, schemeCalendars, baseUrl, *maxResults).Routes())
+
+		// payment batches api
+		v1Router.Mount("/payment-batches", batches.New(batchesRepo, organisationsRepo, paymentsRepo, batchProcessor, baseUrl, *maxResults).Routes())
+
+		// direct debit mandates api
+		v1Router.Mount("/mandates", mandates.New(mandatesRepo, organisationsRepo, baseUrl, *maxResults).Routes())
+
+		// beneficiaries api
+		v1Router.Mount("/beneficiaries", beneficiaries.New(beneficiariesRepo, organisationsRepo, baseUrl, *maxResults).Routes())
+
+		// confirmation of payee api
+		v1Router.Mount("/payee-checks", cop.New(directory, baseUrl).Routes())
+
+		// fx quotes api
+		v1Router.Mount("/fx-quotes", fx.New(quotesRepo, organisationsRepo, rates, *fxQuoteTTL, baseUrl, *maxResults).Routes())
+
+		// business day calendars api
+		v1Router.Mount("/calendars", calendars.New(schemeCalendars, baseUrl).Routes())
+
+		// webhook subscriptions api
+		v1Router.Mount("/subscriptions", subscriptions.New(subscriptionsRepo, deliveriesRepo, baseUrl, *maxResults, *webhooksAllowHttp).Routes())
+
+		// api keys api
+		v1Router.Mount("/api-keys", apikeys.New(apiKeysRepo, organisationsRepo, baseUrl, *maxResults).Routes())
 
 		// more endpoints here...
 	})
@@ -206,6 +565,35 @@ func main() {
 	log.Fatal(http.ListenAndServe(*listen, router))
 }
 
+// newRepo creates a new repo for the given configuration, using
+// the configured driver, initializes it, and checks it is ready. The
+// program exits if any of these steps fails
+func newRepo(config util.RepoConfig) util.Repo {
+	config.Driver = *repoDriver
+	config.Uri = *repoUri
+	config.Migrations = *repoMigrations
+
+	repo, err := util.NewRepo(config)
+
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Could not create repo"))
+	}
+
+	// Initialize the repo. The implementation
+	// can perform prep work here
+	err = repo.Init()
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Could not init repo"))
+	}
+
+	// Stop here if the repo is not ready
+	if err := repo.Check(); err != nil {
+		log.Fatal(errors.Wrap(err, "Could connect to the repo"))
+	}
+
+	return repo
+}
+
 // Simple route information
 type RouteInfo struct {
 	Method string `json:"method"`
@@ -0,0 +1,224 @@
+package accounts
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// AccountAttributes captures the details of a bank
+// account held by an organisation
+type AccountAttributes struct {
+	Name          string `json:"name"`
+	AccountNumber string `json:"account_number"`
+	BankId        string `json:"bank_id"`
+	BankIdCode    string `json:"bank_id_code"`
+	Currency      string `json:"currency"`
+
+	// The funds the account starts with. It cannot
+	// be changed once the account is created
+	OpeningBalance string `json:"opening_balance,omitempty"`
+
+	// The current balance of the account, as computed by
+	// the ledger. This is read only, and never stored
+	Balance string `json:"balance,omitempty"`
+}
+
+// Validate does semantic validation on the account attributes,
+// against the settings of the organisation that holds the account
+func (aa *AccountAttributes) Validate(settings organisations.Settings) error {
+	if len(strings.TrimSpace(aa.AccountNumber)) == 0 {
+		return errors.New("Account number is empty")
+	}
+
+	if len(aa.Currency) != 3 || strings.ToUpper(aa.Currency) != aa.Currency {
+		return fmt.Errorf("Invalid currency: %s", aa.Currency)
+	}
+
+	if !settings.AllowsCurrency(aa.Currency) {
+		return fmt.Errorf("Currency not allowed: %s", aa.Currency)
+	}
+
+	if aa.OpeningBalance != "" {
+		balance, err := ParseAmount(aa.OpeningBalance)
+		if err != nil {
+			return errors.Wrap(err, "Invalid opening balance")
+		}
+
+		if balance < 0 {
+			return errors.New("Opening balance cannot be negative")
+		}
+	}
+
+	return nil
+}
+
+// Account a bank account, that payments are debited from
+type Account struct {
+	Id           string            `json:"id"`
+	Type         string            `json:"type"`
+	Version      int               `json:"version"`
+	Organisation string            `json:"organisation_id"`
+	Attributes   AccountAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the account
+func (a *Account) Validate(settings organisations.Settings) error {
+
+	// check the id is not empty
+	if len(strings.TrimSpace(a.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	// The external account is reserved for
+	// the ledger
+	if a.Id == LedgerExternal {
+		return fmt.Errorf("Reserved id: %s", a.Id)
+	}
+
+	// check the type
+	if a.Type != "Account" {
+		return fmt.Errorf("Invalid type: %s", a.Type)
+	}
+
+	// check the attributes
+	return a.Attributes.Validate(settings)
+}
+
+// Converts an account into something that
+// can be saved into the database. The balance is left out
+func (a *Account) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           a.Id,
+		Version:      a.Version,
+		Organisation: a.Organisation,
+	}
+
+	attrs := a.Attributes
+	attrs.Balance = ""
+
+	bytes, err := json.Marshal(attrs)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize account attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into an account
+func NewAccountFromRepoItem(item *RepoItem) (*Account, error) {
+	a := &Account{
+		Type:         "Account",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+	}
+
+	var attrs AccountAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return a, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	a.Attributes = attrs
+
+	return a, nil
+}
+
+// NewAccountsFromRepoItems converts the given slice of repo
+// items to a list of accounts
+func NewAccountsFromRepoItems(items []*RepoItem) ([]*Account, error) {
+	accounts := []*Account{}
+	for _, i := range items {
+		a, err := NewAccountFromRepoItem(i)
+		if err != nil {
+			return accounts, err
+		}
+		accounts = append(accounts, a)
+	}
+
+	return accounts, nil
+}
+
+// Fetch is a convenience function that looks up an account
+// by id in the given repo. Other services use it in order to check
+// the accounts their resources refer to
+func Fetch(repo Repo, id string) (*Account, error) {
+	found, err := repo.Fetch(&RepoItem{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return NewAccountFromRepoItem(found)
+}
+
+// TransactionAttributes captures the details of a single
+// line in the statement of an account
+type TransactionAttributes struct {
+	// The ledger transfer this transaction is part of
+	TransferId string `json:"transfer_id"`
+
+	// Debits are negative amounts
+	Amount      string    `json:"amount"`
+	Description string    `json:"description"`
+	PaymentId   string    `json:"payment_id,omitempty"`
+	CreatedOn   time.Time `json:"created_on"`
+}
+
+// Transaction a movement of funds in or out of an account
+type Transaction struct {
+	Id         string                `json:"id"`
+	Type       string                `json:"type"`
+	Account    string                `json:"account_id"`
+	Attributes TransactionAttributes `json:"attributes"`
+	Links      Links                 `json:"links,omitempty"`
+}
+
+// NewTransactionFromLedgerEntry converts a ledger entry
+// into a transaction
+func NewTransactionFromLedgerEntry(e *LedgerEntry) *Transaction {
+	return &Transaction{
+		Id:      e.Id,
+		Type:    "Transaction",
+		Account: e.Account,
+		Attributes: TransactionAttributes{
+			TransferId:  e.Transfer,
+			Amount:      FormatAmount(e.Amount),
+			Description: e.Description,
+			PaymentId:   e.Reference,
+			CreatedOn:   time.Unix(0, e.Created).UTC(),
+		},
+	}
+}
+
+// AccountRequest represents a http request that contains
+// an account in its field 'data'
+type AccountRequest struct {
+	Account *Account `json:"data"`
+}
+
+// AccountResponse represents a http response that contains
+// an account in its field 'data' and set of links
+type AccountResponse struct {
+	Data  *Account `json:"data"`
+	Links Links    `json:"links"`
+}
+
+// AccountsResponse represents a http response that contains
+// a list of accounts in its field 'data' and a set of links
+type AccountsResponse struct {
+	Data  []*Account `json:"data"`
+	Links Links      `json:"links"`
+}
+
+// TransactionsResponse represents a http response that contains
+// a list of transactions in its field 'data' and a set of links
+type TransactionsResponse struct {
+	Data  []*Transaction `json:"data"`
+	Links Links          `json:"links"`
+}
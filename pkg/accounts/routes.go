@@ -0,0 +1,437 @@
+// accounts contains the http routes that manage the bank accounts
+// of organisations, and expose their balance and statement, as
+// recorded in the ledger
+package accounts
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	accountsLinkPattern     string
+	accountLinkPattern      string
+	transactionsLinkPattern string
+	paymentLinkPattern      string
+)
+
+func init() {
+	accountsLinkPattern = "/accounts?%sfrom=%v&to=%v"
+	accountLinkPattern = "/accounts/%v"
+	transactionsLinkPattern = "/accounts/%v/transactions?from=%v&to=%v"
+	paymentLinkPattern = "/payments/%v"
+}
+
+// AccountsService represents an accounts service
+// it defines the routes, the repos and the ledger to operate
+// with. It inherits fields and functions from util.HttpService
+type AccountsService struct {
+	HttpService
+	repo          Repo
+	organisations Repo
+	ledger        Ledger
+	maxResults    int
+}
+
+// New creates a new AccountsService with the given repos, ledger,
+// base url and maxResults information. Accounts must belong to one
+// of the organisations in the organisations repo
+func New(repo Repo, organisations Repo, ledger Ledger, baseUrl string, maxResults int) *AccountsService {
+	return &AccountsService{
+		HttpService: HttpService{
+			BaseUrl: baseUrl,
+		},
+		repo:          repo,
+		organisations: organisations,
+		ledger:        ledger,
+		maxResults:    maxResults,
+	}
+}
+
+// Routes returns a router with all routes
+// supported by this service
+func (s *AccountsService) Routes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Get("/", s.List)
+	router.Post("/", s.Create)
+	router.Get("/{id}", s.Fetch)
+	router.Put("/{id}", s.Update)
+	router.Delete("/{id}", s.Delete)
+	router.Get("/{id}/transactions", s.ListTransactions)
+	return router
+}
+
+// List returns a list of accounts, along with their balances, using
+// the same from and to query params semantics as payments. Like
+// payments, they can be filtered by organisation, and principals only
+// see the accounts of the organisations they can access
+func (s *AccountsService) List(w http.ResponseWriter, r *http.Request) {
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	organisation, err := auth.FromRequest(r).Scope(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	repoItems, err := s.repo.Find(RepoFilter{Organisation: organisation}, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	accounts, err := NewAccountsFromRepoItems(repoItems)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, a := range accounts {
+		if err := s.withBalance(a); err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	filter := ""
+	if organisation != "" {
+		filter = fmt.Sprintf("organisation_id=%s&", url.QueryEscape(organisation))
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(accountsLinkPattern, filter, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(accountsLinkPattern, filter, to, to+limit))
+
+	if from >= limit {
+		links["prev"] = s.UrlFor(fmt.Sprintf(accountsLinkPattern, filter, from-limit, from))
+	}
+
+	RenderJSON(w, r, http.StatusOK, &AccountsResponse{
+		Data:  accounts,
+		Links: links,
+	})
+}
+
+// Fetch an account by id, along with its balance
+func (s *AccountsService) Fetch(w http.ResponseWriter, r *http.Request) {
+	account, status, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, account)
+}
+
+// Create a new account. The opening balance, if any, is
+// transferred into the account from the external ledger account
+func (s *AccountsService) Create(w http.ResponseWriter, r *http.Request) {
+	account, err := decodeAccount(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.FromRequest(r).CanSee(account.Organisation) {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Unknown organisation: %s", account.Organisation))
+		return
+	}
+
+	org, status, err := organisations.Lookup(s.organisations, account.Organisation)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	err = account.Validate(org.Attributes.Settings)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	repoItem, err := account.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdItem, err := s.repo.Create(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	// Validated above
+	openingBalance, _ := ParseAmount(account.Attributes.OpeningBalance)
+	if openingBalance > 0 {
+		err = s.ledger.Transfer(&LedgerTransfer{
+			Id:          fmt.Sprintf("opening-balance:%s", account.Id),
+			Debit:       LedgerExternal,
+			Credit:      account.Id,
+			Amount:      openingBalance,
+			Description: "Opening balance",
+		})
+		if err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	account, err = NewAccountFromRepoItem(createdItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.withBalance(account); err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusCreated, account)
+}
+
+// Update an existing account. The organisation, currency and
+// opening balance of an account cannot be changed
+func (s *AccountsService) Update(w http.ResponseWriter, r *http.Request) {
+	account, err := decodeAccount(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id != account.Id {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Account id mismatch: %s", account.Id))
+		return
+	}
+
+	current, status, err := s.fetch(r, id)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	if account.Organisation != current.Organisation || account.Attributes.Currency != current.Attributes.Currency {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("The organisation and currency of an account cannot be changed"))
+		return
+	}
+
+	org, status, err := organisations.Lookup(s.organisations, account.Organisation)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	account.Attributes.OpeningBalance = current.Attributes.OpeningBalance
+	err = account.Validate(org.Attributes.Settings)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	repoItem, err := account.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	updatedItem, err := s.repo.Update(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	account, err = NewAccountFromRepoItem(updatedItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.withBalance(account); err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, account)
+}
+
+// Delete an account by id. Only accounts with a zero
+// balance can be deleted
+func (s *AccountsService) Delete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	versionQP := strings.TrimSpace(r.URL.Query().Get("version"))
+	version, err := strconv.Atoi(versionQP)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	account, status, err := s.fetch(r, id)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	if account.Attributes.Balance != FormatAmount(0) {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Account %s has a balance of %s", id, account.Attributes.Balance))
+		return
+	}
+
+	err = s.repo.Delete(&RepoItem{Id: id, Version: version})
+	if err != nil {
+		errorCode := http.StatusInternalServerError
+		if s.repo.IsNotFound(err) || s.repo.IsConflict(err) {
+			errorCode = http.StatusConflict
+		}
+		HandleHttpError(w, r, errorCode, err)
+		return
+	}
+
+	RenderNoContent(w, r)
+}
+
+// ListTransactions returns the statement of an account: the ledger
+// entries of the account, oldest first, linked to the payments
+// that caused them
+func (s *AccountsService) ListTransactions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, status, err := s.fetch(r, id); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	entries, err := s.ledger.Entries(id, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	transactions := []*Transaction{}
+	for _, e := range entries {
+		t := NewTransactionFromLedgerEntry(e)
+		if t.Attributes.PaymentId != "" {
+			t.Links = Links{"payment": s.UrlFor(fmt.Sprintf(paymentLinkPattern, t.Attributes.PaymentId))}
+		}
+		transactions = append(transactions, t)
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(transactionsLinkPattern, id, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(transactionsLinkPattern, id, to, to+limit))
+	links["account"] = s.UrlFor(fmt.Sprintf(accountLinkPattern, id))
+
+	if from >= limit {
+		links["prev"] = s.UrlFor(fmt.Sprintf(transactionsLinkPattern, id, from-limit, from))
+	}
+
+	RenderJSON(w, r, http.StatusOK, &TransactionsResponse{
+		Data:  transactions,
+		Links: links,
+	})
+}
+
+// fetch looks up an account, along with its balance. Accounts of
+// organisations the principal of the given request cannot access are
+// not found, like their payments. Returns the http status code to
+// respond with on error
+func (s *AccountsService) fetch(r *http.Request, id string) (*Account, int, error) {
+	account, err := Fetch(s.repo, id)
+	if err != nil {
+		if s.repo.IsNotFound(err) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !auth.FromRequest(r).CanSee(account.Organisation) {
+		return nil, http.StatusNotFound, fmt.Errorf("Account %s not found", id)
+	}
+
+	if err := s.withBalance(account); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return account, http.StatusOK, nil
+}
+
+// withBalance sets the current balance of the account,
+// as computed by the ledger
+func (s *AccountsService) withBalance(account *Account) error {
+	balance, err := s.ledger.Balance(account.Id)
+	if err != nil {
+		return err
+	}
+
+	account.Attributes.Balance = FormatAmount(balance)
+	return nil
+}
+
+// page reads the from and to query params, and returns
+// the limit to apply, capped to the maximum number of results
+func (s *AccountsService) page(r *http.Request) (int, int, int, error) {
+	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
+	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
+
+	limit := to - from
+	if limit <= 0 {
+		return from, to, limit, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to)
+	}
+
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	return from, to, limit, nil
+}
+
+// render sends back the given account, along with its links
+func (s *AccountsService) render(w http.ResponseWriter, r *http.Request, status int, account *Account) {
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(accountLinkPattern, account.Id))
+	links["transactions"] = s.UrlFor(fmt.Sprintf(transactionsLinkPattern, account.Id, 0, s.maxResults))
+
+	RenderJSON(w, r, status, &AccountResponse{
+		Data:  account,
+		Links: links,
+	})
+}
+
+// decodeAccount is a convenience function that attempts to
+// decode an account from the HTTP request body.
+func decodeAccount(r *http.Request) (*Account, error) {
+	decoder := json.NewDecoder(r.Body)
+	var ar AccountRequest
+	err := decoder.Decode(&ar)
+	if err == nil && ar.Account == nil {
+		err = fmt.Errorf("No account data")
+	}
+	return ar.Account, err
+}
@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pedro-gutierrez/form3/pkg/logger"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+)
+
+// The headers admin requests are authenticated, and
+// destructive operations are confirmed with
+const (
+	KeyHeader          = "X-Admin-Key"
+	ConfirmationHeader = "X-Admin-Confirmation"
+)
+
+// AuditEntry is what we log about every admin call, whether it
+// was authenticated or not, so that we know who did what, and when.
+// The principal is the id of the admin key the call was authenticated
+// with, if any. The user the client says the call is made on behalf
+// of is not authenticated, so it is only recorded as a claim
+type AuditEntry struct {
+	Method        string `json:"method"`
+	Path          string `json:"path"`
+	Principal     string `json:"principal,omitempty"`
+	ClaimedUser   string `json:"claimed_user,omitempty"`
+	RemoteAddr    string `json:"remote_addr"`
+	RequestId     string `json:"request_id"`
+	Authenticated bool   `json:"authenticated"`
+	Status        int    `json:"status"`
+}
+
+// idOfKey returns the id the given admin key is recorded as in
+// the audit log: a short hash of it, so that calls made with
+// different keys can be told apart, without logging the keys
+func idOfKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "admin-key:" + hex.EncodeToString(sum[:4])
+}
+
+// audit logs every admin call, along with its outcome
+func (s *AdminService) audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			entry := &AuditEntry{
+				Method:        r.Method,
+				Path:          r.URL.Path,
+				ClaimedUser:   UserFromRequest(r),
+				RemoteAddr:    r.RemoteAddr,
+				RequestId:     middleware.GetReqID(r.Context()),
+				Authenticated: s.authenticated(r),
+				Status:        ww.Status(),
+			}
+			if entry.Authenticated {
+				entry.Principal = s.keyId
+			}
+			logger.Info("Admin call", entry)
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// authenticate rejects admin calls made without the admin key. Api
+// keys and bearer tokens are not enough, even with the admin permission,
+// as they are meant for the data of organisations, not for the platform
+func (s *AdminService) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authenticated(r) {
+			HandleHttpError(w, r, http.StatusUnauthorized, errors.New("Invalid admin key"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticated returns true if the given request
+// was made with the admin key
+func (s *AdminService) authenticated(r *http.Request) bool {
+	key := r.Header.Get(KeyHeader)
+	return s.key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.key)) == 1
+}
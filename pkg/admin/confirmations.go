@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// The destructive operations that have to be confirmed
+const (
+	OperationWipe = "wipe"
+)
+
+// Confirmation is a short lived, single use token that confirms
+// a destructive operation is meant, rather than a mistake
+type Confirmation struct {
+	Token     string    `json:"token"`
+	Operation string    `json:"operation"`
+	ExpiresOn time.Time `json:"expires_on"`
+}
+
+// ConfirmationResponse represents the json
+// response for a single confirmation
+type ConfirmationResponse struct {
+	Data *Confirmation `json:"data"`
+}
+
+// Confirmations keeps track of the confirmations issued, and not used
+// yet. They are only kept in memory, so they do not survive restarts,
+// and are only valid for the instance that issued them
+type Confirmations struct {
+	ttl    time.Duration
+	mutex  sync.Mutex
+	issued map[string]*Confirmation
+}
+
+// NewConfirmations returns a new set of confirmations, which
+// are valid for the given ttl once issued
+func NewConfirmations(ttl time.Duration) *Confirmations {
+	return &Confirmations{
+		ttl:    ttl,
+		issued: map[string]*Confirmation{},
+	}
+}
+
+// Issue returns a new confirmation for the given operation
+func (c *Confirmations) Issue(operation string) (*Confirmation, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "Unable to generate confirmation token")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.expire()
+
+	confirmation := &Confirmation{
+		Token:     hex.EncodeToString(b),
+		Operation: operation,
+		ExpiresOn: time.Now().UTC().Add(c.ttl),
+	}
+	c.issued[confirmation.Token] = confirmation
+	return confirmation, nil
+}
+
+// Confirm returns true if the given token was issued for the given
+// operation, and has not expired, nor been used yet. Tokens are used up,
+// whether they confirm the operation or not
+func (c *Confirmations) Confirm(token string, operation string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.expire()
+
+	confirmation, found := c.issued[token]
+	if !found {
+		return false
+	}
+
+	delete(c.issued, token)
+	return confirmation.Operation == operation
+}
+
+// expire forgets the confirmations that expired
+func (c *Confirmations) expire() {
+	now := time.Now()
+	for token, confirmation := range c.issued {
+		if now.After(confirmation.ExpiresOn) {
+			delete(c.issued, token)
+		}
+	}
+}
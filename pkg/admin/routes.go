@@ -1,43 +1,94 @@
 // admin contains extra http endpoints to perform administrative
 // operations on the database. These can be enabled/disabled via the
-// --admin command line flag
+// --admin command line flag, and are only available with the admin key
 package admin
 
 import (
+	"errors"
 	"github.com/go-chi/chi"
 	. "github.com/pedro-gutierrez/form3/pkg/util"
 	"net/http"
+	"time"
 )
 
+// Wipeable is anything we can delete all data from, such
+// as repos and ledgers
+type Wipeable interface {
+	DeleteAll() error
+}
+
 // Admin represents an admin service
 type AdminService struct {
+	// The key admin requests are authenticated with, and
+	// the id it is recorded as in the audit log
+	key   string
+	keyId string
+
+	// The confirmations issued for destructive operations
+	confirmations *Confirmations
+
 	// The database to operate with
 	repo Repo
+
+	// Other repos (or ledgers) to wipe along with the main one
+	others []Wipeable
 }
 
-// New creates a new PaymentsService
-func New(repo Repo) *AdminService {
-	return &AdminService{repo: repo}
+// New creates a new AdminService for the given repo, only available
+// with the given key. Deleting data also deletes everything from the
+// other repos given, and has to be confirmed with a token, valid for
+// the given ttl
+func New(key string, confirmationTTL time.Duration, repo Repo, others ...Wipeable) *AdminService {
+	return &AdminService{
+		key:           key,
+		keyId:         idOfKey(key),
+		confirmations: NewConfirmations(confirmationTTL),
+		repo:          repo,
+		others:        others,
+	}
 }
 
 // Routes returns a router with all routes
 // supported by this service
 func (s *AdminService) Routes() *chi.Mux {
 	router := chi.NewRouter()
+	router.Use(s.audit, s.authenticate)
 	router.Route("/repo", func(r chi.Router) {
 		r.Delete("/", s.DeleteRepo)
 		r.Get("/", s.GetRepo)
+		r.Post("/confirmations", s.ConfirmDeleteRepo)
 	})
 	return router
 }
 
-// DeleteRepo deletes all data from the repo
-func (s *AdminService) DeleteRepo(w http.ResponseWriter, r *http.Request) {
-	err := s.repo.DeleteAll()
+// ConfirmDeleteRepo issues a new token to confirm
+// all data is to be deleted with
+func (s *AdminService) ConfirmDeleteRepo(w http.ResponseWriter, r *http.Request) {
+	confirmation, err := s.confirmations.Issue(OperationWipe)
 	if err != nil {
 		HandleHttpError(w, r, http.StatusInternalServerError, err)
 		return
 	}
+
+	RenderJSON(w, r, http.StatusCreated, &ConfirmationResponse{Data: confirmation})
+}
+
+// DeleteRepo deletes all data from the repo, and from all other
+// repos. This has to be confirmed with a token, issued beforehand,
+// so that all data is never deleted by mistake
+func (s *AdminService) DeleteRepo(w http.ResponseWriter, r *http.Request) {
+	if !s.confirmations.Confirm(r.Header.Get(ConfirmationHeader), OperationWipe) {
+		HandleHttpError(w, r, http.StatusPreconditionRequired, errors.New("Deleting all data has to be confirmed"))
+		return
+	}
+
+	for _, repo := range append([]Wipeable{s.repo}, s.others...) {
+		err := repo.DeleteAll()
+		if err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
 	RenderNoContent(w, r)
 }
 
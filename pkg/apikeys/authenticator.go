@@ -0,0 +1,97 @@
+package apikeys
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/logger"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How long after an api key was last used we record its use
+// again, so that not every request writes to the repo
+const lastUsedEvery = time.Minute
+
+// RootPrincipal is the id of the principal that
+// authenticates with the root key
+const RootPrincipal = "root"
+
+// errInvalidKey is what we tell clients whose key is unknown,
+// revoked, or wrong, so that they cannot tell which
+var errInvalidKey = errors.New("Invalid api key")
+
+// Authenticator authenticates requests made with the api keys in
+// its repo, or with the root key, if any, which can do anything on
+// all organisations, so that the first api keys can be created
+type Authenticator struct {
+	repo Repo
+	root string
+}
+
+// NewAuthenticator returns a new authenticator for the api keys
+// in the given repo, and the given root key, if not empty
+func NewAuthenticator(repo Repo, root string) *Authenticator {
+	return &Authenticator{repo: repo, root: root}
+}
+
+// Authenticate returns the principal of the api key in the given
+// request, if any, and records when the key was last used
+func (a *Authenticator) Authenticate(r *http.Request) (*auth.Principal, int, error) {
+	key := strings.TrimSpace(r.Header.Get(Header))
+	if key == "" {
+		return nil, http.StatusOK, nil
+	}
+
+	if a.root != "" && subtle.ConstantTimeCompare([]byte(key), []byte(a.root)) == 1 {
+		return &auth.Principal{
+			Id:            RootPrincipal,
+			Method:        auth.MethodApiKey,
+			Organisations: []string{auth.AllOrganisations},
+			Permissions:   []string{auth.PermissionAdmin},
+		}, http.StatusOK, nil
+	}
+
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 {
+		return nil, http.StatusUnauthorized, errInvalidKey
+	}
+
+	k, err := Fetch(a.repo, parts[0])
+	if err != nil {
+		if a.repo.IsNotFound(err) {
+			return nil, http.StatusUnauthorized, errInvalidKey
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !k.IsActive() || !k.matches(parts[1]) {
+		return nil, http.StatusUnauthorized, errInvalidKey
+	}
+
+	a.touch(k)
+	return k.Principal(), http.StatusOK, nil
+}
+
+// touch records the given api key was just used, unless we
+// did it recently. Requests do not fail if we cannot, eg. because
+// the key is being rotated at the same time
+func (a *Authenticator) touch(k *ApiKey) {
+	now := time.Now().UTC()
+	if k.Attributes.LastUsedOn != nil && now.Sub(*k.Attributes.LastUsedOn) < lastUsedEvery {
+		return
+	}
+
+	k.Attributes.LastUsedOn = &now
+	repoItem, err := k.ToRepoItem()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	if _, err := a.repo.Update(repoItem); err != nil && !a.repo.IsConflict(err) {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,254 @@
+package apikeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// Header is the header clients send their api key in
+const Header = "X-Api-Key"
+
+// The states of an api key
+const (
+	StatusActive  = "active"
+	StatusRevoked = "revoked"
+)
+
+// KeyAttributes captures the permissions an api key grants, and
+// when it was created, rotated, revoked and last used
+type KeyAttributes struct {
+	Name        string   `json:"name,omitempty"`
+	Permissions []string `json:"permissions"`
+
+	// The key, as clients send it. This is only given back
+	// when the key is created or rotated, and never stored
+	Key string `json:"key,omitempty"`
+
+	// The hash of the secret part of the key. This is
+	// stored, but never given back
+	Hash string `json:"hash,omitempty"`
+
+	// A PEM encoded public key. Keys with a public key have no
+	// secret, and authenticate requests signed with its private key
+	PublicKey string `json:"public_key,omitempty"`
+
+	// These are managed by the server
+	Status     string     `json:"status"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedOn  time.Time  `json:"created_on"`
+	RotatedOn  *time.Time `json:"rotated_on,omitempty"`
+	RevokedOn  *time.Time `json:"revoked_on,omitempty"`
+	LastUsedOn *time.Time `json:"last_used_on,omitempty"`
+}
+
+// ApiKey a key clients authenticate with, on behalf of
+// the organisation it belongs to
+type ApiKey struct {
+	Id           string        `json:"id"`
+	Type         string        `json:"type"`
+	Version      int           `json:"version"`
+	Organisation string        `json:"organisation_id"`
+	Attributes   KeyAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the api key
+func (k *ApiKey) Validate() error {
+	if len(strings.TrimSpace(k.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	// Keys are sent as the id and the secret,
+	// separated by a dot
+	if strings.Contains(k.Id, ".") {
+		return fmt.Errorf("Invalid id: %s", k.Id)
+	}
+
+	if k.Type != "ApiKey" {
+		return fmt.Errorf("Invalid type: %s", k.Type)
+	}
+
+	if len(strings.TrimSpace(k.Organisation)) == 0 {
+		return errors.New("Organisation is empty")
+	}
+
+	if k.IsSigning() {
+		if _, err := k.publicKey(); err != nil {
+			return err
+		}
+	}
+
+	return auth.ValidatePermissions(k.Attributes.Permissions)
+}
+
+// IsActive returns true if the key was not revoked
+func (k *ApiKey) IsActive() bool {
+	return k.Attributes.Status == StatusActive
+}
+
+// IsSigning returns true if the key authenticates signed
+// requests, with a public key, rather than with a secret
+func (k *ApiKey) IsSigning() bool {
+	return k.Attributes.PublicKey != ""
+}
+
+// publicKey parses the public key requests signed with the
+// key are verified with. RSA and ECDSA keys are supported
+func (k *ApiKey) publicKey() (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(k.Attributes.PublicKey))
+	if block == nil {
+		return nil, errors.New("Invalid public key: not PEM encoded")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid public key")
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	}
+	return nil, errors.New("Invalid public key: only RSA and ECDSA keys are supported")
+}
+
+// newSecret gives the api key a new random secret. Only its hash
+// is kept. The key clients send is given back once, until saved
+func (k *ApiKey) newSecret() error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return errors.Wrap(err, "Unable to generate api key secret")
+	}
+
+	secret := hex.EncodeToString(b)
+	k.Attributes.Key = fmt.Sprintf("%s.%s", k.Id, secret)
+	k.Attributes.Hash = hash(secret)
+	return nil
+}
+
+// matches returns true if the given secret
+// is the secret of the api key
+func (k *ApiKey) matches(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(k.Attributes.Hash)) == 1
+}
+
+// Principal returns who requests made with the api key are made by
+func (k *ApiKey) Principal() *auth.Principal {
+	method := auth.MethodApiKey
+	if k.IsSigning() {
+		method = auth.MethodSignature
+	}
+
+	return &auth.Principal{
+		Id:            k.Id,
+		Method:        method,
+		Organisations: []string{k.Organisation},
+		Permissions:   k.Attributes.Permissions,
+	}
+}
+
+// hash returns the hash api key secrets are stored as. Secrets are
+// long and random, so a fast hash is enough
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Converts an api key into something that can be saved
+// into the database. The key itself is never saved
+func (k *ApiKey) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           k.Id,
+		Version:      k.Version,
+		Organisation: k.Organisation,
+	}
+
+	attrs := k.Attributes
+	attrs.Key = ""
+
+	bytes, err := json.Marshal(attrs)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize api key attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into an api key
+func NewApiKeyFromRepoItem(item *RepoItem) (*ApiKey, error) {
+	k := &ApiKey{
+		Type:         "ApiKey",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+	}
+
+	var attrs KeyAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return k, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	k.Attributes = attrs
+
+	return k, nil
+}
+
+// NewApiKeysFromRepoItems converts the given slice of
+// repo items to a list of api keys
+func NewApiKeysFromRepoItems(items []*RepoItem) ([]*ApiKey, error) {
+	keys := []*ApiKey{}
+	for _, i := range items {
+		k, err := NewApiKeyFromRepoItem(i)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// Fetch looks up the api key with the given id in the given repo
+func Fetch(repo Repo, id string) (*ApiKey, error) {
+	found, err := repo.Fetch(&RepoItem{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return NewApiKeyFromRepoItem(found)
+}
+
+// ApiKeyRequest represents a http request that contains
+// an api key in its field 'data'
+type ApiKeyRequest struct {
+	ApiKey *ApiKey `json:"data"`
+}
+
+// ApiKeyResponse represents a http response that contains
+// an api key in its field 'data' and set of links
+type ApiKeyResponse struct {
+	Data  *ApiKey `json:"data"`
+	Links Links   `json:"links"`
+}
+
+// ApiKeysResponse represents a http response that contains
+// a list of api keys in its field 'data' and a set of links
+type ApiKeysResponse struct {
+	Data  []*ApiKey `json:"data"`
+	Links Links     `json:"links"`
+}
@@ -0,0 +1,320 @@
+// apikeys contains the http routes that manage the api keys clients
+// authenticate with, and the authenticators that check them. Keys
+// belong to an organisation, and grant read, write or admin permissions
+// on its data. Only the hash of their secret is stored. Keys can also
+// have a public key instead, to verify signed requests with
+package apikeys
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	apiKeysLinkPattern string
+	apiKeyLinkPattern  string
+)
+
+func init() {
+	apiKeysLinkPattern = "/api-keys?%sfrom=%v&to=%v"
+	apiKeyLinkPattern = "/api-keys/%v"
+}
+
+// ApiKeysService represents an api keys service
+// it defines the routes and the repos to operate
+// with. It inherits fields and functions from util.HttpService
+type ApiKeysService struct {
+	HttpService
+	repo          Repo
+	organisations Repo
+	maxResults    int
+}
+
+// New creates a new ApiKeysService with the given repos, base url
+// and maxResults information. Api keys must belong to one of the
+// organisations in the organisations repo
+func New(repo Repo, organisations Repo, baseUrl string, maxResults int) *ApiKeysService {
+	return &ApiKeysService{
+		HttpService: HttpService{
+			BaseUrl: baseUrl,
+		},
+		repo:          repo,
+		organisations: organisations,
+		maxResults:    maxResults,
+	}
+}
+
+// Routes returns a router with all routes supported by this
+// service. Managing api keys takes the admin permission
+func (s *ApiKeysService) Routes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(auth.Require(auth.PermissionAdmin))
+	router.Get("/", s.List)
+	router.Post("/", s.Create)
+	router.Get("/{id}", s.Fetch)
+	router.Post("/{id}/rotate", s.Rotate)
+	router.Post("/{id}/revoke", s.Revoke)
+	return router
+}
+
+// List returns a list of api keys, using the same from and to query
+// params semantics as payments. The organisation_id query param
+// narrows the list down to the keys of a single organisation
+func (s *ApiKeysService) List(w http.ResponseWriter, r *http.Request) {
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	organisation, err := auth.FromRequest(r).Scope(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	repoItems, err := s.repo.Find(RepoFilter{Organisation: organisation}, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	keys, err := NewApiKeysFromRepoItems(repoItems)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, k := range keys {
+		k.Attributes.Hash = ""
+	}
+
+	filter := ""
+	if organisation != "" {
+		filter = fmt.Sprintf("organisation_id=%s&", url.QueryEscape(organisation))
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(apiKeysLinkPattern, filter, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(apiKeysLinkPattern, filter, to, to+limit))
+
+	if from >= limit {
+		links["prev"] = s.UrlFor(fmt.Sprintf(apiKeysLinkPattern, filter, from-limit, from))
+	}
+
+	RenderJSON(w, r, http.StatusOK, &ApiKeysResponse{
+		Data:  keys,
+		Links: links,
+	})
+}
+
+// Fetch an api key by id. Its secret is never given back
+func (s *ApiKeysService) Fetch(w http.ResponseWriter, r *http.Request) {
+	k, status, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, k)
+}
+
+// Create a new api key for an organisation. The key is given
+// back once, and cannot be found out afterwards
+func (s *ApiKeysService) Create(w http.ResponseWriter, r *http.Request) {
+	k, err := decodeApiKey(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if p := auth.FromRequest(r); p != nil && !p.CanAccess(k.Organisation) {
+		HandleHttpError(w, r, http.StatusForbidden, fmt.Errorf("Principal %s cannot create api keys for organisation %s", p.Id, k.Organisation))
+		return
+	}
+
+	_, status, err := organisations.Lookup(s.organisations, k.Organisation)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	if k.Id == "" {
+		k.Id = NewId()
+	}
+
+	err = k.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	k.Attributes = KeyAttributes{
+		Name:        k.Attributes.Name,
+		Permissions: k.Attributes.Permissions,
+		PublicKey:   k.Attributes.PublicKey,
+		Status:      StatusActive,
+		CreatedBy:   auth.UserFromRequest(r),
+		CreatedOn:   time.Now().UTC(),
+	}
+
+	if !k.IsSigning() {
+		if err := k.newSecret(); err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	repoItem, err := k.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdItem, err := s.repo.Create(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	k.Version = createdItem.Version
+	s.render(w, r, http.StatusCreated, k)
+}
+
+// Rotate gives an active api key a new secret. The previous
+// secret stops working straight away. Keys with a public key have
+// no secret, and are replaced by registering a new public key instead
+func (s *ApiKeysService) Rotate(w http.ResponseWriter, r *http.Request) {
+	s.change(w, r, func(k *ApiKey, now time.Time) (int, error) {
+		if k.IsSigning() {
+			return http.StatusConflict, fmt.Errorf("Api key %s has no secret to rotate", k.Id)
+		}
+
+		k.Attributes.RotatedOn = &now
+		return http.StatusInternalServerError, k.newSecret()
+	})
+}
+
+// Revoke an active api key, for good
+func (s *ApiKeysService) Revoke(w http.ResponseWriter, r *http.Request) {
+	s.change(w, r, func(k *ApiKey, now time.Time) (int, error) {
+		k.Attributes.Status = StatusRevoked
+		k.Attributes.RevokedOn = &now
+		return http.StatusOK, nil
+	})
+}
+
+// change applies the given change to the active api key in the
+// request path, and saves it. Since the key might be used at the
+// same time, a 409 is returned if it changes in the meantime. Changes
+// return the http status code that describes their error, if any
+func (s *ApiKeysService) change(w http.ResponseWriter, r *http.Request, apply func(*ApiKey, time.Time) (int, error)) {
+	k, status, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	if !k.IsActive() {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Api key %s is %s", k.Id, k.Attributes.Status))
+		return
+	}
+
+	if status, err := apply(k, time.Now().UTC()); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	repoItem, err := k.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	updatedItem, err := s.repo.Update(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	k.Version = updatedItem.Version
+	s.render(w, r, http.StatusOK, k)
+}
+
+// fetch looks up an api key by id. Keys of organisations the
+// principal of the request cannot access are not found. Returns
+// the http status code to respond with on error
+func (s *ApiKeysService) fetch(r *http.Request, id string) (*ApiKey, int, error) {
+	k, err := Fetch(s.repo, id)
+	if err != nil {
+		if s.repo.IsNotFound(err) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if p := auth.FromRequest(r); p != nil && !p.CanAccess(k.Organisation) {
+		return nil, http.StatusNotFound, fmt.Errorf("Api key %s not found for principal %s", id, p.Id)
+	}
+
+	return k, http.StatusOK, nil
+}
+
+// page reads the from and to query params, and returns
+// the limit to apply, capped to the maximum number of results
+func (s *ApiKeysService) page(r *http.Request) (int, int, int, error) {
+	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
+	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
+
+	limit := to - from
+	if limit <= 0 {
+		return from, to, limit, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to)
+	}
+
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	return from, to, limit, nil
+}
+
+// render sends back the given api key, along with
+// its links. The hash of its secret is never sent back
+func (s *ApiKeysService) render(w http.ResponseWriter, r *http.Request, status int, k *ApiKey) {
+	k.Attributes.Hash = ""
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(apiKeyLinkPattern, k.Id))
+
+	RenderJSON(w, r, status, &ApiKeyResponse{
+		Data:  k,
+		Links: links,
+	})
+}
+
+// decodeApiKey is a convenience function that attempts to
+// decode an api key from the HTTP request body
+func decodeApiKey(r *http.Request) (*ApiKey, error) {
+	decoder := json.NewDecoder(r.Body)
+	var kr ApiKeyRequest
+	err := decoder.Decode(&kr)
+	if err == nil && kr.ApiKey == nil {
+		err = fmt.Errorf("No api key data")
+	}
+	return kr.ApiKey, err
+}
@@ -0,0 +1,248 @@
+package apikeys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The signature algorithms we verify requests with
+const (
+	AlgorithmRSA   = "rsa-sha256"
+	AlgorithmECDSA = "ecdsa-sha256"
+)
+
+// The headers, and pseudo headers, every signature must cover. The
+// digest header must also be covered, when requests have a body
+const (
+	RequestTarget = "(request-target)"
+	DigestHeader  = "Digest"
+)
+
+var signedHeaders = []string{RequestTarget, "date", "host"}
+
+// errInvalidSignature is what we tell clients whose signature is made
+// with an unknown, revoked, or wrong key, so that they cannot tell which
+var errInvalidSignature = errors.New("Invalid signature")
+
+// Signature is a parsed http message signature, as per
+// draft-cavage-http-signatures
+type Signature struct {
+	KeyId     string
+	Algorithm string
+	Headers   []string
+	Signature []byte
+}
+
+// SignatureAuthenticator authenticates requests signed with the
+// private key of one of the api keys in its repo. Signatures cover the
+// method and path, date, host and digest of the body of requests. Requests
+// dated further apart from now than the given clock skew are rejected,
+// so that signed requests cannot be replayed later on
+type SignatureAuthenticator struct {
+	repo Repo
+	skew time.Duration
+}
+
+// NewSignatureAuthenticator returns a new authenticator for the signed
+// requests made with the api keys in the given repo
+func NewSignatureAuthenticator(repo Repo, skew time.Duration) *SignatureAuthenticator {
+	return &SignatureAuthenticator{repo: repo, skew: skew}
+}
+
+// Authenticate returns the principal of the api key the given
+// request is signed with, if any. Signatures are sent either in the
+// Signature header, or in the Authorization header, with the
+// Signature scheme
+func (a *SignatureAuthenticator) Authenticate(r *http.Request) (*auth.Principal, int, error) {
+	header := r.Header.Get("Signature")
+	if authorization := r.Header.Get("Authorization"); header == "" && len(authorization) > 10 && strings.EqualFold(authorization[:10], "Signature ") {
+		header = authorization[10:]
+	}
+
+	if header == "" {
+		return nil, http.StatusOK, nil
+	}
+
+	s, err := ParseSignature(header)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	if err := a.check(r, s); err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	k, err := Fetch(a.repo, s.KeyId)
+	if err != nil {
+		if a.repo.IsNotFound(err) {
+			return nil, http.StatusUnauthorized, errInvalidSignature
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !k.IsActive() || !k.IsSigning() {
+		return nil, http.StatusUnauthorized, errInvalidSignature
+	}
+
+	key, err := k.publicKey()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !s.verify(key, SigningString(r, s.Headers)) {
+		return nil, http.StatusUnauthorized, errInvalidSignature
+	}
+
+	return k.Principal(), http.StatusOK, nil
+}
+
+// check makes sure the signature covers all the headers it
+// has to, that the request is recent, and that the digest of
+// its body, if any, is right
+func (a *SignatureAuthenticator) check(r *http.Request, s *Signature) error {
+	required := append([]string{}, signedHeaders...)
+	if r.ContentLength != 0 {
+		required = append(required, strings.ToLower(DigestHeader))
+	}
+
+	for _, h := range required {
+		if !covers(s.Headers, h) {
+			return fmt.Errorf("Signature does not cover %s", h)
+		}
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return errors.New("Invalid date")
+	}
+
+	if skew := time.Since(date); skew > a.skew || skew < -a.skew {
+		return errors.New("Request is too old, or too far in the future")
+	}
+
+	if covers(s.Headers, strings.ToLower(DigestHeader)) {
+		return checkDigest(r)
+	}
+
+	return nil
+}
+
+// checkDigest compares the SHA-256 digest in the Digest header of the
+// given request with the digest of its body. The body is read, and
+// then put back, so that handlers can read it again
+func checkDigest(r *http.Request) error {
+	body := []byte{}
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := Digest(body)
+	for _, d := range strings.Split(r.Header.Get(DigestHeader), ",") {
+		if strings.TrimSpace(d) == expected {
+			return nil
+		}
+	}
+
+	return errors.New("Digest does not match the body")
+}
+
+// Digest returns the value of the Digest header for the given body
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf("SHA-256=%s", base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// SigningString returns what is signed, for the given headers
+// of the given request: a line per header, with its name, in lower
+// case, and its values
+func SigningString(r *http.Request, headers []string) string {
+	lines := []string{}
+	for _, h := range headers {
+		var value string
+		switch h {
+		case RequestTarget:
+			value = fmt.Sprintf("%s %s", strings.ToLower(r.Method), r.URL.RequestURI())
+		case "host":
+			value = r.Host
+		default:
+			value = strings.Join(r.Header[http.CanonicalHeaderKey(h)], ", ")
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", h, value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseSignature parses the given signature header, made of comma
+// separated key="value" parameters. Headers default to the date
+// header only, as per the draft, which is not enough for us anyway
+func ParseSignature(header string) (*Signature, error) {
+	params := map[string]string{}
+	for _, param := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("Malformed signature")
+		}
+		params[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil || len(signature) == 0 || params["keyId"] == "" {
+		return nil, errors.New("Malformed signature")
+	}
+
+	headers := []string{"date"}
+	if params["headers"] != "" {
+		headers = strings.Fields(strings.ToLower(params["headers"]))
+	}
+
+	return &Signature{
+		KeyId:     params["keyId"],
+		Algorithm: params["algorithm"],
+		Headers:   headers,
+		Signature: signature,
+	}, nil
+}
+
+// verify checks the signature of the given signing string with the
+// given key. Signatures that do not tell their algorithm are made with
+// the algorithm of the key
+func (s *Signature) verify(key crypto.PublicKey, signing string) bool {
+	digest := sha256.Sum256([]byte(signing))
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return (s.Algorithm == "" || s.Algorithm == AlgorithmRSA) &&
+			rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], s.Signature) == nil
+	case *ecdsa.PublicKey:
+		return (s.Algorithm == "" || s.Algorithm == AlgorithmECDSA) &&
+			ecdsa.VerifyASN1(k, digest[:], s.Signature)
+	}
+	return false
+}
+
+// covers returns true if the given header is in the given list
+func covers(headers []string, header string) bool {
+	for _, h := range headers {
+		if h == header {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/logger"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The signing algorithms we accept tokens signed with
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// How often, at most, a token signed with a key we do not
+// know makes us read the key set again, before it expires
+const jwksRefreshEvery = 10 * time.Second
+
+// jwk is a public key of a key set, along with
+// its id and the algorithm it is used with, if given
+type jwk struct {
+	Kid string
+	Alg string
+	Key crypto.PublicKey
+}
+
+// JWKS is a set of public keys tokens are signed with, read from a
+// file or a url. Keys are cached for the given ttl, and read again
+// sooner if a token is signed with a key we do not know, eg. after
+// the issuer rotated its keys. Only one request at a time reads the
+// key set again, while the rest go on with the keys we already have
+type JWKS struct {
+	source     string
+	ttl        time.Duration
+	client     *http.Client
+	mutex      sync.Mutex
+	keys       []*jwk
+	loadedOn   time.Time
+	refreshing bool
+}
+
+// NewJWKS reads the key set at the given path or url, which is
+// read again once older than the given ttl. Urls are read with
+// the given timeout
+func NewJWKS(source string, ttl time.Duration, timeout time.Duration) (*JWKS, error) {
+	j := &JWKS{
+		source: source,
+		ttl:    ttl,
+		client: &http.Client{Timeout: timeout},
+	}
+
+	keys, err := j.load()
+	j.keys = keys
+	j.loadedOn = time.Now()
+	return j, err
+}
+
+// Key returns the public key with the given id, to verify a token
+// signed with the given algorithm. Tokens without a key id can only
+// be verified if there is a single key for their algorithm. If the key
+// set cannot be read again, we keep using the keys we already have.
+// The key set is read without holding the lock, so that a slow issuer
+// does not hold up the requests that can be verified with our keys
+func (j *JWKS) Key(kid string, alg string) (crypto.PublicKey, error) {
+	j.mutex.Lock()
+	key, found := j.find(kid, alg)
+	age := time.Since(j.loadedOn)
+	refresh := !j.refreshing && (age > j.ttl || (!found && age > jwksRefreshEvery))
+	if refresh {
+		j.refreshing = true
+	}
+	j.mutex.Unlock()
+
+	if refresh {
+		keys, err := j.load()
+
+		j.mutex.Lock()
+		j.refreshing = false
+		j.loadedOn = time.Now()
+		if err != nil {
+			logger.Error(err)
+		} else {
+			j.keys = keys
+		}
+		key, found = j.find(kid, alg)
+		j.mutex.Unlock()
+	}
+
+	if !found {
+		return nil, fmt.Errorf("Unknown signing key %s for %s", kid, alg)
+	}
+
+	return key, nil
+}
+
+// find looks up the key with the given id for the given algorithm,
+// amongst the ones we have. The caller holds the lock
+func (j *JWKS) find(kid string, alg string) (crypto.PublicKey, bool) {
+	var found *jwk
+	for _, k := range j.keys {
+		if (kid == "" || k.Kid == kid) && k.supports(alg) {
+			if found != nil {
+				return nil, false
+			}
+			found = k
+		}
+	}
+
+	if found == nil {
+		return nil, false
+	}
+
+	return found.Key, true
+}
+
+// supports returns true if the key can verify
+// tokens signed with the given algorithm
+func (k *jwk) supports(alg string) bool {
+	if k.Alg != "" && k.Alg != alg {
+		return false
+	}
+
+	switch key := k.Key.(type) {
+	case *rsa.PublicKey:
+		return alg == AlgRS256
+	case *ecdsa.PublicKey:
+		return alg == AlgES256 && key.Curve == elliptic.P256()
+	}
+	return false
+}
+
+// load reads the key set again, from its file or url, and returns
+// its keys, without replacing the ones we have. Keys of types or
+// curves we do not support are ignored
+func (j *JWKS) load() ([]*jwk, error) {
+	data, err := j.read()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not read key set %s", j.source)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.Wrapf(err, "Could not parse key set %s", j.source)
+	}
+
+	keys := []*jwk{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		switch {
+		case k.Kty == "RSA":
+			n, e := decodeInt(k.N), decodeInt(k.E)
+			if n == nil || e == nil || !e.IsInt64() {
+				return nil, fmt.Errorf("Invalid RSA key %s in key set %s", k.Kid, j.source)
+			}
+			key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, y := decodeInt(k.X), decodeInt(k.Y)
+			if x == nil || y == nil || !elliptic.P256().IsOnCurve(x, y) {
+				return nil, fmt.Errorf("Invalid EC key %s in key set %s", k.Kid, j.source)
+			}
+			key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		default:
+			continue
+		}
+
+		keys = append(keys, &jwk{Kid: k.Kid, Alg: k.Alg, Key: key})
+	}
+
+	return keys, nil
+}
+
+// read returns the contents of the key set, from its url, if
+// it looks like one, or from its file otherwise
+func (j *JWKS) read() ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return ioutil.ReadFile(j.source)
+	}
+
+	res, err := j.client.Get(j.source)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status %d", res.StatusCode)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+// decodeInt decodes a base64url encoded, big endian
+// integer, or returns nil if it is not one
+func decodeInt(s string) *big.Int {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return new(big.Int).SetBytes(b)
+}
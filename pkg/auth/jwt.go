@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How far apart we accept the clocks of token issuers and ours to
+// be, when checking whether tokens have expired, or are valid yet
+const jwtLeeway = time.Minute
+
+// JWTAuthenticator authenticates requests made with bearer tokens
+// signed by a trusted issuer, for our audience. The subject of a token
+// is the user requests are made on behalf of. Tokens tell which
+// organisations the subject can access, and their roles, which are the
+// permissions they were granted, in the given claims
+type JWTAuthenticator struct {
+	keys               *JWKS
+	issuer             string
+	audience           string
+	organisationsClaim string
+	rolesClaim         string
+}
+
+// NewJWTAuthenticator returns a new authenticator for the tokens
+// signed with the keys in the given key set, by the given issuer,
+// for the given audience
+func NewJWTAuthenticator(keys *JWKS, issuer string, audience string, organisationsClaim string, rolesClaim string) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		keys:               keys,
+		issuer:             issuer,
+		audience:           audience,
+		organisationsClaim: organisationsClaim,
+		rolesClaim:         rolesClaim,
+	}
+}
+
+// Authenticate returns the principal of the bearer token
+// in the given request, if any
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, int, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return nil, http.StatusOK, nil
+	}
+
+	claims, err := a.verify(strings.TrimSpace(header[7:]))
+	if err != nil {
+		return nil, http.StatusUnauthorized, fmt.Errorf("Invalid bearer token: %v", err)
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, http.StatusUnauthorized, errors.New("Invalid bearer token: no subject")
+	}
+
+	organisations := claimValues(claims[a.organisationsClaim])
+	if len(organisations) == 0 {
+		return nil, http.StatusUnauthorized, fmt.Errorf("Invalid bearer token: no %s", a.organisationsClaim)
+	}
+
+	permissions := []string{}
+	for _, role := range claimValues(claims[a.rolesClaim]) {
+		if rank(role) > 0 {
+			permissions = append(permissions, role)
+		}
+	}
+
+	return &Principal{
+		Id:            subject,
+		User:          subject,
+		Method:        MethodJWT,
+		Organisations: organisations,
+		Permissions:   permissions,
+	}, http.StatusOK, nil
+}
+
+// verify checks the signature of the given token, who issued it,
+// who for, and that it is valid now. Returns its claims
+func (a *JWTAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	key, err := a.keys.Key(header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+
+	if !verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature) {
+		return nil, errors.New("bad signature")
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); iss != a.issuer {
+		return nil, fmt.Errorf("unexpected issuer %s", iss)
+	}
+
+	if !contains(claimValues(claims["aud"]), a.audience) {
+		return nil, fmt.Errorf("not issued for %s", a.audience)
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(json.Number)
+	if !ok {
+		return nil, errors.New("no expiry")
+	}
+
+	if expiresOn, err := exp.Int64(); err != nil || now.After(time.Unix(expiresOn, 0).Add(jwtLeeway)) {
+		return nil, errors.New("expired")
+	}
+
+	if nbf, ok := claims["nbf"].(json.Number); ok {
+		if validFrom, err := nbf.Int64(); err != nil || now.Before(time.Unix(validFrom, 0).Add(-jwtLeeway)) {
+			return nil, errors.New("not valid yet")
+		}
+	}
+
+	return claims, nil
+}
+
+// verifySignature checks the given signature of the given signing
+// input, using the given key, as per the given algorithm
+func verifySignature(alg string, key crypto.PublicKey, input string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(input))
+
+	switch alg {
+	case AlgRS256:
+		rsaKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature) == nil
+	case AlgES256:
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(ecKey, digest[:], r, s)
+	}
+	return false
+}
+
+// decodeSegment decodes the given base64url
+// encoded json segment of a token into v
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("malformed")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return errors.New("malformed")
+	}
+
+	return nil
+}
+
+// claimValues returns the given claim as a list of strings. Claims can
+// be a single string, a space separated list, or an array of strings
+func claimValues(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return strings.Fields(c)
+	case []interface{}:
+		values := []string{}
+		for _, v := range c {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// contains returns true if the given value is in the given list
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+)
+
+// Authenticate returns a middleware that finds out who requests are
+// made by, using the first of the given authenticators that understands
+// their credentials. Requests with invalid credentials are rejected,
+// usually with a 401, and so are anonymous requests, if authentication
+// is required
+func Authenticate(required bool, authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, a := range authenticators {
+				p, status, err := a.Authenticate(r)
+				if err != nil {
+					util.HandleHttpError(w, r, status, err)
+					return
+				}
+
+				if p != nil {
+					next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, p)))
+					return
+				}
+			}
+
+			if required {
+				util.HandleHttpError(w, r, http.StatusUnauthorized, errors.New("Request is not authenticated"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Authorize is a middleware that rejects requests with a 403 unless
+// their principal can read, for safe methods, or write, otherwise.
+// Anonymous requests are let through, since they are only allowed
+// when authentication is not required
+func Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		permission := PermissionWrite
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			permission = PermissionRead
+		}
+
+		Require(permission)(next).ServeHTTP(w, r)
+	})
+}
+
+// Require returns a middleware that rejects requests with a 403
+// unless their principal was granted the given permission. Anonymous
+// requests are let through, as in Authorize
+func Require(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p := FromRequest(r); p != nil && !p.Can(permission) {
+				util.HandleHttpError(w, r, http.StatusForbidden, fmt.Errorf("Principal %s cannot %s", p.Id, permission))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
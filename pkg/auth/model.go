@@ -0,0 +1,165 @@
+// auth authenticates the principals requests are made by, and
+// authorises what they can do, regardless of how they authenticate
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+)
+
+// The permissions principals are granted. Each one
+// implies the ones before it
+const (
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+	PermissionAdmin = "admin"
+)
+
+// The ways principals authenticate
+const (
+	MethodApiKey    = "api_key"
+	MethodJWT       = "jwt"
+	MethodSignature = "signature"
+)
+
+// AllOrganisations is the organisation scope of
+// principals that can access every organisation
+const AllOrganisations = "*"
+
+// Principal who a request is made by: how they authenticated, the
+// organisations they can access, and what they are allowed to do.
+// Principals that authenticate as a user, rather than as a client
+// acting on behalf of its users, know who that user is
+type Principal struct {
+	Id            string
+	User          string
+	Method        string
+	Organisations []string
+	Permissions   []string
+}
+
+// Can returns true if the principal was granted the
+// given permission, or one that implies it
+func (p *Principal) Can(permission string) bool {
+	for _, granted := range p.Permissions {
+		if rank(granted) >= rank(permission) && rank(permission) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess returns true if the principal can
+// access data of the given organisation
+func (p *Principal) CanAccess(organisation string) bool {
+	for _, o := range p.Organisations {
+		if o == AllOrganisations || o == organisation {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSee returns true if data of the given organisation is visible
+// to the principal. Anonymous requests, which are only let through
+// when authentication is not required, see everything
+func (p *Principal) CanSee(organisation string) bool {
+	return p == nil || p.CanAccess(organisation)
+}
+
+// Scope returns the organisation to narrow a list of data down to,
+// given the one requested, if any. Principals must be able to access
+// the requested organisation. Principals that can only access a single
+// organisation see data of that organisation only. The rest have to
+// request one. Anonymous requests see everything they request
+func (p *Principal) Scope(requested string) (string, error) {
+	if p == nil || p.CanAccess(AllOrganisations) {
+		return requested, nil
+	}
+
+	if requested != "" {
+		if !p.CanAccess(requested) {
+			return requested, fmt.Errorf("Principal %s cannot access organisation %s", p.Id, requested)
+		}
+		return requested, nil
+	}
+
+	if len(p.Organisations) == 1 {
+		return p.Organisations[0], nil
+	}
+
+	return requested, fmt.Errorf("Principal %s has to choose an organisation", p.Id)
+}
+
+// ValidatePermissions checks the given permissions
+// are not empty, and known to us
+func ValidatePermissions(permissions []string) error {
+	if len(permissions) == 0 {
+		return errors.New("Permissions are empty")
+	}
+
+	for _, p := range permissions {
+		if rank(p) == 0 {
+			return fmt.Errorf("Invalid permission: %s", p)
+		}
+	}
+
+	return nil
+}
+
+// rank orders permissions, so that higher permissions imply
+// lower ones. Unknown permissions rank lowest
+func rank(permission string) int {
+	switch permission {
+	case PermissionRead:
+		return 1
+	case PermissionWrite:
+		return 2
+	case PermissionAdmin:
+		return 3
+	}
+	return 0
+}
+
+// Authenticator is anything that can tell who a request is made by
+type Authenticator interface {
+	// Authenticate returns the principal the given request is
+	// made by, or nil if the request carries no credentials this
+	// authenticator understands. Invalid credentials are an error.
+	// Returns the http status code that describes the error, if any
+	Authenticate(r *http.Request) (*Principal, int, error)
+}
+
+// contextKey is the key principals are kept under,
+// in the context of the requests they make
+type contextKey struct{}
+
+// FromRequest returns the principal the given request
+// is made by, or nil if the request is anonymous
+func FromRequest(r *http.Request) *Principal {
+	p, _ := r.Context().Value(contextKey{}).(*Principal)
+	return p
+}
+
+// UserFromRequest returns the user the given request is made on
+// behalf of: the user its principal authenticated as, if any, or the
+// one the client tells in the util.UserHeader header otherwise
+func UserFromRequest(r *http.Request) string {
+	if p := FromRequest(r); p != nil && p.User != "" {
+		return p.User
+	}
+	return util.UserFromRequest(r)
+}
+
+// AuthenticatedUser returns the user the principal of the given
+// request authenticated as, if any. Unlike UserFromRequest, the
+// util.UserHeader header is never trusted, so that users cannot tell
+// they are someone else where it matters (eg. approvals)
+func AuthenticatedUser(r *http.Request) string {
+	if p := FromRequest(r); p != nil {
+		return p.User
+	}
+	return ""
+}
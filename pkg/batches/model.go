@@ -0,0 +1,267 @@
+package batches
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	"github.com/pedro-gutierrez/form3/pkg/payments"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// The formats of the files batches are uploaded as
+const (
+	FormatCSV     = "csv"
+	FormatPain001 = "pain.001"
+)
+
+// The states a batch goes through. Uploaded batches are parsed and
+// validated in the background. Batches with no errors can be approved,
+// and their payments are then created in the background too
+const (
+	StatusUploaded  = "uploaded"
+	StatusParsing   = "parsing"
+	StatusValidated = "validated"
+	StatusInvalid   = "invalid"
+	StatusApproving = "approving"
+	StatusApproved  = "approved"
+)
+
+// The maximum number of line errors kept in a batch. The
+// count of errors goes on beyond that
+const maxErrors = 1000
+
+// LineError an error found on a line of the file of a batch. For
+// pain.001 files, this is the line the transaction starts at. Errors
+// about the file as a whole are on line 0
+type LineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// Progress tells how far the batch is in being parsed, or approved,
+// as the number of payments processed out of the total found in the
+// file. The total is only an estimate until the batch is parsed
+type Progress struct {
+	Total     int `json:"total"`
+	Processed int `json:"processed"`
+}
+
+// BatchAttributes captures the file of a batch, the defaults applied
+// to its payments, how far it is in being processed, and the payments
+// created once approved
+type BatchAttributes struct {
+	// Either csv or pain.001, and the content
+	// of the file, as text
+	Format   string `json:"format"`
+	FileName string `json:"file_name,omitempty"`
+	Content  string `json:"content,omitempty"`
+
+	// The account payments are debited from, and the
+	// scheme they use, unless lines say otherwise
+	DebtorAccount string `json:"debtor_account_id,omitempty"`
+	Scheme        string `json:"scheme,omitempty"`
+
+	// These are managed by the server
+	Status       string       `json:"status"`
+	Progress     Progress     `json:"progress"`
+	PaymentCount int          `json:"payment_count"`
+	TotalAmount  string       `json:"total_amount,omitempty"`
+	Errors       []*LineError `json:"errors"`
+	ErrorCount   int          `json:"error_count"`
+	Payments     []string     `json:"payment_ids"`
+	CreatedBy    string       `json:"created_by,omitempty"`
+	ApprovedBy   string       `json:"approved_by,omitempty"`
+	ApprovedOn   *time.Time   `json:"approved_on,omitempty"`
+	CreatedOn    time.Time    `json:"created_on"`
+	UpdatedOn    time.Time    `json:"updated_on"`
+}
+
+// Validate does semantic validation on the batch attributes
+func (ba *BatchAttributes) Validate() error {
+	switch ba.Format {
+	case FormatCSV, FormatPain001:
+	default:
+		return fmt.Errorf("Invalid format: %s", ba.Format)
+	}
+
+	if len(strings.TrimSpace(ba.Content)) == 0 {
+		return errors.New("Content is empty")
+	}
+
+	return nil
+}
+
+// Batch a file of payments, uploaded to be created all at once
+type Batch struct {
+	Id           string          `json:"id"`
+	Type         string          `json:"type"`
+	Version      int             `json:"version"`
+	Organisation string          `json:"organisation_id"`
+	Attributes   BatchAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the batch
+func (b *Batch) Validate() error {
+	if len(strings.TrimSpace(b.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	if b.Type != "PaymentBatch" {
+		return fmt.Errorf("Invalid type: %s", b.Type)
+	}
+
+	return b.Attributes.Validate()
+}
+
+// IsDone returns true if the batch is not waiting for the
+// background processor, either to be parsed or approved
+func (b *Batch) IsDone() bool {
+	switch b.Attributes.Status {
+	case StatusUploaded, StatusParsing, StatusApproving:
+		return false
+	}
+	return true
+}
+
+// PaymentId returns the id of the payment created from the given
+// line of the batch, so that approving the batch again, eg. after
+// a restart, never creates the same payment twice
+func (b *Batch) PaymentId(line int) string {
+	return fmt.Sprintf("%s-%d", b.Id, line)
+}
+
+// NewPayment returns the payment of the given entry of the batch,
+// with the defaults of the batch applied. Payments are created on
+// behalf of whoever uploaded the batch
+func (b *Batch) NewPayment(e *Entry) *payments.Payment {
+	attrs := e.Attributes
+	attrs.Batch = b.Id
+	attrs.CreatedBy = b.Attributes.CreatedBy
+
+	if attrs.DebtorAccount == "" {
+		attrs.DebtorAccount = b.Attributes.DebtorAccount
+	}
+
+	if attrs.Scheme == "" {
+		attrs.Scheme = b.Attributes.Scheme
+	}
+
+	return &payments.Payment{
+		Id:           b.PaymentId(e.Line),
+		Type:         "Payment",
+		Organisation: b.Organisation,
+		Attributes:   attrs,
+	}
+}
+
+// check does semantic validation on the payment of the given entry,
+// against the settings of the organisation that owns the batch
+func (b *Batch) check(e *Entry, settings organisations.Settings) error {
+	p := b.NewPayment(e)
+	p.Attributes.WithDefaults(settings)
+	if err := p.Validate(settings); err != nil {
+		return err
+	}
+
+	party := p.Attributes.BeneficiaryParty
+	if p.Attributes.Beneficiary == "" && (party == nil || party.AccountNumber == "" || party.BankId == "") {
+		return errors.New("Payment has no beneficiary id, nor beneficiary account number and bank id")
+	}
+
+	return nil
+}
+
+// addError records an error on the given line, unless
+// the batch already holds as many errors as we keep
+func (b *Batch) addError(line int, err error) {
+	b.Attributes.ErrorCount++
+	if len(b.Attributes.Errors) < maxErrors {
+		b.Attributes.Errors = append(b.Attributes.Errors, &LineError{Line: line, Message: err.Error()})
+	}
+}
+
+// Converts a batch into something that
+// can be saved into the database
+func (b *Batch) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           b.Id,
+		Version:      b.Version,
+		Organisation: b.Organisation,
+	}
+
+	bytes, err := json.Marshal(b.Attributes)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize batch attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into a batch
+func NewBatchFromRepoItem(item *RepoItem) (*Batch, error) {
+	b := &Batch{
+		Type:         "PaymentBatch",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+	}
+
+	var attrs BatchAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return b, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	b.Attributes = attrs
+
+	return b, nil
+}
+
+// NewBatchesFromRepoItems converts the given slice of
+// repo items to a list of batches
+func NewBatchesFromRepoItems(items []*RepoItem) ([]*Batch, error) {
+	batches := []*Batch{}
+	for _, i := range items {
+		b, err := NewBatchFromRepoItem(i)
+		if err != nil {
+			return batches, err
+		}
+		batches = append(batches, b)
+	}
+
+	return batches, nil
+}
+
+// Fetch looks up the batch with the given id in the given repo
+func Fetch(repo Repo, id string) (*Batch, error) {
+	found, err := repo.Fetch(&RepoItem{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return NewBatchFromRepoItem(found)
+}
+
+// BatchRequest represents a http request that contains
+// a batch in its field 'data'
+type BatchRequest struct {
+	Batch *Batch `json:"data"`
+}
+
+// BatchResponse represents a http response that contains
+// a batch in its field 'data' and set of links
+type BatchResponse struct {
+	Data  *Batch `json:"data"`
+	Links Links  `json:"links"`
+}
+
+// BatchesResponse represents a http response that contains
+// a list of batches in its field 'data' and a set of links
+type BatchesResponse struct {
+	Data  []*Batch `json:"data"`
+	Links Links    `json:"links"`
+}
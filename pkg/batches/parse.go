@@ -0,0 +1,325 @@
+package batches
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/payments"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+// Entry a payment read from the file of a batch, along with the line
+// it was found at, or the error found at that line, if any
+type Entry struct {
+	Line       int
+	Attributes payments.PaymentAttributes
+	Err        error
+}
+
+// count returns an estimate of the number of payments
+// in the given content, before it is actually parsed
+func count(format string, content string) int {
+	switch format {
+	case FormatCSV:
+		lines := 0
+		for _, l := range strings.Split(content, "\n") {
+			if strings.TrimSpace(l) != "" {
+				lines++
+			}
+		}
+		if lines > 0 {
+			lines--
+		}
+		return lines
+	case FormatPain001:
+		return strings.Count(content, "CdtTrfTxInf>") / 2
+	}
+	return 0
+}
+
+// parse reads the payments in the given content, in the given format,
+// and calls each with every one of them, in order. Errors found in the
+// content are given as entries too, so that they can be reported along
+// with the line they were found at. Parsing stops at the first error
+// returned by each
+func parse(format string, content string, each func(*Entry) error) error {
+	switch format {
+	case FormatCSV:
+		return parseCSV(content, each)
+	case FormatPain001:
+		return parsePain001(content, each)
+	}
+	return each(&Entry{Err: fmt.Errorf("Invalid format: %s", format)})
+}
+
+// The columns of csv files. Payments go either to a saved
+// beneficiary or to the account number and bank id given
+var csvColumns = []string{
+	"amount",
+	"currency",
+	"scheme",
+	"reference",
+	"processing_date",
+	"debtor_account_id",
+	"beneficiary_id",
+	"beneficiary_name",
+	"beneficiary_address",
+	"beneficiary_country",
+	"beneficiary_account_number",
+	"beneficiary_bank_id",
+}
+
+// parseCSV reads payments from a csv file with a header row. Only
+// the amount column is required. Unknown columns are rejected, so
+// that a misspelled column is not silently ignored
+func parseCSV(content string, each func(*Entry) error) error {
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return each(&Entry{Line: 1, Err: errors.Wrap(err, "Unable to read header row")})
+	}
+
+	cols := map[string]int{}
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(h))
+		if !known(name) {
+			return each(&Entry{Line: 1, Err: fmt.Errorf("Unknown column: %s", h)})
+		}
+		cols[name] = i
+	}
+
+	if _, ok := cols["amount"]; !ok {
+		return each(&Entry{Line: 1, Err: errors.New("Header row has no amount column")})
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			// The reader moves on to the next record after
+			// a parse error, so we report it and carry on
+			pe, ok := err.(*csv.ParseError)
+			if !ok {
+				return each(&Entry{Err: err})
+			}
+			if err := each(&Entry{Line: pe.Line, Err: pe.Err}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			i, ok := cols[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		e := &Entry{
+			Line: line,
+			Attributes: payments.PaymentAttributes{
+				Amount:         field("amount"),
+				Currency:       field("currency"),
+				Scheme:         field("scheme"),
+				Reference:      field("reference"),
+				ProcessingDate: field("processing_date"),
+				DebtorAccount:  field("debtor_account_id"),
+				Beneficiary:    field("beneficiary_id"),
+			},
+		}
+
+		party := &payments.Party{
+			Name:          field("beneficiary_name"),
+			Address:       field("beneficiary_address"),
+			Country:       field("beneficiary_country"),
+			AccountNumber: field("beneficiary_account_number"),
+			BankId:        field("beneficiary_bank_id"),
+		}
+		if *party != (payments.Party{}) {
+			e.Attributes.BeneficiaryParty = party
+		}
+
+		if err := each(e); err != nil {
+			return err
+		}
+	}
+}
+
+// known returns true if the given name is one of our csv columns
+func known(name string) bool {
+	for _, c := range csvColumns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePain001 reads the credit transfers of a pain.001 (ISO 20022
+// customer credit transfer initiation) file. Each transfer is reported
+// at the line its CdtTrfTxInf element starts at. The number of
+// transfers and their control sum, if given in the group header, are
+// checked once the whole file is read, and reported on line 0
+func parsePain001(content string, each func(*Entry) error) error {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+
+	var (
+		stack    []string
+		text     strings.Builder
+		e        *Entry
+		party    *payments.Party
+		txDepth  int
+		date     string
+		numTxs   string
+		ctrlSum  string
+		found    int
+		sum      int64
+		line     = 1
+		lastSeen int64
+	)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			if se, ok := err.(*xml.SyntaxError); ok {
+				return each(&Entry{Line: se.Line, Err: errors.New(se.Msg)})
+			}
+			return each(&Entry{Line: line, Err: err})
+		}
+
+		// Keep track of the line we are at
+		offset := decoder.InputOffset()
+		line += strings.Count(content[lastSeen:offset], "\n")
+		lastSeen = offset
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			text.Reset()
+
+			switch {
+			case t.Name.Local == "PmtInf":
+				date = ""
+			case t.Name.Local == "CdtTrfTxInf":
+				e = &Entry{Line: line, Attributes: payments.PaymentAttributes{ProcessingDate: date}}
+				party = &payments.Party{}
+				txDepth = len(stack)
+			case e != nil && path(stack, txDepth) == "Amt/InstdAmt":
+				for _, a := range t.Attr {
+					if a.Name.Local == "Ccy" {
+						e.Attributes.Currency = a.Value
+					}
+				}
+			}
+
+		case xml.CharData:
+			text.Write(t)
+
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			text.Reset()
+
+			if e == nil {
+				switch path(stack, len(stack)-2) {
+				case "GrpHdr/NbOfTxs":
+					numTxs = value
+				case "GrpHdr/CtrlSum":
+					ctrlSum = value
+				case "PmtInf/ReqdExctnDt":
+					if value != "" {
+						date = value
+					}
+				}
+				if path(stack, len(stack)-3) == "PmtInf/ReqdExctnDt/Dt" {
+					date = value
+				}
+			}
+
+			if e != nil {
+				switch path(stack, txDepth) {
+				case "":
+					found++
+					if *party != (payments.Party{}) {
+						e.Attributes.BeneficiaryParty = party
+					}
+					if amount, err := ParseAmount(e.Attributes.Amount); err == nil {
+						sum += amount
+					}
+					if err := each(e); err != nil {
+						return err
+					}
+					e = nil
+				case "PmtId/EndToEndId":
+					if e.Attributes.Reference == "" {
+						e.Attributes.Reference = value
+					}
+				case "Amt/InstdAmt":
+					e.Attributes.Amount = value
+				case "Cdtr/Nm":
+					party.Name = value
+				case "Cdtr/PstlAdr/Ctry":
+					party.Country = value
+				case "Cdtr/PstlAdr/AdrLine":
+					if party.Address != "" {
+						party.Address += ", "
+					}
+					party.Address += value
+				case "CdtrAcct/Id/IBAN", "CdtrAcct/Id/Othr/Id":
+					party.AccountNumber = value
+				case "CdtrAgt/FinInstnId/ClrSysMmbId/MmbId":
+					party.BankId = value
+				case "CdtrAgt/FinInstnId/BICFI", "CdtrAgt/FinInstnId/BIC":
+					if party.BankId == "" {
+						party.BankId = value
+					}
+				case "RmtInf/Ustrd":
+					e.Attributes.Reference = value
+				}
+			}
+
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if numTxs != "" && numTxs != fmt.Sprintf("%d", found) {
+		if err := each(&Entry{Err: fmt.Errorf("Group header says %s transactions, but %d were found", numTxs, found)}); err != nil {
+			return err
+		}
+	}
+
+	if ctrlSum != "" {
+		expected, err := ParseAmount(ctrlSum)
+		if err != nil || expected != sum {
+			return each(&Entry{Err: fmt.Errorf("Group header control sum %s does not match the sum of transactions %s", ctrlSum, FormatAmount(sum))})
+		}
+	}
+
+	return nil
+}
+
+// path returns the names of the elements in the given
+// stack, from the given depth onwards, joined by slashes
+func path(stack []string, depth int) string {
+	if depth < 0 {
+		depth = 0
+	}
+	if depth > len(stack) {
+		return ""
+	}
+	return strings.Join(stack[depth:], "/")
+}
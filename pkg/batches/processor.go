@@ -0,0 +1,246 @@
+package batches
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/logger"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	"github.com/pedro-gutierrez/form3/pkg/payments"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The number of batches we read at once
+const pageSize = 100
+
+// The number of payments processed between
+// updates of the progress of a batch
+const progressEvery = 100
+
+// PaymentCreator is anything that can create payments, along
+// with their events, such as the payments service. Returns the
+// http status code that describes the error, if any
+type PaymentCreator interface {
+	CreatePayment(p *payments.Payment) (*payments.Payment, int, error)
+}
+
+// Processor parses and validates uploaded batches, and creates the
+// payments of approved ones, in the background. Batches are updated
+// using their version, so that we stop if a client deletes a batch
+// in the meantime
+type Processor struct {
+	repo          Repo
+	organisations Repo
+	payments      PaymentCreator
+	interval      time.Duration
+	notify        chan struct{}
+	stop          chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewProcessor returns a new processor that checks the batches in
+// the given repo at the given interval, or as soon as notified
+func NewProcessor(repo Repo, organisations Repo, payments PaymentCreator, interval time.Duration) *Processor {
+	return &Processor{
+		repo:          repo,
+		organisations: organisations,
+		payments:      payments,
+		interval:      interval,
+		notify:        make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+	}
+}
+
+// Start processing batches in the background
+func (p *Processor) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-p.notify:
+			case <-p.stop:
+				return
+			}
+			if err := p.Run(); err != nil {
+				logger.Error(err)
+			}
+		}
+	}()
+}
+
+// Stop processing batches, and wait for the current run to finish
+func (p *Processor) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+}
+
+// Notify the processor there is work to do, so that it does not
+// wait for its next tick. Never blocks
+func (p *Processor) Notify() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes all batches waiting to be parsed or approved. A
+// batch that fails is left as it is, and retried on the next run
+func (p *Processor) Run() error {
+	for offset := 0; ; offset += pageSize {
+		repoItems, err := p.repo.List(offset, pageSize)
+		if err != nil {
+			return err
+		}
+
+		batches, err := NewBatchesFromRepoItems(repoItems)
+		if err != nil {
+			return err
+		}
+
+		for _, b := range batches {
+			if err := p.process(b); err != nil {
+				logger.Error(fmt.Errorf("Could not process batch %s: %v", b.Id, err))
+			}
+		}
+
+		if len(repoItems) < pageSize {
+			return nil
+		}
+	}
+}
+
+// process moves the given batch forward, depending on its status
+func (p *Processor) process(b *Batch) error {
+	switch b.Attributes.Status {
+	case StatusUploaded, StatusParsing:
+		return p.validate(b)
+	case StatusApproving:
+		return p.approve(b)
+	}
+	return nil
+}
+
+// validate parses the file of the given batch, and validates each
+// one of its payments against the settings of the organisation. The
+// batch is validated if no errors were found, or invalid otherwise
+func (p *Processor) validate(b *Batch) error {
+	org, _, err := organisations.Lookup(p.organisations, b.Organisation)
+	if err != nil {
+		return err
+	}
+
+	attrs := &b.Attributes
+	attrs.Status = StatusParsing
+	attrs.Progress = Progress{Total: count(attrs.Format, attrs.Content)}
+	attrs.PaymentCount = 0
+	attrs.TotalAmount = ""
+	attrs.Errors = []*LineError{}
+	attrs.ErrorCount = 0
+	if err := p.update(b); err != nil {
+		return err
+	}
+
+	var total int64
+	err = parse(attrs.Format, attrs.Content, func(e *Entry) error {
+		if e.Line == 0 {
+			b.addError(e.Line, e.Err)
+			return nil
+		}
+
+		if e.Err == nil {
+			e.Err = b.check(e, org.Attributes.Settings)
+		}
+
+		if e.Err != nil {
+			b.addError(e.Line, e.Err)
+		} else {
+			amount, _ := ParseAmount(e.Attributes.Amount)
+			total += amount
+			attrs.PaymentCount++
+		}
+
+		attrs.Progress.Processed++
+		if attrs.Progress.Processed%progressEvery == 0 {
+			return p.update(b)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if attrs.Progress.Processed == 0 && attrs.ErrorCount == 0 {
+		b.addError(0, errors.New("No payments found"))
+	}
+
+	attrs.Progress.Total = attrs.Progress.Processed
+	attrs.TotalAmount = FormatAmount(total)
+	attrs.Status = StatusValidated
+	if attrs.ErrorCount > 0 {
+		attrs.Status = StatusInvalid
+	}
+
+	return p.update(b)
+}
+
+// approve creates the payments of the given batch, and links them to
+// the batch. Payments that cannot be created are reported as errors
+// on their line. Since payment ids are derived from their line, a
+// conflict means we already created the payment, eg. before a restart
+func (p *Processor) approve(b *Batch) error {
+	attrs := &b.Attributes
+	attrs.Progress.Processed = 0
+	attrs.Payments = []string{}
+	attrs.Errors = []*LineError{}
+	attrs.ErrorCount = 0
+
+	err := parse(attrs.Format, attrs.Content, func(e *Entry) error {
+		if e.Line == 0 || e.Err != nil {
+			return nil
+		}
+
+		payment := b.NewPayment(e)
+		_, status, err := p.payments.CreatePayment(payment)
+		if err != nil && status != http.StatusConflict {
+			b.addError(e.Line, err)
+		} else {
+			attrs.Payments = append(attrs.Payments, payment.Id)
+		}
+
+		attrs.Progress.Processed++
+		if attrs.Progress.Processed%progressEvery == 0 {
+			return p.update(b)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	attrs.Status = StatusApproved
+	return p.update(b)
+}
+
+// update saves the given batch, and
+// keeps track of its new version
+func (p *Processor) update(b *Batch) error {
+	b.Attributes.UpdatedOn = time.Now().UTC()
+	repoItem, err := b.ToRepoItem()
+	if err != nil {
+		return err
+	}
+
+	updatedItem, err := p.repo.Update(repoItem)
+	if err != nil {
+		return err
+	}
+
+	b.Version = updatedItem.Version
+	return nil
+}
@@ -0,0 +1,418 @@
+// batches contains the http routes that manage payment batches: files
+// of payments, in csv or pain.001 format, that are parsed and validated
+// in the background, and whose payments are created all at once when
+// the batch is approved
+package batches
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	"github.com/pedro-gutierrez/form3/pkg/payments"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	batchesLinkPattern       string
+	batchLinkPattern         string
+	batchPaymentsLinkPattern string
+)
+
+func init() {
+	batchesLinkPattern = "/payment-batches?%sfrom=%v&to=%v"
+	batchLinkPattern = "/payment-batches/%v"
+	batchPaymentsLinkPattern = "/payment-batches/%v/payments?from=%v&to=%v"
+}
+
+// BatchesService represents a payment batches service
+// it defines the routes, the repos to operate with, and the
+// processor batches are handed over to. It inherits fields and
+// functions from util.HttpService
+type BatchesService struct {
+	HttpService
+	repo          Repo
+	organisations Repo
+	payments      Repo
+	processor     *Processor
+	maxResults    int
+}
+
+// New creates a new BatchesService with the given repos, processor,
+// base url and maxResults information. Batches must belong to one of
+// the organisations in the organisations repo. Their payments are read
+// from the payments repo
+func New(repo Repo, organisations Repo, payments Repo, processor *Processor, baseUrl string, maxResults int) *BatchesService {
+	return &BatchesService{
+		HttpService: HttpService{
+			BaseUrl: baseUrl,
+		},
+		repo:          repo,
+		organisations: organisations,
+		payments:      payments,
+		processor:     processor,
+		maxResults:    maxResults,
+	}
+}
+
+// Routes returns a router with all routes
+// supported by this service
+func (s *BatchesService) Routes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Get("/", s.List)
+	router.Post("/", s.Create)
+	router.Get("/{id}", s.Fetch)
+	router.Delete("/{id}", s.Delete)
+	router.Post("/{id}/approve", s.Approve)
+	router.Get("/{id}/payments", s.ListPayments)
+	return router
+}
+
+// List returns a list of batches, using the same from and to query
+// params semantics as payments. The organisation_id query param
+// narrows the list down to the batches of a single organisation, and
+// principals only ever see the batches of the organisations they can access
+func (s *BatchesService) List(w http.ResponseWriter, r *http.Request) {
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	organisation, err := auth.FromRequest(r).Scope(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	repoItems, err := s.repo.Find(RepoFilter{Organisation: organisation}, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	batches, err := NewBatchesFromRepoItems(repoItems)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, b := range batches {
+		b.Attributes.Content = ""
+	}
+
+	filter := ""
+	if organisation != "" {
+		filter = fmt.Sprintf("organisation_id=%s&", url.QueryEscape(organisation))
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(batchesLinkPattern, filter, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(batchesLinkPattern, filter, to, to+limit))
+
+	if from >= limit {
+		links["prev"] = s.UrlFor(fmt.Sprintf(batchesLinkPattern, filter, from-limit, from))
+	}
+
+	RenderJSON(w, r, http.StatusOK, &BatchesResponse{
+		Data:  batches,
+		Links: links,
+	})
+}
+
+// Fetch a batch by id. This is how clients follow the progress
+// of a batch, and find the errors found in its file
+func (s *BatchesService) Fetch(w http.ResponseWriter, r *http.Request) {
+	b, status, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, b)
+}
+
+// Create a new batch from the file in the request. The file is
+// parsed and validated in the background
+func (s *BatchesService) Create(w http.ResponseWriter, r *http.Request) {
+	b, err := decodeBatch(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.FromRequest(r).CanSee(b.Organisation) {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Unknown organisation: %s", b.Organisation))
+		return
+	}
+
+	_, status, err := organisations.Lookup(s.organisations, b.Organisation)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	err = b.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	b.Attributes = BatchAttributes{
+		Format:        b.Attributes.Format,
+		FileName:      b.Attributes.FileName,
+		Content:       b.Attributes.Content,
+		DebtorAccount: b.Attributes.DebtorAccount,
+		Scheme:        b.Attributes.Scheme,
+		Status:        StatusUploaded,
+		Progress:      Progress{Total: count(b.Attributes.Format, b.Attributes.Content)},
+		Errors:        []*LineError{},
+		Payments:      []string{},
+		CreatedBy:     auth.AuthenticatedUser(r),
+		CreatedOn:     now,
+		UpdatedOn:     now,
+	}
+
+	repoItem, err := b.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdItem, err := s.repo.Create(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	b, err = NewBatchFromRepoItem(createdItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.processor.Notify()
+	s.render(w, r, http.StatusCreated, b)
+}
+
+// Approve a validated batch. Its payments are created in the
+// background, so this returns as soon as the batch is approving
+func (s *BatchesService) Approve(w http.ResponseWriter, r *http.Request) {
+	b, status, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	if b.Attributes.Status != StatusValidated {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Batch %s cannot be approved while %s", b.Id, b.Attributes.Status))
+		return
+	}
+
+	now := time.Now().UTC()
+	b.Attributes.Status = StatusApproving
+	b.Attributes.Progress.Processed = 0
+	b.Attributes.ApprovedBy = auth.AuthenticatedUser(r)
+	b.Attributes.ApprovedOn = &now
+	b.Attributes.UpdatedOn = now
+
+	repoItem, err := b.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	updatedItem, err := s.repo.Update(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	b, err = NewBatchFromRepoItem(updatedItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.processor.Notify()
+	s.render(w, r, http.StatusAccepted, b)
+}
+
+// Delete a batch, given its version. Batches whose payments are
+// being, or were, created cannot be deleted, so that payments never
+// lose track of the batch they came from
+func (s *BatchesService) Delete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	versionQP := strings.TrimSpace(r.URL.Query().Get("version"))
+	version, err := strconv.Atoi(versionQP)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	b, status, err := s.fetch(r, id)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	if b.Attributes.Status == StatusApproving || b.Attributes.Status == StatusApproved {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Batch %s cannot be deleted once approved", id))
+		return
+	}
+
+	err = s.repo.Delete(&RepoItem{Id: id, Version: version})
+	if err != nil {
+		errorCode := http.StatusInternalServerError
+		if s.repo.IsNotFound(err) || s.repo.IsConflict(err) {
+			errorCode = http.StatusConflict
+		}
+		HandleHttpError(w, r, errorCode, err)
+		return
+	}
+
+	RenderNoContent(w, r)
+}
+
+// ListPayments returns the payments created by a batch, in the
+// order of the lines of its file, using the same from and to query
+// params semantics as payments. Payments deleted since are skipped
+func (s *BatchesService) ListPayments(w http.ResponseWriter, r *http.Request) {
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	b, status, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	ids := b.Attributes.Payments
+	start, end := from, from+limit
+	if start > len(ids) {
+		start = len(ids)
+	}
+	if end > len(ids) {
+		end = len(ids)
+	}
+
+	found := []*payments.Payment{}
+	for _, id := range ids[start:end] {
+		repoItem, err := s.payments.Fetch(&RepoItem{Id: id})
+		if err != nil {
+			if s.payments.IsNotFound(err) {
+				continue
+			}
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		p, err := payments.NewPaymentFromRepoItem(repoItem)
+		if err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		found = append(found, p)
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(batchPaymentsLinkPattern, b.Id, from, to))
+	links["batch"] = s.UrlFor(fmt.Sprintf(batchLinkPattern, b.Id))
+	if end < len(ids) {
+		links["next"] = s.UrlFor(fmt.Sprintf(batchPaymentsLinkPattern, b.Id, to, to+limit))
+	}
+
+	if from >= limit {
+		links["prev"] = s.UrlFor(fmt.Sprintf(batchPaymentsLinkPattern, b.Id, from-limit, from))
+	}
+
+	RenderJSON(w, r, http.StatusOK, &payments.PaymentsResponse{
+		Data:  found,
+		Links: links,
+	})
+}
+
+// fetch looks up a batch by id. Batches of organisations the
+// principal of the given request cannot access are not found, like
+// their payments. Returns the http status code to respond with on error
+func (s *BatchesService) fetch(r *http.Request, id string) (*Batch, int, error) {
+	b, err := Fetch(s.repo, id)
+	if err != nil {
+		if s.repo.IsNotFound(err) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !auth.FromRequest(r).CanSee(b.Organisation) {
+		return nil, http.StatusNotFound, fmt.Errorf("Batch %s not found", id)
+	}
+
+	return b, http.StatusOK, nil
+}
+
+// page reads the from and to query params, and returns
+// the limit to apply, capped to the maximum number of results
+func (s *BatchesService) page(r *http.Request) (int, int, int, error) {
+	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
+	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
+
+	limit := to - from
+	if limit <= 0 {
+		return from, to, limit, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to)
+	}
+
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	return from, to, limit, nil
+}
+
+// render sends back the given batch, along with its links. The
+// content of the file is never sent back, since it can be large
+func (s *BatchesService) render(w http.ResponseWriter, r *http.Request, status int, b *Batch) {
+	b.Attributes.Content = ""
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(batchLinkPattern, b.Id))
+	if len(b.Attributes.Payments) > 0 {
+		links["payments"] = s.UrlFor(fmt.Sprintf(batchPaymentsLinkPattern, b.Id, 0, s.maxResults))
+	}
+
+	RenderJSON(w, r, status, &BatchResponse{
+		Data:  b,
+		Links: links,
+	})
+}
+
+// decodeBatch is a convenience function that attempts to
+// decode a batch from the HTTP request body
+func decodeBatch(r *http.Request) (*Batch, error) {
+	decoder := json.NewDecoder(r.Body)
+	var br BatchRequest
+	err := decoder.Decode(&br)
+	if err == nil && br.Batch == nil {
+		err = fmt.Errorf("No batch data")
+	}
+	return br.Batch, err
+}
@@ -0,0 +1,159 @@
+package beneficiaries
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var countryRegexp = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// BeneficiaryAttributes captures the details of a party an
+// organisation makes payments to, as saved in its address book
+type BeneficiaryAttributes struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+
+	// The ISO 3166 country code of the
+	// beneficiary (eg. GB), if known
+	Country string `json:"country,omitempty"`
+
+	AccountNumber string `json:"account_number"`
+	BankId        string `json:"bank_id"`
+
+	CreatedOn time.Time `json:"created_on"`
+	UpdatedOn time.Time `json:"updated_on"`
+}
+
+// Validate does semantic validation on the beneficiary attributes
+func (ba *BeneficiaryAttributes) Validate() error {
+	if len(strings.TrimSpace(ba.Name)) == 0 {
+		return errors.New("Name is empty")
+	}
+
+	if ba.Country != "" && !countryRegexp.MatchString(ba.Country) {
+		return fmt.Errorf("Invalid country: %s", ba.Country)
+	}
+
+	if len(strings.TrimSpace(ba.AccountNumber)) == 0 {
+		return errors.New("Account number is empty")
+	}
+
+	if len(strings.TrimSpace(ba.BankId)) == 0 {
+		return errors.New("Bank id is empty")
+	}
+
+	return nil
+}
+
+// Beneficiary a party saved in the address book of an
+// organisation, that its payments can refer to by id
+type Beneficiary struct {
+	Id           string                `json:"id"`
+	Type         string                `json:"type"`
+	Version      int                   `json:"version"`
+	Organisation string                `json:"organisation_id"`
+	Attributes   BeneficiaryAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the beneficiary
+func (b *Beneficiary) Validate() error {
+	if len(strings.TrimSpace(b.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	if b.Type != "Beneficiary" {
+		return fmt.Errorf("Invalid type: %s", b.Type)
+	}
+
+	return b.Attributes.Validate()
+}
+
+// Converts a beneficiary into something that
+// can be saved into the database
+func (b *Beneficiary) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           b.Id,
+		Version:      b.Version,
+		Organisation: b.Organisation,
+	}
+
+	bytes, err := json.Marshal(b.Attributes)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize beneficiary attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into a beneficiary
+func NewBeneficiaryFromRepoItem(item *RepoItem) (*Beneficiary, error) {
+	b := &Beneficiary{
+		Type:         "Beneficiary",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+	}
+
+	var attrs BeneficiaryAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return b, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	b.Attributes = attrs
+
+	return b, nil
+}
+
+// NewBeneficiariesFromRepoItems converts the given slice of
+// repo items to a list of beneficiaries
+func NewBeneficiariesFromRepoItems(items []*RepoItem) ([]*Beneficiary, error) {
+	beneficiaries := []*Beneficiary{}
+	for _, i := range items {
+		b, err := NewBeneficiaryFromRepoItem(i)
+		if err != nil {
+			return beneficiaries, err
+		}
+		beneficiaries = append(beneficiaries, b)
+	}
+
+	return beneficiaries, nil
+}
+
+// Fetch is a convenience function that looks up a beneficiary
+// by id in the given repo. Other services use it in order to
+// expand the beneficiaries their resources refer to
+func Fetch(repo Repo, id string) (*Beneficiary, error) {
+	found, err := repo.Fetch(&RepoItem{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return NewBeneficiaryFromRepoItem(found)
+}
+
+// BeneficiaryRequest represents a http request that contains
+// a beneficiary in its field 'data'
+type BeneficiaryRequest struct {
+	Beneficiary *Beneficiary `json:"data"`
+}
+
+// BeneficiaryResponse represents a http response that contains
+// a beneficiary in its field 'data' and set of links
+type BeneficiaryResponse struct {
+	Data  *Beneficiary `json:"data"`
+	Links Links        `json:"links"`
+}
+
+// BeneficiariesResponse represents a http response that contains
+// a list of beneficiaries in its field 'data' and a set of links
+type BeneficiariesResponse struct {
+	Data  []*Beneficiary `json:"data"`
+	Links Links          `json:"links"`
+}
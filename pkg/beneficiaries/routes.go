@@ -0,0 +1,329 @@
+// beneficiaries contains the http routes that manage the address
+// book of organisations: the parties they make payments to, so that
+// payments can refer to them by id
+package beneficiaries
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	beneficiariesLinkPattern string
+	beneficiaryLinkPattern   string
+)
+
+func init() {
+	beneficiariesLinkPattern = "/beneficiaries?%sfrom=%v&to=%v"
+	beneficiaryLinkPattern = "/beneficiaries/%v"
+}
+
+// BeneficiariesService represents a beneficiaries service
+// it defines the routes and the repos to operate
+// with. It inherits fields and functions from util.HttpService
+type BeneficiariesService struct {
+	HttpService
+	repo          Repo
+	organisations Repo
+	maxResults    int
+}
+
+// New creates a new BeneficiariesService with the given repos, base
+// url and maxResults information. Beneficiaries must belong to one of
+// the organisations in the organisations repo
+func New(repo Repo, organisations Repo, baseUrl string, maxResults int) *BeneficiariesService {
+	return &BeneficiariesService{
+		HttpService: HttpService{
+			BaseUrl: baseUrl,
+		},
+		repo:          repo,
+		organisations: organisations,
+		maxResults:    maxResults,
+	}
+}
+
+// Routes returns a router with all routes
+// supported by this service
+func (s *BeneficiariesService) Routes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Get("/", s.List)
+	router.Post("/", s.Create)
+	router.Get("/{id}", s.Fetch)
+	router.Put("/{id}", s.Update)
+	router.Delete("/{id}", s.Delete)
+	return router
+}
+
+// List returns a list of beneficiaries, using the same from and to
+// query params semantics as payments. The organisation_id query param
+// narrows the list down to the address book of a single organisation.
+// Principals only see the address books of the organisations they
+// can access
+func (s *BeneficiariesService) List(w http.ResponseWriter, r *http.Request) {
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	organisation, err := auth.FromRequest(r).Scope(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	repoItems, err := s.repo.Find(RepoFilter{Organisation: organisation}, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	beneficiaries, err := NewBeneficiariesFromRepoItems(repoItems)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	filter := ""
+	if organisation != "" {
+		filter = fmt.Sprintf("organisation_id=%s&", url.QueryEscape(organisation))
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(beneficiariesLinkPattern, filter, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(beneficiariesLinkPattern, filter, to, to+limit))
+
+	if from >= limit {
+		links["prev"] = s.UrlFor(fmt.Sprintf(beneficiariesLinkPattern, filter, from-limit, from))
+	}
+
+	RenderJSON(w, r, http.StatusOK, &BeneficiariesResponse{
+		Data:  beneficiaries,
+		Links: links,
+	})
+}
+
+// Fetch a beneficiary by id
+func (s *BeneficiariesService) Fetch(w http.ResponseWriter, r *http.Request) {
+	beneficiary, status, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, beneficiary)
+}
+
+// Create a new beneficiary, in the address book of its organisation
+func (s *BeneficiariesService) Create(w http.ResponseWriter, r *http.Request) {
+	beneficiary, err := decodeBeneficiary(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.FromRequest(r).CanSee(beneficiary.Organisation) {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Unknown organisation: %s", beneficiary.Organisation))
+		return
+	}
+
+	_, status, err := organisations.Lookup(s.organisations, beneficiary.Organisation)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	err = beneficiary.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	beneficiary.Attributes.CreatedOn = now
+	beneficiary.Attributes.UpdatedOn = now
+
+	repoItem, err := beneficiary.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdItem, err := s.repo.Create(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	beneficiary, err = NewBeneficiaryFromRepoItem(createdItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusCreated, beneficiary)
+}
+
+// Update an existing beneficiary. The organisation of a beneficiary
+// cannot be changed. Payments already made to the beneficiary keep
+// the details they were created with
+func (s *BeneficiariesService) Update(w http.ResponseWriter, r *http.Request) {
+	beneficiary, err := decodeBeneficiary(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id != beneficiary.Id {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Beneficiary id mismatch: %s", beneficiary.Id))
+		return
+	}
+
+	current, status, err := s.fetch(r, id)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	if beneficiary.Organisation != current.Organisation {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("The organisation of a beneficiary cannot be changed"))
+		return
+	}
+
+	err = beneficiary.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	beneficiary.Attributes.CreatedOn = current.Attributes.CreatedOn
+	beneficiary.Attributes.UpdatedOn = time.Now().UTC()
+
+	repoItem, err := beneficiary.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	updatedItem, err := s.repo.Update(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	beneficiary, err = NewBeneficiaryFromRepoItem(updatedItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, beneficiary)
+}
+
+// Delete a beneficiary by id. Payments already made to
+// the beneficiary are kept
+func (s *BeneficiariesService) Delete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	versionQP := strings.TrimSpace(r.URL.Query().Get("version"))
+	version, err := strconv.Atoi(versionQP)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, status, err := s.fetch(r, id); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	err = s.repo.Delete(&RepoItem{Id: id, Version: version})
+	if err != nil {
+		errorCode := http.StatusInternalServerError
+		if s.repo.IsNotFound(err) || s.repo.IsConflict(err) {
+			errorCode = http.StatusConflict
+		}
+		HandleHttpError(w, r, errorCode, err)
+		return
+	}
+
+	RenderNoContent(w, r)
+}
+
+// fetch looks up a beneficiary by id. Beneficiaries of organisations
+// the principal of the given request cannot access are not found, like
+// their payments. Returns the http status code to respond with on error
+func (s *BeneficiariesService) fetch(r *http.Request, id string) (*Beneficiary, int, error) {
+	beneficiary, err := Fetch(s.repo, id)
+	if err != nil {
+		if s.repo.IsNotFound(err) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !auth.FromRequest(r).CanSee(beneficiary.Organisation) {
+		return nil, http.StatusNotFound, fmt.Errorf("Beneficiary %s not found", id)
+	}
+
+	return beneficiary, http.StatusOK, nil
+}
+
+// page reads the from and to query params, and returns
+// the limit to apply, capped to the maximum number of results
+func (s *BeneficiariesService) page(r *http.Request) (int, int, int, error) {
+	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
+	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
+
+	limit := to - from
+	if limit <= 0 {
+		return from, to, limit, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to)
+	}
+
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	return from, to, limit, nil
+}
+
+// render sends back the given beneficiary, along with its links
+func (s *BeneficiariesService) render(w http.ResponseWriter, r *http.Request, status int, beneficiary *Beneficiary) {
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(beneficiaryLinkPattern, beneficiary.Id))
+
+	RenderJSON(w, r, status, &BeneficiaryResponse{
+		Data:  beneficiary,
+		Links: links,
+	})
+}
+
+// decodeBeneficiary is a convenience function that attempts
+// to decode a beneficiary from the HTTP request body
+func decodeBeneficiary(r *http.Request) (*Beneficiary, error) {
+	decoder := json.NewDecoder(r.Body)
+	var br BeneficiaryRequest
+	err := decoder.Decode(&br)
+	if err == nil && br.Beneficiary == nil {
+		err = fmt.Errorf("No beneficiary data")
+	}
+	return br.Beneficiary, err
+}
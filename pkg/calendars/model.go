@@ -0,0 +1,184 @@
+package calendars
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cutOffLayout is the layout of cut-off times (eg. 15:30)
+const cutOffLayout = "15:04"
+
+// Calendar captures the days payments of a scheme can be
+// processed on. Weekends are never processing days. Neither are
+// the bank holidays of the country the scheme runs in
+type Calendar struct {
+	Scheme  string `json:"scheme"`
+	Country string `json:"country,omitempty"`
+
+	// The time of the day, in UTC, after which payments can no
+	// longer be processed on the same day (eg. 15:30). Optional
+	CutOff string `json:"cut_off,omitempty"`
+
+	// The bank holidays of the scheme, as a map of
+	// dates (eg. 2019-12-25) to their names
+	Holidays map[string]string `json:"holidays,omitempty"`
+}
+
+// Validate does semantic validation on the calendar
+func (c *Calendar) Validate() error {
+	if len(strings.TrimSpace(c.Scheme)) == 0 {
+		return errors.New("Scheme is empty")
+	}
+
+	if c.CutOff != "" {
+		if _, err := time.Parse(cutOffLayout, c.CutOff); err != nil {
+			return errors.Wrap(err, "Invalid cut-off time")
+		}
+	}
+
+	for date := range c.Holidays {
+		if _, err := ParseDate(date); err != nil {
+			return errors.Wrap(err, "Invalid holiday")
+		}
+	}
+
+	return nil
+}
+
+// IsBusinessDay returns true if payments can be
+// processed on the given day
+func (c *Calendar) IsBusinessDay(day time.Time) bool {
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		return false
+	}
+
+	_, holiday := c.Holidays[FormatDate(day)]
+	return !holiday
+}
+
+// IsPastCutOff returns true if payments can no longer be
+// processed on the day of the given time
+func (c *Calendar) IsPastCutOff(now time.Time) bool {
+	if c.CutOff == "" {
+		return false
+	}
+
+	// The cut-off was validated when loading the calendar
+	cutOff, _ := time.Parse(cutOffLayout, c.CutOff)
+	now = now.UTC()
+	return now.Hour()*60+now.Minute() >= cutOff.Hour()*60+cutOff.Minute()
+}
+
+// NextBusinessDay returns the first day, on or after the given date,
+// payments can be processed on. If the date is today, and we are
+// already past the cut-off, today does not count
+func (c *Calendar) NextBusinessDay(date string, now time.Time) (string, error) {
+	day, err := ParseDate(date)
+	if err != nil {
+		return "", err
+	}
+
+	if date == FormatDate(now) && c.IsPastCutOff(now) {
+		day = day.AddDate(0, 0, 1)
+	}
+
+	for !c.IsBusinessDay(day) {
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return FormatDate(day), nil
+}
+
+// LastBusinessDay returns the last day of the given
+// month payments can be processed on
+func (c *Calendar) LastBusinessDay(year int, month time.Month) time.Time {
+	day := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+	for !c.IsBusinessDay(day) {
+		day = day.AddDate(0, 0, -1)
+	}
+	return day
+}
+
+// Calendars holds the calendars of all
+// the schemes we know of, by scheme
+type Calendars map[string]*Calendar
+
+// Load reads all calendars from the json files in the given
+// directory, one per scheme (eg. BACS.json). A missing directory
+// means we know of no calendars
+func Load(dir string) (Calendars, error) {
+	calendars := make(Calendars)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to list calendars")
+	}
+
+	for _, file := range files {
+		bytes, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read calendar %s", file)
+		}
+
+		var c Calendar
+		if err := json.Unmarshal(bytes, &c); err != nil {
+			return nil, errors.Wrapf(err, "Unable to parse calendar %s", file)
+		}
+
+		if err := c.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "Invalid calendar %s", file)
+		}
+
+		scheme := strings.ToUpper(c.Scheme)
+		if _, ok := calendars[scheme]; ok {
+			return nil, fmt.Errorf("Duplicate calendar for scheme %s: %s", c.Scheme, file)
+		}
+		calendars[scheme] = &c
+	}
+
+	return calendars, nil
+}
+
+// Lookup returns the calendar of the given scheme, if we know it
+func (cs Calendars) Lookup(scheme string) (*Calendar, bool) {
+	c, ok := cs[strings.ToUpper(scheme)]
+	return c, ok
+}
+
+// For returns the calendar of the given scheme. Schemes we
+// know no calendar of only skip weekends
+func (cs Calendars) For(scheme string) *Calendar {
+	if c, ok := cs.Lookup(scheme); ok {
+		return c
+	}
+	return &Calendar{Scheme: scheme}
+}
+
+// BusinessDay is the answer to the question of when payments
+// of a scheme can be processed, from a given date
+type BusinessDay struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+	From   string `json:"from"`
+	Date   string `json:"date"`
+}
+
+// CalendarResponse represents a http response that contains
+// a calendar in its field 'data' and set of links
+type CalendarResponse struct {
+	Data  *Calendar `json:"data"`
+	Links Links     `json:"links"`
+}
+
+// BusinessDayResponse represents a http response that contains
+// a business day in its field 'data' and set of links
+type BusinessDayResponse struct {
+	Data  *BusinessDay `json:"data"`
+	Links Links        `json:"links"`
+}
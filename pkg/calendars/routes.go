@@ -0,0 +1,114 @@
+// calendars contains the http routes that expose the business day
+// calendars of payment schemes, used to check processing dates
+package calendars
+
+import (
+	"fmt"
+	"github.com/go-chi/chi"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	calendarLinkPattern        string
+	nextBusinessDayLinkPattern string
+)
+
+func init() {
+	calendarLinkPattern = "/calendars/%v"
+	nextBusinessDayLinkPattern = "/calendars/%v/next-business-day?date=%v"
+}
+
+// CalendarsService represents a calendars service
+// it defines the routes and the calendars to operate
+// with. It inherits fields and functions from util.HttpService
+type CalendarsService struct {
+	HttpService
+	calendars Calendars
+}
+
+// New creates a new CalendarsService with the
+// given calendars and base url
+func New(calendars Calendars, baseUrl string) *CalendarsService {
+	return &CalendarsService{
+		HttpService: HttpService{
+			BaseUrl: baseUrl,
+		},
+		calendars: calendars,
+	}
+}
+
+// Routes returns a router with all routes
+// supported by this service
+func (s *CalendarsService) Routes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Get("/{scheme}", s.Fetch)
+	router.Get("/{scheme}/next-business-day", s.NextBusinessDay)
+	return router
+}
+
+// Fetch the calendar of a scheme
+func (s *CalendarsService) Fetch(w http.ResponseWriter, r *http.Request) {
+	c, status, err := s.lookup(chi.URLParam(r, "scheme"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(calendarLinkPattern, c.Scheme))
+
+	RenderJSON(w, r, http.StatusOK, &CalendarResponse{
+		Data:  c,
+		Links: links,
+	})
+}
+
+// NextBusinessDay returns the first day, on or after the date given
+// in the date query param, payments of a scheme can be processed on.
+// The date defaults to today, taking the cut-off of the scheme into
+// account
+func (s *CalendarsService) NextBusinessDay(w http.ResponseWriter, r *http.Request) {
+	c, status, err := s.lookup(chi.URLParam(r, "scheme"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	from := strings.TrimSpace(r.URL.Query().Get("date"))
+	if from == "" {
+		from = Today()
+	}
+
+	date, err := c.NextBusinessDay(from, time.Now())
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(nextBusinessDayLinkPattern, c.Scheme, from))
+	links["calendar"] = s.UrlFor(fmt.Sprintf(calendarLinkPattern, c.Scheme))
+
+	RenderJSON(w, r, http.StatusOK, &BusinessDayResponse{
+		Data: &BusinessDay{
+			Type:   "BusinessDay",
+			Scheme: c.Scheme,
+			From:   from,
+			Date:   date,
+		},
+		Links: links,
+	})
+}
+
+// lookup returns the calendar of the given scheme. Returns
+// the http status code to respond with on error
+func (s *CalendarsService) lookup(scheme string) (*Calendar, int, error) {
+	c, ok := s.calendars.Lookup(scheme)
+	if !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("No calendar for scheme: %s", scheme)
+	}
+	return c, http.StatusOK, nil
+}
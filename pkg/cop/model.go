@@ -0,0 +1,233 @@
+// cop checks the name a payer gives for a beneficiary against the
+// name its bank account is registered with (Confirmation of Payee),
+// as found in a locally stored account directory
+package cop
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/screening"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultThreshold is the similarity, from 0 to 1, above
+// which a name is a close match of the registered one
+const DefaultThreshold = 0.8
+
+// The outcomes of a check
+const (
+	Match      = "match"
+	CloseMatch = "close_match"
+	NoMatch    = "no_match"
+)
+
+// Why a check is not a match
+const (
+	ReasonAccountNotFound     = "account_not_found"
+	ReasonAccountTypeMismatch = "account_type_mismatch"
+	ReasonNameMismatch        = "name_mismatch"
+	ReasonNameCloselyMatches  = "name_closely_matches"
+)
+
+// The types of accounts, when known
+const (
+	AccountTypePersonal = "personal"
+	AccountTypeBusiness = "business"
+)
+
+// Account a bank account, and the name and type
+// it is registered with, as found in the directory
+type Account struct {
+	BankId        string
+	AccountNumber string
+	Name          string
+	Type          string
+}
+
+// Check the name a payer gives for the holder of a bank account,
+// and optionally its type, to be confirmed against the directory
+type Check struct {
+	Name          string `json:"name"`
+	AccountNumber string `json:"account_number"`
+	BankId        string `json:"bank_id"`
+	AccountType   string `json:"account_type,omitempty"`
+
+	// The outcome of the check. These are
+	// managed by the server
+	Result *Result `json:"result,omitempty"`
+}
+
+// Validate does semantic validation on the check
+func (c *Check) Validate() error {
+	if len(strings.TrimSpace(c.Name)) == 0 {
+		return errors.New("Name is empty")
+	}
+
+	if len(strings.TrimSpace(c.AccountNumber)) == 0 {
+		return errors.New("Account number is empty")
+	}
+
+	if len(strings.TrimSpace(c.BankId)) == 0 {
+		return errors.New("Bank id is empty")
+	}
+
+	switch c.AccountType {
+	case "", AccountTypePersonal, AccountTypeBusiness:
+	default:
+		return fmt.Errorf("Invalid account type: %s", c.AccountType)
+	}
+
+	return nil
+}
+
+// Result the outcome of a check: a match, a close match or no
+// match, why it is not a match, and the registered name of the
+// account, only given back on close matches, so that the payer
+// can correct the name they gave
+type Result struct {
+	Match       string    `json:"match"`
+	Reason      string    `json:"reason,omitempty"`
+	AccountName string    `json:"account_name,omitempty"`
+	CheckedOn   time.Time `json:"checked_on"`
+}
+
+// Directory holds the bank accounts names are checked
+// against, and the threshold of close matches
+type Directory struct {
+	accounts  map[string]*Account
+	threshold float64
+}
+
+// Load reads the account directory from the given csv file, which
+// has a header row, with bank_id, account_number and name columns,
+// and an optional account_type column. A missing file means an empty
+// directory, in which no account can be found
+func Load(file string, threshold float64) (*Directory, error) {
+	if threshold <= 0 || threshold > 1 {
+		return nil, fmt.Errorf("Invalid payee check threshold: %v", threshold)
+	}
+
+	d := &Directory{accounts: map[string]*Account{}, threshold: threshold}
+
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return d, nil
+		}
+		return nil, errors.Wrapf(err, "Unable to read account directory %s", file)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return d, nil
+		}
+		return nil, errors.Wrapf(err, "Unable to parse account directory %s", file)
+	}
+
+	bankCol, accountCol, nameCol, typeCol := column(header, "bank_id"), column(header, "account_number"), column(header, "name"), column(header, "account_type")
+	if bankCol < 0 || accountCol < 0 || nameCol < 0 {
+		return nil, fmt.Errorf("Account directory %s needs bank_id, account_number and name columns", file)
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to parse account directory %s", file)
+		}
+
+		a := &Account{
+			BankId:        field(record, bankCol),
+			AccountNumber: field(record, accountCol),
+			Name:          field(record, nameCol),
+			Type:          strings.ToLower(field(record, typeCol)),
+		}
+
+		if a.BankId == "" || a.AccountNumber == "" || a.Name == "" {
+			continue
+		}
+
+		d.accounts[key(a.BankId, a.AccountNumber)] = a
+	}
+
+	return d, nil
+}
+
+// Check confirms the given name against the registered name of the
+// bank account. Names are compared regardless of case, punctuation,
+// spacing and word order. Names similar enough are close matches,
+// and so are matching names of accounts of another type
+func (d *Directory) Check(c *Check) *Result {
+	r := &Result{Match: NoMatch, CheckedOn: time.Now().UTC()}
+
+	a, ok := d.accounts[key(c.BankId, c.AccountNumber)]
+	if !ok {
+		r.Reason = ReasonAccountNotFound
+		return r
+	}
+
+	score := screening.Similarity(c.Name, a.Name)
+	switch {
+	case score >= 1 && (c.AccountType == "" || a.Type == "" || c.AccountType == a.Type):
+		r.Match = Match
+	case score >= 1:
+		r.Match = CloseMatch
+		r.Reason = ReasonAccountTypeMismatch
+		r.AccountName = a.Name
+	case score >= d.threshold:
+		r.Match = CloseMatch
+		r.Reason = ReasonNameCloselyMatches
+		r.AccountName = a.Name
+	default:
+		r.Reason = ReasonNameMismatch
+	}
+
+	return r
+}
+
+// key identifies a bank account in the directory
+func key(bankId string, accountNumber string) string {
+	return fmt.Sprintf("%s/%s", strings.TrimSpace(bankId), strings.TrimSpace(accountNumber))
+}
+
+// column returns the index of the column with the given
+// name in the given header row, or -1 if there is none
+func column(header []string, name string) int {
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// field returns the given column of the record, if any
+func field(record []string, col int) string {
+	if col < 0 || col >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[col])
+}
+
+// CheckRequest represents a http request that contains
+// a payee check in its field 'data'
+type CheckRequest struct {
+	Check *Check `json:"data"`
+}
+
+// CheckResponse represents a http response that contains
+// a payee check, along with its result, in its field 'data'
+type CheckResponse struct {
+	Data *Check `json:"data"`
+}
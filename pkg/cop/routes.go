@@ -0,0 +1,69 @@
+package cop
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+)
+
+// PayeeChecksService represents a payee checks service
+// it defines the routes and the account directory names are
+// checked against. It inherits fields and functions from
+// util.HttpService
+type PayeeChecksService struct {
+	HttpService
+	directory *Directory
+}
+
+// New creates a new PayeeChecksService with the given
+// account directory and base url
+func New(directory *Directory, baseUrl string) *PayeeChecksService {
+	return &PayeeChecksService{
+		HttpService: HttpService{
+			BaseUrl: baseUrl,
+		},
+		directory: directory,
+	}
+}
+
+// Routes returns a router with all routes
+// supported by this service
+func (s *PayeeChecksService) Routes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Post("/", s.Check)
+	return router
+}
+
+// Check confirms the name of the holder of a bank account against
+// our directory. Checks are not kept, so the check is sent back,
+// along with its result
+func (s *PayeeChecksService) Check(w http.ResponseWriter, r *http.Request) {
+	c, err := decodeCheck(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	err = c.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	c.Result = s.directory.Check(c)
+	RenderJSON(w, r, http.StatusOK, &CheckResponse{Data: c})
+}
+
+// decodeCheck is a convenience function that attempts
+// to decode a payee check from the HTTP request body
+func decodeCheck(r *http.Request) (*Check, error) {
+	decoder := json.NewDecoder(r.Body)
+	var cr CheckRequest
+	err := decoder.Decode(&cr)
+	if err == nil && cr.Check == nil {
+		err = fmt.Errorf("No payee check data")
+	}
+	return cr.Check, err
+}
@@ -0,0 +1,97 @@
+// events defines the events our services emit whenever
+// a resource changes, and the abstractions used to deliver them to
+// interested parties (eg. webhook subscribers)
+package events
+
+import (
+	"encoding/json"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// The types of events we emit for payments
+const (
+	PaymentCreated   = "payment.created"
+	PaymentUpdated   = "payment.updated"
+	PaymentDeleted   = "payment.deleted"
+	PaymentSubmitted = "payment.submitted"
+	PaymentReturned  = "payment.returned"
+	PaymentReversed  = "payment.reversed"
+	PaymentReleased  = "payment.released"
+	PaymentRejected  = "payment.rejected"
+	PaymentApproved  = "payment.approved"
+	PaymentHeld      = "payment.held"
+)
+
+// Event represents something that happened to one of our
+// resources. The data field holds a snapshot of the resource
+// at the time the event was emitted
+type Event struct {
+	Id           string          `json:"id"`
+	Type         string          `json:"type"`
+	Organisation string          `json:"organisation_id"`
+	ResourceId   string          `json:"resource_id"`
+	CreatedOn    time.Time       `json:"created_on"`
+	Data         json.RawMessage `json:"data"`
+}
+
+// NewEvent returns a new event of the given type, for the given
+// resource. The resource is serialized as json
+func NewEvent(eventType string, organisation string, resourceId string, resource interface{}) (*Event, error) {
+	e := &Event{
+		Id:           NewId(),
+		Type:         eventType,
+		Organisation: organisation,
+		ResourceId:   resourceId,
+		CreatedOn:    time.Now().UTC(),
+	}
+
+	bytes, err := json.Marshal(resource)
+	if err != nil {
+		return e, errors.Wrap(err, "Unable to serialize event data")
+	}
+
+	e.Data = bytes
+	return e, nil
+}
+
+// EventPublisher is a small abstraction of anything able to
+// deliver events, so that services that emit events do not need to know
+// who is going to consume them
+type EventPublisher interface {
+
+	// Publish the given event. Implementations
+	// should return an error if the event could not be
+	// accepted for delivery
+	Publish(e *Event) error
+}
+
+// ToOutboxMessage wraps the event into a message that can be
+// written to a repo outbox
+func (e *Event) ToOutboxMessage() (*OutboxMessage, error) {
+	m := &OutboxMessage{
+		Id:      e.Id,
+		Type:    e.Type,
+		Created: e.CreatedOn.UnixNano(),
+	}
+
+	bytes, err := json.Marshal(e)
+	if err != nil {
+		return m, errors.Wrap(err, "Unable to serialize event")
+	}
+
+	m.Payload = string(bytes)
+	return m, nil
+}
+
+// NewEventFromOutboxMessage converts an outbox message back
+// into an event
+func NewEventFromOutboxMessage(m *OutboxMessage) (*Event, error) {
+	e := &Event{}
+	err := json.Unmarshal([]byte(m.Payload), e)
+	if err != nil {
+		return e, errors.Wrap(err, "Error parsing outbox message")
+	}
+	return e, nil
+}
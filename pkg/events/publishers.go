@@ -0,0 +1,116 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// InProcessPublisher delivers events to handlers living in
+// the same process (eg. the webhooks dispatcher). Events are
+// delivered synchronously, and the first error is returned, so that
+// the event can be published again later
+type InProcessPublisher struct {
+	handlers []EventPublisher
+}
+
+// NewInProcessPublisher returns a new publisher, with no handlers
+func NewInProcessPublisher() *InProcessPublisher {
+	return &InProcessPublisher{}
+}
+
+// Subscribe registers a new handler. This is not safe to
+// call once events are being published
+func (p *InProcessPublisher) Subscribe(handler EventPublisher) {
+	p.handlers = append(p.handlers, handler)
+}
+
+// Publish hands the given event to all handlers
+func (p *InProcessPublisher) Publish(e *Event) error {
+	for _, h := range p.handlers {
+		if err := h.Publish(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FilePublisher appends events to a file, as json lines
+type FilePublisher struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFilePublisher opens the given file for appending,
+// creating it if it does not exist. The caller is in charge
+// of closing the publisher when it is no longer needed
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to open events file")
+	}
+	return &FilePublisher{file: f}, nil
+}
+
+// Publish appends the event to the file, and flushes it
+// to disk before returning
+func (p *FilePublisher) Publish(e *Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "Unable to serialize event")
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "Unable to write event")
+	}
+	return p.file.Sync()
+}
+
+// Close the file
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
+
+// HttpPublisher POSTs events as json to a fixed url
+type HttpPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewHttpPublisher returns a new publisher that posts to
+// the given url, with the given timeout
+func NewHttpPublisher(url string, timeout time.Duration) *HttpPublisher {
+	return &HttpPublisher{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Publish posts the event. Any response other than
+// a 2xx is treated as an error
+func (p *HttpPublisher) Publish(e *Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "Unable to serialize event")
+	}
+
+	res, err := p.client.Post(p.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "Unable to publish event")
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("Unable to publish event %s: got status %v", e.Id, res.StatusCode)
+	}
+	return nil
+}
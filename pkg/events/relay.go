@@ -0,0 +1,97 @@
+package events
+
+import (
+	"github.com/pedro-gutierrez/form3/pkg/logger"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"sync"
+	"time"
+)
+
+// Relay drains the outbox of a repo, and hands events
+// to a publisher. Messages are only removed from the outbox once
+// published, so events are delivered at least once: consumers should
+// use event ids in order to detect duplicates
+type Relay struct {
+	repo      Repo
+	publisher EventPublisher
+	interval  time.Duration
+	batchSize int
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewRelay returns a new relay that polls the outbox of the given repo
+// at the given interval, reading up to batchSize messages each time
+func NewRelay(repo Repo, publisher EventPublisher, interval time.Duration, batchSize int) *Relay {
+	return &Relay{
+		repo:      repo,
+		publisher: publisher,
+		interval:  interval,
+		batchSize: batchSize,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start polling the outbox in the background
+func (r *Relay) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Drain(); err != nil {
+					logger.Error(err)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop polling, and wait for the current batch to finish
+func (r *Relay) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+// Drain publishes messages from the outbox, in order, until it is
+// empty. We stop at the first error, so that events are not reordered,
+// and try again on the next tick
+func (r *Relay) Drain() error {
+	for {
+		messages, err := r.repo.Outbox(r.batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range messages {
+			// A message we cannot read will never be published, so
+			// we log it and remove it from the outbox, instead of
+			// blocking all other events forever
+			e, err := NewEventFromOutboxMessage(m)
+			if err != nil {
+				logger.Error(err)
+				if err := r.repo.AckOutbox(m); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := r.publisher.Publish(e); err != nil {
+				return err
+			}
+
+			if err := r.repo.AckOutbox(m); err != nil {
+				return err
+			}
+		}
+
+		if len(messages) < r.batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package fx
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateDecimals is the number of decimal places
+// exchange rates are rounded to
+const rateDecimals = 6
+
+var (
+	currencyRegexp = regexp.MustCompile(`^[A-Z]{3}$`)
+	pairRegexp     = regexp.MustCompile(`^([A-Z]{3})/([A-Z]{3})$`)
+)
+
+// Rates holds the exchange rates we quote, by currency pair
+// (eg. GBP/USD), as the amount of the second currency one unit
+// of the first one buys
+type Rates map[string]float64
+
+// LoadRates reads the exchange rates from the given json file, as
+// a map of currency pairs to rates (eg. {"GBP/USD": 1.265}). A missing
+// file means we quote no rates
+func LoadRates(file string) (Rates, error) {
+	rates := make(Rates)
+
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rates, nil
+		}
+		return nil, errors.Wrapf(err, "Unable to read rates %s", file)
+	}
+
+	if err := json.Unmarshal(bytes, &rates); err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse rates %s", file)
+	}
+
+	for pair, rate := range rates {
+		if !pairRegexp.MatchString(pair) {
+			return nil, fmt.Errorf("Invalid currency pair in %s: %s", file, pair)
+		}
+		if rate <= 0 {
+			return nil, fmt.Errorf("Invalid rate for %s in %s: %v", pair, file, rate)
+		}
+	}
+
+	return rates, nil
+}
+
+// Rate returns the rate to sell the given currency at, in order to
+// buy the other one. Pairs we only know the other way round are
+// quoted at the inverse rate
+func (rs Rates) Rate(sell string, buy string) (float64, bool) {
+	if rate, ok := rs[fmt.Sprintf("%s/%s", sell, buy)]; ok {
+		return rate, true
+	}
+
+	if rate, ok := rs[fmt.Sprintf("%s/%s", buy, sell)]; ok {
+		scale := math.Pow10(rateDecimals)
+		return math.Round(scale/rate) / scale, true
+	}
+
+	return 0, false
+}
+
+// Convert returns the given amount, in minor units, converted
+// at the given exchange rate
+func Convert(amount int64, rate string) (int64, error) {
+	value, err := strconv.ParseFloat(rate, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid exchange rate: %s", rate)
+	}
+	return int64(math.Round(float64(amount) * value)), nil
+}
+
+// QuoteAttributes captures the rate we lock for an organisation
+// to sell a currency at, in order to buy another one
+type QuoteAttributes struct {
+	SellCurrency string `json:"sell_currency"`
+	BuyCurrency  string `json:"buy_currency"`
+
+	// The locked rate, the reference of the contract, and the
+	// time the quote can be used until. These are managed by
+	// the server
+	ExchangeRate      string    `json:"exchange_rate,omitempty"`
+	ContractReference string    `json:"contract_reference,omitempty"`
+	CreatedOn         time.Time `json:"created_on"`
+	ExpiresOn         time.Time `json:"expires_on"`
+}
+
+// Validate does semantic validation on the quote attributes
+func (qa *QuoteAttributes) Validate() error {
+	if !currencyRegexp.MatchString(qa.SellCurrency) {
+		return fmt.Errorf("Invalid sell currency: %s", qa.SellCurrency)
+	}
+
+	if !currencyRegexp.MatchString(qa.BuyCurrency) {
+		return fmt.Errorf("Invalid buy currency: %s", qa.BuyCurrency)
+	}
+
+	if qa.SellCurrency == qa.BuyCurrency {
+		return fmt.Errorf("Sell and buy currencies are the same: %s", qa.SellCurrency)
+	}
+
+	return nil
+}
+
+// Quote an exchange rate, locked for a while, that
+// cross-currency payments can be converted at
+type Quote struct {
+	Id           string          `json:"id"`
+	Type         string          `json:"type"`
+	Version      int             `json:"version"`
+	Organisation string          `json:"organisation_id"`
+	Attributes   QuoteAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the quote
+func (q *Quote) Validate() error {
+	if len(strings.TrimSpace(q.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	if q.Type != "Quote" {
+		return fmt.Errorf("Invalid type: %s", q.Type)
+	}
+
+	return q.Attributes.Validate()
+}
+
+// IsExpired returns true if the rate of the
+// quote is no longer locked at the given time
+func (q *Quote) IsExpired(now time.Time) bool {
+	return !now.Before(q.Attributes.ExpiresOn)
+}
+
+// Converts a quote into something that can
+// be saved into the database
+func (q *Quote) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           q.Id,
+		Version:      q.Version,
+		Organisation: q.Organisation,
+	}
+
+	bytes, err := json.Marshal(q.Attributes)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize quote attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into a quote
+func NewQuoteFromRepoItem(item *RepoItem) (*Quote, error) {
+	q := &Quote{
+		Type:         "Quote",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+	}
+
+	var attrs QuoteAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return q, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	q.Attributes = attrs
+
+	return q, nil
+}
+
+// NewQuotesFromRepoItems converts the given slice of repo
+// items to a list of quotes
+func NewQuotesFromRepoItems(items []*RepoItem) ([]*Quote, error) {
+	quotes := []*Quote{}
+	for _, i := range items {
+		q, err := NewQuoteFromRepoItem(i)
+		if err != nil {
+			return quotes, err
+		}
+		quotes = append(quotes, q)
+	}
+
+	return quotes, nil
+}
+
+// Fetch is a convenience function that looks up a quote by
+// id in the given repo. Payments use it in order to check the
+// quotes they are converted at
+func Fetch(repo Repo, id string) (*Quote, error) {
+	found, err := repo.Fetch(&RepoItem{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return NewQuoteFromRepoItem(found)
+}
+
+// QuoteRequest represents a http request that contains
+// a quote in its field 'data'
+type QuoteRequest struct {
+	Quote *Quote `json:"data"`
+}
+
+// QuoteResponse represents a http response that contains
+// a quote in its field 'data' and set of links
+type QuoteResponse struct {
+	Data  *Quote `json:"data"`
+	Links Links  `json:"links"`
+}
+
+// QuotesResponse represents a http response that contains
+// a list of quotes in its field 'data' and a set of links
+type QuotesResponse struct {
+	Data  []*Quote `json:"data"`
+	Links Links    `json:"links"`
+}
@@ -0,0 +1,241 @@
+// fx contains the http routes that quote the exchange rates
+// cross-currency payments are converted at
+package fx
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	quotesLinkPattern string
+	quoteLinkPattern  string
+)
+
+func init() {
+	quotesLinkPattern = "/fx-quotes?%sfrom=%v&to=%v"
+	quoteLinkPattern = "/fx-quotes/%v"
+}
+
+// QuotesService represents a fx quotes service
+// it defines the routes and the repos to operate
+// with. It inherits fields and functions from util.HttpService
+type QuotesService struct {
+	HttpService
+	repo          Repo
+	organisations Repo
+	rates         Rates
+	ttl           time.Duration
+	maxResults    int
+}
+
+// New creates a new QuotesService with the given repos, rate table,
+// base url and maxResults information. Quoted rates are locked for
+// the given ttl
+func New(repo Repo, organisations Repo, rates Rates, ttl time.Duration, baseUrl string, maxResults int) *QuotesService {
+	return &QuotesService{
+		HttpService: HttpService{
+			BaseUrl: baseUrl,
+		},
+		repo:          repo,
+		organisations: organisations,
+		rates:         rates,
+		ttl:           ttl,
+		maxResults:    maxResults,
+	}
+}
+
+// Routes returns a router with all routes
+// supported by this service
+func (s *QuotesService) Routes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Get("/", s.List)
+	router.Post("/", s.Create)
+	router.Get("/{id}", s.Fetch)
+	return router
+}
+
+// List returns a list of quotes, using the same from and to
+// query params semantics as payments. Like payments, they can be
+// filtered by organisation, and principals only see the quotes of
+// the organisations they can access
+func (s *QuotesService) List(w http.ResponseWriter, r *http.Request) {
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	organisation, err := auth.FromRequest(r).Scope(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	repoItems, err := s.repo.Find(RepoFilter{Organisation: organisation}, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	quotes, err := NewQuotesFromRepoItems(repoItems)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	filter := ""
+	if organisation != "" {
+		filter = fmt.Sprintf("organisation_id=%s&", url.QueryEscape(organisation))
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(quotesLinkPattern, filter, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(quotesLinkPattern, filter, to, to+limit))
+
+	if from >= limit {
+		links["prev"] = s.UrlFor(fmt.Sprintf(quotesLinkPattern, filter, from-limit, from))
+	}
+
+	RenderJSON(w, r, http.StatusOK, &QuotesResponse{
+		Data:  quotes,
+		Links: links,
+	})
+}
+
+// Fetch a quote by id. Quotes of organisations the principal
+// cannot access are not found, like their payments
+func (s *QuotesService) Fetch(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	quote, err := Fetch(s.repo, id)
+	if err != nil {
+		if s.repo.IsNotFound(err) {
+			HandleHttpError(w, r, http.StatusNotFound, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	if !auth.FromRequest(r).CanSee(quote.Organisation) {
+		HandleHttpError(w, r, http.StatusNotFound, fmt.Errorf("Quote %s not found", id))
+		return
+	}
+
+	s.render(w, r, http.StatusOK, quote)
+}
+
+// Create a new quote, at the current rate of the currency pair,
+// with a new contract reference. The rate is locked until the quote
+// expires
+func (s *QuotesService) Create(w http.ResponseWriter, r *http.Request) {
+	quote, err := decodeQuote(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.FromRequest(r).CanSee(quote.Organisation) {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Unknown organisation: %s", quote.Organisation))
+		return
+	}
+
+	_, status, err := organisations.Lookup(s.organisations, quote.Organisation)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	err = quote.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	attrs := &quote.Attributes
+	rate, ok := s.rates.Rate(attrs.SellCurrency, attrs.BuyCurrency)
+	if !ok {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("No rate to sell %s for %s", attrs.SellCurrency, attrs.BuyCurrency))
+		return
+	}
+
+	now := time.Now().UTC()
+	attrs.ExchangeRate = strconv.FormatFloat(rate, 'f', -1, 64)
+	attrs.ContractReference = fmt.Sprintf("FX-%s", strings.ToUpper(NewId()[:8]))
+	attrs.CreatedOn = now
+	attrs.ExpiresOn = now.Add(s.ttl)
+
+	repoItem, err := quote.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdItem, err := s.repo.Create(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	quote, err = NewQuoteFromRepoItem(createdItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusCreated, quote)
+}
+
+// page reads the from and to query params, and returns
+// the limit to apply, capped to the maximum number of results
+func (s *QuotesService) page(r *http.Request) (int, int, int, error) {
+	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
+	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
+
+	limit := to - from
+	if limit <= 0 {
+		return from, to, limit, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to)
+	}
+
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	return from, to, limit, nil
+}
+
+// render sends back the given quote, along with its links
+func (s *QuotesService) render(w http.ResponseWriter, r *http.Request, status int, quote *Quote) {
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(quoteLinkPattern, quote.Id))
+
+	RenderJSON(w, r, status, &QuoteResponse{
+		Data:  quote,
+		Links: links,
+	})
+}
+
+// decodeQuote is a convenience function that attempts to
+// decode a quote from the HTTP request body
+func decodeQuote(r *http.Request) (*Quote, error) {
+	decoder := json.NewDecoder(r.Body)
+	var qr QuoteRequest
+	err := decoder.Decode(&qr)
+	if err == nil && qr.Quote == nil {
+		err = fmt.Errorf("No quote data")
+	}
+	return qr.Quote, err
+}
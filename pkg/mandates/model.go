@@ -0,0 +1,242 @@
+package mandates
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The states a mandate can be in. New mandates are pending until
+// the payer's bank confirms them, through AUDDIS. Only active
+// mandates can be collected against
+const (
+	MandatePending   = "pending"
+	MandateActive    = "active"
+	MandateCancelled = "cancelled"
+)
+
+// mandateTransitions are the states a mandate can move to,
+// from each of the states it can be in
+var mandateTransitions = map[string][]string{
+	MandatePending: {MandateActive, MandateCancelled},
+	MandateActive:  {MandateCancelled},
+}
+
+// CancellationReasons are the AUDDIS reason codes a mandate can be
+// cancelled with, either by the payer, their bank, or us, along with
+// their descriptions
+var CancellationReasons = map[string]string{
+	"0": "Instruction cancelled, refer to payer",
+	"1": "Instruction cancelled by payer",
+	"2": "Payer deceased",
+	"3": "Account transferred",
+	"5": "No account",
+	"6": "No instruction",
+	"B": "Account closed",
+	"C": "Account transferred to another bank",
+	"F": "Invalid account type",
+	"G": "Bank will not accept direct debits on account",
+	"H": "Instruction expired",
+	"I": "Payer reference is not unique",
+	"K": "Instruction cancelled by bank",
+	"L": "Incorrect payer account details",
+	"N": "Transaction disallowed at payer branch",
+	"O": "Invalid reference",
+	"P": "Payer name not present",
+}
+
+var (
+	accountNumberRegexp = regexp.MustCompile(`^[0-9]{8}$`)
+	sortCodeRegexp      = regexp.MustCompile(`^[0-9]{6}$`)
+	referenceRegexp     = regexp.MustCompile(`^[A-Za-z0-9 &./-]{6,18}$`)
+)
+
+// MandateAttributes captures the details of a Bacs Direct
+// Debit Instruction, given by a payer to an organisation
+type MandateAttributes struct {
+	// The reference the payer knows the mandate by
+	Reference string `json:"reference"`
+
+	// The payer's name and bank account
+	DebtorName          string `json:"debtor_name"`
+	DebtorAccountNumber string `json:"debtor_account_number"`
+	DebtorBankId        string `json:"debtor_bank_id"`
+
+	// The status of the mandate, and the AUDDIS reason code,
+	// and its description, it was cancelled with. These are
+	// managed by the server
+	Status     string `json:"status,omitempty"`
+	ReasonCode string `json:"reason_code,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+
+	CreatedOn time.Time `json:"created_on"`
+	UpdatedOn time.Time `json:"updated_on"`
+}
+
+// Validate does semantic validation on the mandate attributes
+func (ma *MandateAttributes) Validate() error {
+	if !referenceRegexp.MatchString(ma.Reference) {
+		return fmt.Errorf("Invalid reference: %s", ma.Reference)
+	}
+
+	if len(strings.TrimSpace(ma.DebtorName)) == 0 {
+		return errors.New("Debtor name is empty")
+	}
+
+	if !accountNumberRegexp.MatchString(ma.DebtorAccountNumber) {
+		return fmt.Errorf("Invalid debtor account number: %s", ma.DebtorAccountNumber)
+	}
+
+	if !sortCodeRegexp.MatchString(ma.DebtorBankId) {
+		return fmt.Errorf("Invalid debtor bank id: %s", ma.DebtorBankId)
+	}
+
+	return nil
+}
+
+// Mandate a direct debit mandate, that allows an organisation
+// to collect payments from a payer's account
+type Mandate struct {
+	Id           string            `json:"id"`
+	Type         string            `json:"type"`
+	Version      int               `json:"version"`
+	Organisation string            `json:"organisation_id"`
+	Attributes   MandateAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the mandate
+func (m *Mandate) Validate() error {
+	if len(strings.TrimSpace(m.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	if m.Type != "Mandate" {
+		return fmt.Errorf("Invalid type: %s", m.Type)
+	}
+
+	return m.Attributes.Validate()
+}
+
+// IsActive returns true if payments can be
+// collected against the mandate
+func (m *Mandate) IsActive() bool {
+	return m.Attributes.Status == MandateActive
+}
+
+// CanMoveTo returns true if the mandate
+// can move to the given status
+func (m *Mandate) CanMoveTo(status string) bool {
+	for _, to := range mandateTransitions[m.Attributes.Status] {
+		if to == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if the given bank account
+// is the one of the payer of the mandate
+func (m *Mandate) Matches(accountNumber string, bankId string) bool {
+	return m.Attributes.DebtorAccountNumber == accountNumber &&
+		m.Attributes.DebtorBankId == bankId
+}
+
+// Converts a mandate into something that can
+// be saved into the database
+func (m *Mandate) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           m.Id,
+		Version:      m.Version,
+		Organisation: m.Organisation,
+	}
+
+	bytes, err := json.Marshal(m.Attributes)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize mandate attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into a mandate
+func NewMandateFromRepoItem(item *RepoItem) (*Mandate, error) {
+	m := &Mandate{
+		Type:         "Mandate",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+	}
+
+	var attrs MandateAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return m, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	m.Attributes = attrs
+
+	return m, nil
+}
+
+// NewMandatesFromRepoItems converts the given slice of repo
+// items to a list of mandates
+func NewMandatesFromRepoItems(items []*RepoItem) ([]*Mandate, error) {
+	mandates := []*Mandate{}
+	for _, i := range items {
+		m, err := NewMandateFromRepoItem(i)
+		if err != nil {
+			return mandates, err
+		}
+		mandates = append(mandates, m)
+	}
+
+	return mandates, nil
+}
+
+// Fetch is a convenience function that looks up a mandate
+// by id in the given repo. Other services use it in order to check
+// the mandates their resources refer to
+func Fetch(repo Repo, id string) (*Mandate, error) {
+	found, err := repo.Fetch(&RepoItem{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return NewMandateFromRepoItem(found)
+}
+
+// Cancellation captures why a mandate is cancelled
+type Cancellation struct {
+	ReasonCode string `json:"reason_code"`
+}
+
+// MandateRequest represents a http request that contains
+// a mandate in its field 'data'
+type MandateRequest struct {
+	Mandate *Mandate `json:"data"`
+}
+
+// CancellationRequest represents a http request that contains
+// a cancellation in its field 'data'
+type CancellationRequest struct {
+	Cancellation *Cancellation `json:"data"`
+}
+
+// MandateResponse represents a http response that contains
+// a mandate in its field 'data' and set of links
+type MandateResponse struct {
+	Data  *Mandate `json:"data"`
+	Links Links    `json:"links"`
+}
+
+// MandatesResponse represents a http response that contains
+// a list of mandates in its field 'data' and a set of links
+type MandatesResponse struct {
+	Data  []*Mandate `json:"data"`
+	Links Links      `json:"links"`
+}
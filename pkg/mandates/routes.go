@@ -0,0 +1,312 @@
+// mandates contains the http routes that manage the direct debit
+// mandates organisations collect payments against
+package mandates
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	mandatesLinkPattern string
+	mandateLinkPattern  string
+)
+
+func init() {
+	mandatesLinkPattern = "/mandates?%sfrom=%v&to=%v"
+	mandateLinkPattern = "/mandates/%v"
+}
+
+// MandatesService represents a mandates service
+// it defines the routes and the repos to operate
+// with. It inherits fields and functions from util.HttpService
+type MandatesService struct {
+	HttpService
+	repo          Repo
+	organisations Repo
+	maxResults    int
+}
+
+// New creates a new MandatesService with the given repos, base url
+// and maxResults information. Mandates must belong to one of the
+// organisations in the organisations repo
+func New(repo Repo, organisations Repo, baseUrl string, maxResults int) *MandatesService {
+	return &MandatesService{
+		HttpService: HttpService{
+			BaseUrl: baseUrl,
+		},
+		repo:          repo,
+		organisations: organisations,
+		maxResults:    maxResults,
+	}
+}
+
+// Routes returns a router with all routes
+// supported by this service
+func (s *MandatesService) Routes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Get("/", s.List)
+	router.Post("/", s.Create)
+	router.Get("/{id}", s.Fetch)
+	router.Post("/{id}/activate", s.Activate)
+	router.Post("/{id}/cancel", s.Cancel)
+	return router
+}
+
+// List returns a list of mandates, using the same from and to
+// query params semantics as payments. Like payments, they can be
+// filtered by organisation, and principals only see the mandates of
+// the organisations they can access
+func (s *MandatesService) List(w http.ResponseWriter, r *http.Request) {
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	organisation, err := auth.FromRequest(r).Scope(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	repoItems, err := s.repo.Find(RepoFilter{Organisation: organisation}, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	mandates, err := NewMandatesFromRepoItems(repoItems)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	filter := ""
+	if organisation != "" {
+		filter = fmt.Sprintf("organisation_id=%s&", url.QueryEscape(organisation))
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(mandatesLinkPattern, filter, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(mandatesLinkPattern, filter, to, to+limit))
+
+	if from >= limit {
+		links["prev"] = s.UrlFor(fmt.Sprintf(mandatesLinkPattern, filter, from-limit, from))
+	}
+
+	RenderJSON(w, r, http.StatusOK, &MandatesResponse{
+		Data:  mandates,
+		Links: links,
+	})
+}
+
+// Fetch a mandate by id
+func (s *MandatesService) Fetch(w http.ResponseWriter, r *http.Request) {
+	mandate, status, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, mandate)
+}
+
+// Create a new mandate. New mandates are pending, until
+// the payer's bank confirms them
+func (s *MandatesService) Create(w http.ResponseWriter, r *http.Request) {
+	mandate, err := decodeMandate(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.FromRequest(r).CanSee(mandate.Organisation) {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Unknown organisation: %s", mandate.Organisation))
+		return
+	}
+
+	_, status, err := organisations.Lookup(s.organisations, mandate.Organisation)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	err = mandate.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	attrs := &mandate.Attributes
+	attrs.Status = MandatePending
+	attrs.ReasonCode = ""
+	attrs.Reason = ""
+	attrs.CreatedOn = now
+	attrs.UpdatedOn = now
+
+	repoItem, err := mandate.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdItem, err := s.repo.Create(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	mandate, err = NewMandateFromRepoItem(createdItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusCreated, mandate)
+}
+
+// Activate a pending mandate, once the payer's bank has
+// confirmed it. Payments can then be collected against it
+func (s *MandatesService) Activate(w http.ResponseWriter, r *http.Request) {
+	s.moveTo(w, r, MandateActive, "")
+}
+
+// Cancel a mandate, with one of the AUDDIS reason codes.
+// No more payments can be collected against it
+func (s *MandatesService) Cancel(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	var cr CancellationRequest
+	err := decoder.Decode(&cr)
+	if err == nil && cr.Cancellation == nil {
+		err = fmt.Errorf("No cancellation data")
+	}
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, ok := CancellationReasons[cr.Cancellation.ReasonCode]; !ok {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Invalid reason code: %s", cr.Cancellation.ReasonCode))
+		return
+	}
+
+	s.moveTo(w, r, MandateCancelled, cr.Cancellation.ReasonCode)
+}
+
+// moveTo moves the mandate in the request path to the given status,
+// recording the given reason code, if any. Returns a 409 if the
+// mandate cannot move to that status
+func (s *MandatesService) moveTo(w http.ResponseWriter, r *http.Request, status string, reasonCode string) {
+	mandate, code, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, code, err)
+		return
+	}
+
+	if !mandate.CanMoveTo(status) {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Mandate %s cannot move from %s to %s", mandate.Id, mandate.Attributes.Status, status))
+		return
+	}
+
+	mandate.Attributes.Status = status
+	mandate.Attributes.ReasonCode = reasonCode
+	mandate.Attributes.Reason = CancellationReasons[reasonCode]
+	mandate.Attributes.UpdatedOn = time.Now().UTC()
+
+	repoItem, err := mandate.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	updatedItem, err := s.repo.Update(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	mandate, err = NewMandateFromRepoItem(updatedItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, mandate)
+}
+
+// fetch looks up a mandate by id. Mandates of organisations the
+// principal of the given request cannot access are not found, like
+// their payments. Returns the http status code to respond with on error
+func (s *MandatesService) fetch(r *http.Request, id string) (*Mandate, int, error) {
+	mandate, err := Fetch(s.repo, id)
+	if err != nil {
+		if s.repo.IsNotFound(err) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !auth.FromRequest(r).CanSee(mandate.Organisation) {
+		return nil, http.StatusNotFound, fmt.Errorf("Mandate %s not found", id)
+	}
+
+	return mandate, http.StatusOK, nil
+}
+
+// page reads the from and to query params, and returns
+// the limit to apply, capped to the maximum number of results
+func (s *MandatesService) page(r *http.Request) (int, int, int, error) {
+	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
+	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
+
+	limit := to - from
+	if limit <= 0 {
+		return from, to, limit, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to)
+	}
+
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	return from, to, limit, nil
+}
+
+// render sends back the given mandate, along with its links
+func (s *MandatesService) render(w http.ResponseWriter, r *http.Request, status int, mandate *Mandate) {
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(mandateLinkPattern, mandate.Id))
+
+	RenderJSON(w, r, status, &MandateResponse{
+		Data:  mandate,
+		Links: links,
+	})
+}
+
+// decodeMandate is a convenience function that attempts to
+// decode a mandate from the HTTP request body
+func decodeMandate(r *http.Request) (*Mandate, error) {
+	decoder := json.NewDecoder(r.Body)
+	var mr MandateRequest
+	err := decoder.Decode(&mr)
+	if err == nil && mr.Mandate == nil {
+		err = fmt.Errorf("No mandate data")
+	}
+	return mr.Mandate, err
+}
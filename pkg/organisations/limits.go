@@ -0,0 +1,304 @@
+package organisations
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// How many times the usage of an organisation is read and written
+// again, when someone else changed it in between
+const usageAttempts = 10
+
+// The layouts the days and months usage is tracked for are keyed by
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// Usage captures the total amount, per currency, and the number, of
+// the payments an organisation created over a period (eg. 2019-04-01,
+// 2019-04)
+type Usage struct {
+	Period  string        `json:"period"`
+	Amounts []*UsedAmount `json:"amounts"`
+	Count   int           `json:"count"`
+}
+
+// UsedAmount captures the total amount of the
+// payments of a period in a single currency
+type UsedAmount struct {
+	Currency string `json:"currency,omitempty"`
+	Amount   string `json:"amount"`
+}
+
+// Usages captures what an organisation has used
+// of its limits, today and this month
+type Usages struct {
+	Daily   Usage `json:"daily"`
+	Monthly Usage `json:"monthly"`
+}
+
+// LimitExceededError is returned when a payment would take an
+// organisation over one of its limits
+type LimitExceededError struct {
+	Organisation string
+	Limit        string
+	Value        string
+}
+
+// Error describes the limit exceeded
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("Payment exceeds the %s of %s of organisation %s", e.Limit, e.Value, e.Organisation)
+}
+
+// IsLimitExceeded returns true if the given error
+// was caused by a payment over one of the limits
+func IsLimitExceeded(err error) bool {
+	_, ok := errors.Cause(err).(*LimitExceededError)
+	return ok
+}
+
+// Limits keeps track of the payments each organisation creates,
+// per day and per month, and checks them against the limits in the
+// settings of the organisation. The usage of an organisation is a
+// single versioned repo item, so that concurrent payments cannot
+// both take the organisation over its limits
+type Limits struct {
+	repo Repo
+}
+
+// NewLimits returns new limits, that keep
+// the usage of organisations in the given repo
+func NewLimits(repo Repo) *Limits {
+	return &Limits{repo: repo}
+}
+
+// Reserve counts a new payment of the given amount, in minor units,
+// and currency, against the limits of the given organisation, at the
+// given time. Returns a LimitExceededError, and counts nothing, if the
+// payment would take the organisation over any of its limits
+func (l *Limits) Reserve(org *Organisation, currency string, amount int64, at time.Time) error {
+	if amount <= 0 {
+		return fmt.Errorf("Payment amount must be positive: %s", FormatAmount(amount))
+	}
+	return l.add(org, currency, amount, amount, 1, at)
+}
+
+// Release gives back a payment of the given amount and currency counted
+// at the given time, when it could not be created after all
+func (l *Limits) Release(org *Organisation, currency string, amount int64, at time.Time) error {
+	return l.add(org, currency, 0, -amount, -1, at)
+}
+
+// Adjust counts the increase in the amount of an existing payment, from
+// one amount to another, in the given currency, against the limits of
+// the given organisation, at the given time. Decreases are not given
+// back, since the payment may have been counted on another day or month
+func (l *Limits) Adjust(org *Organisation, currency string, from int64, to int64, at time.Time) error {
+	if to <= from {
+		return nil
+	}
+	return l.add(org, currency, to, to-from, 0, at)
+}
+
+// Unadjust gives back the increase in the amount of a payment counted
+// at the given time, when it could not be updated after all
+func (l *Limits) Unadjust(org *Organisation, currency string, from int64, to int64, at time.Time) error {
+	if to <= from {
+		return nil
+	}
+	return l.add(org, currency, 0, from-to, 0, at)
+}
+
+// Usage returns what the given organisation has used
+// of its limits, on the day and month of the given time
+func (l *Limits) Usage(org string, at time.Time) (*Usages, error) {
+	usages, _, err := l.fetch(org)
+	if err != nil {
+		return nil, err
+	}
+
+	usages.Daily.roll(at.UTC().Format(dayLayout))
+	usages.Monthly.roll(at.UTC().Format(monthLayout))
+	return usages, nil
+}
+
+// add adds the given amount and count to the usage of the organisation,
+// in the given currency, for the day and month of the given time,
+// provided neither a payment of the given amount nor the new usage are
+// over the limits of the organisation. Decreases are never checked
+func (l *Limits) add(org *Organisation, currency string, payment int64, amount int64, count int, at time.Time) error {
+	check := amount > 0 || count > 0
+	settings := org.Attributes.Settings
+
+	if check && payment <= 0 {
+		return fmt.Errorf("Payment amount must be positive: %s", FormatAmount(payment))
+	}
+
+	if check && settings.MaxPaymentAmount != "" {
+		// Limits were validated along with the settings
+		max, _ := ParseAmount(settings.MaxPaymentAmount)
+		if payment > max {
+			return &LimitExceededError{Organisation: org.Id, Limit: "maximum payment amount", Value: settings.MaxPaymentAmount}
+		}
+	}
+
+	for attempt := 0; attempt < usageAttempts; attempt++ {
+		usages, version, err := l.fetch(org.Id)
+		if err != nil {
+			return err
+		}
+
+		// Payments are only counted against the current day and
+		// month, never against those already rolled over
+		if usages.Daily.roll(at.UTC().Format(dayLayout)) {
+			if err := usages.Daily.add(currency, amount, count); err != nil {
+				return err
+			}
+		}
+		if usages.Monthly.roll(at.UTC().Format(monthLayout)) {
+			if err := usages.Monthly.add(currency, amount, count); err != nil {
+				return err
+			}
+		}
+
+		if check {
+			if err := usages.check(org); err != nil {
+				return err
+			}
+		}
+
+		bytes, err := json.Marshal(usages)
+		if err != nil {
+			return errors.Wrap(err, "Unable to serialize usage")
+		}
+
+		item := &RepoItem{
+			Id:           org.Id,
+			Version:      version,
+			Organisation: org.Id,
+			Attributes:   string(bytes),
+		}
+
+		if version < 0 {
+			_, err = l.repo.Create(item)
+		} else {
+			_, err = l.repo.Update(item)
+		}
+
+		if err == nil || !l.repo.IsConflict(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("Unable to update the usage of organisation %s, too many concurrent payments", org.Id)
+}
+
+// fetch returns the usage of the given organisation, and its version.
+// Organisations with no usage yet have version -1
+func (l *Limits) fetch(org string) (*Usages, int, error) {
+	usages := &Usages{}
+	found, err := l.repo.Fetch(&RepoItem{Id: org})
+	if err != nil {
+		if l.repo.IsNotFound(err) {
+			return usages, -1, nil
+		}
+		return nil, 0, err
+	}
+
+	err = json.NewDecoder(strings.NewReader(found.Attributes)).Decode(usages)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "Error parsing usage")
+	}
+
+	return usages, found.Version, nil
+}
+
+// roll starts afresh the usage of a past period, when the given
+// one begins. Returns false if the usage is of a later period
+func (u *Usage) roll(period string) bool {
+	if u.Period > period {
+		return false
+	}
+
+	if u.Period != period {
+		*u = Usage{Period: period, Amounts: []*UsedAmount{}}
+	}
+	return true
+}
+
+// check returns an error if the usage is over any of the limits of
+// the given organisation. Amount limits apply to each currency
+func (u *Usages) check(org *Organisation) error {
+	settings := org.Attributes.Settings
+	for _, limit := range []struct {
+		name  string
+		value string
+		usage *Usage
+	}{
+		{"daily limit", settings.DailyLimit, &u.Daily},
+		{"monthly limit", settings.MonthlyLimit, &u.Monthly},
+	} {
+		if limit.value == "" {
+			continue
+		}
+
+		max, _ := ParseAmount(limit.value)
+		for _, a := range limit.usage.Amounts {
+			used, _ := ParseAmount(a.Amount)
+			if used > max {
+				return &LimitExceededError{Organisation: org.Id, Limit: limit.name, Value: limit.value}
+			}
+		}
+	}
+
+	if settings.DailyCountLimit > 0 && u.Daily.Count > settings.DailyCountLimit {
+		return &LimitExceededError{Organisation: org.Id, Limit: "daily count limit", Value: fmt.Sprint(settings.DailyCountLimit)}
+	}
+
+	if settings.MonthlyCountLimit > 0 && u.Monthly.Count > settings.MonthlyCountLimit {
+		return &LimitExceededError{Organisation: org.Id, Limit: "monthly count limit", Value: fmt.Sprint(settings.MonthlyCountLimit)}
+	}
+
+	return nil
+}
+
+// add adds the given amount, in minor units, of the given currency,
+// and count to the usage. Only what was added can be taken away, so
+// usage can never go below zero
+func (u *Usage) add(currency string, amount int64, count int) error {
+	var found *UsedAmount
+	for _, a := range u.Amounts {
+		if a.Currency == currency {
+			found = a
+		}
+	}
+
+	if found == nil {
+		found = &UsedAmount{Currency: currency, Amount: FormatAmount(0)}
+		u.Amounts = append(u.Amounts, found)
+	}
+
+	used, err := ParseAmount(found.Amount)
+	if err != nil {
+		return errors.Wrap(err, "Invalid usage amount")
+	}
+
+	if amount > math.MaxInt64-used {
+		return fmt.Errorf("Usage of %s in %s is too large", u.Period, currency)
+	}
+
+	used += amount
+	u.Count += count
+	if used < 0 || u.Count < 0 {
+		return fmt.Errorf("Usage of %s in %s cannot go below zero", u.Period, currency)
+	}
+
+	found.Amount = FormatAmount(used)
+	return nil
+}
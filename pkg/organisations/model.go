@@ -0,0 +1,396 @@
+package organisations
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The states an organisation can be in. Only active
+// organisations can own new payments
+const (
+	OrganisationActive   = "active"
+	OrganisationInactive = "inactive"
+)
+
+// What to do with payments whose processing date is not a
+// business day of their scheme. By default, dates are rolled
+// forward to the next business day
+const (
+	ProcessingDateRollForward = "roll_forward"
+	ProcessingDateReject      = "reject"
+)
+
+// What to do with payments that look like duplicates of a
+// recent one. By default, duplicates are not looked for
+const (
+	DuplicatesWarn   = "warn"
+	DuplicatesReject = "reject"
+)
+
+// What to do with UK payments whose beneficiary name does not
+// match the name its account is registered with. By default,
+// payee names are not checked
+const (
+	PayeeCheckWarn   = "warn"
+	PayeeCheckReject = "reject"
+)
+
+// DefaultDuplicateWindow is how far back we look for
+// duplicates, unless the organisation says otherwise
+const DefaultDuplicateWindow = 10 * time.Minute
+
+// Settings captures the organisation wide preferences and
+// constraints that apply to its payments. All settings
+// are optional
+type Settings struct {
+	// The scheme used by payments that do not specify one
+	// (eg. FPS, BACS, SEPA)
+	DefaultScheme string `json:"default_scheme,omitempty"`
+
+	// The ISO 4217 currencies payments can be made in. An
+	// empty list means any currency
+	AllowedCurrencies []string `json:"allowed_currencies,omitempty"`
+
+	// The maximum amount a single day, or month, of payments
+	// can add up to, and the maximum number of them
+	DailyLimit        string `json:"daily_limit,omitempty"`
+	MonthlyLimit      string `json:"monthly_limit,omitempty"`
+	DailyCountLimit   int    `json:"daily_count_limit,omitempty"`
+	MonthlyCountLimit int    `json:"monthly_count_limit,omitempty"`
+
+	// The maximum amount of a single payment
+	MaxPaymentAmount string `json:"max_payment_amount,omitempty"`
+
+	// Either roll_forward or reject
+	ProcessingDatePolicy string `json:"processing_date_policy,omitempty"`
+
+	// Either warn or reject, and how far back to look for
+	// duplicates (eg. 5m)
+	DuplicatePolicy string `json:"duplicate_policy,omitempty"`
+	DuplicateWindow string `json:"duplicate_window,omitempty"`
+
+	// Either warn or reject
+	PayeeCheckPolicy string `json:"payee_check_policy,omitempty"`
+
+	// The amount above which payments need to be approved
+	// by a second user before they can be submitted
+	ApprovalThreshold string `json:"approval_threshold,omitempty"`
+}
+
+// Validate does semantic validation on the organisation settings
+func (s *Settings) Validate() error {
+	for _, c := range s.AllowedCurrencies {
+		if len(c) != 3 || strings.ToUpper(c) != c {
+			return fmt.Errorf("Invalid currency: %s", c)
+		}
+	}
+
+	for _, limit := range []struct {
+		name  string
+		value string
+	}{
+		{"daily limit", s.DailyLimit},
+		{"monthly limit", s.MonthlyLimit},
+		{"maximum payment amount", s.MaxPaymentAmount},
+	} {
+		if limit.value == "" {
+			continue
+		}
+
+		value, err := ParseAmount(limit.value)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid %s", limit.name)
+		}
+
+		if value <= 0 {
+			return fmt.Errorf("The %s must be positive", limit.name)
+		}
+	}
+
+	if s.DailyCountLimit < 0 || s.MonthlyCountLimit < 0 {
+		return errors.New("Count limits cannot be negative")
+	}
+
+	switch s.ProcessingDatePolicy {
+	case "", ProcessingDateRollForward, ProcessingDateReject:
+	default:
+		return fmt.Errorf("Invalid processing date policy: %s", s.ProcessingDatePolicy)
+	}
+
+	switch s.DuplicatePolicy {
+	case "", DuplicatesWarn, DuplicatesReject:
+	default:
+		return fmt.Errorf("Invalid duplicate policy: %s", s.DuplicatePolicy)
+	}
+
+	if s.DuplicateWindow != "" {
+		window, err := time.ParseDuration(s.DuplicateWindow)
+		if err != nil {
+			return errors.Wrap(err, "Invalid duplicate window")
+		}
+
+		if window <= 0 {
+			return errors.New("Duplicate window must be positive")
+		}
+	}
+
+	switch s.PayeeCheckPolicy {
+	case "", PayeeCheckWarn, PayeeCheckReject:
+	default:
+		return fmt.Errorf("Invalid payee check policy: %s", s.PayeeCheckPolicy)
+	}
+
+	if s.ApprovalThreshold != "" {
+		threshold, err := ParseAmount(s.ApprovalThreshold)
+		if err != nil {
+			return errors.Wrap(err, "Invalid approval threshold")
+		}
+
+		if threshold < 0 {
+			return errors.New("Approval threshold cannot be negative")
+		}
+	}
+
+	return nil
+}
+
+// ChecksDuplicates returns true if payments are
+// checked against the recent ones, for duplicates
+func (s *Settings) ChecksDuplicates() bool {
+	return s.DuplicatePolicy != ""
+}
+
+// RejectsDuplicates returns true if duplicate
+// payments are rejected, instead of only flagged
+func (s *Settings) RejectsDuplicates() bool {
+	return s.DuplicatePolicy == DuplicatesReject
+}
+
+// DuplicatesWithin returns how far back we look for duplicates
+func (s *Settings) DuplicatesWithin() time.Duration {
+	if s.DuplicateWindow == "" {
+		return DefaultDuplicateWindow
+	}
+
+	// The window was validated along with the settings
+	window, _ := time.ParseDuration(s.DuplicateWindow)
+	return window
+}
+
+// ChecksPayees returns true if the beneficiary names of UK
+// payments are checked against their registered account names
+func (s *Settings) ChecksPayees() bool {
+	return s.PayeeCheckPolicy != ""
+}
+
+// RejectsPayeeMismatches returns true if UK payments whose
+// beneficiary name is not a match are rejected, instead of
+// only flagged
+func (s *Settings) RejectsPayeeMismatches() bool {
+	return s.PayeeCheckPolicy == PayeeCheckReject
+}
+
+// RequiresApproval returns true if payments of the given
+// amount, in minor units, need to be approved by a second user
+func (s *Settings) RequiresApproval(amount int64) bool {
+	if s.ApprovalThreshold == "" {
+		return false
+	}
+
+	// The threshold was validated along with the settings
+	threshold, _ := ParseAmount(s.ApprovalThreshold)
+	return amount > threshold
+}
+
+// RejectsNonProcessingDays returns true if payments whose processing
+// date is not a business day are rejected, instead of rolled forward
+func (s *Settings) RejectsNonProcessingDays() bool {
+	return s.ProcessingDatePolicy == ProcessingDateReject
+}
+
+// AllowsCurrency returns true if payments can be made
+// in the given currency
+func (s *Settings) AllowsCurrency(currency string) bool {
+	if len(s.AllowedCurrencies) == 0 {
+		return true
+	}
+
+	for _, c := range s.AllowedCurrencies {
+		if c == currency {
+			return true
+		}
+	}
+
+	return false
+}
+
+// OrganisationAttributes captures the details of an organisation
+type OrganisationAttributes struct {
+	Name     string   `json:"name"`
+	Status   string   `json:"status"`
+	Settings Settings `json:"settings"`
+
+	// What the organisation has used of its limits, today
+	// and this month. This is managed by the server
+	Usage *Usages `json:"usage,omitempty"`
+}
+
+// Validate does semantic validation on the organisation attributes
+func (oa *OrganisationAttributes) Validate() error {
+	if len(strings.TrimSpace(oa.Name)) == 0 {
+		return errors.New("Name is empty")
+	}
+
+	if oa.Status != OrganisationActive && oa.Status != OrganisationInactive {
+		return fmt.Errorf("Invalid status: %s", oa.Status)
+	}
+
+	return oa.Settings.Validate()
+}
+
+// Organisation an organisation, owner of payments
+type Organisation struct {
+	Id         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Version    int                    `json:"version"`
+	Attributes OrganisationAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the organisation
+func (o *Organisation) Validate() error {
+
+	// check the id is not empty
+	if len(strings.TrimSpace(o.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	// check the type
+	if o.Type != "Organisation" {
+		return fmt.Errorf("Invalid type: %s", o.Type)
+	}
+
+	// check the attributes
+	return o.Attributes.Validate()
+}
+
+// IsActive returns true if the organisation can own
+// new payments
+func (o *Organisation) IsActive() bool {
+	return o.Attributes.Status == OrganisationActive
+}
+
+// Converts an organisation into something that can be saved
+// into the database. Organisations own themselves. The usage
+// is left out, as it is tracked by the limits
+func (o *Organisation) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           o.Id,
+		Version:      o.Version,
+		Organisation: o.Id,
+	}
+
+	attrs := o.Attributes
+	attrs.Usage = nil
+	bytes, err := json.Marshal(attrs)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize organisation attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into an organisation
+func NewOrganisationFromRepoItem(item *RepoItem) (*Organisation, error) {
+	o := &Organisation{
+		Type:    "Organisation",
+		Id:      item.Id,
+		Version: item.Version,
+	}
+
+	var attrs OrganisationAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return o, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	o.Attributes = attrs
+
+	return o, nil
+}
+
+// NewOrganisationsFromRepoItems converts the given slice of repo
+// items to a list of organisations
+func NewOrganisationsFromRepoItems(items []*RepoItem) ([]*Organisation, error) {
+	organisations := []*Organisation{}
+	for _, i := range items {
+		o, err := NewOrganisationFromRepoItem(i)
+		if err != nil {
+			return organisations, err
+		}
+		organisations = append(organisations, o)
+	}
+
+	return organisations, nil
+}
+
+// Fetch is a convenience function that looks up an organisation
+// by id in the given repo. Other services use it in order to check
+// the organisations their resources belong to
+func Fetch(repo Repo, id string) (*Organisation, error) {
+	found, err := repo.Fetch(&RepoItem{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return NewOrganisationFromRepoItem(found)
+}
+
+// Lookup is a convenience function used by other services in order to
+// check the organisation that owns one of their resources. Resources can
+// only belong to existing, active organisations. Returns the http status
+// code to respond with if the organisation cannot be used
+func Lookup(repo Repo, id string) (*Organisation, int, error) {
+	if len(strings.TrimSpace(id)) == 0 {
+		return nil, http.StatusBadRequest, errors.New("Organisation is empty")
+	}
+
+	org, err := Fetch(repo, id)
+	if err != nil {
+		if repo.IsNotFound(err) {
+			return nil, http.StatusBadRequest, fmt.Errorf("Unknown organisation: %s", id)
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !org.IsActive() {
+		return nil, http.StatusBadRequest, fmt.Errorf("Organisation is not active: %s", id)
+	}
+
+	return org, http.StatusOK, nil
+}
+
+// OrganisationRequest represents a http request that contains
+// an organisation in its field 'data'
+type OrganisationRequest struct {
+	Organisation *Organisation `json:"data"`
+}
+
+// OrganisationResponse represents a http response that contains
+// an organisation in its field 'data' and set of links
+type OrganisationResponse struct {
+	Data  *Organisation `json:"data"`
+	Links Links         `json:"links"`
+}
+
+// OrganisationsResponse represents a http response that contains
+// a list of organisations in its field 'data' and a set of links
+type OrganisationsResponse struct {
+	Data  []*Organisation `json:"data"`
+	Links Links           `json:"links"`
+}
@@ -0,0 +1,328 @@
+// organisations contains the http routes that perform CRUD
+// operations on organisations, the owners of payments
+package organisations
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	organisationsLinkPattern string
+	organisationLinkPattern  string
+)
+
+func init() {
+	organisationsLinkPattern = "/organisations?%sfrom=%v&to=%v"
+	organisationLinkPattern = "/organisations/%v"
+}
+
+// OrganisationsService represents an organisations service
+// it defines the routes and the repo to operate
+// with. It inherits fields and functions from util.HttpService
+type OrganisationsService struct {
+	HttpService
+	repo       Repo
+	limits     *Limits
+	maxResults int
+}
+
+// New creates a new OrganisationsService with the given repo,
+// limits, base url and maxResults information
+func New(repo Repo, limits *Limits, baseUrl string, maxResults int) *OrganisationsService {
+	return &OrganisationsService{
+		HttpService: HttpService{
+			BaseUrl: baseUrl,
+		},
+		repo:       repo,
+		limits:     limits,
+		maxResults: maxResults,
+	}
+}
+
+// Routes returns a router with all routes
+// supported by this service. The settings of an organisation,
+// such as its limits, can only be changed with the admin
+// permission
+func (s *OrganisationsService) Routes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Get("/", s.List)
+	router.Get("/{id}", s.Fetch)
+
+	admin := router.With(auth.Require(auth.PermissionAdmin))
+	admin.Post("/", s.Create)
+	admin.Put("/{id}", s.Update)
+	admin.Delete("/{id}", s.Delete)
+	return router
+}
+
+// List returns a list of organisations, using the same from and to
+// query params semantics as payments. Like payments, principals only
+// see the organisations they can access
+func (s *OrganisationsService) List(w http.ResponseWriter, r *http.Request) {
+	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
+	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
+
+	limit := to - from
+	if limit <= 0 {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to))
+		return
+	}
+
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	organisation, err := auth.FromRequest(r).Scope(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	repoItems, err := s.repo.Find(RepoFilter{Organisation: organisation}, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	organisations, err := NewOrganisationsFromRepoItems(repoItems)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, o := range organisations {
+		if err := s.withUsage(o); err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	filter := ""
+	if organisation != "" {
+		filter = fmt.Sprintf("organisation_id=%s&", url.QueryEscape(organisation))
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(organisationsLinkPattern, filter, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(organisationsLinkPattern, filter, to, to+limit))
+
+	if from >= limit {
+		links["prev"] = s.UrlFor(fmt.Sprintf(organisationsLinkPattern, filter, from-limit, from))
+	}
+
+	RenderJSON(w, r, http.StatusOK, &OrganisationsResponse{
+		Data:  organisations,
+		Links: links,
+	})
+}
+
+// Fetch an organisation by id, along with its usage
+func (s *OrganisationsService) Fetch(w http.ResponseWriter, r *http.Request) {
+	organisation, status, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, organisation)
+}
+
+// Create a new organisation
+func (s *OrganisationsService) Create(w http.ResponseWriter, r *http.Request) {
+	organisation, err := decodeOrganisation(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if p := auth.FromRequest(r); p != nil && !p.CanAccess(organisation.Id) {
+		HandleHttpError(w, r, http.StatusForbidden, fmt.Errorf("Principal %s cannot create organisation %s", p.Id, organisation.Id))
+		return
+	}
+
+	err = organisation.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	repoItem, err := organisation.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdItem, err := s.repo.Create(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	organisation, err = NewOrganisationFromRepoItem(createdItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusCreated, organisation)
+}
+
+// Update an existing organisation. Deactivating an organisation
+// prevents new payments from being made on its behalf
+func (s *OrganisationsService) Update(w http.ResponseWriter, r *http.Request) {
+	organisation, err := decodeOrganisation(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	err = organisation.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id != organisation.Id {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Organisation id mismatch: %s", organisation.Id))
+		return
+	}
+
+	if _, status, err := s.fetch(r, id); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	repoItem, err := organisation.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	updatedItem, err := s.repo.Update(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	organisation, err = NewOrganisationFromRepoItem(updatedItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, organisation)
+}
+
+// Delete an organisation by id. Existing payments are kept, but
+// no new payments can be made on behalf of the organisation
+func (s *OrganisationsService) Delete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	versionQP := strings.TrimSpace(r.URL.Query().Get("version"))
+	version, err := strconv.Atoi(versionQP)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, status, err := s.fetch(r, id); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	err = s.repo.Delete(&RepoItem{Id: id, Version: version})
+	if err != nil {
+		errorCode := http.StatusInternalServerError
+		if s.repo.IsNotFound(err) || s.repo.IsConflict(err) {
+			errorCode = http.StatusConflict
+		}
+		HandleHttpError(w, r, errorCode, err)
+		return
+	}
+
+	RenderNoContent(w, r)
+}
+
+// fetch looks up an organisation by id. Organisations the principal
+// of the given request cannot access are not found, like their
+// payments. Returns the http status code to respond with on error
+func (s *OrganisationsService) fetch(r *http.Request, id string) (*Organisation, int, error) {
+	organisation, err := Fetch(s.repo, id)
+	if err != nil {
+		if s.repo.IsNotFound(err) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !auth.FromRequest(r).CanSee(id) {
+		return nil, http.StatusNotFound, fmt.Errorf("Organisation %s not found", id)
+	}
+
+	return organisation, http.StatusOK, nil
+}
+
+// render sends back the given organisation, along with
+// its usage and links
+func (s *OrganisationsService) render(w http.ResponseWriter, r *http.Request, status int, organisation *Organisation) {
+	if err := s.withUsage(organisation); err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(organisationLinkPattern, organisation.Id))
+
+	RenderJSON(w, r, status, &OrganisationResponse{
+		Data:  organisation,
+		Links: links,
+	})
+}
+
+// withUsage sets what the organisation has used
+// of its limits, today and this month
+func (s *OrganisationsService) withUsage(organisation *Organisation) error {
+	usage, err := s.limits.Usage(organisation.Id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	organisation.Attributes.Usage = usage
+	return nil
+}
+
+// decodeOrganisation is a convenience function that attempts to
+// decode an organisation from the HTTP request body. Organisations
+// are active, unless said otherwise
+func decodeOrganisation(r *http.Request) (*Organisation, error) {
+	decoder := json.NewDecoder(r.Body)
+	var or OrganisationRequest
+	err := decoder.Decode(&or)
+	if err == nil && or.Organisation == nil {
+		err = fmt.Errorf("No organisation data")
+	}
+
+	if err == nil && or.Organisation.Attributes.Status == "" {
+		or.Organisation.Attributes.Status = OrganisationActive
+	}
+
+	return or.Organisation, err
+}
@@ -0,0 +1,159 @@
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/events"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"io"
+	"net/http"
+	"time"
+)
+
+// The states the approval of a payment can be in
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// Approval captures the request for a second user to approve a
+// payment above the approval threshold of its organisation, and the
+// decision they took
+type Approval struct {
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by,omitempty"`
+	RequestedOn time.Time  `json:"requested_on"`
+	DecidedBy   string     `json:"decided_by,omitempty"`
+	DecidedOn   *time.Time `json:"decided_on,omitempty"`
+	Comment     string     `json:"comment,omitempty"`
+}
+
+// ApprovalDecision captures the comment an approver
+// can leave along with their decision
+type ApprovalDecision struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+// ApprovalDecisionRequest represents a http request that
+// contains an approval decision in its field 'data'
+type ApprovalDecisionRequest struct {
+	Decision *ApprovalDecision `json:"data"`
+}
+
+// Approve a payment awaiting approval, on behalf of the user the
+// request is authenticated as. Payments cannot be approved by the
+// user they were created or last changed by
+func (s *PaymentsService) Approve(w http.ResponseWriter, r *http.Request) {
+	s.decide(w, r, ApprovalApproved)
+}
+
+// Reject a payment awaiting approval, on behalf of the user the
+// request is authenticated as. Rejected payments are kept, but can
+// no longer be changed, deleted or submitted
+func (s *PaymentsService) Reject(w http.ResponseWriter, r *http.Request) {
+	s.decide(w, r, ApprovalRejected)
+}
+
+// decide moves the approval of the payment in the request path to
+// the given status, on behalf of the user the request is
+// authenticated as
+func (s *PaymentsService) decide(w http.ResponseWriter, r *http.Request, status string) {
+	var dr ApprovalDecisionRequest
+	err := json.NewDecoder(r.Body).Decode(&dr)
+	if err != nil && err != io.EOF {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	comment := ""
+	if dr.Decision != nil {
+		comment = dr.Decision.Comment
+	}
+
+	// Approvers have to authenticate as themselves. Clients acting on
+	// behalf of their users, or anonymous requests, could tell any
+	// user in the user header
+	user := auth.AuthenticatedUser(r)
+	if user == "" {
+		HandleHttpError(w, r, http.StatusForbidden, errors.New("Payments can only be approved by authenticated users"))
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	p, code, err := s.fetchPayment(id)
+	if err != nil {
+		HandleHttpError(w, r, code, err)
+		return
+	}
+
+	approval := p.Attributes.Approval
+	if approval == nil || approval.Status != ApprovalPending || p.IsRejected() {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Payment %s is not awaiting approval", id))
+		return
+	}
+
+	if user == approval.RequestedBy || user == p.Attributes.CreatedBy {
+		HandleHttpError(w, r, http.StatusForbidden, fmt.Errorf("Payment %s cannot be approved by %s, who requested it", id, user))
+		return
+	}
+
+	now := time.Now().UTC()
+	approval.Status = status
+	approval.DecidedBy = user
+	approval.DecidedOn = &now
+	approval.Comment = comment
+
+	eventType := events.PaymentApproved
+	if status == ApprovalRejected {
+		p.Attributes.Status = StatusRejected
+		eventType = events.PaymentRejected
+	}
+
+	if code, err := s.updateWithEvent(eventType, p); err != nil {
+		HandleHttpError(w, r, code, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id))
+	s.withRelatedLinks(links, p)
+
+	RenderJSON(w, r, http.StatusOK, &PaymentResponse{
+		Data:  p,
+		Links: links,
+	})
+}
+
+// withApproval requests the approval of the given payment, on behalf
+// of the given authenticated user, if its amount is above the approval
+// threshold of its organisation. The user is required, so that they
+// cannot approve the payment themselves, unless the payment was created
+// from a schedule. Returns the http status code to respond with on error
+func (s *PaymentsService) withApproval(p *Payment, settings organisations.Settings, user string) (int, error) {
+	amount, err := ParseAmount(p.Attributes.Amount)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if !settings.RequiresApproval(amount) {
+		p.Attributes.Approval = nil
+		return http.StatusOK, nil
+	}
+
+	if user == "" && p.Attributes.Schedule == "" {
+		return http.StatusForbidden, fmt.Errorf("Payments above %s have to be made by an authenticated user, to be approved by another one", settings.ApprovalThreshold)
+	}
+
+	p.Attributes.Approval = &Approval{
+		Status:      ApprovalPending,
+		RequestedBy: user,
+		RequestedOn: time.Now().UTC(),
+	}
+
+	return http.StatusOK, nil
+}
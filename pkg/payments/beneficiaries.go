@@ -0,0 +1,106 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/beneficiaries"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// withBeneficiary expands the saved beneficiary the payment refers
+// to, if any, into its beneficiary party. The beneficiary must belong
+// to the organisation of the payment. Returns the http status code to
+// respond with on error
+func (s *PaymentsService) withBeneficiary(p *Payment) (int, error) {
+	if p.Attributes.Beneficiary == "" {
+		return http.StatusOK, nil
+	}
+
+	beneficiary, err := beneficiaries.Fetch(s.beneficiaries, p.Attributes.Beneficiary)
+	if err != nil {
+		if s.beneficiaries.IsNotFound(err) {
+			return http.StatusBadRequest, fmt.Errorf("Unknown beneficiary: %s", p.Attributes.Beneficiary)
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	if beneficiary.Organisation != p.Organisation {
+		return http.StatusBadRequest, fmt.Errorf("Beneficiary %s does not belong to organisation %s", beneficiary.Id, p.Organisation)
+	}
+
+	p.Attributes.BeneficiaryParty = &Party{
+		Name:          beneficiary.Attributes.Name,
+		Address:       beneficiary.Attributes.Address,
+		Country:       beneficiary.Attributes.Country,
+		AccountNumber: beneficiary.Attributes.AccountNumber,
+		BankId:        beneficiary.Attributes.BankId,
+	}
+
+	return http.StatusOK, nil
+}
+
+// withNewBeneficiary flags the payment if its organisation never paid
+// the bank account of its beneficiary before. A payment stays new to
+// its beneficiary if it is the first one that paid it. Returns the
+// http status code to respond with on error
+func (s *PaymentsService) withNewBeneficiary(p *Payment) (int, error) {
+	p.Attributes.NewBeneficiary = false
+	if p.Attributes.BeneficiaryParty == nil {
+		return http.StatusOK, nil
+	}
+
+	found, err := s.payees.Fetch(&RepoItem{Id: p.payee()})
+	if err != nil {
+		if s.payees.IsNotFound(err) {
+			p.Attributes.NewBeneficiary = true
+			return http.StatusOK, nil
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	var payee Payee
+	if err := json.NewDecoder(strings.NewReader(found.Attributes)).Decode(&payee); err != nil {
+		return http.StatusInternalServerError, errors.Wrap(err, "Error parsing payee")
+	}
+
+	p.Attributes.NewBeneficiary = payee.Payment == p.Id
+	return http.StatusOK, nil
+}
+
+// withPayee remembers the bank account the given payment is made to,
+// as paid by its organisation, unless it was paid before. This is best
+// effort: the payment is already saved, so errors are only logged
+func (s *PaymentsService) withPayee(p *Payment) {
+	if p.Attributes.BeneficiaryParty == nil {
+		return
+	}
+
+	bytes, err := json.Marshal(&Payee{
+		Payment:   p.Id,
+		CreatedOn: time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("Unable to serialize payee of payment %s: %v", p.Id, err)
+		return
+	}
+
+	_, err = s.payees.Create(&RepoItem{
+		Id:           p.payee(),
+		Organisation: p.Organisation,
+		Attributes:   string(bytes),
+	})
+	if err != nil && !s.payees.IsConflict(err) {
+		log.Printf("Unable to record payee of payment %s: %v", p.Id, err)
+	}
+}
+
+// payee identifies the bank account the payment
+// is made to, as paid by its organisation
+func (p *Payment) payee() string {
+	return fmt.Sprintf("%s:%s", p.Organisation, p.Attributes.BeneficiaryParty.key())
+}
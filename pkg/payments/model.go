@@ -1,28 +1,216 @@
 package payments
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/cop"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	"github.com/pedro-gutierrez/form3/pkg/screening"
 	. "github.com/pedro-gutierrez/form3/pkg/util"
 	"github.com/pkg/errors"
-	"strconv"
 	"strings"
+	"time"
+)
+
+// The states a payment can be in. New payments can be changed
+// freely, until they are submitted. Submitted payments can then be
+// returned by the receiving bank, in one or more goes, or reversed
+// by us. Payments whose parties match a sanctions list, or with a
+// high fraud risk score, are held until reviewed, and then either
+// released or rejected for good.
+// Payments can also be rejected by their approver
+const (
+	StatusCreated           = "created"
+	StatusHeld              = "held"
+	StatusRejected          = "rejected"
+	StatusSubmitted         = "submitted"
+	StatusPartiallyReturned = "partially_returned"
+	StatusReturned          = "returned"
+	StatusReversed          = "reversed"
 )
 
 // Payment attributes captures all detaled information
-// about a payment. Here we are only capturing the Amount, for convenience,
-// and we're leaving out the rest.
+// about a payment. Here we are only capturing the Amount, currency,
+// scheme and debtor account, for convenience, and we're leaving out
+// the rest.
 type PaymentAttributes struct {
-	Amount string `json:"amount"`
+	Amount   string `json:"amount"`
+	Currency string `json:"currency,omitempty"`
+	Scheme   string `json:"scheme,omitempty"`
+
+	// The reference the beneficiary sees the payment with
+	Reference string `json:"reference,omitempty"`
+
+	// The day the payment is to be processed on
+	// (eg. 2019-04-01). Optional
+	ProcessingDate string `json:"processing_date,omitempty"`
+
+	// The schedule the payment was created from, if
+	// any. This is managed by the server
+	Schedule string `json:"schedule_id,omitempty"`
+
+	// The batch the payment was created from, if
+	// any. This is managed by the server too
+	Batch string `json:"batch_id,omitempty"`
+
+	// The account the payment is debited from,
+	// when submitted
+	DebtorAccount string `json:"debtor_account_id,omitempty"`
+
+	// The direct debit mandate the payment is collected
+	// against, and the party it is collected from. Both are
+	// required for direct debits, and must match
+	Mandate     string `json:"mandate_id,omitempty"`
+	DebtorParty *Party `json:"debtor_party,omitempty"`
+
+	// The party the payment is made to, either given in full
+	// or as a beneficiary saved in the address book of the
+	// organisation, expanded into the party when created
+	Beneficiary      string `json:"beneficiary_id,omitempty"`
+	BeneficiaryParty *Party `json:"beneficiary_party,omitempty"`
+
+	// Whether the organisation never paid the bank account
+	// of the beneficiary before. This is managed by the server
+	NewBeneficiary bool `json:"new_beneficiary,omitempty"`
+
+	// The outcome of checking the beneficiary name against the
+	// name its account is registered with, for UK payments of
+	// organisations that check payees. This is managed by the
+	// server
+	PayeeCheck *cop.Result `json:"payee_check,omitempty"`
+
+	// The fx quote cross-currency payments are
+	// converted at, and the result of the conversion
+	FX *FX `json:"fx,omitempty"`
+
+	// The outcome of screening the parties of the payment
+	// against sanctions lists, if anything matched. This is
+	// managed by the server
+	Screening *Screening `json:"screening,omitempty"`
+
+	// The fraud risk score of the payment, when scored.
+	// This is managed by the server
+	Risk *Risk `json:"risk,omitempty"`
+
+	// The user the payment was created on behalf of, and the
+	// approval payments above the approval threshold of their
+	// organisation need. These are managed by the server
+	CreatedBy string    `json:"created_by,omitempty"`
+	Approval  *Approval `json:"approval,omitempty"`
+
+	// The principal (eg. the api key) the payment was created
+	// with, if authenticated, so that it cannot review the payment
+	// itself. This is managed by the server
+	CreatedWith string `json:"created_with,omitempty"`
+
+	// The status of the payment. This is managed
+	// by the server, and ignored in requests
+	Status string `json:"status,omitempty"`
+
+	// The part of the amount returned so far by the
+	// receiving bank. This is managed by the server too
+	ReturnedAmount string `json:"returned_amount,omitempty"`
+
+	// The amount of each return counted in the returned amount, by
+	// return id, and the reversal the payment was reversed with, so
+	// that returns and reversals that failed half way through can be
+	// finished by trying again. These are managed by the server too
+	ReturnAmounts map[string]string `json:"return_amounts,omitempty"`
+	Reversal      string            `json:"reversal_id,omitempty"`
 
 	// TODO: add support for the rest of payment data
-	// eg. beneficiary_party, charges_information, etc..
+	// eg. charges_information, etc..
 }
 
-// Validate does semantic validation on the payment attributes
-func (pa *PaymentAttributes) Validate() error {
+// Party captures the name, address, country and
+// bank account of one of the parties of a payment
+type Party struct {
+	Name          string `json:"name,omitempty"`
+	Address       string `json:"address,omitempty"`
+	Country       string `json:"country,omitempty"`
+	AccountNumber string `json:"account_number"`
+	BankId        string `json:"bank_id"`
+}
+
+// FX captures how a cross-currency payment is converted. Clients
+// only give the quote. The rest is filled in by the server, from the
+// amount and currency of the payment, at the rate of the quote
+type FX struct {
+	Quote             string `json:"quote_id"`
+	ContractReference string `json:"contract_reference,omitempty"`
+	ExchangeRate      string `json:"exchange_rate,omitempty"`
+	ConvertedAmount   string `json:"converted_amount,omitempty"`
+	ConvertedCurrency string `json:"converted_currency,omitempty"`
+}
 
-	amount, err := strconv.ParseFloat(pa.Amount, 64)
+// equals returns true if both parties are the same in every
+// detail, or if neither is given
+func (pa *Party) equals(other *Party) bool {
+	if pa == nil || other == nil {
+		return pa == other
+	}
+	return *pa == *other
+}
+
+// quote returns the id of the fx quote, if any
+func (fx *FX) quote() string {
+	if fx == nil {
+		return ""
+	}
+	return fx.Quote
+}
+
+// key identifies the bank account of the party, if any
+func (pa *Party) key() string {
+	if pa == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", pa.BankId, pa.AccountNumber)
+}
+
+// subject returns the party as something to screen
+// against sanctions lists, in the given role
+func (pa *Party) subject(role string) screening.Subject {
+	if pa == nil {
+		return screening.Subject{Role: role}
+	}
+	return screening.Subject{Role: role, Name: pa.Name, Address: pa.Address}
+}
+
+// country returns the ISO 3166 country
+// code of the party, if known
+func (pa *Party) country() string {
+	if pa == nil {
+		return ""
+	}
+	return pa.Country
+}
+
+// Screening captures the hits found when screening the parties of a
+// payment against sanctions lists, and the decision taken on review
+type Screening struct {
+	Hits       []screening.Hit `json:"hits"`
+	ScreenedOn time.Time       `json:"screened_on"`
+	ReviewOutcome
+}
+
+// Risk captures the fraud risk score of a payment, from 0 to 100, the
+// rules that made it up, and the stage it was last scored at. Payments
+// scored above the risk threshold are held, until reviewed
+type Risk struct {
+	Score    int       `json:"score"`
+	Rules    []string  `json:"rules"`
+	Stage    string    `json:"stage"`
+	ScoredOn time.Time `json:"scored_on"`
+	Held     bool      `json:"held,omitempty"`
+	ReviewOutcome
+}
+
+// Validate does semantic validation on the payment attributes,
+// against the settings of the organisation that owns the payment
+func (pa *PaymentAttributes) Validate(settings organisations.Settings) error {
+	amount, err := ParseAmount(pa.Amount)
 	if err != nil {
 		return errors.Wrap(err, "Invalid payment amount")
 	}
@@ -31,9 +219,36 @@ func (pa *PaymentAttributes) Validate() error {
 		return fmt.Errorf("Payment amount must be positive")
 	}
 
+	if !settings.AllowsCurrency(pa.Currency) {
+		return fmt.Errorf("Currency not allowed: %s", pa.Currency)
+	}
+
+	if pa.ProcessingDate != "" {
+		if _, err := ParseDate(pa.ProcessingDate); err != nil {
+			return errors.Wrap(err, "Invalid processing date")
+		}
+	}
+
+	// A single payment cannot go over the daily limit. The
+	// limit is validated along with the settings
+	if settings.DailyLimit != "" {
+		limit, _ := ParseAmount(settings.DailyLimit)
+		if amount > limit {
+			return fmt.Errorf("Payment amount exceeds the daily limit of %s", settings.DailyLimit)
+		}
+	}
+
 	return nil
 }
 
+// WithDefaults fills in the attributes not given in the request
+// with the defaults from the organisation settings
+func (pa *PaymentAttributes) WithDefaults(settings organisations.Settings) {
+	if pa.Scheme == "" {
+		pa.Scheme = settings.DefaultScheme
+	}
+}
+
 // Payment a payment
 type Payment struct {
 	Id           string            `json:"id"`
@@ -43,8 +258,9 @@ type Payment struct {
 	Attributes   PaymentAttributes `json:"attributes"`
 }
 
-// Validate does semantic validation on the payment
-func (p *Payment) Validate() error {
+// Validate does semantic validation on the payment. The settings
+// of the organisation that owns the payment are taken into account
+func (p *Payment) Validate(settings organisations.Settings) error {
 
 	// check the id is not empty
 	if len(strings.TrimSpace(p.Id)) == 0 {
@@ -62,7 +278,115 @@ func (p *Payment) Validate() error {
 	}
 
 	// check the attributes
-	return p.Attributes.Validate()
+	return p.Attributes.Validate(settings)
+}
+
+// IsSubmitted returns true if the payment was already submitted,
+// and therefore can no longer be changed. Payments created before
+// we tracked their status were never submitted
+func (p *Payment) IsSubmitted() bool {
+	switch p.Attributes.Status {
+	case "", StatusCreated, StatusHeld, StatusRejected:
+		return false
+	}
+	return true
+}
+
+// IsHeld returns true if the payment is held, pending the review
+// of its sanctions screening hits or its fraud risk score
+func (p *Payment) IsHeld() bool {
+	return p.Attributes.Status == StatusHeld
+}
+
+// IsRejected returns true if the payment was rejected, either
+// on review of its sanctions screening hits, or by its approver
+func (p *Payment) IsRejected() bool {
+	return p.Attributes.Status == StatusRejected
+}
+
+// pendingReview returns true if any of the reasons
+// the payment was held for is yet to be reviewed
+func (p *Payment) pendingReview() bool {
+	if sc := p.Attributes.Screening; sc != nil && sc.Decision == "" {
+		return true
+	}
+	if r := p.Attributes.Risk; r != nil && r.Held && r.Decision == "" {
+		return true
+	}
+	return false
+}
+
+// AwaitsApproval returns true if the payment needs to be
+// approved by a second user before it can be submitted
+func (p *Payment) AwaitsApproval() bool {
+	return p.Attributes.Approval != nil && p.Attributes.Approval.Status != ApprovalApproved
+}
+
+// sameParties returns true if the given payment has the
+// same parties as this one, by name and address
+func (p *Payment) sameParties(other *Payment) bool {
+	return p.Attributes.DebtorParty.subject("") == other.Attributes.DebtorParty.subject("") &&
+		p.Attributes.BeneficiaryParty.subject("") == other.Attributes.BeneficiaryParty.subject("")
+}
+
+// sameInstruction returns true if the given payment moves the same
+// money as this one: the same amount and currency, between the same
+// parties and accounts, with the same reference, scheme, processing
+// date and fx quote. Approvals only hold for the payment approved
+func (p *Payment) sameInstruction(other *Payment) bool {
+	a, b := p.Attributes, other.Attributes
+	return a.Amount == b.Amount &&
+		a.Currency == b.Currency &&
+		a.Scheme == b.Scheme &&
+		a.Reference == b.Reference &&
+		a.ProcessingDate == b.ProcessingDate &&
+		a.DebtorAccount == b.DebtorAccount &&
+		a.Mandate == b.Mandate &&
+		a.DebtorParty.equals(b.DebtorParty) &&
+		a.BeneficiaryParty.equals(b.BeneficiaryParty) &&
+		a.FX.quote() == b.FX.quote()
+}
+
+// CanBeReturned returns true if the receiving bank can still
+// return (part of) the payment
+func (p *Payment) CanBeReturned() bool {
+	return p.Attributes.Status == StatusSubmitted || p.Attributes.Status == StatusPartiallyReturned
+}
+
+// Returned returns the part of the payment amount returned
+// so far, in minor units
+func (p *Payment) Returned() (int64, error) {
+	if p.Attributes.ReturnedAmount == "" {
+		return 0, nil
+	}
+	return ParseAmount(p.Attributes.ReturnedAmount)
+}
+
+// CanBeReversed returns true if the payment can be reversed. Only
+// submitted payments, with nothing returned yet, can be reversed
+func (p *Payment) CanBeReversed() bool {
+	return p.Attributes.Status == StatusSubmitted
+}
+
+// Fingerprint returns a digest of what makes a payment the same
+// payment as another one, regardless of its id: who pays whom, how
+// much, and with what reference
+func (p *Payment) Fingerprint() string {
+	amount, err := ParseAmount(p.Attributes.Amount)
+	if err != nil {
+		amount = -1
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%d\n%s\n%s",
+		p.Organisation,
+		p.Attributes.DebtorAccount,
+		p.Attributes.DebtorParty.key(),
+		p.Attributes.BeneficiaryParty.key(),
+		amount,
+		p.Attributes.Currency,
+		p.Attributes.Reference)
+	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
 // Converts a payment into something that
@@ -120,6 +444,21 @@ func NewPaymentsFromRepoItems(items []*RepoItem) ([]*Payment, error) {
 	return payments, nil
 }
 
+// Fingerprint records the last payment created with a given
+// fingerprint, so that duplicates of it can be spotted. Fingerprints
+// given back by a payment that could not be created may have none
+type Fingerprint struct {
+	Payment   string    `json:"payment_id"`
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// Payee records the first payment an organisation made
+// to a bank account, so that new beneficiaries can be spotted
+type Payee struct {
+	Payment   string    `json:"payment_id"`
+	CreatedOn time.Time `json:"created_on"`
+}
+
 // PaymentRequest represents a http request that contains
 // a payment in its field 'data'
 type PaymentRequest struct {
@@ -133,9 +472,6 @@ type PaymentResponse struct {
 	Links Links    `json:"links"`
 }
 
-// A simple type to add restful links to our responses
-type Links map[string]string
-
 // PaymentsResponse represents a http response that contains
 // a list of payments in its field 'data' and a set of links
 type PaymentsResponse struct {
@@ -0,0 +1,54 @@
+package payments
+
+import (
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/cop"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	"net/http"
+	"strings"
+)
+
+// withPayeeCheck confirms the name of the beneficiary party of UK
+// payments against the name its account is registered with, if their
+// organisation checks payees, and rejects the payment if it is not
+// a match and the organisation says so. Returns the http status code
+// to respond with on error
+func (s *PaymentsService) withPayeeCheck(p *Payment, settings organisations.Settings) (int, error) {
+	p.Attributes.PayeeCheck = nil
+	if s.directory == nil || !settings.ChecksPayees() || !p.checksPayee() {
+		return http.StatusOK, nil
+	}
+
+	beneficiary := p.Attributes.BeneficiaryParty
+	result := s.directory.Check(&cop.Check{
+		Name:          beneficiary.Name,
+		AccountNumber: beneficiary.AccountNumber,
+		BankId:        beneficiary.BankId,
+	})
+	p.Attributes.PayeeCheck = result
+
+	if result.Match != cop.Match && settings.RejectsPayeeMismatches() {
+		return http.StatusUnprocessableEntity, fmt.Errorf("The beneficiary name of payment %s is a %s of its account name", p.Id, result.Match)
+	}
+
+	return http.StatusOK, nil
+}
+
+// checksPayee returns true if the payment is a UK payment,
+// whose beneficiary name can be checked
+func (p *Payment) checksPayee() bool {
+	return strings.EqualFold(p.Attributes.Currency, "GBP") && p.Attributes.BeneficiaryParty != nil
+}
+
+// samePayee returns true if both payments are made in the same
+// currency, to the same name and bank account
+func (p *Payment) samePayee(other *Payment) bool {
+	a, b := p.Attributes.BeneficiaryParty, other.Attributes.BeneficiaryParty
+	if a == nil || b == nil {
+		return a == b && p.Attributes.Currency == other.Attributes.Currency
+	}
+
+	return p.Attributes.Currency == other.Attributes.Currency &&
+		a.key() == b.key() &&
+		a.Name == b.Name
+}
@@ -0,0 +1,521 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The states a recall can be in. Recalls are requested by our
+// customers, sent to the receiving bank, where they stay pending
+// until the bank accepts or rejects them
+const (
+	RecallRequested = "requested"
+	RecallPending   = "pending"
+	RecallAccepted  = "accepted"
+	RecallRejected  = "rejected"
+)
+
+// recallTransitions are the states a recall can move to,
+// from each of the states it can be in
+var recallTransitions = map[string][]string{
+	RecallRequested: {RecallPending},
+	RecallPending:   {RecallAccepted, RecallRejected},
+}
+
+// recallReturnReason is the return reason code of the funds
+// sent back by the receiving bank, when it accepts a recall
+const recallReturnReason = "FOCR"
+
+// RecallReasons are the ISO 20022 reason codes a payment
+// can be recalled with, along with their descriptions
+var RecallReasons = map[string]string{
+	"AC03": "Wrong creditor account",
+	"AM09": "Wrong amount",
+	"CUST": "Requested by customer",
+	"DUPL": "Duplicate payment",
+	"FRAD": "Fraudulent origin",
+	"TECH": "Technical problem",
+}
+
+// RecallRejectionReasons are the ISO 20022 reason codes the
+// receiving bank can reject a recall with
+var RecallRejectionReasons = map[string]string{
+	"AC04": "Closed account number",
+	"AM04": "Insufficient funds",
+	"ARDT": "Already returned",
+	"CUST": "Customer decision",
+	"LEGL": "Legal decision",
+	"NOAS": "No answer from customer",
+	"NOOR": "No original transaction received",
+}
+
+// RecallAttributes captures the details of a recall
+type RecallAttributes struct {
+	Status string `json:"status"`
+
+	// The reason code given by our customer, and its
+	// description, which is filled in by the server
+	ReasonCode string `json:"reason_code"`
+	Reason     string `json:"reason,omitempty"`
+
+	// The reason code given by the receiving bank, and its
+	// description, when the recall is rejected
+	RejectionCode string `json:"rejection_code,omitempty"`
+	Rejection     string `json:"rejection,omitempty"`
+
+	// The return the funds came back with, once
+	// the recall is accepted
+	Return string `json:"return_id,omitempty"`
+
+	CreatedOn time.Time `json:"created_on"`
+	UpdatedOn time.Time `json:"updated_on"`
+}
+
+// Recall tracks our request to get a submitted payment
+// back from the receiving bank
+type Recall struct {
+	Id           string           `json:"id"`
+	Type         string           `json:"type"`
+	Version      int              `json:"version"`
+	Organisation string           `json:"organisation_id"`
+	Payment      string           `json:"payment_id"`
+	Attributes   RecallAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the recall. Rejected
+// recalls must say why they were rejected
+func (rc *Recall) Validate() error {
+	if len(strings.TrimSpace(rc.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	if rc.Type != "Recall" {
+		return fmt.Errorf("Invalid type: %s", rc.Type)
+	}
+
+	if _, ok := RecallReasons[rc.Attributes.ReasonCode]; !ok {
+		return fmt.Errorf("Invalid recall reason code: %s", rc.Attributes.ReasonCode)
+	}
+
+	switch rc.Attributes.Status {
+	case RecallRequested, RecallPending, RecallAccepted:
+	case RecallRejected:
+		if _, ok := RecallRejectionReasons[rc.Attributes.RejectionCode]; !ok {
+			return fmt.Errorf("Invalid recall rejection code: %s", rc.Attributes.RejectionCode)
+		}
+	default:
+		return fmt.Errorf("Invalid recall status: %s", rc.Attributes.Status)
+	}
+
+	return nil
+}
+
+// IsOpen returns true if the recall is still waiting
+// for an answer from the receiving bank
+func (rc *Recall) IsOpen() bool {
+	return rc.Attributes.Status == RecallRequested || rc.Attributes.Status == RecallPending
+}
+
+// CanMoveTo returns true if the recall can move
+// to the given status
+func (rc *Recall) CanMoveTo(status string) bool {
+	for _, s := range recallTransitions[rc.Attributes.Status] {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Converts a recall into something that can be saved
+// into the database. Recalls belong to their payment
+func (rc *Recall) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           rc.Id,
+		Version:      rc.Version,
+		Organisation: rc.Organisation,
+		Parent:       rc.Payment,
+	}
+
+	bytes, err := json.Marshal(rc.Attributes)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize recall attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into a recall
+func NewRecallFromRepoItem(item *RepoItem) (*Recall, error) {
+	rc := &Recall{
+		Type:         "Recall",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+		Payment:      item.Parent,
+	}
+
+	var attrs RecallAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return rc, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	rc.Attributes = attrs
+
+	return rc, nil
+}
+
+// NewRecallsFromRepoItems converts the given slice of repo
+// items to a list of recalls
+func NewRecallsFromRepoItems(items []*RepoItem) ([]*Recall, error) {
+	recalls := []*Recall{}
+	for _, i := range items {
+		rc, err := NewRecallFromRepoItem(i)
+		if err != nil {
+			return recalls, err
+		}
+		recalls = append(recalls, rc)
+	}
+
+	return recalls, nil
+}
+
+// RecallRequest represents a http request that contains
+// a recall in its field 'data'
+type RecallRequest struct {
+	Recall *Recall `json:"data"`
+}
+
+// RecallResponse represents a http response that contains
+// a recall in its field 'data' and set of links
+type RecallResponse struct {
+	Data  *Recall `json:"data"`
+	Links Links   `json:"links"`
+}
+
+// RecallsResponse represents a http response that contains
+// a list of recalls in its field 'data' and a set of links
+type RecallsResponse struct {
+	Data  []*Recall `json:"data"`
+	Links Links     `json:"links"`
+}
+
+// ListRecalls returns the recalls of a payment, using the same
+// from and to query params semantics as payments
+func (s *PaymentsService) ListRecalls(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, status, err := s.fetchPayment(id); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	recalls, err := s.findRecalls(id, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(recallsLinkPattern, id, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(recallsLinkPattern, id, to, to+limit))
+	links["payment"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id))
+
+	RenderJSON(w, r, http.StatusOK, &RecallsResponse{
+		Data:  recalls,
+		Links: links,
+	})
+}
+
+// FetchRecall returns a single recall of a payment
+func (s *PaymentsService) FetchRecall(w http.ResponseWriter, r *http.Request) {
+	rc, status, err := s.fetchRecall(chi.URLParam(r, "id"), chi.URLParam(r, "recallId"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	s.renderRecall(w, r, http.StatusOK, rc)
+}
+
+// CreateRecall requests a submitted payment back from the receiving
+// bank. Payments can only have one open recall at a time. Bacs has no
+// recall procedure, so Bacs payments cannot be recalled
+func (s *PaymentsService) CreateRecall(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	p, status, err := s.fetchPayment(id)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	rc, err := decodeRecall(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if rc.Id == "" {
+		rc.Id = NewId()
+	}
+
+	rc.Organisation = p.Organisation
+	rc.Payment = p.Id
+	rc.Attributes.Status = RecallRequested
+	err = rc.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if strings.ToUpper(p.Attributes.Scheme) == "BACS" {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Bacs payments cannot be recalled: %s", id))
+		return
+	}
+
+	if !p.CanBeReturned() {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Payment %s cannot be recalled, it is %s", id, p.Attributes.Status))
+		return
+	}
+
+	for offset := 0; ; offset += s.maxResults {
+		recalls, err := s.findRecalls(id, offset, s.maxResults)
+		if err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		for _, existing := range recalls {
+			if existing.IsOpen() {
+				HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Payment %s already has an open recall: %s", id, existing.Id))
+				return
+			}
+		}
+
+		if len(recalls) < s.maxResults {
+			break
+		}
+	}
+
+	rc.Attributes.Reason = RecallReasons[rc.Attributes.ReasonCode]
+	rc.Attributes.RejectionCode = ""
+	rc.Attributes.Return = ""
+	rc.Attributes.CreatedOn = time.Now().UTC()
+	rc.Attributes.UpdatedOn = rc.Attributes.CreatedOn
+
+	repoItem, err := rc.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdItem, err := s.recalls.Create(repoItem)
+	if err != nil {
+		if s.recalls.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	rc, err = NewRecallFromRepoItem(createdItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.renderRecall(w, r, http.StatusCreated, rc)
+}
+
+// UpdateRecall moves a recall on to its next status. Only the
+// status, and the rejection code of rejected recalls, can be changed.
+//
+// Accepting a recall records the funds sent back by the receiving bank
+// as a return of whatever was left of the payment. The return has the
+// same id as the recall, so that accepting a recall again, after a
+// failure, does not return the payment twice
+func (s *PaymentsService) UpdateRecall(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	recallId := chi.URLParam(r, "recallId")
+
+	rc, err := decodeRecall(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if rc.Id != "" && rc.Id != recallId {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Recall id mismatch: %s", rc.Id))
+		return
+	}
+
+	current, status, err := s.fetchRecall(id, recallId)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	if !current.CanMoveTo(rc.Attributes.Status) {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Recall %s cannot move from %s to %s", recallId, current.Attributes.Status, rc.Attributes.Status))
+		return
+	}
+
+	updated := *current
+	updated.Version = rc.Version
+	updated.Attributes.Status = rc.Attributes.Status
+	updated.Attributes.RejectionCode = rc.Attributes.RejectionCode
+	err = updated.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	updated.Attributes.Rejection = RecallRejectionReasons[updated.Attributes.RejectionCode]
+	updated.Attributes.UpdatedOn = time.Now().UTC()
+
+	if updated.Attributes.Status == RecallAccepted {
+		rt, status, err := s.returnRecalled(&updated)
+		if err != nil {
+			HandleHttpError(w, r, status, err)
+			return
+		}
+		updated.Attributes.Return = rt.Id
+	}
+
+	repoItem, err := updated.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	updatedItem, err := s.recalls.Update(repoItem)
+	if err != nil {
+		if s.recalls.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	rc, err = NewRecallFromRepoItem(updatedItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.renderRecall(w, r, http.StatusOK, rc)
+}
+
+// returnRecalled records whatever is left of the payment of the given
+// recall as returned, under the id of the recall. If that return was
+// already counted, it is finished instead, with the amount it was
+// counted for. Returns the http status code to respond with on error
+func (s *PaymentsService) returnRecalled(rc *Recall) (*Return, int, error) {
+	p, status, err := s.fetchPayment(rc.Payment)
+	if err != nil {
+		return nil, status, err
+	}
+
+	total, err := ParseAmount(p.Attributes.Amount)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	returned, err := p.Returned()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	amount := FormatAmount(total - returned)
+	if counted, ok := p.Attributes.ReturnAmounts[rc.Id]; ok {
+		amount = counted
+	}
+
+	return s.returnPayment(p, &Return{
+		Id:           rc.Id,
+		Type:         "Return",
+		Organisation: p.Organisation,
+		Payment:      p.Id,
+		Attributes: ReturnAttributes{
+			Amount:     amount,
+			ReasonCode: recallReturnReason,
+		},
+	})
+}
+
+// fetchRecall looks up a recall of the given payment. Recalls are
+// only visible under their own payment. Returns the http status code
+// to respond with on error
+func (s *PaymentsService) fetchRecall(id string, recallId string) (*Recall, int, error) {
+	found, err := s.recalls.Fetch(&RepoItem{Id: recallId})
+	if err != nil {
+		if s.recalls.IsNotFound(err) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if found.Parent != id {
+		return nil, http.StatusNotFound, fmt.Errorf("Recall %s does not belong to payment %s", recallId, id)
+	}
+
+	rc, err := NewRecallFromRepoItem(found)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return rc, http.StatusOK, nil
+}
+
+// findRecalls returns a page of recalls of the given payment
+func (s *PaymentsService) findRecalls(id string, offset int, limit int) ([]*Recall, error) {
+	repoItems, err := s.recalls.Find(RepoFilter{Parent: id}, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecallsFromRepoItems(repoItems)
+}
+
+// renderRecall sends back the given recall, along with its links
+func (s *PaymentsService) renderRecall(w http.ResponseWriter, r *http.Request, status int, rc *Recall) {
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(recallLinkPattern, rc.Payment, rc.Id))
+	links["payment"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, rc.Payment))
+
+	if rc.Attributes.Return != "" {
+		links["return"] = s.UrlFor(fmt.Sprintf(returnLinkPattern, rc.Payment, rc.Attributes.Return))
+	}
+
+	RenderJSON(w, r, status, &RecallResponse{
+		Data:  rc,
+		Links: links,
+	})
+}
+
+// decodeRecall is a convenience function that attempts to
+// decode a recall from the HTTP request body
+func decodeRecall(r *http.Request) (*Recall, error) {
+	decoder := json.NewDecoder(r.Body)
+	var rr RecallRequest
+	err := decoder.Decode(&rr)
+	if err == nil && rr.Recall == nil {
+		err = fmt.Errorf("No recall data")
+	}
+	return rr.Recall, err
+}
@@ -0,0 +1,411 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/events"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// bacsReturnReasons are the ARUCS (Automated Return of Unapplied
+// Credits Service) reason codes Bacs payments are returned with
+var bacsReturnReasons = map[string]string{
+	"0": "Refer to payer",
+	"2": "Beneficiary deceased",
+	"3": "Account transferred",
+	"5": "No account",
+	"B": "Account closed",
+	"F": "Invalid account type",
+	"G": "Bank will not accept",
+	"H": "Instruction expired",
+}
+
+// isoReturnReasons are the ISO 20022 reason codes payments of every
+// other scheme (eg. FPS, SEPA) are returned with
+var isoReturnReasons = map[string]string{
+	"AC01": "Incorrect account number",
+	"AC04": "Closed account number",
+	"AC06": "Blocked account",
+	"AG01": "Transaction forbidden",
+	"AM05": "Duplication",
+	"BE04": "Missing creditor address",
+	"FOCR": "Following cancellation request",
+	"MD07": "End customer deceased",
+	"MS02": "Not specified reason customer generated",
+	"MS03": "Not specified reason agent generated",
+	"RC01": "Bank identifier incorrect",
+	"RR04": "Regulatory reason",
+}
+
+// ReturnReasons returns the reason codes payments of the given
+// scheme can be returned with, along with their descriptions
+func ReturnReasons(scheme string) map[string]string {
+	if strings.ToUpper(scheme) == "BACS" {
+		return bacsReturnReasons
+	}
+	return isoReturnReasons
+}
+
+// ReturnAttributes captures the details of a payment return
+type ReturnAttributes struct {
+	// The part of the payment amount that was returned
+	Amount string `json:"amount"`
+
+	// The reason code given by the receiving bank, and
+	// its description, which is filled in by the server
+	ReasonCode string `json:"reason_code"`
+	Reason     string `json:"reason,omitempty"`
+
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// Return records (part of) a payment that was sent back
+// to us by the receiving bank
+type Return struct {
+	Id           string           `json:"id"`
+	Type         string           `json:"type"`
+	Version      int              `json:"version"`
+	Organisation string           `json:"organisation_id"`
+	Payment      string           `json:"payment_id"`
+	Attributes   ReturnAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the return, against
+// the payment being returned. Reason codes depend on the
+// scheme of the payment
+func (rt *Return) Validate(p *Payment) error {
+	if len(strings.TrimSpace(rt.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	if rt.Type != "Return" {
+		return fmt.Errorf("Invalid type: %s", rt.Type)
+	}
+
+	amount, err := ParseAmount(rt.Attributes.Amount)
+	if err != nil {
+		return errors.Wrap(err, "Invalid return amount")
+	}
+
+	if amount <= 0 {
+		return errors.New("Return amount must be positive")
+	}
+
+	if _, ok := ReturnReasons(p.Attributes.Scheme)[rt.Attributes.ReasonCode]; !ok {
+		return fmt.Errorf("Invalid return reason code: %s", rt.Attributes.ReasonCode)
+	}
+
+	return nil
+}
+
+// Converts a return into something that can be saved
+// into the database. Returns belong to their payment
+func (rt *Return) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           rt.Id,
+		Version:      rt.Version,
+		Organisation: rt.Organisation,
+		Parent:       rt.Payment,
+	}
+
+	bytes, err := json.Marshal(rt.Attributes)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize return attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into a return
+func NewReturnFromRepoItem(item *RepoItem) (*Return, error) {
+	rt := &Return{
+		Type:         "Return",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+		Payment:      item.Parent,
+	}
+
+	var attrs ReturnAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return rt, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	rt.Attributes = attrs
+
+	return rt, nil
+}
+
+// NewReturnsFromRepoItems converts the given slice of repo
+// items to a list of returns
+func NewReturnsFromRepoItems(items []*RepoItem) ([]*Return, error) {
+	returns := []*Return{}
+	for _, i := range items {
+		rt, err := NewReturnFromRepoItem(i)
+		if err != nil {
+			return returns, err
+		}
+		returns = append(returns, rt)
+	}
+
+	return returns, nil
+}
+
+// ReturnRequest represents a http request that contains
+// a return in its field 'data'
+type ReturnRequest struct {
+	Return *Return `json:"data"`
+}
+
+// ReturnResponse represents a http response that contains
+// a return in its field 'data' and set of links
+type ReturnResponse struct {
+	Data  *Return `json:"data"`
+	Links Links   `json:"links"`
+}
+
+// ReturnsResponse represents a http response that contains
+// a list of returns in its field 'data' and a set of links
+type ReturnsResponse struct {
+	Data  []*Return `json:"data"`
+	Links Links     `json:"links"`
+}
+
+// ListReturns returns the returns of a payment, using the same
+// from and to query params semantics as payments
+func (s *PaymentsService) ListReturns(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, status, err := s.fetchPayment(id); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	repoItems, err := s.returns.Find(RepoFilter{Parent: id}, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	returns, err := NewReturnsFromRepoItems(repoItems)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(returnsLinkPattern, id, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(returnsLinkPattern, id, to, to+limit))
+	links["payment"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id))
+
+	RenderJSON(w, r, http.StatusOK, &ReturnsResponse{
+		Data:  returns,
+		Links: links,
+	})
+}
+
+// FetchReturn returns a single return of a payment
+func (s *PaymentsService) FetchReturn(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	found, err := s.returns.Fetch(&RepoItem{Id: chi.URLParam(r, "returnId")})
+	if err != nil {
+		if s.returns.IsNotFound(err) {
+			HandleHttpError(w, r, http.StatusNotFound, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	// Returns are only visible under their own payment
+	if found.Parent != id {
+		HandleHttpError(w, r, http.StatusNotFound, fmt.Errorf("Return %s does not belong to payment %s", found.Id, id))
+		return
+	}
+
+	rt, err := NewReturnFromRepoItem(found)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.renderReturn(w, r, http.StatusOK, rt)
+}
+
+// CreateReturn records (part of) a submitted payment as returned
+// by the receiving bank
+func (s *PaymentsService) CreateReturn(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	p, status, err := s.fetchPayment(id)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	rt, err := decodeReturn(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if rt.Id == "" {
+		rt.Id = NewId()
+	}
+
+	rt.Organisation = p.Organisation
+	rt.Payment = p.Id
+	err = rt.Validate(p)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	rt, status, err = s.returnPayment(p, rt)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	s.renderReturn(w, r, http.StatusCreated, rt)
+}
+
+// returnPayment records the given, already validated, return of the
+// given payment. The returned amount is credited back to the debtor
+// account, and the payment moves to the returned status, or
+// partially_returned, if there is still some amount left that
+// could be returned later.
+//
+// The payment is updated first, so that concurrent returns of the same
+// payment are serialized by its version, and the returned amount never
+// goes over the payment amount. The return is then created, and the
+// ledger transfer posted. Neither is atomic with the update of the
+// payment, so each step is skipped if already done: returning a payment
+// again, with the same return id and amount, finishes what a failed
+// return left undone. Returns the http status code to respond with
+// on error
+func (s *PaymentsService) returnPayment(p *Payment, rt *Return) (*Return, int, error) {
+	// The return amount was already validated
+	amount, _ := ParseAmount(rt.Attributes.Amount)
+	rt.Attributes.Amount = FormatAmount(amount)
+	rt.Attributes.Reason = ReturnReasons(p.Attributes.Scheme)[rt.Attributes.ReasonCode]
+	rt.Attributes.CreatedOn = time.Now().UTC()
+
+	counted, ok := p.Attributes.ReturnAmounts[rt.Id]
+	if ok && counted != rt.Attributes.Amount {
+		return nil, http.StatusConflict, fmt.Errorf("Return %s already exists, for %s", rt.Id, counted)
+	}
+
+	if !ok {
+		if status, err := s.countReturn(p, rt.Id, amount); err != nil {
+			return nil, status, err
+		}
+	}
+
+	repoItem, err := rt.ToRepoItem()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	createdItem, err := s.returns.Create(repoItem)
+	if err != nil && s.returns.IsConflict(err) {
+		createdItem, err = s.returns.Fetch(&RepoItem{Id: rt.Id})
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if createdItem.Parent != p.Id {
+		return nil, http.StatusConflict, fmt.Errorf("Return already exists: %s", rt.Id)
+	}
+
+	if err := s.refund(p, fmt.Sprintf("return:%s", rt.Id), amount, fmt.Sprintf("Return %s of payment %s", rt.Id, p.Id)); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	rt, err = NewReturnFromRepoItem(createdItem)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return rt, http.StatusOK, nil
+}
+
+// countReturn adds the given amount, of the return with the given id,
+// to the returned amount of the given payment, provided the payment can
+// still be returned, and the amount is not over what is left to return.
+// Returns the http status code to respond with on error
+func (s *PaymentsService) countReturn(p *Payment, id string, amount int64) (int, error) {
+	if !p.CanBeReturned() {
+		return http.StatusConflict, fmt.Errorf("Payment %s cannot be returned, it is %s", p.Id, p.Attributes.Status)
+	}
+
+	// Returns of other payments, or counted before we kept
+	// track of them, cannot be finished this way
+	if _, err := s.returns.Fetch(&RepoItem{Id: id}); err == nil {
+		return http.StatusConflict, fmt.Errorf("Return already exists: %s", id)
+	}
+
+	total, err := ParseAmount(p.Attributes.Amount)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	returned, err := p.Returned()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if returned+amount > total {
+		return http.StatusBadRequest, fmt.Errorf("Return amount %s exceeds the %s left to return", FormatAmount(amount), FormatAmount(total-returned))
+	}
+
+	if p.Attributes.ReturnAmounts == nil {
+		p.Attributes.ReturnAmounts = map[string]string{}
+	}
+
+	p.Attributes.ReturnAmounts[id] = FormatAmount(amount)
+	p.Attributes.ReturnedAmount = FormatAmount(returned + amount)
+	p.Attributes.Status = StatusPartiallyReturned
+	if returned+amount == total {
+		p.Attributes.Status = StatusReturned
+	}
+
+	return s.updateWithEvent(events.PaymentReturned, p)
+}
+
+// renderReturn sends back the given return, along with its links
+func (s *PaymentsService) renderReturn(w http.ResponseWriter, r *http.Request, status int, rt *Return) {
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(returnLinkPattern, rt.Payment, rt.Id))
+	links["payment"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, rt.Payment))
+
+	RenderJSON(w, r, status, &ReturnResponse{
+		Data:  rt,
+		Links: links,
+	})
+}
+
+// decodeReturn is a convenience function that attempts to
+// decode a return from the HTTP request body
+func decodeReturn(r *http.Request) (*Return, error) {
+	decoder := json.NewDecoder(r.Body)
+	var rr ReturnRequest
+	err := decoder.Decode(&rr)
+	if err == nil && rr.Return == nil {
+		err = fmt.Errorf("No return data")
+	}
+	return rr.Return, err
+}
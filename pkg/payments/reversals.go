@@ -0,0 +1,335 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/events"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ReversalReasons are the ISO 20022 reason codes a payment
+// can be reversed with, along with their descriptions
+var ReversalReasons = map[string]string{
+	"AC03": "Invalid creditor account number",
+	"AM05": "Duplication",
+	"CUST": "Requested by customer",
+	"FRAD": "Fraudulent origin",
+	"MS02": "Not specified reason customer generated",
+	"MS03": "Not specified reason agent generated",
+	"TECH": "Technical problem",
+	"UPAY": "Undue payment",
+}
+
+// ReversalAttributes captures the details of a payment reversal
+type ReversalAttributes struct {
+	// Payments are always reversed in full. The amount
+	// is filled in by the server
+	Amount string `json:"amount,omitempty"`
+
+	// The reason code given by the client, and its
+	// description, which is filled in by the server
+	ReasonCode string `json:"reason_code"`
+	Reason     string `json:"reason,omitempty"`
+
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// Reversal records a submitted payment that we
+// took back, in full
+type Reversal struct {
+	Id           string             `json:"id"`
+	Type         string             `json:"type"`
+	Version      int                `json:"version"`
+	Organisation string             `json:"organisation_id"`
+	Payment      string             `json:"payment_id"`
+	Attributes   ReversalAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the reversal
+func (rv *Reversal) Validate() error {
+	if len(strings.TrimSpace(rv.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	if rv.Type != "Reversal" {
+		return fmt.Errorf("Invalid type: %s", rv.Type)
+	}
+
+	if _, ok := ReversalReasons[rv.Attributes.ReasonCode]; !ok {
+		return fmt.Errorf("Invalid reversal reason code: %s", rv.Attributes.ReasonCode)
+	}
+
+	return nil
+}
+
+// Converts a reversal into something that can be saved
+// into the database. Reversals belong to their payment
+func (rv *Reversal) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           rv.Id,
+		Version:      rv.Version,
+		Organisation: rv.Organisation,
+		Parent:       rv.Payment,
+	}
+
+	bytes, err := json.Marshal(rv.Attributes)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize reversal attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into a reversal
+func NewReversalFromRepoItem(item *RepoItem) (*Reversal, error) {
+	rv := &Reversal{
+		Type:         "Reversal",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+		Payment:      item.Parent,
+	}
+
+	var attrs ReversalAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return rv, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	rv.Attributes = attrs
+
+	return rv, nil
+}
+
+// NewReversalsFromRepoItems converts the given slice of repo
+// items to a list of reversals
+func NewReversalsFromRepoItems(items []*RepoItem) ([]*Reversal, error) {
+	reversals := []*Reversal{}
+	for _, i := range items {
+		rv, err := NewReversalFromRepoItem(i)
+		if err != nil {
+			return reversals, err
+		}
+		reversals = append(reversals, rv)
+	}
+
+	return reversals, nil
+}
+
+// ReversalRequest represents a http request that contains
+// a reversal in its field 'data'
+type ReversalRequest struct {
+	Reversal *Reversal `json:"data"`
+}
+
+// ReversalResponse represents a http response that contains
+// a reversal in its field 'data' and set of links
+type ReversalResponse struct {
+	Data  *Reversal `json:"data"`
+	Links Links     `json:"links"`
+}
+
+// ReversalsResponse represents a http response that contains
+// a list of reversals in its field 'data' and a set of links
+type ReversalsResponse struct {
+	Data  []*Reversal `json:"data"`
+	Links Links       `json:"links"`
+}
+
+// ListReversals returns the reversals of a payment. There is
+// at most one, but we keep it a collection, as for returns
+func (s *PaymentsService) ListReversals(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, status, err := s.fetchPayment(id); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	repoItems, err := s.reversals.Find(RepoFilter{Parent: id}, 0, s.maxResults)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	reversals, err := NewReversalsFromRepoItems(repoItems)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(reversalsLinkPattern, id))
+	links["payment"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id))
+
+	RenderJSON(w, r, http.StatusOK, &ReversalsResponse{
+		Data:  reversals,
+		Links: links,
+	})
+}
+
+// FetchReversal returns a single reversal of a payment
+func (s *PaymentsService) FetchReversal(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	found, err := s.reversals.Fetch(&RepoItem{Id: chi.URLParam(r, "reversalId")})
+	if err != nil {
+		if s.reversals.IsNotFound(err) {
+			HandleHttpError(w, r, http.StatusNotFound, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	// Reversals are only visible under their own payment
+	if found.Parent != id {
+		HandleHttpError(w, r, http.StatusNotFound, fmt.Errorf("Reversal %s does not belong to payment %s", found.Id, id))
+		return
+	}
+
+	rv, err := NewReversalFromRepoItem(found)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.renderReversal(w, r, http.StatusOK, rv)
+}
+
+// CreateReversal takes back a submitted payment, in full. The
+// payment amount is credited back to the debtor account, and the
+// payment moves to the reversed status. Payments the receiving bank
+// already returned, even partially, cannot be reversed.
+//
+// As for returns, the payment is updated first, and then the reversal
+// is created, and the ledger transfer posted. Reversing a payment again
+// finishes what a failed reversal left undone, under the id of the
+// reversal the payment was reversed with
+func (s *PaymentsService) CreateReversal(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	p, status, err := s.fetchPayment(id)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	rv, err := decodeReversal(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if rv.Id == "" {
+		rv.Id = NewId()
+	}
+
+	rv.Organisation = p.Organisation
+	rv.Payment = p.Id
+	err = rv.Validate()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	amount, err := ParseAmount(p.Attributes.Amount)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Payments already reversed are only
+	// finished, under the same reversal
+	reversed := p.Attributes.Status == StatusReversed && p.Attributes.Reversal != ""
+	if reversed {
+		rv.Id = p.Attributes.Reversal
+	} else if !p.CanBeReversed() {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Payment %s cannot be reversed, it is %s", id, p.Attributes.Status))
+		return
+	} else if _, err := s.reversals.Fetch(&RepoItem{Id: rv.Id}); err == nil {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Reversal already exists: %s", rv.Id))
+		return
+	}
+
+	rv.Attributes.Amount = FormatAmount(amount)
+	rv.Attributes.Reason = ReversalReasons[rv.Attributes.ReasonCode]
+	rv.Attributes.CreatedOn = time.Now().UTC()
+
+	if !reversed {
+		p.Attributes.Status = StatusReversed
+		p.Attributes.Reversal = rv.Id
+		if status, err := s.updateWithEvent(events.PaymentReversed, p); err != nil {
+			HandleHttpError(w, r, status, err)
+			return
+		}
+	}
+
+	repoItem, err := rv.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdItem, err := s.reversals.Create(repoItem)
+	existed := err != nil && s.reversals.IsConflict(err)
+	if existed {
+		createdItem, err = s.reversals.Fetch(&RepoItem{Id: rv.Id})
+	}
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if createdItem.Parent != p.Id {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Reversal already exists: %s", rv.Id))
+		return
+	}
+
+	if err := s.refund(p, fmt.Sprintf("reversal:%s", p.Id), amount, fmt.Sprintf("Reversal of payment %s", p.Id)); err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Reversals that were already finished are not taken twice
+	if reversed && existed {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Payment %s is already reversed", id))
+		return
+	}
+
+	rv, err = NewReversalFromRepoItem(createdItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.renderReversal(w, r, http.StatusCreated, rv)
+}
+
+// renderReversal sends back the given reversal, along with its links
+func (s *PaymentsService) renderReversal(w http.ResponseWriter, r *http.Request, status int, rv *Reversal) {
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(reversalLinkPattern, rv.Payment, rv.Id))
+	links["payment"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, rv.Payment))
+
+	RenderJSON(w, r, status, &ReversalResponse{
+		Data:  rv,
+		Links: links,
+	})
+}
+
+// decodeReversal is a convenience function that attempts to
+// decode a reversal from the HTTP request body
+func decodeReversal(r *http.Request) (*Reversal, error) {
+	decoder := json.NewDecoder(r.Body)
+	var rr ReversalRequest
+	err := decoder.Decode(&rr)
+	if err == nil && rr.Reversal == nil {
+		err = fmt.Errorf("No reversal data")
+	}
+	return rr.Reversal, err
+}
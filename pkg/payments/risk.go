@@ -0,0 +1,91 @@
+package payments
+
+import (
+	"github.com/pedro-gutierrez/form3/pkg/risk"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ReviewRisk releases or rejects a payment held because of its fraud
+// risk score. Released payments are not scored again. Rejected payments
+// are kept, but can no longer be changed, deleted or submitted
+func (s *PaymentsService) ReviewRisk(w http.ResponseWriter, r *http.Request) {
+	s.review(w, r, "risk", func(p *Payment) *ReviewOutcome {
+		if p.Attributes.Risk == nil || !p.Attributes.Risk.Held {
+			return nil
+		}
+		return &p.Attributes.Risk.ReviewOutcome
+	})
+}
+
+// withRisk scores the given payment for fraud, at the given stage,
+// and holds it if scored above the risk threshold. Payments already
+// released on review of their risk are not scored again. Returns true
+// if the payment is held, and the http status code to respond with on
+// error
+func (s *PaymentsService) withRisk(p *Payment, stage string) (bool, int, error) {
+	if s.scorer == nil {
+		return false, http.StatusOK, nil
+	}
+
+	if current := p.Attributes.Risk; current != nil && current.Held && current.Decision == OutcomeReleased {
+		return false, http.StatusOK, nil
+	}
+
+	subject, err := p.riskSubject(stage)
+	if err != nil {
+		return false, http.StatusBadRequest, err
+	}
+
+	assessment, err := s.scorer.Score(subject)
+	if err != nil {
+		log.Printf("Could not score payment %s: %v", p.Id, err)
+		return false, http.StatusServiceUnavailable, errors.Wrapf(err, "Unable to score payment %s", p.Id)
+	}
+
+	held := assessment.Score > s.riskThreshold
+	p.Attributes.Risk = &Risk{
+		Score:    assessment.Score,
+		Rules:    assessment.Rules,
+		Stage:    stage,
+		ScoredOn: subject.At,
+		Held:     held,
+	}
+
+	if held {
+		p.Attributes.Status = StatusHeld
+	}
+
+	return held, http.StatusOK, nil
+}
+
+// riskSubject returns what the payment is
+// scored on, at the given stage
+func (p *Payment) riskSubject(stage string) (*risk.Subject, error) {
+	amount, err := ParseAmount(p.Attributes.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := &risk.Subject{
+		Stage:              stage,
+		Payment:            p.Id,
+		Organisation:       p.Organisation,
+		Amount:             amount,
+		Currency:           p.Attributes.Currency,
+		Scheme:             p.Attributes.Scheme,
+		At:                 time.Now().UTC(),
+		NewBeneficiary:     p.Attributes.NewBeneficiary,
+		BeneficiaryCountry: p.Attributes.BeneficiaryParty.country(),
+		DebtorCountry:      p.Attributes.DebtorParty.country(),
+	}
+
+	if p.Attributes.BeneficiaryParty != nil {
+		subject.Beneficiary = p.Attributes.BeneficiaryParty.key()
+	}
+
+	return subject, nil
+}
@@ -6,42 +6,174 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/accounts"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/calendars"
+	"github.com/pedro-gutierrez/form3/pkg/cop"
+	"github.com/pedro-gutierrez/form3/pkg/events"
+	"github.com/pedro-gutierrez/form3/pkg/fx"
+	"github.com/pedro-gutierrez/form3/pkg/mandates"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	"github.com/pedro-gutierrez/form3/pkg/risk"
+	"github.com/pedro-gutierrez/form3/pkg/screening"
 	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	maxResults          int
 	paymentsLinkPattern string
 	paymentLinkPattern  string
+	accountLinkPattern  string
+	mandateLinkPattern  string
+	quoteLinkPattern    string
+
+	returnsLinkPattern   string
+	returnLinkPattern    string
+	reversalsLinkPattern string
+	reversalLinkPattern  string
+	recallsLinkPattern   string
+	recallLinkPattern    string
 )
 
 func init() {
-	paymentsLinkPattern = "/payments?from=%v&to=%v"
-	paymentLinkPattern = "/payment/%v"
+	paymentsLinkPattern = "/payments?%sfrom=%v&to=%v"
+	paymentLinkPattern = "/payments/%v"
+	accountLinkPattern = "/accounts/%v"
+	mandateLinkPattern = "/mandates/%v"
+	quoteLinkPattern = "/fx-quotes/%v"
+	returnsLinkPattern = "/payments/%v/returns?from=%v&to=%v"
+	returnLinkPattern = "/payments/%v/returns/%v"
+	reversalsLinkPattern = "/payments/%v/reversals"
+	reversalLinkPattern = "/payments/%v/reversals/%v"
+	recallsLinkPattern = "/payments/%v/recalls?from=%v&to=%v"
+	recallLinkPattern = "/payments/%v/recalls/%v"
+}
+
+// Config is a simple container for everything the
+// payments service depends on
+type Config struct {
+	// Where payments are stored
+	Repo Repo
+
+	// The organisations payments belong to
+	Organisations Repo
+
+	// The accounts payments are debited from, and the
+	// ledger that keeps track of their balances
+	Accounts Repo
+	Ledger   Ledger
+
+	// Where the returns and reversals of
+	// submitted payments are stored
+	Returns   Repo
+	Reversals Repo
+
+	// Where the recalls of submitted payments
+	// are tracked
+	Recalls Repo
+
+	// The business day calendars processing
+	// dates are checked against
+	Calendars calendars.Calendars
+
+	// The direct debit mandates payments
+	// are collected against
+	Mandates Repo
+
+	// The fx quotes cross-currency
+	// payments are converted at
+	Quotes Repo
+
+	// The fingerprints of recent payments,
+	// used to spot duplicates
+	Fingerprints Repo
+
+	// The address books payments can pick their beneficiary
+	// from, and the bank accounts each organisation paid
+	// before, used to spot new beneficiaries
+	Beneficiaries Repo
+	Payees        Repo
+
+	// The account directory the beneficiary names
+	// of UK payments are checked against
+	Directory *cop.Directory
+
+	// The sanctions lists the parties
+	// of payments are screened against
+	Screener *screening.Screener
+
+	// The daily and monthly limits of organisations,
+	// payments are counted against as they are created
+	Limits *organisations.Limits
+
+	// What scores payments for fraud, if anything, and the
+	// score above which payments are held until reviewed
+	Scorer        risk.RiskScorer
+	RiskThreshold int
+
+	BaseUrl    string
+	MaxResults int
 }
 
 // PaymentsService represents a payments service
-// it defines the routes and the repo to operate
+// it defines the routes and the repos to operate
 // with. It inherits fields and functions from util.HttpService
 type PaymentsService struct {
 	HttpService
-	repo       Repo
-	maxResults int
+	repo          Repo
+	organisations Repo
+	accounts      Repo
+	ledger        Ledger
+	returns       Repo
+	reversals     Repo
+	recalls       Repo
+	calendars     calendars.Calendars
+	mandates      Repo
+	quotes        Repo
+	fingerprints  Repo
+	beneficiaries Repo
+	payees        Repo
+	directory     *cop.Directory
+	screener      *screening.Screener
+	limits        *organisations.Limits
+	scorer        risk.RiskScorer
+	riskThreshold int
+	maxResults    int
 }
 
 // New creates a new PaymentsService with the given
-// repo, base url and maxResults information
-func New(repo Repo, baseUrl string, maxResults int) *PaymentsService {
+// configuration
+func New(config Config) *PaymentsService {
 	return &PaymentsService{
 		HttpService: HttpService{
-			BaseUrl: baseUrl,
+			BaseUrl: config.BaseUrl,
 		},
-		repo:       repo,
-		maxResults: maxResults,
+		repo:          config.Repo,
+		organisations: config.Organisations,
+		accounts:      config.Accounts,
+		ledger:        config.Ledger,
+		returns:       config.Returns,
+		reversals:     config.Reversals,
+		recalls:       config.Recalls,
+		calendars:     config.Calendars,
+		mandates:      config.Mandates,
+		quotes:        config.Quotes,
+		fingerprints:  config.Fingerprints,
+		beneficiaries: config.Beneficiaries,
+		payees:        config.Payees,
+		directory:     config.Directory,
+		screener:      config.Screener,
+		limits:        config.Limits,
+		scorer:        config.Scorer,
+		riskThreshold: config.RiskThreshold,
+		maxResults:    config.MaxResults,
 	}
 }
 
@@ -50,17 +182,47 @@ func New(repo Repo, baseUrl string, maxResults int) *PaymentsService {
 func (s *PaymentsService) Routes() *chi.Mux {
 	router := chi.NewRouter()
 	router.Get("/payments", s.List)
-	router.Get("/payments/{id}", s.Fetch)
 	router.Post("/payments", s.Create)
-	router.Put("/payments/{id}", s.Update)
-	router.Delete("/payments/{id}", s.Delete)
+
+	owned := router.With(s.owned)
+	owned.Get("/payments/{id}", s.Fetch)
+	owned.Put("/payments/{id}", s.Update)
+	owned.Delete("/payments/{id}", s.Delete)
+	owned.Post("/payments/{id}/submissions", s.Submit)
+	owned.Post("/payments/{id}/approve", s.Approve)
+	owned.Post("/payments/{id}/reject", s.Reject)
+	owned.Get("/payments/{id}/returns", s.ListReturns)
+	owned.Post("/payments/{id}/returns", s.CreateReturn)
+	owned.Get("/payments/{id}/returns/{returnId}", s.FetchReturn)
+	owned.Get("/payments/{id}/reversals", s.ListReversals)
+	owned.Post("/payments/{id}/reversals", s.CreateReversal)
+	owned.Get("/payments/{id}/reversals/{reversalId}", s.FetchReversal)
+	owned.Get("/payments/{id}/recalls", s.ListRecalls)
+	owned.Post("/payments/{id}/recalls", s.CreateRecall)
+	owned.Get("/payments/{id}/recalls/{recallId}", s.FetchRecall)
+	owned.Put("/payments/{id}/recalls/{recallId}", s.UpdateRecall)
+
+	// Held payments are reviewed by admins only, so that
+	// clients cannot release the payments they create
+	reviews := owned.With(auth.Require(auth.PermissionAdmin))
+	reviews.Post("/payments/{id}/screening-review", s.ReviewScreening)
+	reviews.Post("/payments/{id}/risk-review", s.ReviewRisk)
 	return router
 }
 
 // List returns a list of payments. We return finite lists of payments
 // so we need to check the from and to query params, and make sure
-// they make sense. If they are not set, we fallback to defaults.
+// they make sense. If they are not set, we fallback to defaults. If
+// the as_of query param is set, payments are returned as they were
+// at that time. The organisation_id query param narrows the list down
+// to the payments of a single organisation, and principals only ever
+// see the payments of the organisations they can access
 func (s *PaymentsService) List(w http.ResponseWriter, r *http.Request) {
+	asOf, err := asOfFromRequest(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
 
 	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
 	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
@@ -79,7 +241,19 @@ func (s *PaymentsService) List(w http.ResponseWriter, r *http.Request) {
 		limit = s.maxResults
 	}
 
-	repoItems, err := s.repo.List(from, limit)
+	organisation, err := auth.FromRequest(r).Scope(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	var repoItems []*RepoItem
+	if asOf.IsZero() {
+		repoItems, err = s.repo.Find(RepoFilter{Organisation: organisation}, from, limit)
+	} else {
+		repoItems, err = s.repo.FindAt(RepoFilter{Organisation: organisation}, from, limit, asOf)
+	}
+
 	if err != nil {
 		HandleHttpError(w, r, http.StatusInternalServerError, err)
 		return
@@ -92,13 +266,18 @@ func (s *PaymentsService) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	filter := ""
+	if organisation != "" {
+		filter = fmt.Sprintf("organisation_id=%s&", url.QueryEscape(organisation))
+	}
+
 	// Render links
 	links := make(Links)
-	links["self"] = s.UrlFor(fmt.Sprintf(paymentsLinkPattern, from, to))
-	links["next"] = s.UrlFor(fmt.Sprintf(paymentsLinkPattern, to, to+limit))
+	links["self"] = s.UrlFor(fmt.Sprintf(paymentsLinkPattern, filter, from, to) + asOfQuery(asOf, "&"))
+	links["next"] = s.UrlFor(fmt.Sprintf(paymentsLinkPattern, filter, to, to+limit) + asOfQuery(asOf, "&"))
 
 	if from >= limit {
-		links["prev"] = s.UrlFor(fmt.Sprintf(paymentsLinkPattern, from-limit, from))
+		links["prev"] = s.UrlFor(fmt.Sprintf(paymentsLinkPattern, filter, from-limit, from) + asOfQuery(asOf, "&"))
 	}
 
 	// Send back the response
@@ -109,10 +288,23 @@ func (s *PaymentsService) List(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// Fetch a payment by id
+// Fetch a payment by id. If the as_of query param is set, we
+// return the version of the payment that was valid at that time
 func (s *PaymentsService) Fetch(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	found, err := s.repo.Fetch(&RepoItem{Id: id})
+	asOf, err := asOfFromRequest(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var found *RepoItem
+	if asOf.IsZero() {
+		found, err = s.repo.Fetch(&RepoItem{Id: id})
+	} else {
+		found, err = s.repo.FetchAt(&RepoItem{Id: id}, asOf)
+	}
+
 	if err != nil {
 		// Look for not found errors
 		if s.repo.IsNotFound(err) {
@@ -131,7 +323,8 @@ func (s *PaymentsService) Fetch(w http.ResponseWriter, r *http.Request) {
 
 	// Render links
 	links := make(Links)
-	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id))
+	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id) + asOfQuery(asOf, "?"))
+	s.withRelatedLinks(links, p)
 
 	// Send back the response
 	RenderJSON(w, r, http.StatusOK, &PaymentResponse{
@@ -155,7 +348,7 @@ func (s *PaymentsService) Delete(w http.ResponseWriter, r *http.Request) {
 
 	// Do a lookup in order to return a proper 404 if
 	// no record with that id exists
-	_, err = s.repo.Fetch(&RepoItem{Id: id})
+	found, err := s.repo.Fetch(&RepoItem{Id: id})
 	if err != nil {
 		// Look for not found errors
 		if s.repo.IsNotFound(err) {
@@ -166,9 +359,35 @@ func (s *PaymentsService) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Submitted payments can no longer be deleted
+	current, err := NewPaymentFromRepoItem(found)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if current.IsSubmitted() {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Payment already submitted: %s", id))
+		return
+	}
+
+	if err := heldOrRejected(current); err != nil {
+		HandleHttpError(w, r, http.StatusConflict, err)
+		return
+	}
+
+	// Let subscribers know about the deleted payment. The event
+	// is written to the outbox along with the deletion
+	deleted := &RepoItem{Id: id, Version: version}
+	err = s.withEvent(events.PaymentDeleted, found, deleted)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
 	// Delete the item from the repo assuming we are on the
 	// right version
-	err = s.repo.Delete(&RepoItem{Id: id, Version: version})
+	err = s.repo.Delete(deleted)
 	if err != nil {
 		// Look for not found errors again
 		errorCode := http.StatusInternalServerError
@@ -201,21 +420,166 @@ func (s *PaymentsService) Create(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("payment: %v", p)
 
-	// Validate the payment json
-	err = p.Validate()
-	if err != nil {
+	// Only the scheduler creates payments on behalf of a
+	// schedule, and only approved batches on their own behalf
+	p.Attributes.Schedule = ""
+	p.Attributes.Batch = ""
+	p.Attributes.CreatedBy = auth.AuthenticatedUser(r)
+	p.Attributes.CreatedWith = ""
+	if principal := auth.FromRequest(r); principal != nil {
+		p.Attributes.CreatedWith = principal.Id
+	}
+
+	// Principals can only create payments for
+	// the organisations they can access
+	if err := visible(r, p.Organisation); err != nil {
 		HandleHttpError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
+	// Look for recent payments this one might be a duplicate
+	// of, unless the client says it is not
+	p, duplicateOf, status, err := s.createPayment(p, &duplicates{
+		allowed: r.URL.Query().Get("allow_duplicate") == "true",
+	})
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, p.Id))
+
+	if duplicateOf != "" {
+		w.Header().Set("Warning", fmt.Sprintf(`199 - "Possible duplicate of payment %s"`, duplicateOf))
+		links["duplicate_of"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, duplicateOf))
+	}
+
+	// Everything went fine. Confirm back to the client
+	RenderJSON(w, r, http.StatusCreated, &PaymentResponse{
+		Data:  p,
+		Links: links,
+	})
+}
+
+// CreatePayment validates and saves the given new payment, along with
+// its payment.created event. This is what the Create handler does once
+// the payment is decoded, so that other services (eg. the scheduler)
+// can create payments too. Their fingerprints are taken, so that
+// payments created through the api are checked against them, but they
+// are never rejected as duplicates themselves, as they were approved
+// already (eg. along with their batch). Returns the http status code
+// to respond with on error
+func (s *PaymentsService) CreatePayment(p *Payment) (*Payment, int, error) {
+	p, _, status, err := s.createPayment(p, &duplicates{allowed: true})
+	return p, status, err
+}
+
+// duplicates tells how a new payment is checked for duplicates, and
+// whether it is created anyway if it looks like one
+type duplicates struct {
+	allowed bool
+}
+
+// createPayment does the work of CreatePayment. Payments are checked for
+// duplicates if told how to, in which case the id of the recent payment
+// the new one looks like a duplicate of, if any, is returned too
+func (s *PaymentsService) createPayment(p *Payment, dup *duplicates) (*Payment, string, int, error) {
+	// Look up the organisation that owns the payment
+	org, status, err := organisations.Lookup(s.organisations, p.Organisation)
+	if err != nil {
+		return nil, "", status, err
+	}
+
+	// Validate the payment json, against the
+	// organisation settings
+	p.Attributes.WithDefaults(org.Attributes.Settings)
+	err = p.Validate(org.Attributes.Settings)
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+
+	if status, err := s.withProcessingDate(p, org.Attributes.Settings); err != nil {
+		return nil, "", status, err
+	}
+
+	if _, status, err := s.debtorAccountOf(p); err != nil {
+		return nil, "", status, err
+	}
+
+	if _, status, err := s.mandateOf(p); err != nil {
+		return nil, "", status, err
+	}
+
+	if status, err := s.withBeneficiary(p); err != nil {
+		return nil, "", status, err
+	}
+
+	if status, err := s.withNewBeneficiary(p); err != nil {
+		return nil, "", status, err
+	}
+
+	if status, err := s.withPayeeCheck(p, org.Attributes.Settings); err != nil {
+		return nil, "", status, err
+	}
+
+	if status, err := s.withFX(p); err != nil {
+		return nil, "", status, err
+	}
+
+	if status, err := s.withApproval(p, org.Attributes.Settings, p.Attributes.CreatedBy); err != nil {
+		return nil, "", status, err
+	}
+
+	// New payments are not submitted yet. Those whose
+	// parties match a sanctions list are held
+	p.Attributes.Status = StatusCreated
+	p.Attributes.ReturnedAmount = ""
+	p.Attributes.ReturnAmounts = nil
+	p.Attributes.Reversal = ""
+	s.withScreening(p)
+
+	// Payments with a high fraud risk score are held too
+	if _, status, err := s.withRisk(p, risk.StageCreate); err != nil {
+		return nil, "", status, err
+	}
+
 	// try to save it. The database
 	// will do whatever integrity checks are necessary
 	repoItem, err := p.ToRepoItem()
 	if err != nil {
-		// check for conflicts
-		// or internal errors
-		HandleHttpError(w, r, http.StatusInternalServerError, err)
-		return
+		return nil, "", http.StatusInternalServerError, err
+	}
+
+	// New payments always start at version 0. The event
+	// is written to the outbox along with the payment
+	err = s.withEvent(events.PaymentCreated, &RepoItem{
+		Id:           repoItem.Id,
+		Organisation: repoItem.Organisation,
+		Attributes:   repoItem.Attributes,
+	}, repoItem)
+	if err != nil {
+		return nil, "", http.StatusInternalServerError, err
+	}
+
+	// Take the fingerprint of the payment, and give it back
+	// if the payment cannot be saved after all
+	duplicateOf := ""
+	release := func() {}
+	if dup != nil {
+		duplicateOf, release, status, err = s.reserveFingerprint(p, org.Attributes.Settings, dup.allowed)
+		if err != nil {
+			return nil, "", status, err
+		}
+	}
+
+	// Count the payment against the limits of the organisation,
+	// and give it back if the payment cannot be saved after all
+	amount, _ := ParseAmount(p.Attributes.Amount)
+	now := time.Now()
+	if status, err := s.reserve(org, p.Attributes.Currency, amount, now); err != nil {
+		release()
+		return nil, "", status, err
 	}
 
 	// Create the repo item for the payment
@@ -223,31 +587,26 @@ func (s *PaymentsService) Create(w http.ResponseWriter, r *http.Request) {
 	// concurrency and locking strategy.
 	createdItem, err := s.repo.Create(repoItem)
 	if err != nil {
+		release()
+		if err := s.limits.Release(org, p.Attributes.Currency, amount, now); err != nil {
+			log.Printf("Could not release payment %s from the limits of organisation %s: %v", p.Id, org.Id, err)
+		}
+
 		if s.repo.IsConflict(err) {
 			// We have a conflict, so return the appropiate
 			// status code
-			HandleHttpError(w, r, http.StatusConflict, err)
-		} else {
-			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return nil, "", http.StatusConflict, err
 		}
-
-		return
+		return nil, "", http.StatusInternalServerError, err
 	}
 
 	p, err = NewPaymentFromRepoItem(createdItem)
 	if err != nil {
-		HandleHttpError(w, r, http.StatusInternalServerError, err)
-		return
+		return nil, "", http.StatusInternalServerError, err
 	}
 
-	links := make(Links)
-	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, p.Id))
-
-	// Everything went fine. Confirm back to the client
-	RenderJSON(w, r, http.StatusCreated, &PaymentResponse{
-		Data:  p,
-		Links: links,
-	})
+	s.withPayee(p)
+	return p, duplicateOf, http.StatusCreated, nil
 }
 
 // Update an existing payment
@@ -262,9 +621,7 @@ func (s *PaymentsService) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate the payment json
-	err = p.Validate()
-	if err != nil {
+	if err := visible(r, p.Organisation); err != nil {
 		HandleHttpError(w, r, http.StatusBadRequest, err)
 		return
 	}
@@ -279,7 +636,7 @@ func (s *PaymentsService) Update(w http.ResponseWriter, r *http.Request) {
 
 	// Perform a lookup in order to return a proper 404
 	// code if no record with that id exists
-	_, err = s.repo.Fetch(&RepoItem{Id: id})
+	found, err := s.repo.Fetch(&RepoItem{Id: id})
 	if err != nil {
 		// Look for not found errors
 		if s.repo.IsNotFound(err) {
@@ -290,6 +647,139 @@ func (s *PaymentsService) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	current, err := NewPaymentFromRepoItem(found)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Payments stay with the organisation they were created for, so
+	// that the settings, limits and accounts of another one are never
+	// checked instead of theirs
+	if p.Organisation != current.Organisation {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("The organisation of payment %s cannot be changed", id))
+		return
+	}
+
+	// Look up the organisation that owns the payment
+	org, status, err := organisations.Lookup(s.organisations, p.Organisation)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	// Validate the payment json, against the
+	// organisation settings
+	p.Attributes.WithDefaults(org.Attributes.Settings)
+	err = p.Validate(org.Attributes.Settings)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// Submitted payments can no longer be changed. The
+	// status is managed by us, not by clients
+	if current.IsSubmitted() {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Payment already submitted: %s", id))
+		return
+	}
+
+	if err := heldOrRejected(current); err != nil {
+		HandleHttpError(w, r, http.StatusConflict, err)
+		return
+	}
+
+	p.Attributes.Status = current.Attributes.Status
+	p.Attributes.ReturnedAmount = current.Attributes.ReturnedAmount
+	p.Attributes.ReturnAmounts = current.Attributes.ReturnAmounts
+	p.Attributes.Reversal = current.Attributes.Reversal
+	p.Attributes.Schedule = current.Attributes.Schedule
+	p.Attributes.Batch = current.Attributes.Batch
+	p.Attributes.CreatedBy = current.Attributes.CreatedBy
+	p.Attributes.CreatedWith = current.Attributes.CreatedWith
+
+	// Saved beneficiaries are only expanded again if the payment
+	// refers to a different one, and beneficiaries are only new
+	// if the payment is made to a different bank account
+	if p.Attributes.Beneficiary != current.Attributes.Beneficiary {
+		if status, err := s.withBeneficiary(p); err != nil {
+			HandleHttpError(w, r, status, err)
+			return
+		}
+	}
+
+	p.Attributes.NewBeneficiary = current.Attributes.NewBeneficiary
+	if p.Attributes.BeneficiaryParty.key() != current.Attributes.BeneficiaryParty.key() {
+		if status, err := s.withNewBeneficiary(p); err != nil {
+			HandleHttpError(w, r, status, err)
+			return
+		}
+	}
+
+	// Payee names are only checked again if the beneficiary or
+	// currency change, so that payments let through with a
+	// warning can still be updated
+	if p.samePayee(current) {
+		p.Attributes.PayeeCheck = current.Attributes.PayeeCheck
+	} else if status, err := s.withPayeeCheck(p, org.Attributes.Settings); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	// Parties are only screened again if they change, so that
+	// released payments are not held again for the same hits
+	p.Attributes.Screening = current.Attributes.Screening
+	if !p.sameParties(current) {
+		s.withScreening(p)
+	}
+
+	// Risk is scored again when the payment is submitted
+	p.Attributes.Risk = current.Attributes.Risk
+
+	// Processing dates are only checked when they change, so
+	// that payments can still be updated once their day is past
+	if p.Attributes.ProcessingDate != current.Attributes.ProcessingDate ||
+		p.Attributes.Scheme != current.Attributes.Scheme {
+		if status, err := s.withProcessingDate(p, org.Attributes.Settings); err != nil {
+			HandleHttpError(w, r, status, err)
+			return
+		}
+	}
+
+	if _, status, err := s.debtorAccountOf(p); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	if _, status, err := s.mandateOf(p); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	// Payments are only converted again if their quote, amount
+	// or currency change, so that they can still be updated once
+	// their quote has expired
+	if p.Attributes.FX != nil && current.Attributes.FX != nil &&
+		p.Attributes.FX.Quote == current.Attributes.FX.Quote &&
+		p.Attributes.Amount == current.Attributes.Amount &&
+		p.Attributes.Currency == current.Attributes.Currency {
+		p.Attributes.FX = current.Attributes.FX
+	} else if status, err := s.withFX(p); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	// Approval is requested again if anything that makes the payment
+	// what it is changes, on behalf of the user changing it, so that
+	// approved payments cannot be changed and then submitted, and the
+	// user cannot approve the changes themselves
+	if p.sameInstruction(current) {
+		p.Attributes.Approval = current.Attributes.Approval
+	} else if status, err := s.withApproval(p, org.Attributes.Settings, auth.AuthenticatedUser(r)); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
 	// Convert the payment into a repo item
 	// Further validations can be done here, so we need
 	// to handle errors
@@ -299,11 +789,40 @@ func (s *PaymentsService) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Increases in the amount are counted against the limits of the
+	// organisation today, and given back if the update fails. Payments
+	// changed to another currency count in full in that currency
+	from, _ := ParseAmount(current.Attributes.Amount)
+	to, _ := ParseAmount(p.Attributes.Amount)
+	if current.Attributes.Currency != p.Attributes.Currency {
+		from = 0
+	}
+	now := time.Now()
+	if status, err := s.adjust(org, p.Attributes.Currency, from, to, now); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	// The event describes the payment as it will be once
+	// updated, with its version increased
+	err = s.withEvent(events.PaymentUpdated, &RepoItem{
+		Id:           repoItem.Id,
+		Version:      repoItem.Version + 1,
+		Organisation: repoItem.Organisation,
+		Attributes:   repoItem.Attributes,
+	}, repoItem)
+	if err != nil {
+		s.unadjust(org, p.Attributes.Currency, from, to, now)
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
 	// Update the payment. the repo implementation
 	// will implement the most appropriate concurrency and locking
 	// statregy
 	updatedItem, err := s.repo.Update(repoItem)
 	if err != nil {
+		s.unadjust(org, p.Attributes.Currency, from, to, now)
 		if s.repo.IsConflict(err) {
 			// We have a conflict, so return the appropiate
 			// status code
@@ -320,6 +839,8 @@ func (s *PaymentsService) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.withPayee(p)
+
 	// Render links
 	links := make(Links)
 	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id))
@@ -332,6 +853,555 @@ func (s *PaymentsService) Update(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Submit a payment. The payment amount is transferred from the
+// debtor account to the external ledger account, provided the debtor
+// account has enough funds, and the payment is marked as submitted.
+//
+// The ledger transfer and the payment update are not atomic. If the
+// update fails after the transfer was posted, submitting again finds
+// the transfer already posted, and only updates the payment
+func (s *PaymentsService) Submit(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	found, err := s.repo.Fetch(&RepoItem{Id: id})
+	if err != nil {
+		if s.repo.IsNotFound(err) {
+			HandleHttpError(w, r, http.StatusNotFound, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	p, err := NewPaymentFromRepoItem(found)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if p.IsSubmitted() {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Payment already submitted: %s", id))
+		return
+	}
+
+	if err := heldOrRejected(p); err != nil {
+		HandleHttpError(w, r, http.StatusConflict, err)
+		return
+	}
+
+	if p.AwaitsApproval() {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Payment %s awaits approval", id))
+		return
+	}
+
+	// The organisation might have been deactivated
+	// since the payment was created
+	if _, status, err := organisations.Lookup(s.organisations, p.Organisation); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	account, status, err := s.debtorAccountOf(p)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	if account == nil {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Payment has no debtor account: %s", id))
+		return
+	}
+
+	// The mandate might have been cancelled
+	// since the payment was created
+	if _, status, err := s.mandateOf(p); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	// Payments are scored again, as the risk may have grown since
+	// they were created. High risk payments are held instead
+	held, status, err := s.withRisk(p, risk.StageSubmit)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	if held {
+		if status, err := s.updateWithEvent(events.PaymentHeld, p); err != nil {
+			HandleHttpError(w, r, status, err)
+			return
+		}
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Payment %s is held for risk review, with a score of %d", id, p.Attributes.Risk.Score))
+		return
+	}
+
+	amount, err := ParseAmount(p.Attributes.Amount)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	err = s.ledger.Transfer(&LedgerTransfer{
+		Id:          fmt.Sprintf("payment:%s", p.Id),
+		Debit:       account.Id,
+		Credit:      LedgerExternal,
+		Amount:      amount,
+		Reference:   p.Id,
+		Description: fmt.Sprintf("Payment %s", p.Id),
+	})
+	if err != nil && !s.ledger.IsConflict(err) {
+		if s.ledger.IsInsufficientFunds(err) {
+			HandleHttpError(w, r, http.StatusUnprocessableEntity, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	p.Attributes.Status = StatusSubmitted
+	if status, err := s.updateWithEvent(events.PaymentSubmitted, p); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id))
+	links["debtor_account"] = s.UrlFor(fmt.Sprintf(accountLinkPattern, account.Id))
+
+	RenderJSON(w, r, http.StatusCreated, &PaymentResponse{
+		Data:  p,
+		Links: links,
+	})
+}
+
+// FetchPayment looks up a payment by id, so that other services
+// (eg. the scheduler) can tell which payment an id belongs to.
+// Returns the http status code that describes the error, if any
+func (s *PaymentsService) FetchPayment(id string) (*Payment, int, error) {
+	return s.fetchPayment(id)
+}
+
+// fetchPayment looks up a payment by id. Returns the http
+// status code to respond with on error
+func (s *PaymentsService) fetchPayment(id string) (*Payment, int, error) {
+	found, err := s.repo.Fetch(&RepoItem{Id: id})
+	if err != nil {
+		if s.repo.IsNotFound(err) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	p, err := NewPaymentFromRepoItem(found)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return p, http.StatusOK, nil
+}
+
+// updateWithEvent saves the given payment, along with an event of the
+// given type, describing the payment as it will be once updated. The
+// version of the payment is increased. Returns the http status code
+// to respond with on error
+func (s *PaymentsService) updateWithEvent(eventType string, p *Payment) (int, error) {
+	repoItem, err := p.ToRepoItem()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	err = s.withEvent(eventType, &RepoItem{
+		Id:           repoItem.Id,
+		Version:      repoItem.Version + 1,
+		Organisation: repoItem.Organisation,
+		Attributes:   repoItem.Attributes,
+	}, repoItem)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	updatedItem, err := s.repo.Update(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			return http.StatusConflict, err
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	p.Version = updatedItem.Version
+	return http.StatusOK, nil
+}
+
+// refund credits the given amount back to the debtor account of the
+// given payment, from the external account. Transfers are only
+// posted once, so retrying a refund is harmless
+func (s *PaymentsService) refund(p *Payment, transferId string, amount int64, description string) error {
+	if p.Attributes.DebtorAccount == "" {
+		return nil
+	}
+
+	err := s.ledger.Transfer(&LedgerTransfer{
+		Id:          transferId,
+		Debit:       LedgerExternal,
+		Credit:      p.Attributes.DebtorAccount,
+		Amount:      amount,
+		Reference:   p.Id,
+		Description: description,
+	})
+	if err != nil && !s.ledger.IsConflict(err) {
+		return err
+	}
+
+	return nil
+}
+
+// withRelatedLinks adds links to the mandate and fx quote of the
+// given payment, and to its recalls, returns or reversals, if it can have any
+func (s *PaymentsService) withRelatedLinks(links Links, p *Payment) {
+	if p.Attributes.Mandate != "" {
+		links["mandate"] = s.UrlFor(fmt.Sprintf(mandateLinkPattern, p.Attributes.Mandate))
+	}
+
+	if p.Attributes.FX != nil {
+		links["fx_quote"] = s.UrlFor(fmt.Sprintf(quoteLinkPattern, p.Attributes.FX.Quote))
+	}
+
+	if p.IsSubmitted() {
+		links["recalls"] = s.UrlFor(fmt.Sprintf(recallsLinkPattern, p.Id, 0, s.maxResults))
+	}
+
+	switch p.Attributes.Status {
+	case StatusPartiallyReturned, StatusReturned:
+		links["returns"] = s.UrlFor(fmt.Sprintf(returnsLinkPattern, p.Id, 0, s.maxResults))
+	case StatusReversed:
+		links["reversals"] = s.UrlFor(fmt.Sprintf(reversalsLinkPattern, p.Id))
+	}
+}
+
+// page reads the from and to query params, and returns
+// the limit to apply, capped to the maximum number of results
+func (s *PaymentsService) page(r *http.Request) (int, int, int, error) {
+	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
+	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
+
+	limit := to - from
+	if limit <= 0 {
+		return from, to, limit, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to)
+	}
+
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	return from, to, limit, nil
+}
+
+// withProcessingDate checks the processing date of the given payment,
+// if any, is a business day of its scheme. Otherwise, the date is
+// rolled forward to the next business day, unless the organisation
+// settings say such payments are rejected. Payments created from
+// schedules are always rolled forward. Returns the http status code to
+// respond with on error
+func (s *PaymentsService) withProcessingDate(p *Payment, settings organisations.Settings) (int, error) {
+	if p.Attributes.ProcessingDate == "" {
+		return http.StatusOK, nil
+	}
+
+	date, err := s.calendars.For(p.Attributes.Scheme).NextBusinessDay(p.Attributes.ProcessingDate, time.Now())
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if date != p.Attributes.ProcessingDate {
+		if settings.RejectsNonProcessingDays() && p.Attributes.Schedule == "" {
+			return http.StatusBadRequest, fmt.Errorf("Processing date %s is not a business day of scheme %s, the next one is %s", p.Attributes.ProcessingDate, p.Attributes.Scheme, date)
+		}
+		p.Attributes.ProcessingDate = date
+	}
+
+	return http.StatusOK, nil
+}
+
+// debtorAccountOf looks up the debtor account of the given payment, if
+// any. The account must belong to the organisation of the payment, and
+// be in the currency of the payment. Returns the http status code to
+// respond with on error
+func (s *PaymentsService) debtorAccountOf(p *Payment) (*accounts.Account, int, error) {
+	if p.Attributes.DebtorAccount == "" {
+		return nil, http.StatusOK, nil
+	}
+
+	account, err := accounts.Fetch(s.accounts, p.Attributes.DebtorAccount)
+	if err != nil {
+		if s.accounts.IsNotFound(err) {
+			return nil, http.StatusBadRequest, fmt.Errorf("Unknown debtor account: %s", p.Attributes.DebtorAccount)
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if account.Organisation != p.Organisation {
+		return nil, http.StatusBadRequest, fmt.Errorf("Debtor account %s does not belong to organisation %s", account.Id, p.Organisation)
+	}
+
+	if p.Attributes.Currency != "" && p.Attributes.Currency != account.Attributes.Currency {
+		return nil, http.StatusBadRequest, fmt.Errorf("Debtor account %s is not in %s", account.Id, p.Attributes.Currency)
+	}
+
+	return account, http.StatusOK, nil
+}
+
+// mandateOf looks up the direct debit mandate of the given payment, if
+// any. Direct debits are Bacs only. The mandate must belong to the
+// organisation of the payment, be active, and the debtor party of the
+// payment must be the payer of the mandate. Returns the http status
+// code to respond with on error
+func (s *PaymentsService) mandateOf(p *Payment) (*mandates.Mandate, int, error) {
+	if p.Attributes.Mandate == "" {
+		return nil, http.StatusOK, nil
+	}
+
+	if !strings.EqualFold(p.Attributes.Scheme, "BACS") {
+		return nil, http.StatusBadRequest, fmt.Errorf("Direct debits are not supported by scheme %s", p.Attributes.Scheme)
+	}
+
+	mandate, err := mandates.Fetch(s.mandates, p.Attributes.Mandate)
+	if err != nil {
+		if s.mandates.IsNotFound(err) {
+			return nil, http.StatusBadRequest, fmt.Errorf("Unknown mandate: %s", p.Attributes.Mandate)
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if mandate.Organisation != p.Organisation {
+		return nil, http.StatusBadRequest, fmt.Errorf("Mandate %s does not belong to organisation %s", mandate.Id, p.Organisation)
+	}
+
+	if !mandate.IsActive() {
+		return nil, http.StatusBadRequest, fmt.Errorf("Mandate %s is not active", mandate.Id)
+	}
+
+	debtor := p.Attributes.DebtorParty
+	if debtor == nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Payment has no debtor party: %s", p.Id)
+	}
+
+	if !mandate.Matches(debtor.AccountNumber, debtor.BankId) {
+		return nil, http.StatusBadRequest, fmt.Errorf("Debtor party does not match the payer of mandate %s", mandate.Id)
+	}
+
+	return mandate, http.StatusOK, nil
+}
+
+// reserve counts a new payment of the given amount and currency
+// against the limits of the given organisation. Returns the http
+// status code to respond with on error
+func (s *PaymentsService) reserve(org *organisations.Organisation, currency string, amount int64, at time.Time) (int, error) {
+	if err := s.limits.Reserve(org, currency, amount, at); err != nil {
+		if organisations.IsLimitExceeded(err) {
+			return http.StatusUnprocessableEntity, err
+		}
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// adjust counts the increase in the amount of an existing payment
+// against the limits of the given organisation. Returns the http
+// status code to respond with on error
+func (s *PaymentsService) adjust(org *organisations.Organisation, currency string, from int64, to int64, at time.Time) (int, error) {
+	if err := s.limits.Adjust(org, currency, from, to, at); err != nil {
+		if organisations.IsLimitExceeded(err) {
+			return http.StatusUnprocessableEntity, err
+		}
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// unadjust gives back the increase in the amount of a payment
+// that could not be updated after all
+func (s *PaymentsService) unadjust(org *organisations.Organisation, currency string, from int64, to int64, at time.Time) {
+	if err := s.limits.Unadjust(org, currency, from, to, at); err != nil {
+		log.Printf("Could not give back the limits of organisation %s: %v", org.Id, err)
+	}
+}
+
+// withFX converts the given payment at the rate of its fx quote, if
+// any. The quote must belong to the organisation of the payment, not be
+// expired, and sell the currency of the payment. Returns the http
+// status code to respond with on error
+func (s *PaymentsService) withFX(p *Payment) (int, error) {
+	if p.Attributes.FX == nil || p.Attributes.FX.Quote == "" {
+		p.Attributes.FX = nil
+		return http.StatusOK, nil
+	}
+
+	quote, err := fx.Fetch(s.quotes, p.Attributes.FX.Quote)
+	if err != nil {
+		if s.quotes.IsNotFound(err) {
+			return http.StatusBadRequest, fmt.Errorf("Unknown fx quote: %s", p.Attributes.FX.Quote)
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	if quote.Organisation != p.Organisation {
+		return http.StatusBadRequest, fmt.Errorf("Fx quote %s does not belong to organisation %s", quote.Id, p.Organisation)
+	}
+
+	if quote.IsExpired(time.Now()) {
+		return http.StatusBadRequest, fmt.Errorf("Fx quote %s expired on %s", quote.Id, quote.Attributes.ExpiresOn.Format(time.RFC3339))
+	}
+
+	if p.Attributes.Currency != quote.Attributes.SellCurrency {
+		return http.StatusBadRequest, fmt.Errorf("Fx quote %s does not sell %s", quote.Id, p.Attributes.Currency)
+	}
+
+	amount, err := ParseAmount(p.Attributes.Amount)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	converted, err := fx.Convert(amount, quote.Attributes.ExchangeRate)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	p.Attributes.FX = &FX{
+		Quote:             quote.Id,
+		ContractReference: quote.Attributes.ContractReference,
+		ExchangeRate:      quote.Attributes.ExchangeRate,
+		ConvertedAmount:   FormatAmount(converted),
+		ConvertedCurrency: quote.Attributes.BuyCurrency,
+	}
+
+	return http.StatusOK, nil
+}
+
+// The number of times we try to take the fingerprint of a payment,
+// if other payments with the same fingerprint keep taking it first
+const fingerprintAttempts = 3
+
+// reserveFingerprint records the given payment as the latest one with its
+// fingerprint, before it is saved, and returns the id of the recent
+// payment it looks like a duplicate of, if any, and if its organisation
+// looks for duplicates. Organisations can choose to reject duplicates
+// with a 409, unless explicitly allowed. Fingerprints are created, or
+// updated with their version, so that of two payments with the same
+// fingerprint created at once, only one takes it, and the other one is
+// checked against it. The returned function gives the fingerprint back,
+// for when the payment cannot be saved after all. Returns the http
+// status code to respond with on error
+func (s *PaymentsService) reserveFingerprint(p *Payment, settings organisations.Settings, allowed bool) (string, func(), int, error) {
+	bytes, err := json.Marshal(&Fingerprint{
+		Payment:   p.Id,
+		CreatedOn: time.Now().UTC(),
+	})
+	if err != nil {
+		return "", nil, http.StatusInternalServerError, errors.Wrap(err, "Unable to serialize fingerprint")
+	}
+
+	for attempt := 0; attempt < fingerprintAttempts; attempt++ {
+		item := &RepoItem{
+			Id:           p.Fingerprint(),
+			Organisation: p.Organisation,
+			Attributes:   string(bytes),
+		}
+
+		var previous Fingerprint
+		found, err := s.fingerprints.Fetch(&RepoItem{Id: item.Id})
+		exists := err == nil
+		if err != nil && !s.fingerprints.IsNotFound(err) {
+			return "", nil, http.StatusInternalServerError, err
+		}
+
+		if exists {
+			if err := json.Unmarshal([]byte(found.Attributes), &previous); err != nil {
+				return "", nil, http.StatusInternalServerError, errors.Wrap(err, "Error parsing fingerprint")
+			}
+		}
+
+		// Scheduled payments repeat the same instruction on purpose,
+		// and are never created twice, as their ids are derived
+		duplicateOf := ""
+		if settings.ChecksDuplicates() && p.Attributes.Schedule == "" && previous.Payment != "" &&
+			previous.Payment != p.Id && time.Since(previous.CreatedOn) <= settings.DuplicatesWithin() {
+			duplicateOf = previous.Payment
+		}
+
+		if duplicateOf != "" && settings.RejectsDuplicates() && !allowed {
+			return duplicateOf, nil, http.StatusConflict, fmt.Errorf("Payment %s looks like a duplicate of payment %s", p.Id, duplicateOf)
+		}
+
+		var reserved *RepoItem
+		if exists {
+			item.Version = found.Version
+			reserved, err = s.fingerprints.Update(item)
+		} else {
+			reserved, err = s.fingerprints.Create(item)
+		}
+
+		if err == nil {
+			return duplicateOf, func() { s.releaseFingerprint(reserved, &previous) }, http.StatusOK, nil
+		}
+
+		// Another payment took the fingerprint
+		// first, so we check against it
+		if !s.fingerprints.IsConflict(err) {
+			return "", nil, http.StatusInternalServerError, err
+		}
+	}
+
+	return "", nil, http.StatusConflict, fmt.Errorf("Unable to take the fingerprint of payment %s", p.Id)
+}
+
+// releaseFingerprint gives back the fingerprint taken for a payment
+// that could not be saved, by recording again what it recorded
+// before, unless another payment took it in the meantime. Failing to
+// do so only means a duplicate might be reported where there is none,
+// so errors are logged, not returned
+func (s *PaymentsService) releaseFingerprint(reserved *RepoItem, previous *Fingerprint) {
+	bytes, err := json.Marshal(previous)
+	if err != nil {
+		log.Printf("Unable to serialize fingerprint %s: %v", reserved.Id, err)
+		return
+	}
+
+	_, err = s.fingerprints.Update(&RepoItem{
+		Id:           reserved.Id,
+		Version:      reserved.Version,
+		Organisation: reserved.Organisation,
+		Attributes:   string(bytes),
+	})
+	if err != nil {
+		log.Printf("Unable to release fingerprint %s: %v", reserved.Id, err)
+	}
+}
+
+// asOfFromRequest parses the as_of query param, as a RFC 3339
+// timestamp. Returns a zero time if not set
+func asOfFromRequest(r *http.Request) (time.Time, error) {
+	var asOf time.Time
+	asOfQP := strings.TrimSpace(r.URL.Query().Get("as_of"))
+	if asOfQP == "" {
+		return asOf, nil
+	}
+
+	asOf, err := time.Parse(time.RFC3339Nano, asOfQP)
+	if err != nil {
+		return asOf, errors.Wrap(err, "Invalid as_of query param")
+	}
+	return asOf, nil
+}
+
+// asOfQuery renders the given time as a as_of query param, to
+// be appended to links, after the given separator
+func asOfQuery(asOf time.Time, separator string) string {
+	if asOf.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%sas_of=%s", separator, url.QueryEscape(asOf.Format(time.RFC3339Nano)))
+}
+
 // decodePayment is a convenience function that attempts to
 // decode a payment from the HTTP request body.
 func decodePayment(r *http.Request) (*Payment, error) {
@@ -340,3 +1410,28 @@ func decodePayment(r *http.Request) (*Payment, error) {
 	err := decoder.Decode(&pr)
 	return pr.Payment, err
 }
+
+// withEvent adds a new event of the given type to the outbox of the
+// target repo item. The event data is the payment held by the given
+// snapshot repo item. The repo saves outbox messages in the same
+// transaction as the item itself, so that no event is lost, or emitted
+// for a change that was not saved
+func (s *PaymentsService) withEvent(eventType string, snapshot *RepoItem, target *RepoItem) error {
+	p, err := NewPaymentFromRepoItem(snapshot)
+	if err != nil {
+		return err
+	}
+
+	e, err := events.NewEvent(eventType, p.Organisation, p.Id, p)
+	if err != nil {
+		return err
+	}
+
+	m, err := e.ToOutboxMessage()
+	if err != nil {
+		return err
+	}
+
+	target.Outbox = append(target.Outbox, m)
+	return nil
+}
@@ -0,0 +1,177 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/events"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"time"
+)
+
+// The decisions a held payment can be reviewed with, and
+// what they are recorded as on the payment
+const (
+	ReviewRelease = "release"
+	ReviewReject  = "reject"
+
+	OutcomeReleased = "released"
+	OutcomeRejected = "rejected"
+)
+
+// Review captures the decision taken on why a payment was held
+type Review struct {
+	Decision string `json:"decision"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// ReviewRequest represents a http request that contains
+// a review in its field 'data'
+type ReviewRequest struct {
+	Review *Review `json:"data"`
+}
+
+// ReviewOutcome captures the decision taken on review of one
+// of the reasons a payment was held for, who took it and when, and
+// any comment the reviewer left
+type ReviewOutcome struct {
+	Decision   string     `json:"decision,omitempty"`
+	Comment    string     `json:"comment,omitempty"`
+	ReviewedBy string     `json:"reviewed_by,omitempty"`
+	ReviewedOn *time.Time `json:"reviewed_on,omitempty"`
+}
+
+// ReviewScreening releases or rejects a payment held because its
+// parties matched a sanctions list. Released payments can be changed
+// and submitted again, unless still held for another review. Rejected
+// payments are kept, but can no longer be changed, deleted or submitted
+func (s *PaymentsService) ReviewScreening(w http.ResponseWriter, r *http.Request) {
+	s.review(w, r, "sanctions screening", func(p *Payment) *ReviewOutcome {
+		if p.Attributes.Screening == nil {
+			return nil
+		}
+		return &p.Attributes.Screening.ReviewOutcome
+	})
+}
+
+// review records the decision in the request on the outcome returned by
+// the given function, for the payment in the request path. The function
+// returns nil when the payment was not held for that review. Payments
+// are released once none of their reviews are pending. Payments cannot
+// be reviewed by the principal, or the user, they were created by
+func (s *PaymentsService) review(w http.ResponseWriter, r *http.Request, reason string, outcomeOf func(*Payment) *ReviewOutcome) {
+	decoder := json.NewDecoder(r.Body)
+	var rr ReviewRequest
+	err := decoder.Decode(&rr)
+	if err == nil && rr.Review == nil {
+		err = fmt.Errorf("No review data")
+	}
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	p, status, err := s.fetchPayment(id)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	outcome := outcomeOf(p)
+	if !p.IsHeld() || outcome == nil || outcome.Decision != "" {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Payment %s is not held for %s review, it is %s", id, reason, p.Attributes.Status))
+		return
+	}
+
+	reviewer := auth.UserFromRequest(r)
+	principal := auth.FromRequest(r)
+	if principal != nil {
+		if principal.Id == p.Attributes.CreatedWith {
+			HandleHttpError(w, r, http.StatusForbidden, fmt.Errorf("Payment %s cannot be reviewed by %s, who created it", id, principal.Id))
+			return
+		}
+
+		if reviewer == "" {
+			reviewer = principal.Id
+		}
+	}
+
+	if reviewer != "" && reviewer == p.Attributes.CreatedBy {
+		HandleHttpError(w, r, http.StatusForbidden, fmt.Errorf("Payment %s cannot be reviewed by %s, who created it", id, reviewer))
+		return
+	}
+
+	var eventType string
+	switch rr.Review.Decision {
+	case ReviewRelease:
+		outcome.Decision = OutcomeReleased
+		eventType = events.PaymentUpdated
+	case ReviewReject:
+		outcome.Decision = OutcomeRejected
+		p.Attributes.Status = StatusRejected
+		eventType = events.PaymentRejected
+	default:
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Invalid review decision: %s", rr.Review.Decision))
+		return
+	}
+
+	now := time.Now().UTC()
+	outcome.Comment = rr.Review.Comment
+	outcome.ReviewedBy = reviewer
+	outcome.ReviewedOn = &now
+
+	if p.IsHeld() && !p.pendingReview() {
+		p.Attributes.Status = StatusCreated
+		eventType = events.PaymentReleased
+	}
+
+	if status, err := s.updateWithEvent(eventType, p); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id))
+	s.withRelatedLinks(links, p)
+
+	RenderJSON(w, r, http.StatusOK, &PaymentResponse{
+		Data:  p,
+		Links: links,
+	})
+}
+
+// withScreening screens the debtor and beneficiary parties of the given
+// payment against our sanctions lists. Payments with hits are held until
+// reviewed. Payments with no hits carry no screening
+func (s *PaymentsService) withScreening(p *Payment) {
+	hits := s.screener.Screen(
+		p.Attributes.DebtorParty.subject("debtor"),
+		p.Attributes.BeneficiaryParty.subject("beneficiary"))
+
+	if len(hits) == 0 {
+		p.Attributes.Screening = nil
+		return
+	}
+
+	p.Attributes.Status = StatusHeld
+	p.Attributes.Screening = &Screening{
+		Hits:       hits,
+		ScreenedOn: time.Now().UTC(),
+	}
+}
+
+// heldOrRejected returns an error if the given payment is held for
+// review, or was rejected, either on review or by its approver. Such
+// payments cannot be changed, deleted or submitted
+func heldOrRejected(p *Payment) error {
+	switch {
+	case p.IsHeld():
+		return fmt.Errorf("Payment %s is held for review", p.Id)
+	case p.IsRejected():
+		return fmt.Errorf("Payment %s was rejected on review", p.Id)
+	}
+	return nil
+}
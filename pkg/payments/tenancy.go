@@ -0,0 +1,62 @@
+package payments
+
+import (
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+)
+
+// owned guards the routes of a single payment, and of its returns,
+// reversals and recalls. Payments of organisations the principal of the
+// request cannot access are not found, rather than forbidden, so that
+// tenants cannot tell the ids of each other's payments apart from
+// unknown ones. Payments that do not exist, at least not anymore, are
+// left to the handlers, which know how to report them
+func (s *PaymentsService) owned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.FromRequest(r)
+		if principal == nil || principal.CanAccess(auth.AllOrganisations) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		found, err := s.repo.Fetch(&RepoItem{Id: id})
+
+		// Deleted payments can still be read as they were before,
+		// so we look them up at that time too
+		if err != nil && s.repo.IsNotFound(err) {
+			if asOf, e := asOfFromRequest(r); e == nil && !asOf.IsZero() {
+				found, err = s.repo.FetchAt(&RepoItem{Id: id}, asOf)
+			}
+		}
+
+		if err != nil {
+			if s.repo.IsNotFound(err) {
+				next.ServeHTTP(w, r)
+			} else {
+				HandleHttpError(w, r, http.StatusInternalServerError, err)
+			}
+			return
+		}
+
+		if !principal.CanAccess(found.Organisation) {
+			HandleHttpError(w, r, http.StatusNotFound, fmt.Errorf("Principal %s cannot access payment %s", principal.Id, id))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// visible returns an error if the given organisation cannot be
+// accessed by the principal of the given request. This is the same
+// error as for unknown organisations, for the same reasons as above
+func visible(r *http.Request, organisation string) error {
+	if !auth.FromRequest(r).CanSee(organisation) {
+		return fmt.Errorf("Unknown organisation: %s", organisation)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package risk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+// Callout scores payments by posting them, as json, to an external
+// scoring service, which is expected to respond with an assessment,
+// eg. {"score": 80, "rules": ["mule_account"]}
+type Callout struct {
+	url    string
+	client *http.Client
+}
+
+// NewCallout returns a new scorer that posts to
+// the given url, with the given timeout
+func NewCallout(url string, timeout time.Duration) *Callout {
+	return &Callout{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Score posts the subject to the scoring service. Any response
+// other than a 2xx, with a valid assessment, is treated as an error
+func (c *Callout) Score(subject *Subject) (*Assessment, error) {
+	body, err := json.Marshal(subject)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to serialize risk subject")
+	}
+
+	res, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to call the risk scoring service")
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("Unable to score payment %s: got status %v", subject.Payment, res.StatusCode)
+	}
+
+	var a Assessment
+	if err := json.NewDecoder(res.Body).Decode(&a); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse risk assessment")
+	}
+
+	if a.Score < 0 || a.Score > MaxScore {
+		return nil, fmt.Errorf("Invalid risk score for payment %s: %v", subject.Payment, a.Score)
+	}
+
+	if a.Rules == nil {
+		a.Rules = []string{}
+	}
+
+	return &a, nil
+}
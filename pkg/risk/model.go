@@ -0,0 +1,65 @@
+// risk scores payments for the likelihood of fraud, as they are created
+// and submitted, either with our own rules, or by calling out to an
+// external scoring service. Payments scored above a threshold are held
+// until reviewed
+package risk
+
+import (
+	"time"
+)
+
+// The stages of the life of a payment it is scored at
+const (
+	StageCreate = "create"
+	StageSubmit = "submit"
+)
+
+// DefaultThreshold is the score, from 0 to 100, above which
+// payments are held until reviewed
+const DefaultThreshold = 70
+
+// MaxScore is the highest score a payment can get
+const MaxScore = 100
+
+// Subject captures what a payment is scored on
+type Subject struct {
+	Stage        string    `json:"stage"`
+	Payment      string    `json:"payment_id"`
+	Organisation string    `json:"organisation_id"`
+	Amount       int64     `json:"amount"`
+	Currency     string    `json:"currency,omitempty"`
+	Scheme       string    `json:"scheme,omitempty"`
+	At           time.Time `json:"at"`
+
+	// The bank account of the beneficiary (eg. bank id and account
+	// number), whether the organisation never paid it before, and
+	// the countries the parties are based in, if known
+	Beneficiary        string `json:"beneficiary,omitempty"`
+	NewBeneficiary     bool   `json:"new_beneficiary"`
+	BeneficiaryCountry string `json:"beneficiary_country,omitempty"`
+	DebtorCountry      string `json:"debtor_country,omitempty"`
+}
+
+// Assessment captures the score of a payment, from 0 (no risk)
+// to 100, and the names of the rules that made up the score
+type Assessment struct {
+	Score int      `json:"score"`
+	Rules []string `json:"rules"`
+}
+
+// RiskScorer is anything able to score payments
+// for the likelihood of fraud
+type RiskScorer interface {
+	Score(subject *Subject) (*Assessment, error)
+}
+
+// capped keeps a score within the range of valid scores
+func capped(score int) int {
+	switch {
+	case score < 0:
+		return 0
+	case score > MaxScore:
+		return MaxScore
+	}
+	return score
+}
@@ -0,0 +1,265 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// The types of rules the engine supports
+const (
+	RuleAmount         = "amount"
+	RuleNewBeneficiary = "new_beneficiary"
+	RuleVelocity       = "velocity"
+	RuleCountry        = "country"
+)
+
+// How many times the recent payments of an organisation are read
+// and written again, when someone else changed them in between
+const historyAttempts = 10
+
+// Rule adds its score to payments it matches:
+//
+// - amount rules match payments above the given amount, optionally
+// in a given currency
+//
+// - new_beneficiary rules match payments to a bank account the
+// organisation never paid before
+//
+// - velocity rules match payments of organisations that created
+// more than the given count of payments within the given window
+//
+// - country rules match payments whose debtor or beneficiary
+// is based in one of the given countries
+type Rule struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Score     int      `json:"score"`
+	Above     string   `json:"above,omitempty"`
+	Currency  string   `json:"currency,omitempty"`
+	Count     int      `json:"count,omitempty"`
+	Window    string   `json:"window,omitempty"`
+	Countries []string `json:"countries,omitempty"`
+
+	// The amount and window, parsed
+	above  int64
+	window time.Duration
+}
+
+// LoadRules reads the rules of the engine from the given json
+// file, as a list of rules. A missing file means there are no rules
+func LoadRules(file string) ([]*Rule, error) {
+	rules := []*Rule{}
+
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rules, nil
+		}
+		return nil, errors.Wrapf(err, "Unable to read risk rules %s", file)
+	}
+
+	if err := json.Unmarshal(bytes, &rules); err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse risk rules %s", file)
+	}
+
+	for _, r := range rules {
+		if err := r.parse(); err != nil {
+			return nil, errors.Wrapf(err, "Invalid risk rule %s in %s", r.Name, file)
+		}
+	}
+
+	return rules, nil
+}
+
+// parse validates the rule, and parses its amount and window
+func (r *Rule) parse() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("Name is empty")
+	}
+
+	if r.Score < 0 || r.Score > MaxScore {
+		return fmt.Errorf("Invalid score: %v", r.Score)
+	}
+
+	switch r.Type {
+	case RuleAmount:
+		above, err := ParseAmount(r.Above)
+		if err != nil {
+			return errors.Wrap(err, "Invalid amount")
+		}
+		r.above = above
+	case RuleNewBeneficiary:
+	case RuleVelocity:
+		window, err := time.ParseDuration(r.Window)
+		if err != nil {
+			return errors.Wrap(err, "Invalid window")
+		}
+		if window <= 0 || r.Count <= 0 {
+			return errors.New("Window and count must be positive")
+		}
+		r.window = window
+	case RuleCountry:
+		if len(r.Countries) == 0 {
+			return errors.New("No countries")
+		}
+	default:
+		return fmt.Errorf("Invalid type: %s", r.Type)
+	}
+
+	return nil
+}
+
+// matches returns true if the rule matches the given subject, given
+// the times of the recent payments of its organisation
+func (r *Rule) matches(s *Subject, recent []time.Time) bool {
+	switch r.Type {
+	case RuleAmount:
+		return s.Amount > r.above && (r.Currency == "" || r.Currency == s.Currency)
+	case RuleNewBeneficiary:
+		return s.NewBeneficiary
+	case RuleVelocity:
+		count := 0
+		for _, at := range recent {
+			if !at.Before(s.At.Add(-r.window)) {
+				count++
+			}
+		}
+		return count > r.Count
+	case RuleCountry:
+		for _, c := range r.Countries {
+			if strings.EqualFold(c, s.BeneficiaryCountry) || strings.EqualFold(c, s.DebtorCountry) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Engine scores payments with our own rules. The score of a payment
+// is the sum of the scores of the rules it matches. The recent payments
+// of each organisation, that velocity rules need, are remembered in the
+// given repo, as payments are scored
+type Engine struct {
+	rules  []*Rule
+	repo   Repo
+	window time.Duration
+}
+
+// NewEngine returns a new rule engine, with the given rules, that
+// remembers what it saw in the given repo
+func NewEngine(rules []*Rule, repo Repo) *Engine {
+	e := &Engine{rules: rules, repo: repo}
+	for _, r := range rules {
+		if r.window > e.window {
+			e.window = r.window
+		}
+	}
+	return e
+}
+
+// recentPayment records when a payment was first scored
+type recentPayment struct {
+	Payment string    `json:"payment_id"`
+	At      time.Time `json:"at"`
+}
+
+// Score scores the given subject with all the rules of the engine
+func (e *Engine) Score(s *Subject) (*Assessment, error) {
+	recent, err := e.recentPayments(s)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Assessment{Rules: []string{}}
+	for _, r := range e.rules {
+		if r.matches(s, recent) {
+			a.Score += r.Score
+			a.Rules = append(a.Rules, r.Name)
+		}
+	}
+
+	a.Score = capped(a.Score)
+	return a, nil
+}
+
+// recentPayments returns when the payments of the organisation were
+// first scored, within the longest window of the velocity rules. The
+// payment being scored is remembered too
+func (e *Engine) recentPayments(s *Subject) ([]time.Time, error) {
+	if !e.uses(RuleVelocity) {
+		return nil, nil
+	}
+
+	id := fmt.Sprintf("velocity:%s", s.Organisation)
+	for attempt := 0; attempt < historyAttempts; attempt++ {
+		payments := []recentPayment{}
+		version := -1
+
+		found, err := e.repo.Fetch(&RepoItem{Id: id})
+		if err == nil {
+			if err := json.NewDecoder(strings.NewReader(found.Attributes)).Decode(&payments); err != nil {
+				return nil, errors.Wrap(err, "Error parsing recent payments")
+			}
+			version = found.Version
+		} else if !e.repo.IsNotFound(err) {
+			return nil, err
+		}
+
+		// Forget the payments out of every window, and
+		// remember the one being scored, once
+		recent := []recentPayment{}
+		times := []time.Time{}
+		seen := false
+		for _, p := range payments {
+			if p.At.Before(s.At.Add(-e.window)) {
+				continue
+			}
+			seen = seen || p.Payment == s.Payment
+			recent = append(recent, p)
+			times = append(times, p.At)
+		}
+
+		if !seen {
+			recent = append(recent, recentPayment{Payment: s.Payment, At: s.At})
+			times = append(times, s.At)
+		}
+
+		bytes, err := json.Marshal(recent)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to serialize recent payments")
+		}
+
+		item := &RepoItem{Id: id, Version: version, Organisation: s.Organisation, Attributes: string(bytes)}
+		if version < 0 {
+			_, err = e.repo.Create(item)
+		} else {
+			_, err = e.repo.Update(item)
+		}
+
+		if err == nil {
+			return times, nil
+		}
+
+		if !e.repo.IsConflict(err) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("Unable to update the recent payments of organisation %s, too many concurrent payments", s.Organisation)
+}
+
+// uses returns true if any of the rules of the engine is of the given type
+func (e *Engine) uses(ruleType string) bool {
+	for _, r := range e.rules {
+		if r.Type == ruleType {
+			return true
+		}
+	}
+	return false
+}
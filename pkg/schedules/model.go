@@ -0,0 +1,371 @@
+package schedules
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/calendars"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	"github.com/pedro-gutierrez/form3/pkg/payments"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// The states a schedule can be in. Active schedules are picked up
+// by the scheduler. Paused schedules are skipped until resumed.
+// Cancelled and completed schedules never create payments again
+const (
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+)
+
+// statusTransitions are the states a schedule can be moved to by
+// clients, from each of the states it can be in
+var statusTransitions = map[string][]string{
+	StatusActive: {StatusPaused, StatusCancelled},
+	StatusPaused: {StatusActive, StatusCancelled},
+}
+
+// The frequencies payments can recur at
+const (
+	Weekly          = "weekly"
+	Monthly         = "monthly"
+	LastBusinessDay = "last_business_day"
+)
+
+// Recurrence describes how often a schedule creates a payment
+type Recurrence struct {
+	// One of weekly, monthly or last_business_day
+	Frequency string `json:"frequency"`
+
+	// The first day payments can be created on. Weekly and monthly
+	// payments are created on the same weekday, or day of the month,
+	// as the start date. Monthly payments fall on the last day of
+	// shorter months
+	StartDate string `json:"start_date"`
+
+	// The last day payments can be created on. Optional
+	EndDate string `json:"end_date,omitempty"`
+}
+
+// Validate does semantic validation on the recurrence
+func (rc *Recurrence) Validate() error {
+	switch rc.Frequency {
+	case Weekly, Monthly, LastBusinessDay:
+	default:
+		return fmt.Errorf("Invalid frequency: %s", rc.Frequency)
+	}
+
+	start, err := ParseDate(rc.StartDate)
+	if err != nil {
+		return errors.Wrap(err, "Invalid start date")
+	}
+
+	if rc.StartDate < Today() {
+		return fmt.Errorf("Start date is in the past: %s", rc.StartDate)
+	}
+
+	if rc.EndDate != "" {
+		end, err := ParseDate(rc.EndDate)
+		if err != nil {
+			return errors.Wrap(err, "Invalid end date")
+		}
+
+		if end.Before(start) {
+			return fmt.Errorf("End date is before the start date: %s", rc.EndDate)
+		}
+	}
+
+	return nil
+}
+
+// First returns the date of the first payment of the recurrence.
+// Business days are taken from the given calendar
+func (rc *Recurrence) First(cal *calendars.Calendar) (string, error) {
+	start, err := ParseDate(rc.StartDate)
+	if err != nil {
+		return "", err
+	}
+
+	if rc.Frequency == LastBusinessDay {
+		first := cal.LastBusinessDay(start.Year(), start.Month())
+		if first.Before(start) {
+			first = cal.LastBusinessDay(start.Year(), start.Month()+1)
+		}
+		return rc.within(first), nil
+	}
+
+	return rc.within(start), nil
+}
+
+// After returns the date of the payment that follows the one on
+// the given date, or an empty string, if the recurrence has ended.
+// Business days are taken from the given calendar
+func (rc *Recurrence) After(date string, cal *calendars.Calendar) (string, error) {
+	start, err := ParseDate(rc.StartDate)
+	if err != nil {
+		return "", err
+	}
+
+	current, err := ParseDate(date)
+	if err != nil {
+		return "", err
+	}
+
+	var next time.Time
+	switch rc.Frequency {
+	case Weekly:
+		next = current.AddDate(0, 0, 7)
+	case Monthly:
+		next = dayOfMonth(current.Year(), current.Month()+1, start.Day())
+	case LastBusinessDay:
+		next = cal.LastBusinessDay(current.Year(), current.Month()+1)
+	default:
+		return "", fmt.Errorf("Invalid frequency: %s", rc.Frequency)
+	}
+
+	return rc.within(next), nil
+}
+
+// within returns the given date, or an empty
+// string if it is after the end date
+func (rc *Recurrence) within(date time.Time) string {
+	next := FormatDate(date)
+	if rc.EndDate != "" && next > rc.EndDate {
+		return ""
+	}
+	return next
+}
+
+// dayOfMonth returns the given day of the given month, or the
+// last day of that month, if the month is shorter
+func dayOfMonth(year int, month time.Month, day int) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+	if day > last.Day() {
+		return last
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// ScheduleAttributes captures the payment a schedule creates,
+// and when it creates it
+type ScheduleAttributes struct {
+	// The attributes of the payments created by the schedule.
+	// Their processing date is the day they are created on, rolled
+	// forward to the next business day of their scheme
+	Payment payments.PaymentAttributes `json:"payment"`
+
+	// The day a one-off payment is created on. Either this, or
+	// a recurrence, must be given
+	ProcessingDate string `json:"processing_date,omitempty"`
+
+	// How often recurring payments are created
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+
+	// The status of the schedule, the day the next payment will be
+	// created on, the last payment created, and the last error we
+	// got trying to create one. These are managed by the server
+	Status      string `json:"status,omitempty"`
+	NextDate    string `json:"next_date,omitempty"`
+	LastPayment string `json:"last_payment_id,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// Validate does semantic validation on the schedule attributes,
+// against the settings of the organisation that owns the schedule
+func (sa *ScheduleAttributes) Validate(settings organisations.Settings) error {
+	if err := sa.Payment.Validate(settings); err != nil {
+		return err
+	}
+
+	if (sa.ProcessingDate == "") == (sa.Recurrence == nil) {
+		return errors.New("Either a processing date or a recurrence is required")
+	}
+
+	if sa.Recurrence != nil {
+		return sa.Recurrence.Validate()
+	}
+
+	if _, err := ParseDate(sa.ProcessingDate); err != nil {
+		return errors.Wrap(err, "Invalid processing date")
+	}
+
+	if sa.ProcessingDate < Today() {
+		return fmt.Errorf("Processing date is in the past: %s", sa.ProcessingDate)
+	}
+
+	return nil
+}
+
+// Schedule a payment instruction, that the scheduler turns into
+// one or more payments, on the right days
+type Schedule struct {
+	Id           string             `json:"id"`
+	Type         string             `json:"type"`
+	Version      int                `json:"version"`
+	Organisation string             `json:"organisation_id"`
+	Attributes   ScheduleAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the schedule
+func (s *Schedule) Validate(settings organisations.Settings) error {
+	if len(strings.TrimSpace(s.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	if s.Type != "Schedule" {
+		return fmt.Errorf("Invalid type: %s", s.Type)
+	}
+
+	return s.Attributes.Validate(settings)
+}
+
+// First returns the day the first payment of the schedule is
+// to be created on, using the given business day calendar
+func (s *Schedule) First(cal *calendars.Calendar) (string, error) {
+	if s.Attributes.Recurrence == nil {
+		return s.Attributes.ProcessingDate, nil
+	}
+	return s.Attributes.Recurrence.First(cal)
+}
+
+// Advance moves the schedule past the payment due on its next
+// date. Schedules with no more payments to create are completed
+func (s *Schedule) Advance(cal *calendars.Calendar) error {
+	next := ""
+	if s.Attributes.Recurrence != nil {
+		var err error
+		next, err = s.Attributes.Recurrence.After(s.Attributes.NextDate, cal)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.Attributes.NextDate = next
+	if next == "" {
+		s.Attributes.Status = StatusCompleted
+	}
+
+	return nil
+}
+
+// IsDue returns true if the schedule has a
+// payment to create on or before the given day
+func (s *Schedule) IsDue(today string) bool {
+	return s.Attributes.Status == StatusActive &&
+		s.Attributes.NextDate != "" &&
+		s.Attributes.NextDate <= today
+}
+
+// CanMoveTo returns true if clients can move
+// the schedule to the given status
+func (s *Schedule) CanMoveTo(status string) bool {
+	for _, to := range statusTransitions[s.Attributes.Status] {
+		if to == status {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentId returns the id of the payment the schedule creates on
+// the given day. Ids are derived from the schedule and the day, so
+// that the same payment is never created twice, even if the scheduler
+// is restarted before recording it
+func (s *Schedule) PaymentId(date string) string {
+	return fmt.Sprintf("%s-%s", s.Id, strings.Replace(date, "-", "", -1))
+}
+
+// NewPayment returns the payment the schedule creates on the
+// given day
+func (s *Schedule) NewPayment(date string) *payments.Payment {
+	attrs := s.Attributes.Payment
+	attrs.ProcessingDate = date
+	attrs.Schedule = s.Id
+
+	return &payments.Payment{
+		Id:           s.PaymentId(date),
+		Type:         "Payment",
+		Organisation: s.Organisation,
+		Attributes:   attrs,
+	}
+}
+
+// Converts a schedule into something that can
+// be saved into the database
+func (s *Schedule) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           s.Id,
+		Version:      s.Version,
+		Organisation: s.Organisation,
+	}
+
+	bytes, err := json.Marshal(s.Attributes)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize schedule attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into a schedule
+func NewScheduleFromRepoItem(item *RepoItem) (*Schedule, error) {
+	s := &Schedule{
+		Type:         "Schedule",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+	}
+
+	var attrs ScheduleAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return s, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	s.Attributes = attrs
+
+	return s, nil
+}
+
+// NewSchedulesFromRepoItems converts the given slice of repo
+// items to a list of schedules
+func NewSchedulesFromRepoItems(items []*RepoItem) ([]*Schedule, error) {
+	schedules := []*Schedule{}
+	for _, i := range items {
+		s, err := NewScheduleFromRepoItem(i)
+		if err != nil {
+			return schedules, err
+		}
+		schedules = append(schedules, s)
+	}
+
+	return schedules, nil
+}
+
+// ScheduleRequest represents a http request that contains
+// a schedule in its field 'data'
+type ScheduleRequest struct {
+	Schedule *Schedule `json:"data"`
+}
+
+// ScheduleResponse represents a http response that contains
+// a schedule in its field 'data' and set of links
+type ScheduleResponse struct {
+	Data  *Schedule `json:"data"`
+	Links Links     `json:"links"`
+}
+
+// SchedulesResponse represents a http response that contains
+// a list of schedules in its field 'data' and a set of links
+type SchedulesResponse struct {
+	Data  []*Schedule `json:"data"`
+	Links Links       `json:"links"`
+}
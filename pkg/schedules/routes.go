@@ -0,0 +1,348 @@
+// schedules contains the http routes that manage scheduled and
+// recurring payments, and the scheduler that creates their payments
+package schedules
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	"github.com/pedro-gutierrez/form3/pkg/calendars"
+	"github.com/pedro-gutierrez/form3/pkg/organisations"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	schedulesLinkPattern string
+	scheduleLinkPattern  string
+	paymentLinkPattern   string
+)
+
+func init() {
+	schedulesLinkPattern = "/schedules?%sfrom=%v&to=%v"
+	scheduleLinkPattern = "/schedules/%v"
+	paymentLinkPattern = "/payments/%v"
+}
+
+// SchedulesService represents a schedules service
+// it defines the routes and the repos to operate
+// with. It inherits fields and functions from util.HttpService
+type SchedulesService struct {
+	HttpService
+	repo          Repo
+	organisations Repo
+	calendars     calendars.Calendars
+	maxResults    int
+}
+
+// New creates a new SchedulesService with the given repos, calendars,
+// base url and maxResults information. Schedules must belong to one of
+// the organisations in the organisations repo
+func New(repo Repo, organisations Repo, calendars calendars.Calendars, baseUrl string, maxResults int) *SchedulesService {
+	return &SchedulesService{
+		HttpService: HttpService{
+			BaseUrl: baseUrl,
+		},
+		repo:          repo,
+		organisations: organisations,
+		calendars:     calendars,
+		maxResults:    maxResults,
+	}
+}
+
+// Routes returns a router with all routes
+// supported by this service
+func (s *SchedulesService) Routes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Get("/", s.List)
+	router.Post("/", s.Create)
+	router.Get("/{id}", s.Fetch)
+	router.Post("/{id}/pause", s.Pause)
+	router.Post("/{id}/resume", s.Resume)
+	router.Post("/{id}/cancel", s.Cancel)
+	return router
+}
+
+// List returns a list of schedules, using the same from and to
+// query params semantics as payments. Like payments, they can be
+// filtered by organisation, and principals only see the schedules of
+// the organisations they can access
+func (s *SchedulesService) List(w http.ResponseWriter, r *http.Request) {
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	organisation, err := auth.FromRequest(r).Scope(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	repoItems, err := s.repo.Find(RepoFilter{Organisation: organisation}, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	schedules, err := NewSchedulesFromRepoItems(repoItems)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	filter := ""
+	if organisation != "" {
+		filter = fmt.Sprintf("organisation_id=%s&", url.QueryEscape(organisation))
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(schedulesLinkPattern, filter, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(schedulesLinkPattern, filter, to, to+limit))
+
+	if from >= limit {
+		links["prev"] = s.UrlFor(fmt.Sprintf(schedulesLinkPattern, filter, from-limit, from))
+	}
+
+	RenderJSON(w, r, http.StatusOK, &SchedulesResponse{
+		Data:  schedules,
+		Links: links,
+	})
+}
+
+// Fetch a schedule by id
+func (s *SchedulesService) Fetch(w http.ResponseWriter, r *http.Request) {
+	schedule, status, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, schedule)
+}
+
+// Create a new schedule. Its first payment will be created
+// by the scheduler on its processing date, or on the first day
+// of its recurrence
+func (s *SchedulesService) Create(w http.ResponseWriter, r *http.Request) {
+	schedule, err := decodeSchedule(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.FromRequest(r).CanSee(schedule.Organisation) {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Unknown organisation: %s", schedule.Organisation))
+		return
+	}
+
+	org, status, err := organisations.Lookup(s.organisations, schedule.Organisation)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	// The payment template only carries what clients can
+	// set on a payment. The rest is filled in by the scheduler
+	attrs := &schedule.Attributes
+	attrs.Payment.ProcessingDate = ""
+	attrs.Payment.Schedule = ""
+	attrs.Payment.Status = ""
+	attrs.Payment.ReturnedAmount = ""
+	attrs.Payment.CreatedBy = auth.AuthenticatedUser(r)
+	attrs.Payment.WithDefaults(org.Attributes.Settings)
+
+	err = schedule.Validate(org.Attributes.Settings)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// Fx quotes expire long before most payments are due
+	if attrs.Payment.FX != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Scheduled payments cannot be converted at a fx quote"))
+		return
+	}
+
+	next, err := schedule.First(s.calendars.For(attrs.Payment.Scheme))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if next == "" {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Schedule %s would never create a payment", schedule.Id))
+		return
+	}
+
+	attrs.Status = StatusActive
+	attrs.NextDate = next
+	attrs.LastPayment = ""
+	attrs.LastError = ""
+	attrs.CreatedOn = time.Now().UTC()
+
+	repoItem, err := schedule.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdItem, err := s.repo.Create(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	schedule, err = NewScheduleFromRepoItem(createdItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusCreated, schedule)
+}
+
+// Pause an active schedule. No payments are created
+// until it is resumed
+func (s *SchedulesService) Pause(w http.ResponseWriter, r *http.Request) {
+	s.moveTo(w, r, StatusPaused)
+}
+
+// Resume a paused schedule. Payments that were due while
+// the schedule was paused are skipped
+func (s *SchedulesService) Resume(w http.ResponseWriter, r *http.Request) {
+	s.moveTo(w, r, StatusActive)
+}
+
+// Cancel a schedule, for good
+func (s *SchedulesService) Cancel(w http.ResponseWriter, r *http.Request) {
+	s.moveTo(w, r, StatusCancelled)
+}
+
+// moveTo moves the schedule in the request path to the given status.
+// Since the scheduler might be updating the same schedule, a 409 is
+// returned if the schedule changes in the meantime
+func (s *SchedulesService) moveTo(w http.ResponseWriter, r *http.Request, status string) {
+	schedule, code, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, code, err)
+		return
+	}
+
+	if !schedule.CanMoveTo(status) {
+		HandleHttpError(w, r, http.StatusConflict, fmt.Errorf("Schedule %s cannot move from %s to %s", schedule.Id, schedule.Attributes.Status, status))
+		return
+	}
+
+	schedule.Attributes.Status = status
+	if status == StatusActive {
+		today := Today()
+		cal := s.calendars.For(schedule.Attributes.Payment.Scheme)
+		for schedule.Attributes.NextDate != "" && schedule.Attributes.NextDate < today {
+			if err := schedule.Advance(cal); err != nil {
+				HandleHttpError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+	}
+
+	repoItem, err := schedule.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	updatedItem, err := s.repo.Update(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	schedule, err = NewScheduleFromRepoItem(updatedItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, schedule)
+}
+
+// fetch looks up a schedule by id. Schedules of organisations the
+// principal of the given request cannot access are not found, like
+// their payments. Returns the http status code to respond with on error
+func (s *SchedulesService) fetch(r *http.Request, id string) (*Schedule, int, error) {
+	found, err := s.repo.Fetch(&RepoItem{Id: id})
+	if err != nil {
+		if s.repo.IsNotFound(err) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !auth.FromRequest(r).CanSee(found.Organisation) {
+		return nil, http.StatusNotFound, fmt.Errorf("Schedule %s not found", id)
+	}
+
+	schedule, err := NewScheduleFromRepoItem(found)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return schedule, http.StatusOK, nil
+}
+
+// page reads the from and to query params, and returns
+// the limit to apply, capped to the maximum number of results
+func (s *SchedulesService) page(r *http.Request) (int, int, int, error) {
+	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
+	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
+
+	limit := to - from
+	if limit <= 0 {
+		return from, to, limit, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to)
+	}
+
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	return from, to, limit, nil
+}
+
+// render sends back the given schedule, along with its links
+func (s *SchedulesService) render(w http.ResponseWriter, r *http.Request, status int, schedule *Schedule) {
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(scheduleLinkPattern, schedule.Id))
+	if schedule.Attributes.LastPayment != "" {
+		links["last_payment"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, schedule.Attributes.LastPayment))
+	}
+
+	RenderJSON(w, r, status, &ScheduleResponse{
+		Data:  schedule,
+		Links: links,
+	})
+}
+
+// decodeSchedule is a convenience function that attempts to
+// decode a schedule from the HTTP request body
+func decodeSchedule(r *http.Request) (*Schedule, error) {
+	decoder := json.NewDecoder(r.Body)
+	var sr ScheduleRequest
+	err := decoder.Decode(&sr)
+	if err == nil && sr.Schedule == nil {
+		err = fmt.Errorf("No schedule data")
+	}
+	return sr.Schedule, err
+}
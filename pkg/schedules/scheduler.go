@@ -0,0 +1,170 @@
+package schedules
+
+import (
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/calendars"
+	"github.com/pedro-gutierrez/form3/pkg/logger"
+	"github.com/pedro-gutierrez/form3/pkg/payments"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The number of schedules we read at once
+const pageSize = 100
+
+// PaymentCreator is anything that can create payments, along
+// with their events, and fetch them, such as the payments service.
+// Returns the http status code that describes the error, if any
+type PaymentCreator interface {
+	CreatePayment(p *payments.Payment) (*payments.Payment, int, error)
+	FetchPayment(id string) (*payments.Payment, int, error)
+}
+
+// Scheduler creates the payments of active schedules, once they are
+// due. Payment ids are derived from their schedule and processing
+// date, so that running the scheduler again, eg. after a restart,
+// never creates the same payment twice
+type Scheduler struct {
+	repo      Repo
+	payments  PaymentCreator
+	calendars calendars.Calendars
+	interval  time.Duration
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewScheduler returns a new scheduler that checks the schedules
+// in the given repo at the given interval. Recurring payments fall
+// on the business days of the given calendars
+func NewScheduler(repo Repo, payments PaymentCreator, calendars calendars.Calendars, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		repo:      repo,
+		payments:  payments,
+		calendars: calendars,
+		interval:  interval,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start checking schedules in the background
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Run(); err != nil {
+					logger.Error(err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop checking schedules, and wait for the current run to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// Run creates all payments due today, or before, if we did not
+// run for a while. A schedule that fails is left as it is, and
+// retried on the next run
+func (s *Scheduler) Run() error {
+	today := Today()
+	for offset := 0; ; offset += pageSize {
+		repoItems, err := s.repo.List(offset, pageSize)
+		if err != nil {
+			return err
+		}
+
+		schedules, err := NewSchedulesFromRepoItems(repoItems)
+		if err != nil {
+			return err
+		}
+
+		for _, schedule := range schedules {
+			if err := s.materialise(schedule, today); err != nil {
+				logger.Error(err)
+			}
+		}
+
+		if len(repoItems) < pageSize {
+			return nil
+		}
+	}
+}
+
+// materialise creates the payments of the given schedule that are
+// due on or before the given day, and moves the schedule forward
+// after each one of them. The schedule is updated using its version,
+// so that we stop if a client pauses or cancels it in the meantime
+func (s *Scheduler) materialise(schedule *Schedule, today string) error {
+	for schedule.IsDue(today) {
+		p := schedule.NewPayment(schedule.Attributes.NextDate)
+		_, status, err := s.payments.CreatePayment(p)
+
+		// A conflict might mean we already created this payment,
+		// but did not record it in the schedule. Anything else
+		// in conflict (eg. a limit) is an error like any other
+		if err != nil && status == http.StatusConflict && s.created(schedule, p.Id) {
+			err = nil
+		}
+
+		if err != nil {
+			if schedule.Attributes.LastError != err.Error() {
+				schedule.Attributes.LastError = err.Error()
+				if err := s.update(schedule); err != nil {
+					return err
+				}
+			}
+			return fmt.Errorf("Could not create payment %s of schedule %s: %v", p.Id, schedule.Id, err)
+		}
+
+		schedule.Attributes.LastPayment = p.Id
+		schedule.Attributes.LastError = ""
+		if err := schedule.Advance(s.calendars.For(schedule.Attributes.Payment.Scheme)); err != nil {
+			return err
+		}
+
+		if err := s.update(schedule); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// created returns true if the payment with the given id exists,
+// and was created by the given schedule
+func (s *Scheduler) created(schedule *Schedule, id string) bool {
+	p, _, err := s.payments.FetchPayment(id)
+	if err != nil {
+		return false
+	}
+	return p.Attributes.Schedule == schedule.Id
+}
+
+// update saves the given schedule, and
+// keeps track of its new version
+func (s *Scheduler) update(schedule *Schedule) error {
+	repoItem, err := schedule.ToRepoItem()
+	if err != nil {
+		return err
+	}
+
+	updatedItem, err := s.repo.Update(repoItem)
+	if err != nil {
+		return err
+	}
+
+	schedule.Version = updatedItem.Version
+	return nil
+}
@@ -0,0 +1,276 @@
+// screening checks the parties of payments against local copies of
+// sanctions lists (eg. OFAC SDN, UK HMT), using fuzzy matching, so
+// that small differences in spelling or word order still match
+package screening
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultThreshold is the similarity, from 0 to 1, above
+// which a name or address is taken as a match
+const DefaultThreshold = 0.85
+
+// Entry a sanctioned party, as found in one of the lists
+type Entry struct {
+	List    string
+	Id      string
+	Name    string
+	Address string
+
+	// The name and address, normalized for matching
+	name    string
+	address string
+}
+
+// Subject a party of a payment to screen. The role
+// tells which party it is (eg. debtor, beneficiary)
+type Subject struct {
+	Role    string
+	Name    string
+	Address string
+}
+
+// Hit a party of a payment that matched an entry of a sanctions
+// list, on either its name or address, with the given score
+type Hit struct {
+	Party string  `json:"party"`
+	Field string  `json:"field"`
+	Value string  `json:"value"`
+	List  string  `json:"list"`
+	Entry string  `json:"entry_id,omitempty"`
+	Name  string  `json:"entry_name"`
+	Score float64 `json:"score"`
+}
+
+// Screener holds the entries of all the sanctions lists
+// we screen against, and the threshold to match them at
+type Screener struct {
+	entries   []*Entry
+	threshold float64
+}
+
+// Load reads all the sanctions lists from the csv files in the
+// given directory. Each file is a list, named after the file (eg.
+// ofac_sdn.csv). Files either have a header row, with a name column,
+// and optional id and address columns, or follow the OFAC SDN layout,
+// with no header, the entry number in the first column, and the name
+// in the second one. A missing directory means we screen against
+// no lists
+func Load(dir string, threshold float64) (*Screener, error) {
+	if threshold <= 0 || threshold > 1 {
+		return nil, fmt.Errorf("Invalid screening threshold: %v", threshold)
+	}
+
+	s := &Screener{threshold: threshold}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to list sanctions lists")
+	}
+
+	for _, file := range files {
+		list := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		entries, err := loadList(file, list)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to load sanctions list %s", file)
+		}
+		s.entries = append(s.entries, entries...)
+	}
+
+	return s, nil
+}
+
+// loadList reads the entries of a single sanctions list
+func loadList(file string, list string) ([]*Entry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	// Without a header, we expect the OFAC SDN layout
+	nameCol, idCol, addressCol := 1, 0, -1
+	entries := []*Entry{}
+	for line := 0; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if line == 0 {
+			if col := column(record, "name"); col >= 0 {
+				nameCol, idCol, addressCol = col, column(record, "id"), column(record, "address")
+				continue
+			}
+		}
+
+		name := field(record, nameCol)
+		if name == "" {
+			continue
+		}
+
+		entries = append(entries, &Entry{
+			List:    list,
+			Id:      field(record, idCol),
+			Name:    name,
+			Address: field(record, addressCol),
+			name:    normalize(name),
+			address: normalize(field(record, addressCol)),
+		})
+	}
+
+	return entries, nil
+}
+
+// column returns the index of the column with the given
+// name in the given header row, or -1 if there is none
+func column(header []string, name string) int {
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// field returns the given column of the record, if any. The
+// OFAC SDN lists use -0- for empty fields
+func field(record []string, col int) string {
+	if col < 0 || col >= len(record) {
+		return ""
+	}
+
+	value := strings.TrimSpace(record[col])
+	if value == "-0-" {
+		return ""
+	}
+	return value
+}
+
+// Screen checks the given subjects against all the entries of our
+// sanctions lists, and returns the matches, if any. Names are matched
+// against names, and addresses against addresses. A nil screener
+// screens against nothing
+func (s *Screener) Screen(subjects ...Subject) []Hit {
+	if s == nil {
+		return nil
+	}
+
+	hits := []Hit{}
+	for _, subject := range subjects {
+		name := normalize(subject.Name)
+		address := normalize(subject.Address)
+		for _, e := range s.entries {
+			if name != "" {
+				if score := similarity(name, e.name); score >= s.threshold {
+					hits = append(hits, e.hit(subject.Role, "name", subject.Name, score))
+				}
+			}
+
+			if address != "" && e.address != "" {
+				if score := similarity(address, e.address); score >= s.threshold {
+					hits = append(hits, e.hit(subject.Role, "address", subject.Address, score))
+				}
+			}
+		}
+	}
+
+	return hits
+}
+
+// hit returns a hit on the entry, for the given
+// field of the given party
+func (e *Entry) hit(party string, field string, value string, score float64) Hit {
+	return Hit{
+		Party: party,
+		Field: field,
+		Value: value,
+		List:  e.List,
+		Entry: e.Id,
+		Name:  e.Name,
+		Score: float64(int(score*100)) / 100,
+	}
+}
+
+// normalize makes names and addresses comparable, regardless
+// of case, punctuation, spacing, and the order of their words
+func normalize(value string) string {
+	words := strings.FieldsFunc(strings.ToUpper(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// Similarity returns how similar two names or addresses are, from
+// 0 to 1, regardless of case, punctuation, spacing and word order.
+// Other services use it in order to match names the same way
+func Similarity(a string, b string) float64 {
+	return similarity(normalize(a), normalize(b))
+}
+
+// similarity returns how similar two normalized values are, from
+// 0 to 1, based on the edit distance between them
+func similarity(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+
+	if longest == 0 {
+		return 0
+	}
+
+	return 1 - float64(distance(ra, rb))/float64(longest)
+}
+
+// distance returns the Levenshtein distance between
+// two strings, as the number of single rune edits
+func distance(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minOf(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// minOf returns the smallest of the given numbers
+func minOf(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+	return first
+}
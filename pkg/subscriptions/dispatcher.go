@@ -0,0 +1,307 @@
+package subscriptions
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/events"
+	"github.com/pedro-gutierrez/form3/pkg/logger"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The http headers we set on every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventIdHeader   = "X-Webhook-Event-Id"
+	EventTypeHeader = "X-Webhook-Event-Type"
+	DeliveryHeader  = "X-Webhook-Delivery-Id"
+)
+
+// The number of repo items we read at once when scanning
+// subscriptions or deliveries
+const pageSize = 100
+
+// DispatcherConfig is a simple container for the delivery
+// worker configuration
+type DispatcherConfig struct {
+	// Number of concurrent delivery workers
+	Workers int
+
+	// Maximum number of attempts before a delivery
+	// is moved to the dead letter list
+	MaxAttempts int
+
+	// Delay before the first retry. Further retries
+	// double this delay, up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout for each http callback
+	Timeout time.Duration
+}
+
+// Dispatcher delivers events to the callbacks registered
+// by subscribers. It implements events.EventPublisher so that
+// it can be plugged into any service that emits events
+type Dispatcher struct {
+	subscriptions Repo
+	deliveries    Repo
+	config        DispatcherConfig
+	client        *http.Client
+	queue         chan *Delivery
+	stop          chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewDispatcher creates a new dispatcher that reads subscriptions
+// and records deliveries in the given repos
+func NewDispatcher(subscriptions Repo, deliveries Repo, config DispatcherConfig) *Dispatcher {
+	return &Dispatcher{
+		subscriptions: subscriptions,
+		deliveries:    deliveries,
+		config:        config,
+		client:        &http.Client{Timeout: config.Timeout},
+		queue:         make(chan *Delivery, pageSize),
+		stop:          make(chan struct{}),
+	}
+}
+
+// Sign returns the signature of the given body, as sent
+// in the signature header: the hex encoded HMAC-SHA256 of the body,
+// keyed with the subscription secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return fmt.Sprintf("sha256=%s", hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Start spawns the delivery workers, and resumes pending
+// deliveries left by a previous run
+func (d *Dispatcher) Start() error {
+	for i := 0; i < d.config.Workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+
+	for offset := 0; ; offset += pageSize {
+		items, err := d.deliveries.Find(RepoFilter{}, offset, pageSize)
+		if err != nil {
+			return errors.Wrap(err, "Could not resume deliveries")
+		}
+
+		pending, err := NewDeliveriesFromRepoItems(items)
+		if err != nil {
+			return errors.Wrap(err, "Could not resume deliveries")
+		}
+
+		for _, p := range pending {
+			if p.Attributes.Status == DeliveryPending {
+				d.schedule(p, time.Until(p.Attributes.NextAttempt))
+			}
+		}
+
+		if len(items) < pageSize {
+			return nil
+		}
+	}
+}
+
+// Stop tells all workers to finish, and waits for them
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+}
+
+// Publish records a new pending delivery for every subscription
+// of the event's organisation interested in the event type, and
+// schedules them for immediate delivery
+func (d *Dispatcher) Publish(e *events.Event) error {
+	for offset := 0; ; offset += pageSize {
+		items, err := d.subscriptions.Find(RepoFilter{Organisation: e.Organisation}, offset, pageSize)
+		if err != nil {
+			return err
+		}
+
+		subscriptions, err := NewSubscriptionsFromRepoItems(items)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range subscriptions {
+			if !s.Attributes.Matches(e.Type) {
+				continue
+			}
+
+			delivery := &Delivery{
+				Id:           NewId(),
+				Organisation: e.Organisation,
+				Subscription: s.Id,
+				Attributes: DeliveryAttributes{
+					Status:      DeliveryPending,
+					Event:       e,
+					Attempts:    []Attempt{},
+					NextAttempt: time.Now().UTC(),
+				},
+			}
+
+			item, err := delivery.ToRepoItem()
+			if err != nil {
+				return err
+			}
+
+			if _, err := d.deliveries.Create(item); err != nil {
+				return err
+			}
+
+			d.schedule(delivery, 0)
+		}
+
+		if len(items) < pageSize {
+			return nil
+		}
+	}
+}
+
+// schedule enqueues the given delivery after the given delay
+func (d *Dispatcher) schedule(delivery *Delivery, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		select {
+		case d.queue <- delivery:
+		case <-d.stop:
+		}
+	})
+}
+
+// work is the main loop of a delivery worker
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case delivery := <-d.queue:
+			if err := d.attempt(delivery); err != nil {
+				logger.Error(err)
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// backoff returns how long we should wait after the given
+// number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.Backoff
+	for i := 1; i < attempts && delay < d.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > d.config.MaxBackoff {
+		delay = d.config.MaxBackoff
+	}
+
+	return delay
+}
+
+// attempt tries to deliver the event to the subscriber, records
+// the outcome, and either schedules a retry or gives up
+func (d *Dispatcher) attempt(delivery *Delivery) error {
+	attempt := Attempt{Time: time.Now().UTC()}
+
+	// The subscription might have been deleted, or changed
+	// since the delivery was created
+	found, err := d.subscriptions.Fetch(&RepoItem{Id: delivery.Subscription})
+	if err != nil && !d.subscriptions.IsNotFound(err) {
+		return err
+	}
+
+	if err != nil {
+		attempt.Error = "subscription not found"
+		delivery.Attributes.Attempts = append(delivery.Attributes.Attempts, attempt)
+		delivery.Attributes.Status = DeliveryDead
+		return d.save(delivery)
+	}
+
+	subscription, err := NewSubscriptionFromRepoItem(found)
+	if err != nil {
+		return err
+	}
+
+	attempt.StatusCode, err = d.post(subscription, delivery)
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	delivery.Attributes.Attempts = append(delivery.Attributes.Attempts, attempt)
+	attempts := len(delivery.Attributes.Attempts)
+
+	switch {
+	case err == nil && attempt.StatusCode >= 200 && attempt.StatusCode < 300:
+		delivery.Attributes.Status = DeliveryDelivered
+	case attempts >= d.config.MaxAttempts:
+		delivery.Attributes.Status = DeliveryDead
+	default:
+		delivery.Attributes.NextAttempt = attempt.Time.Add(d.backoff(attempts))
+	}
+
+	if err := d.save(delivery); err != nil {
+		return err
+	}
+
+	if delivery.Attributes.Status == DeliveryPending {
+		d.schedule(delivery, time.Until(delivery.Attributes.NextAttempt))
+	}
+
+	return nil
+}
+
+// post sends the signed event to the subscription callback, and
+// returns the http status code of the response
+func (d *Dispatcher) post(subscription *Subscription, delivery *Delivery) (int, error) {
+	body, err := json.Marshal(delivery.Attributes.Event)
+	if err != nil {
+		return 0, errors.Wrap(err, "Unable to serialize event")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, subscription.Attributes.CallbackUri, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(subscription.Attributes.Secret, body))
+	req.Header.Set(EventIdHeader, delivery.Attributes.Event.Id)
+	req.Header.Set(EventTypeHeader, delivery.Attributes.Event.Type)
+	req.Header.Set(DeliveryHeader, delivery.Id)
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+	return res.StatusCode, nil
+}
+
+// save records the latest state of the delivery in the repo, and
+// keeps track of its new version
+func (d *Dispatcher) save(delivery *Delivery) error {
+	item, err := delivery.ToRepoItem()
+	if err != nil {
+		return err
+	}
+
+	updated, err := d.deliveries.Update(item)
+	if err != nil {
+		return err
+	}
+
+	delivery.Version = updated.Version
+	return nil
+}
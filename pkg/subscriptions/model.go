@@ -0,0 +1,279 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/events"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"github.com/pkg/errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The states a delivery can be in
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// SubscriptionAttributes captures where and what we should
+// notify to a subscriber
+type SubscriptionAttributes struct {
+	// The url we POST events to
+	CallbackUri string `json:"callback_uri"`
+
+	// The types of events the subscriber is interested in
+	// (eg. payment.created). An empty list, or "*"
+	// means all events
+	EventTypes []string `json:"event_types"`
+
+	// The shared secret used to sign deliveries. It is
+	// write only, so it is never sent back to clients
+	Secret string `json:"secret,omitempty"`
+}
+
+// Validate does semantic validation on the subscription attributes.
+// Plain http callbacks are only accepted if allowHttp is true
+func (sa *SubscriptionAttributes) Validate(allowHttp bool) error {
+	u, err := url.Parse(sa.CallbackUri)
+	if err != nil {
+		return errors.Wrap(err, "Invalid callback uri")
+	}
+
+	if u.Scheme != "https" && !(allowHttp && u.Scheme == "http") {
+		return fmt.Errorf("Unsupported callback uri scheme: %s", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return errors.New("Callback uri has no host")
+	}
+
+	if len(strings.TrimSpace(sa.Secret)) == 0 {
+		return errors.New("Secret is empty")
+	}
+
+	return nil
+}
+
+// Matches returns true if the subscription is interested
+// in the given event type
+func (sa *SubscriptionAttributes) Matches(eventType string) bool {
+	if len(sa.EventTypes) == 0 {
+		return true
+	}
+
+	for _, t := range sa.EventTypes {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Subscription a webhook subscription
+type Subscription struct {
+	Id           string                 `json:"id"`
+	Type         string                 `json:"type"`
+	Version      int                    `json:"version"`
+	Organisation string                 `json:"organisation_id"`
+	Attributes   SubscriptionAttributes `json:"attributes"`
+}
+
+// Validate does semantic validation on the subscription
+func (s *Subscription) Validate(allowHttp bool) error {
+
+	// check the id is not empty
+	if len(strings.TrimSpace(s.Id)) == 0 {
+		return errors.New("Id is empty")
+	}
+
+	// check the type
+	if s.Type != "Subscription" {
+		return fmt.Errorf("Invalid type: %s", s.Type)
+	}
+
+	// check the organisation
+	if len(strings.TrimSpace(s.Organisation)) == 0 {
+		return errors.New("Organisation is empty")
+	}
+
+	// check the attributes
+	return s.Attributes.Validate(allowHttp)
+}
+
+// WithoutSecret returns a copy of the subscription
+// without its secret, that can be sent back to clients
+func (s *Subscription) WithoutSecret() *Subscription {
+	redacted := *s
+	redacted.Attributes.Secret = ""
+	return &redacted
+}
+
+// Converts a subscription into something that
+// can be saved into the database
+func (s *Subscription) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           s.Id,
+		Version:      s.Version,
+		Organisation: s.Organisation,
+	}
+
+	bytes, err := json.Marshal(s.Attributes)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize subscription attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into a subscription
+func NewSubscriptionFromRepoItem(item *RepoItem) (*Subscription, error) {
+	s := &Subscription{
+		Type:         "Subscription",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+	}
+
+	var attrs SubscriptionAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return s, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	s.Attributes = attrs
+
+	return s, nil
+}
+
+// NewSubscriptionsFromRepoItems converts the given slice of repo
+// items to a list of subscriptions
+func NewSubscriptionsFromRepoItems(items []*RepoItem) ([]*Subscription, error) {
+	subscriptions := []*Subscription{}
+	for _, i := range items {
+		s, err := NewSubscriptionFromRepoItem(i)
+		if err != nil {
+			return subscriptions, err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+
+	return subscriptions, nil
+}
+
+// Attempt records the outcome of a single attempt to
+// deliver an event to a subscriber
+type Attempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// DeliveryAttributes captures the event to be delivered, and
+// the log of all attempts made so far
+type DeliveryAttributes struct {
+	Status      string        `json:"status"`
+	Event       *events.Event `json:"event"`
+	Attempts    []Attempt     `json:"attempts"`
+	NextAttempt time.Time     `json:"next_attempt,omitempty"`
+}
+
+// Delivery represents an event to be delivered to
+// a given subscription
+type Delivery struct {
+	Id           string             `json:"id"`
+	Type         string             `json:"type"`
+	Version      int                `json:"version"`
+	Organisation string             `json:"organisation_id"`
+	Subscription string             `json:"subscription_id"`
+	Attributes   DeliveryAttributes `json:"attributes"`
+}
+
+// Converts a delivery into something that
+// can be saved into the database. Deliveries are children
+// of their subscription
+func (d *Delivery) ToRepoItem() (*RepoItem, error) {
+	repoItem := &RepoItem{
+		Id:           d.Id,
+		Version:      d.Version,
+		Organisation: d.Organisation,
+		Parent:       d.Subscription,
+	}
+
+	bytes, err := json.Marshal(d.Attributes)
+	if err != nil {
+		return repoItem, errors.Wrap(err, "Unable to serialize delivery attributes")
+	}
+
+	repoItem.Attributes = string(bytes)
+	return repoItem, nil
+}
+
+// Converts a repo item into a delivery
+func NewDeliveryFromRepoItem(item *RepoItem) (*Delivery, error) {
+	d := &Delivery{
+		Type:         "Delivery",
+		Id:           item.Id,
+		Version:      item.Version,
+		Organisation: item.Organisation,
+		Subscription: item.Parent,
+	}
+
+	var attrs DeliveryAttributes
+	if item.Attributes != "" {
+		err := json.NewDecoder(strings.NewReader(item.Attributes)).Decode(&attrs)
+		if err != nil {
+			return d, errors.Wrap(err, "Error parsing repo item attributes")
+		}
+	}
+	d.Attributes = attrs
+
+	return d, nil
+}
+
+// NewDeliveriesFromRepoItems converts the given slice of repo
+// items to a list of deliveries
+func NewDeliveriesFromRepoItems(items []*RepoItem) ([]*Delivery, error) {
+	deliveries := []*Delivery{}
+	for _, i := range items {
+		d, err := NewDeliveryFromRepoItem(i)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, nil
+}
+
+// SubscriptionRequest represents a http request that contains
+// a subscription in its field 'data'
+type SubscriptionRequest struct {
+	Subscription *Subscription `json:"data"`
+}
+
+// SubscriptionResponse represents a http response that contains
+// a subscription in its field 'data' and set of links
+type SubscriptionResponse struct {
+	Data  *Subscription `json:"data"`
+	Links Links         `json:"links"`
+}
+
+// SubscriptionsResponse represents a http response that contains
+// a list of subscriptions in its field 'data' and a set of links
+type SubscriptionsResponse struct {
+	Data  []*Subscription `json:"data"`
+	Links Links           `json:"links"`
+}
+
+// DeliveriesResponse represents a http response that contains
+// a list of deliveries in its field 'data' and a set of links
+type DeliveriesResponse struct {
+	Data  []*Delivery `json:"data"`
+	Links Links       `json:"links"`
+}
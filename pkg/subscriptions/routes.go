@@ -0,0 +1,411 @@
+// subscriptions contains the http routes that manage webhook
+// subscriptions, and the dispatcher that delivers events to them
+package subscriptions
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/pedro-gutierrez/form3/pkg/auth"
+	. "github.com/pedro-gutierrez/form3/pkg/util"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	subscriptionsLinkPattern string
+	subscriptionLinkPattern  string
+	deliveriesLinkPattern    string
+	deadLettersLinkPattern   string
+)
+
+func init() {
+	subscriptionsLinkPattern = "/subscriptions?%sfrom=%v&to=%v"
+	subscriptionLinkPattern = "/subscriptions/%v"
+	deliveriesLinkPattern = "/subscriptions/%v/deliveries?from=%v&to=%v"
+	deadLettersLinkPattern = "/subscriptions/%v/dead-letters"
+}
+
+// SubscriptionsService represents a webhook subscriptions service
+// it defines the routes and the repos to operate
+// with. It inherits fields and functions from util.HttpService
+type SubscriptionsService struct {
+	HttpService
+	repo       Repo
+	deliveries Repo
+	maxResults int
+	allowHttp  bool
+}
+
+// New creates a new SubscriptionsService with the given
+// repos, base url and maxResults information. Plain http callbacks
+// are only accepted if allowHttp is true
+func New(repo Repo, deliveries Repo, baseUrl string, maxResults int, allowHttp bool) *SubscriptionsService {
+	return &SubscriptionsService{
+		HttpService: HttpService{
+			BaseUrl: baseUrl,
+		},
+		repo:       repo,
+		deliveries: deliveries,
+		maxResults: maxResults,
+		allowHttp:  allowHttp,
+	}
+}
+
+// Routes returns a router with all routes
+// supported by this service
+func (s *SubscriptionsService) Routes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Get("/", s.List)
+	router.Post("/", s.Create)
+	router.Get("/{id}", s.Fetch)
+	router.Put("/{id}", s.Update)
+	router.Delete("/{id}", s.Delete)
+	router.Get("/{id}/deliveries", s.ListDeliveries)
+	router.Get("/{id}/dead-letters", s.ListDeadLetters)
+	return router
+}
+
+// List returns a list of subscriptions, using the same from and to
+// query params semantics as payments. Like payments, they can be
+// filtered by organisation, and principals only see the subscriptions
+// of the organisations they can access
+func (s *SubscriptionsService) List(w http.ResponseWriter, r *http.Request) {
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	organisation, err := auth.FromRequest(r).Scope(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	repoItems, err := s.repo.Find(RepoFilter{Organisation: organisation}, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	subscriptions, err := NewSubscriptionsFromRepoItems(repoItems)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	for i, subscription := range subscriptions {
+		subscriptions[i] = subscription.WithoutSecret()
+	}
+
+	filter := ""
+	if organisation != "" {
+		filter = fmt.Sprintf("organisation_id=%s&", url.QueryEscape(organisation))
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(subscriptionsLinkPattern, filter, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(subscriptionsLinkPattern, filter, to, to+limit))
+
+	if from >= limit {
+		links["prev"] = s.UrlFor(fmt.Sprintf(subscriptionsLinkPattern, filter, from-limit, from))
+	}
+
+	RenderJSON(w, r, http.StatusOK, &SubscriptionsResponse{
+		Data:  subscriptions,
+		Links: links,
+	})
+}
+
+// Fetch a subscription by id
+func (s *SubscriptionsService) Fetch(w http.ResponseWriter, r *http.Request) {
+	subscription, status, err := s.fetch(r, chi.URLParam(r, "id"))
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, subscription)
+}
+
+// Create a new subscription
+func (s *SubscriptionsService) Create(w http.ResponseWriter, r *http.Request) {
+	subscription, err := decodeSubscription(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.FromRequest(r).CanSee(subscription.Organisation) {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Unknown organisation: %s", subscription.Organisation))
+		return
+	}
+
+	err = subscription.Validate(s.allowHttp)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	repoItem, err := subscription.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	createdItem, err := s.repo.Create(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	subscription, err = NewSubscriptionFromRepoItem(createdItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusCreated, subscription)
+}
+
+// Update an existing subscription. Subscriptions stay with the
+// organisation they were created for, and keep their secret,
+// unless a new one is given
+func (s *SubscriptionsService) Update(w http.ResponseWriter, r *http.Request) {
+	subscription, err := decodeSubscription(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id != subscription.Id {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Subscription id mismatch: %s", subscription.Id))
+		return
+	}
+
+	current, status, err := s.fetch(r, id)
+	if err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	subscription.Organisation = current.Organisation
+	if subscription.Attributes.Secret == "" {
+		subscription.Attributes.Secret = current.Attributes.Secret
+	}
+
+	err = subscription.Validate(s.allowHttp)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	repoItem, err := subscription.ToRepoItem()
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	updatedItem, err := s.repo.Update(repoItem)
+	if err != nil {
+		if s.repo.IsConflict(err) {
+			HandleHttpError(w, r, http.StatusConflict, err)
+		} else {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	subscription, err = NewSubscriptionFromRepoItem(updatedItem)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.render(w, r, http.StatusOK, subscription)
+}
+
+// Delete a subscription by id. Pending deliveries for this
+// subscription will be moved to the dead letter list
+func (s *SubscriptionsService) Delete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	versionQP := strings.TrimSpace(r.URL.Query().Get("version"))
+	version, err := strconv.Atoi(versionQP)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, status, err := s.fetch(r, id); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	err = s.repo.Delete(&RepoItem{Id: id, Version: version})
+	if err != nil {
+		errorCode := http.StatusInternalServerError
+		if s.repo.IsNotFound(err) || s.repo.IsConflict(err) {
+			errorCode = http.StatusConflict
+		}
+		HandleHttpError(w, r, errorCode, err)
+		return
+	}
+
+	RenderNoContent(w, r)
+}
+
+// ListDeliveries returns the delivery attempt log of a subscription
+func (s *SubscriptionsService) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	from, to, limit, err := s.page(r)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, status, err := s.fetch(r, id); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	deliveries, err := s.findDeliveries(id, from, limit)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(deliveriesLinkPattern, id, from, to))
+	links["next"] = s.UrlFor(fmt.Sprintf(deliveriesLinkPattern, id, to, to+limit))
+	links["subscription"] = s.UrlFor(fmt.Sprintf(subscriptionLinkPattern, id))
+
+	RenderJSON(w, r, http.StatusOK, &DeliveriesResponse{
+		Data:  deliveries,
+		Links: links,
+	})
+}
+
+// ListDeadLetters returns all deliveries of a subscription
+// we gave up on, after exhausting all retries
+func (s *SubscriptionsService) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, status, err := s.fetch(r, id); err != nil {
+		HandleHttpError(w, r, status, err)
+		return
+	}
+
+	dead := []*Delivery{}
+
+	for offset := 0; ; offset += pageSize {
+		deliveries, err := s.findDeliveries(id, offset, pageSize)
+		if err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		for _, d := range deliveries {
+			if d.Attributes.Status == DeliveryDead {
+				dead = append(dead, d)
+			}
+		}
+
+		if len(deliveries) < pageSize {
+			break
+		}
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(deadLettersLinkPattern, id))
+	links["subscription"] = s.UrlFor(fmt.Sprintf(subscriptionLinkPattern, id))
+
+	RenderJSON(w, r, http.StatusOK, &DeliveriesResponse{
+		Data:  dead,
+		Links: links,
+	})
+}
+
+// fetch looks up a subscription by id. Subscriptions of organisations
+// the principal of the given request cannot access are not found, like
+// their payments. Returns the http status code to respond with on error
+func (s *SubscriptionsService) fetch(r *http.Request, id string) (*Subscription, int, error) {
+	found, err := s.repo.Fetch(&RepoItem{Id: id})
+	if err != nil {
+		if s.repo.IsNotFound(err) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if !auth.FromRequest(r).CanSee(found.Organisation) {
+		return nil, http.StatusNotFound, fmt.Errorf("Subscription %s not found", id)
+	}
+
+	subscription, err := NewSubscriptionFromRepoItem(found)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return subscription, http.StatusOK, nil
+}
+
+// findDeliveries returns a page of deliveries for the given subscription
+func (s *SubscriptionsService) findDeliveries(id string, offset int, limit int) ([]*Delivery, error) {
+	repoItems, err := s.deliveries.Find(RepoFilter{Parent: id}, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return NewDeliveriesFromRepoItems(repoItems)
+}
+
+// page reads the from and to query params, and returns
+// the limit to apply, capped to the maximum number of results
+func (s *SubscriptionsService) page(r *http.Request) (int, int, int, error) {
+	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
+	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
+
+	limit := to - from
+	if limit <= 0 {
+		return from, to, limit, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to)
+	}
+
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	return from, to, limit, nil
+}
+
+// render sends back the given subscription, without
+// its secret, along with its links
+func (s *SubscriptionsService) render(w http.ResponseWriter, r *http.Request, status int, subscription *Subscription) {
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(subscriptionLinkPattern, subscription.Id))
+	links["deliveries"] = s.UrlFor(fmt.Sprintf(deliveriesLinkPattern, subscription.Id, 0, s.maxResults))
+	links["dead_letters"] = s.UrlFor(fmt.Sprintf(deadLettersLinkPattern, subscription.Id))
+
+	RenderJSON(w, r, status, &SubscriptionResponse{
+		Data:  subscription.WithoutSecret(),
+		Links: links,
+	})
+}
+
+// decodeSubscription is a convenience function that attempts to
+// decode a subscription from the HTTP request body.
+func decodeSubscription(r *http.Request) (*Subscription, error) {
+	decoder := json.NewDecoder(r.Body)
+	var sr SubscriptionRequest
+	err := decoder.Decode(&sr)
+	if err == nil && sr.Subscription == nil {
+		err = fmt.Errorf("No subscription data")
+	}
+	return sr.Subscription, err
+}
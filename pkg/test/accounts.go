@@ -0,0 +1,120 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+)
+
+// AnAccountWithOpeningBalance defines a new GBP account of the org1
+// organisation in the current scenario context, with the given id
+// and opening balance
+func (w *World) AnAccountWithOpeningBalance(id string, balance string) error {
+	w.Data.AccountData = &AccountData{
+		Id:             id,
+		Organisation:   "org1",
+		Currency:       "GBP",
+		OpeningBalance: balance,
+	}
+	return nil
+}
+
+// ThatAccountBelongsToThatOrganisation sets the organisation of the
+// account defined in the scenario data
+func (w *World) ThatAccountBelongsToThatOrganisation() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.AccountData), func() error {
+		return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+			w.Data.AccountData.Organisation = w.Data.OrganisationData.Id
+			return nil
+		})
+	})
+}
+
+// ICreateThatAccount creates the account defined in the scenario
+// data, by posting it to the accounts endpoint, as json
+func (w *World) ICreateThatAccount() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.AccountData), func() error {
+		w.Client.Post(w.versionedPath("/accounts"), w.Data.AccountData.ToJSON())
+		return nil
+	})
+}
+
+// ICreatedAnAccountWithOpeningBalance combines logic from previous steps
+// in order to provide a convenience Given step for account fixtures
+func (w *World) ICreatedAnAccountWithOpeningBalance(id string, balance string) error {
+	return DoThen(w.AnAccountWithOpeningBalance(id, balance), func() error {
+		return DoThen(w.ICreateThatAccount(), func() error {
+			return w.IShouldHaveStatusCode(201)
+		})
+	})
+}
+
+// IGetThatAccount sends a GET request for the account
+// defined in the scenario data
+func (w *World) IGetThatAccount() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.AccountData), func() error {
+		w.Client.Get(w.versionedPath(fmt.Sprintf("/accounts/%s", w.Data.AccountData.Id)))
+		return nil
+	})
+}
+
+// IDeleteThatAccount sends a DELETE request for the account
+// defined in the scenario data, and its current version
+func (w *World) IDeleteThatAccount() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.AccountData), func() error {
+		a := w.Data.AccountData
+		w.Client.Delete(w.versionedPath(fmt.Sprintf("/accounts/%s?version=%v", a.Id, a.Version)))
+		return nil
+	})
+}
+
+// IGetTheTransactionsOfThatAccount sends a GET request for the
+// statement of the account defined in the scenario data
+func (w *World) IGetTheTransactionsOfThatAccount() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.AccountData), func() error {
+		w.Client.Get(w.versionedPath(fmt.Sprintf("/accounts/%s/transactions", w.Data.AccountData.Id)))
+		return nil
+	})
+}
+
+// ThatAccountShouldHaveBalance fetches the account defined in the
+// scenario data and checks its balance
+func (w *World) ThatAccountShouldHaveBalance(expected string) error {
+	return DoThen(w.IGetThatAccount(), func() error {
+		return DoThen(w.IShouldHaveStatusCode(200), func() error {
+			return DoThen(w.IShouldHaveAJson(), func() error {
+				return w.ThatJsonShouldHaveString("data.attributes.balance", expected)
+			})
+		})
+	})
+}
+
+// ThatPaymentIsDebitedFromThatAccount sets the debtor account of the
+// payment defined in the scenario data to the scenario's account
+func (w *World) ThatPaymentIsDebitedFromThatAccount() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		return ExpectThen(ShouldNotBeNil(w.Data.AccountData), func() error {
+			w.Data.PaymentData.Account = w.Data.AccountData.Id
+			return nil
+		})
+	})
+}
+
+// ISubmitThatPayment submits the payment defined in the scenario data
+func (w *World) ISubmitThatPayment() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		path := w.versionedPath(fmt.Sprintf("/payments/%s/submissions", w.Data.PaymentData.Id))
+		w.Client.Post(path, "{}")
+		return nil
+	})
+}
+
+// ISubmittedThatPayment combines logic from previous steps in order
+// to provide a convenience Given step for submitted payment fixtures
+func (w *World) ISubmittedThatPayment() error {
+	return DoThen(w.ISubmitThatPayment(), func() error {
+		return DoThen(w.IShouldHaveStatusCode(201), func() error {
+			w.Data.PaymentData.Version++
+			return nil
+		})
+	})
+}
@@ -0,0 +1,62 @@
+package test
+
+import (
+	"github.com/mdaverde/jsonpath"
+)
+
+// The admin key the BDD server is expected to be started with
+const adminKey = "bdd-admin-key"
+
+// IUseAnInvalidAdminKey makes the next admin
+// requests with a key the server does not know
+func (w *World) IUseAnInvalidAdminKey() error {
+	w.Data.AdminKey = "invalid"
+	return nil
+}
+
+// IUseNoAdminKey makes the next admin requests without a key
+func (w *World) IUseNoAdminKey() error {
+	w.Data.AdminKey = ""
+	return nil
+}
+
+// IRequestAConfirmationToDeleteAllData sends a POST request for
+// a new confirmation token, which is remembered, if issued
+func (w *World) IRequestAConfirmationToDeleteAllData() error {
+	return w.asAdmin(func() {
+		w.Client.Post("/admin/repo/confirmations", "")
+		if w.Client.Resp != nil && w.Client.Resp.StatusCode == 201 {
+			if token, err := jsonpath.Get(w.Client.Json, "data.token"); err == nil {
+				w.Data.Confirmation, _ = token.(string)
+			}
+		}
+	})
+}
+
+// IDeleteAllDataWithThatConfirmation sends a DELETE request for
+// all data, confirmed with the token requested by a previous step
+func (w *World) IDeleteAllDataWithThatConfirmation() error {
+	return w.asAdmin(func() {
+		w.Client.Confirmation = w.Data.Confirmation
+		w.Client.Delete("/admin/repo")
+		w.Client.Confirmation = ""
+	})
+}
+
+// IDeleteAllDataWithoutConfirmation sends a DELETE
+// request for all data, without confirming it
+func (w *World) IDeleteAllDataWithoutConfirmation() error {
+	return w.asAdmin(func() {
+		w.Client.Delete("/admin/repo")
+	})
+}
+
+// asAdmin makes the requests of the given function with the admin
+// key of the scenario, and only those, so that the admin key is never
+// sent along with api requests
+func (w *World) asAdmin(requests func()) error {
+	w.Client.AdminKey = w.Data.AdminKey
+	requests()
+	w.Client.AdminKey = ""
+	return nil
+}
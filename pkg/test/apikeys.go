@@ -0,0 +1,97 @@
+package test
+
+import (
+	"fmt"
+	"github.com/mdaverde/jsonpath"
+	"strings"
+)
+
+// ICreateAnApiKeyWithPermissions sends a POST request for a new api
+// key with the given id, for org1, granting the given comma separated
+// permissions. The key given back is remembered by id
+func (w *World) ICreateAnApiKeyWithPermissions(id string, permissions string) error {
+	w.Client.Post(w.versionedPath("/api-keys"), fmt.Sprintf(`{
+		"data": {
+			"id": "%s",
+			"type": "ApiKey",
+			"organisation_id": "org1",
+			"attributes": {
+				"permissions": ["%s"]
+			}
+		}
+	}`, id, strings.Join(strings.Split(permissions, ","), `","`)))
+	return w.rememberApiKey(id)
+}
+
+// ICreatedAnApiKeyWithPermissions combines logic from previous steps
+// in order to provide a convenience Given step for api keys
+func (w *World) ICreatedAnApiKeyWithPermissions(id string, permissions string) error {
+	return DoThen(w.ICreateAnApiKeyWithPermissions(id, permissions), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// IGetApiKey sends a GET request for
+// the api key with the given id
+func (w *World) IGetApiKey(id string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/api-keys/%s", id)))
+	return nil
+}
+
+// IRotateApiKey sends a POST request to rotate the api key with
+// the given id. Both its new and previous keys are remembered
+func (w *World) IRotateApiKey(id string) error {
+	w.Client.Post(w.versionedPath(fmt.Sprintf("/api-keys/%s/rotate", id)), "")
+	w.Data.PreviousApiKeys[id] = w.Data.ApiKeys[id]
+	return w.rememberApiKey(id)
+}
+
+// IRevokeApiKey sends a POST request to revoke
+// the api key with the given id
+func (w *World) IRevokeApiKey(id string) error {
+	w.Client.Post(w.versionedPath(fmt.Sprintf("/api-keys/%s/revoke", id)), "")
+	return nil
+}
+
+// IUseApiKey authenticates the next requests
+// with the api key with the given id
+func (w *World) IUseApiKey(id string) error {
+	w.Client.ApiKey = w.Data.ApiKeys[id]
+	return nil
+}
+
+// IUseThePreviousKeyOfApiKey authenticates the next requests with
+// the key the api key with the given id had before it was rotated
+func (w *World) IUseThePreviousKeyOfApiKey(id string) error {
+	w.Client.ApiKey = w.Data.PreviousApiKeys[id]
+	return nil
+}
+
+// IUseAnInvalidApiKey authenticates the next
+// requests with a key that does not exist
+func (w *World) IUseAnInvalidApiKey() error {
+	w.Client.ApiKey = "unknown.secret"
+	return nil
+}
+
+// IUseNoApiKey makes the next requests anonymous
+func (w *World) IUseNoApiKey() error {
+	w.Client.ApiKey = ""
+	return nil
+}
+
+// rememberApiKey keeps the key in the last response, if
+// any, as the key of the api key with the given id
+func (w *World) rememberApiKey(id string) error {
+	if w.Client.Json == nil || w.Client.Resp == nil || w.Client.Resp.StatusCode >= 300 {
+		return nil
+	}
+
+	key, err := jsonpath.Get(w.Client.Json, "data.attributes.key")
+	if err != nil {
+		return err
+	}
+
+	w.Data.ApiKeys[id] = fmt.Sprintf("%v", key)
+	return nil
+}
@@ -0,0 +1,48 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+)
+
+// ThatOrganisationRequiresApprovalAbove sets the amount above
+// which payments of the organisation defined in the scenario data
+// need to be approved by a second user
+func (w *World) ThatOrganisationRequiresApprovalAbove(threshold string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Data.OrganisationData.ApprovalThreshold = threshold
+		return nil
+	})
+}
+
+// IActAsUser makes the following requests on
+// behalf of the given user
+func (w *World) IActAsUser(user string) error {
+	w.Client.User = user
+	return nil
+}
+
+// IApproveThatPayment sends a POST request in order to
+// approve the payment defined in the scenario data
+func (w *World) IApproveThatPayment() error {
+	return w.decideOnThatPayment("approve")
+}
+
+// IRejectThatPayment sends a POST request in order to
+// reject the payment defined in the scenario data
+func (w *World) IRejectThatPayment() error {
+	return w.decideOnThatPayment("reject")
+}
+
+// decideOnThatPayment sends a POST request in order to approve or
+// reject the payment defined in the scenario data
+func (w *World) decideOnThatPayment(decision string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Client.Post(w.versionedPath(fmt.Sprintf("/payments/%s/%s", w.Data.PaymentData.Id, decision)), `{
+			"data": {
+				"comment": "Decided in BDDs"
+			}
+		}`)
+		return nil
+	})
+}
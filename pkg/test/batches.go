@@ -0,0 +1,118 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// IUploadABatchOfPayments sends a POST request for a new csv batch
+// with the given id, for org1, of the given number of payments. If
+// invalid, the amount of the last payment is negative
+func (w *World) IUploadABatchOfPayments(id string, count int, invalid string) error {
+	lines := []string{"amount,currency,reference,beneficiary_name,beneficiary_account_number,beneficiary_bank_id"}
+	for i := 1; i <= count; i++ {
+		amount := "1.00"
+		if i == count && invalid != "" {
+			amount = "-1.00"
+		}
+		lines = append(lines, fmt.Sprintf("%s,GBP,invoice %d,Jane Doe,87654321,400300", amount, i))
+	}
+
+	return w.uploadBatch(id, "csv", strings.Join(lines, "\n"))
+}
+
+// IUploadedABatchOfPayments combines logic from previous steps
+// in order to provide a convenience Given step for batches
+func (w *World) IUploadedABatchOfPayments(id string, count int, invalid string) error {
+	return DoThen(w.IUploadABatchOfPayments(id, count, invalid), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// IUploadAPain001BatchOfPayments sends a POST request for a new
+// pain.001 batch with the given id, for org1, of the given number
+// of payments
+func (w *World) IUploadAPain001BatchOfPayments(id string, count int) error {
+	txs := []string{}
+	for i := 1; i <= count; i++ {
+		txs = append(txs, fmt.Sprintf(`
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>invoice %d</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="GBP">1.00</InstdAmt></Amt>
+        <CdtrAgt><FinInstnId><ClrSysMmbId><MmbId>400300</MmbId></ClrSysMmbId></FinInstnId></CdtrAgt>
+        <Cdtr><Nm>Jane Doe</Nm></Cdtr>
+        <CdtrAcct><Id><Othr><Id>87654321</Id></Othr></Id></CdtrAcct>
+      </CdtTrfTxInf>`, i))
+	}
+
+	return w.uploadBatch(id, "pain.001", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">
+  <CstmrCdtTrfInitn>
+    <GrpHdr>
+      <MsgId>%s</MsgId>
+      <NbOfTxs>%d</NbOfTxs>
+    </GrpHdr>
+    <PmtInf>%s
+    </PmtInf>
+  </CstmrCdtTrfInitn>
+</Document>`, id, count, strings.Join(txs, "")))
+}
+
+// uploadBatch sends a POST request for a new batch
+// with the given id, for org1, of the given file
+func (w *World) uploadBatch(id string, format string, content string) error {
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+
+	w.Client.Post(w.versionedPath("/payment-batches"), fmt.Sprintf(`{
+		"data": {
+			"id": "%s",
+			"type": "PaymentBatch",
+			"organisation_id": "org1",
+			"attributes": {
+				"format": "%s",
+				"content": %s
+			}
+		}
+	}`, id, format, encoded))
+	return nil
+}
+
+// IGetBatch sends a GET request for
+// the batch with the given id
+func (w *World) IGetBatch(id string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/payment-batches/%s", id)))
+	return nil
+}
+
+// IApproveBatch sends a POST request to approve
+// the batch with the given id
+func (w *World) IApproveBatch(id string) error {
+	w.Client.Post(w.versionedPath(fmt.Sprintf("/payment-batches/%s/approve", id)), "")
+	return nil
+}
+
+// IGetThePaymentsOfBatch sends a GET request for
+// the payments created by the batch with the given id
+func (w *World) IGetThePaymentsOfBatch(id string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/payment-batches/%s/payments", id)))
+	return nil
+}
+
+// BatchShouldBe waits for the batch with the given id to have
+// the expected status. Batches are processed in the background
+func (w *World) BatchShouldBe(id string, expected string) error {
+	return DoEventually(func() error {
+		return DoThen(w.IGetBatch(id), func() error {
+			return DoThen(w.IShouldHaveStatusCode(200), func() error {
+				return DoThen(w.IShouldHaveAJson(), func() error {
+					return w.ThatJsonShouldHaveString("data.attributes.status", expected)
+				})
+			})
+		})
+	}, 40, 250*time.Millisecond)
+}
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+)
+
+// ICreateABeneficiaryForAccount sends a POST request for a new
+// beneficiary with the given id, in the address book of org1, that
+// pays the given account
+func (w *World) ICreateABeneficiaryForAccount(id string, account string) error {
+	w.Client.Post(w.versionedPath("/beneficiaries"), beneficiaryJSON(id, 0, account))
+	return nil
+}
+
+// IUpdateBeneficiaryForAccount sends a PUT request for the first
+// version of the beneficiary with the given id, so that it pays the
+// given account
+func (w *World) IUpdateBeneficiaryForAccount(id string, account string) error {
+	w.Client.Put(w.versionedPath(fmt.Sprintf("/beneficiaries/%s", id)), beneficiaryJSON(id, 0, account))
+	return nil
+}
+
+// IDeleteBeneficiary sends a DELETE request for the first
+// version of the beneficiary with the given id
+func (w *World) IDeleteBeneficiary(id string) error {
+	w.Client.Delete(w.versionedPath(fmt.Sprintf("/beneficiaries/%s?version=0", id)))
+	return nil
+}
+
+// IGetAllBeneficiaries sends a GET request for all beneficiaries
+func (w *World) IGetAllBeneficiaries() error {
+	w.Client.Get(w.versionedPath("/beneficiaries"))
+	return nil
+}
+
+// IGetBeneficiariesOfOrganisation sends a GET request for the
+// beneficiaries in the address book of the given organisation
+func (w *World) IGetBeneficiariesOfOrganisation(organisation string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/beneficiaries?organisation_id=%s", organisation)))
+	return nil
+}
+
+// beneficiaryJSON returns the json of the beneficiary with the given
+// id and version, in the address book of org1, that pays the given
+// account
+func beneficiaryJSON(id string, version int, account string) string {
+	return fmt.Sprintf(`{
+		"data": {
+			"id": "%s",
+			"type": "Beneficiary",
+			"version": %v,
+			"organisation_id": "org1",
+			"attributes": {
+				"name": "Jane Doe",
+				"country": "GB",
+				"account_number": "%s",
+				"bank_id": "400300"
+			}
+		}
+	}`, id, version, account)
+}
+
+// ICreatedABeneficiaryForAccount combines logic from previous steps
+// in order to provide a convenience Given step for beneficiaries
+func (w *World) ICreatedABeneficiaryForAccount(id string, account string) error {
+	return DoThen(w.ICreateABeneficiaryForAccount(id, account), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// IGetBeneficiary sends a GET request for
+// the beneficiary with the given id
+func (w *World) IGetBeneficiary(id string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/beneficiaries/%s", id)))
+	return nil
+}
+
+// ThatPaymentIsMadeToBeneficiary makes the payment defined in the
+// scenario data refer to the given saved beneficiary
+func (w *World) ThatPaymentIsMadeToBeneficiary(id string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.Beneficiary = id
+		return nil
+	})
+}
@@ -0,0 +1,38 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+)
+
+// IGetTheNextBusinessDayOfSchemeFrom sends a GET request for the
+// first business day of the given scheme, on or after the given date
+func (w *World) IGetTheNextBusinessDayOfSchemeFrom(scheme string, date string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/calendars/%s/next-business-day?date=%s", scheme, date)))
+	return nil
+}
+
+// IGetTheCalendarOfScheme sends a GET request for
+// the calendar of the given scheme
+func (w *World) IGetTheCalendarOfScheme(scheme string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/calendars/%s", scheme)))
+	return nil
+}
+
+// ThatPaymentUsesScheme sets the scheme of the payment
+// defined in the scenario data
+func (w *World) ThatPaymentUsesScheme(scheme string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.Scheme = scheme
+		return nil
+	})
+}
+
+// ThatPaymentIsToBeProcessedOn sets the processing date of
+// the payment defined in the scenario data
+func (w *World) ThatPaymentIsToBeProcessedOn(date string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.ProcessingDate = date
+		return nil
+	})
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/ddliu/go-httpclient"
+	"github.com/pedro-gutierrez/form3/pkg/admin"
+	"github.com/pedro-gutierrez/form3/pkg/apikeys"
+	"github.com/pedro-gutierrez/form3/pkg/util"
 	"io/ioutil"
 	"log"
 	"strings"
@@ -20,6 +23,23 @@ type Client struct {
 	Json      map[string]interface{}
 	Text      string
 	Err       error
+
+	// The user requests are made on behalf of, if any
+	User string
+
+	// The api key requests are authenticated with, if any
+	ApiKey string
+
+	// The bearer token requests are authenticated with, if any
+	Token string
+
+	// What signs requests, if anything
+	Signer *Signer
+
+	// The key admin requests are authenticated with, and the
+	// token destructive admin operations are confirmed with, if any
+	AdminKey     string
+	Confirmation string
 }
 
 // NewClient returns a new HTTP client for the given
@@ -31,6 +51,21 @@ func NewClient(serverUrl string) *Client {
 	}
 }
 
+// Clone returns a new client for the same server, that authenticates
+// its requests in the same way, so that requests can be sent at once
+func (c *Client) Clone() *Client {
+	return &Client{
+		http:         httpclient.NewHttpClient(),
+		ServerUrl:    c.ServerUrl,
+		User:         c.User,
+		ApiKey:       c.ApiKey,
+		Token:        c.Token,
+		Signer:       c.Signer,
+		AdminKey:     c.AdminKey,
+		Confirmation: c.Confirmation,
+	}
+}
+
 // UrlFor builds a url for the given path
 // using the client's internal server configuration.
 func (c *Client) UrlFor(path string) string {
@@ -41,7 +76,7 @@ func (c *Client) UrlFor(path string) string {
 // and updates its last response record
 func (c *Client) Get(path string) {
 	url := c.UrlFor(path)
-	res, err := c.http.Get(url)
+	res, err := c.request("GET", url, "").Get(url)
 	c.Resp = res
 	c.Err = err
 	c.parseResponse()
@@ -51,7 +86,7 @@ func (c *Client) Get(path string) {
 // and updates its last response record
 func (c *Client) Delete(path string) {
 	url := c.UrlFor(path)
-	res, err := c.http.Delete(url)
+	res, err := c.request("DELETE", url, "").Delete(url)
 	c.Resp = res
 	c.Err = err
 	c.parseResponse()
@@ -61,7 +96,7 @@ func (c *Client) Delete(path string) {
 // with the given payload as json
 func (c *Client) Post(path string, data string) {
 	url := c.UrlFor(path)
-	res, err := c.http.PostJson(url, data)
+	res, err := c.request("POST", url, data).PostJson(url, data)
 	c.Resp = res
 	c.Err = err
 	c.parseResponse()
@@ -71,12 +106,38 @@ func (c *Client) Post(path string, data string) {
 // with the given payload as json
 func (c *Client) Put(path string, data string) {
 	url := c.UrlFor(path)
-	res, err := c.http.PutJson(url, data)
+	res, err := c.request("PUT", url, data).PutJson(url, data)
 	c.Resp = res
 	c.Err = err
 	c.parseResponse()
 }
 
+// request returns the http client to send the given request
+// with, along with the headers that identify the user and
+// authenticate the request
+func (c *Client) request(method string, url string, body string) *httpclient.HttpClient {
+	headers := map[string]string{}
+	if c.Signer != nil {
+		headers = c.Signer.Sign(method, url, body)
+	}
+	if c.User != "" {
+		headers[util.UserHeader] = c.User
+	}
+	if c.ApiKey != "" {
+		headers[apikeys.Header] = c.ApiKey
+	}
+	if c.Token != "" {
+		headers["Authorization"] = fmt.Sprintf("Bearer %s", c.Token)
+	}
+	if c.AdminKey != "" {
+		headers[admin.KeyHeader] = c.AdminKey
+	}
+	if c.Confirmation != "" {
+		headers[admin.ConfirmationHeader] = c.Confirmation
+	}
+	return c.http.WithHeaders(headers)
+}
+
 // parseResponse attempts to unmarshall the latest
 // response to either generic map (json) or simple tesxt. This will
 // initialize the Json and Textfields in the client's last response
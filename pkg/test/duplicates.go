@@ -0,0 +1,97 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+	"sync"
+)
+
+// ThatOrganisationHandlesDuplicatePayments sets the duplicate policy
+// of the organisation defined in the scenario data: either warn
+// or reject
+func (w *World) ThatOrganisationHandlesDuplicatePayments(policy string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Data.OrganisationData.DuplicatePolicy = policy
+		return nil
+	})
+}
+
+// ThatPaymentHasReference sets the reference of the
+// payment defined in the scenario data
+func (w *World) ThatPaymentHasReference(reference string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.Reference = reference
+		return nil
+	})
+}
+
+// ICreatedThatPayment combines logic from previous steps
+// in order to provide a convenience Given step for payments
+func (w *World) ICreatedThatPayment() error {
+	return DoThen(w.ICreateThatPayment(), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// ICreateThatPaymentAllowingDuplicates creates the payment defined
+// in the scenario data, even if it looks like a duplicate
+func (w *World) ICreateThatPaymentAllowingDuplicates() error {
+	w.Client.Post(w.versionedPath("/payments?allow_duplicate=true"), w.Data.PaymentData.ToJSON())
+	return nil
+}
+
+// IShouldHaveAWarning expects the client's latest
+// response to come with a warning header
+func (w *World) IShouldHaveAWarning() error {
+	return ExpectThen(ShouldNotBeNil(w.Client.Resp), func() error {
+		return Expect(ShouldNotBeEmpty(w.Client.Resp.Header.Get("Warning")))
+	})
+}
+
+// IShouldHaveNoWarning expects the client's latest
+// response to come with no warning header
+func (w *World) IShouldHaveNoWarning() error {
+	return ExpectThen(ShouldNotBeNil(w.Client.Resp), func() error {
+		return Expect(ShouldBeEmpty(w.Client.Resp.Header.Get("Warning")))
+	})
+}
+
+// ICreateCopiesOfThatPaymentAtOnce creates as many copies of the payment
+// defined in the scenario data as given, each one with its own id, all
+// at once, and remembers the status code of every request
+func (w *World) ICreateCopiesOfThatPaymentAtOnce(count int) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.StatusCodes = make([]int, count)
+
+		var wg sync.WaitGroup
+		for i := 0; i < count; i++ {
+			p := *w.Data.PaymentData
+			p.Id = fmt.Sprintf("%s%d", p.Id, i)
+			client := w.Client.Clone()
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				client.Post(w.versionedPath("/payments"), p.ToJSON())
+				if client.Resp != nil {
+					w.Data.StatusCodes[i] = client.Resp.StatusCode
+				}
+			}(i)
+		}
+
+		wg.Wait()
+		return nil
+	})
+}
+
+// OfThemShouldHaveStatusCode expects the given number of the requests
+// a previous step sent at once to have the given status code
+func (w *World) OfThemShouldHaveStatusCode(expected int, status int) error {
+	actual := 0
+	for _, s := range w.Data.StatusCodes {
+		if s == status {
+			actual++
+		}
+	}
+	return Expect(ShouldEqual(actual, expected))
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/events"
+	. "github.com/smartystreets/assertions"
+	"io"
+	"os"
+	"time"
+)
+
+// IFollowTheEventsFile remembers where the events file ends, so that
+// later steps only look at the events published after this step
+func (w *World) IFollowTheEventsFile() error {
+	if w.eventsFile == "" {
+		return fmt.Errorf("No events file to follow")
+	}
+
+	info, err := os.Stat(w.eventsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			w.Data.EventsOffset = 0
+			return nil
+		}
+		return err
+	}
+
+	w.Data.EventsOffset = info.Size()
+	return nil
+}
+
+// TheEventsFileShouldGetEventsOfTypeForPayment waits for the events
+// file to have the expected number of events of the given type about
+// the payment with the given id, since we started following it. The
+// relay publishes events in order, so once an event shows up, the
+// events written to the outbox before it are in the file too
+func (w *World) TheEventsFileShouldGetEventsOfTypeForPayment(expected int, eventType string, id string) error {
+	return DoEventually(func() error {
+		published, err := w.eventsSinceOffset()
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		for _, e := range published {
+			if e.Type == eventType && e.ResourceId == id {
+				count++
+			}
+		}
+		return Expect(ShouldEqual(count, expected))
+	}, 20, 250*time.Millisecond)
+}
+
+// eventsSinceOffset reads the events appended to the
+// events file since we started following it
+func (w *World) eventsSinceOffset() ([]*events.Event, error) {
+	f, err := os.Open(w.eventsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	if _, err := f.Seek(w.Data.EventsOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	published := []*events.Event{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		e := &events.Event{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, err
+		}
+		published = append(published, e)
+	}
+	return published, scanner.Err()
+}
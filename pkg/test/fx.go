@@ -0,0 +1,70 @@
+package test
+
+import (
+	"fmt"
+	"github.com/mdaverde/jsonpath"
+	. "github.com/smartystreets/assertions"
+	"time"
+)
+
+// IRequestAFxQuoteToSellFor sends a POST request for a new fx
+// quote with the given id, to sell a currency for another one
+func (w *World) IRequestAFxQuoteToSellFor(id string, sell string, buy string) error {
+	w.Client.Post(w.versionedPath("/fx-quotes"), fmt.Sprintf(`{
+		"data": {
+			"id": "%s",
+			"type": "Quote",
+			"organisation_id": "org1",
+			"attributes": {
+				"sell_currency": "%s",
+				"buy_currency": "%s"
+			}
+		}
+	}`, id, sell, buy))
+	return nil
+}
+
+// IRequestedAFxQuoteToSellFor combines logic from previous steps
+// in order to provide a convenience Given step for fx quotes
+func (w *World) IRequestedAFxQuoteToSellFor(id string, sell string, buy string) error {
+	return DoThen(w.IRequestAFxQuoteToSellFor(id, sell, buy), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// IGetFxQuote sends a GET request for
+// the fx quote with the given id
+func (w *World) IGetFxQuote(id string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/fx-quotes/%s", id)))
+	return nil
+}
+
+// IWaitForFxQuoteToExpire looks up the fx quote with the given
+// id, and waits until it expires. BDDs run with a short quote ttl
+func (w *World) IWaitForFxQuoteToExpire(id string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/fx-quotes/%s", id)))
+	return DoThen(w.IShouldHaveAJson(), func() error {
+		value, err := jsonpath.Get(w.Data.Subject, "data.attributes.expires_on")
+		if err != nil {
+			return err
+		}
+
+		expiresOn, err := time.Parse(time.RFC3339Nano, fmt.Sprintf("%v", value))
+		if err != nil {
+			return err
+		}
+
+		time.Sleep(time.Until(expiresOn))
+		return nil
+	})
+}
+
+// ThatPaymentIsConvertedAtFxQuote sets the currency of the payment
+// defined in the scenario data, and the fx quote it is converted at
+func (w *World) ThatPaymentIsConvertedAtFxQuote(currency string, quote string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.Currency = currency
+		w.Data.PaymentData.Quote = quote
+		return nil
+	})
+}
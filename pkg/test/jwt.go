@@ -0,0 +1,147 @@
+package test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// The issuer and audience of the bearer tokens BDDs use, and the
+// keys they are signed with. The server is expected to trust the key
+// set in the same directory
+const (
+	jwtIssuer   = "form3-bdd"
+	jwtAudience = "form3"
+	jwtKeys     = "jwt"
+)
+
+// IUseATokenFor authenticates the next requests with a bearer
+// token signed with the given algorithm, for the given subject,
+// organisation and comma separated roles
+func (w *World) IUseATokenFor(alg string, subject string, organisation string, roles string) error {
+	return w.useToken(alg, alg, subject, organisation, roles, jwtAudience, time.Now().Add(5*time.Minute))
+}
+
+// IUseAnExpiredTokenFor authenticates the next requests
+// with a bearer token that expired a while ago
+func (w *World) IUseAnExpiredTokenFor(subject string, organisation string, roles string) error {
+	return w.useToken("RS256", "RS256", subject, organisation, roles, jwtAudience, time.Now().Add(-time.Hour))
+}
+
+// IUseATokenForAnotherAudience authenticates the next requests
+// with a bearer token that was issued for someone else
+func (w *World) IUseATokenForAnotherAudience(subject string, organisation string, roles string) error {
+	return w.useToken("RS256", "RS256", subject, organisation, roles, "someone-else", time.Now().Add(5*time.Minute))
+}
+
+// IUseATokenSignedWithAnUnknownKey authenticates the next requests
+// with a bearer token signed with a key the server does not trust,
+// under the id of one it does
+func (w *World) IUseATokenSignedWithAnUnknownKey(subject string, organisation string, roles string) error {
+	return w.useToken("RS256", "unknown", subject, organisation, roles, jwtAudience, time.Now().Add(5*time.Minute))
+}
+
+// IUseNoToken stops authenticating requests with a bearer token
+func (w *World) IUseNoToken() error {
+	w.Client.Token = ""
+	return nil
+}
+
+// useToken signs a new bearer token with the given claims, and
+// the given algorithm and key, and uses it for the next requests
+func (w *World) useToken(alg string, key string, subject string, organisation string, roles string, audience string, expiresOn time.Time) error {
+	token, err := SignToken(alg, key, map[string]interface{}{
+		"iss":           jwtIssuer,
+		"aud":           audience,
+		"sub":           subject,
+		"organisations": []string{organisation},
+		"roles":         strings.Split(roles, ","),
+		"iat":           time.Now().Unix(),
+		"exp":           expiresOn.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Client.Token = token
+	return nil
+}
+
+// SignToken returns a new bearer token with the given claims, signed
+// with the given algorithm, RS256 or ES256, and the BDD key for
+// it. An unknown key signs it with a key nobody trusts instead
+func SignToken(alg string, key string, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"typ": "JWT",
+		"alg": alg,
+		"kid": fmt.Sprintf("bdd-%s", strings.ToLower(alg)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := fmt.Sprintf("%s.%s", base64.RawURLEncoding.EncodeToString(header), base64.RawURLEncoding.EncodeToString(payload))
+	digest := sha256.Sum256([]byte(input))
+
+	signer, err := signingKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	var signature []byte
+	switch k := signer.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, e := ecdsa.Sign(rand.Reader, k, digest[:])
+		signature, err = append(padded(r.Bytes()), padded(s.Bytes())...), e
+	default:
+		err = fmt.Errorf("Unsupported signing key %s", key)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s.%s", input, base64.RawURLEncoding.EncodeToString(signature)), nil
+}
+
+// signingKey reads the BDD private key for the given algorithm, or
+// generates a new one, if unknown
+func signingKey(key string) (interface{}, error) {
+	if key == "unknown" {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+
+	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s.pem", jwtKeys, strings.ToLower(key)))
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("No private key for %s", key)
+	}
+
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+// padded left pads the given bytes of an ES256
+// signature component to its 32 byte length
+func padded(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
@@ -0,0 +1,37 @@
+package test
+
+import (
+	. "github.com/smartystreets/assertions"
+)
+
+// ThatOrganisationHasAMonthlyLimitOf sets the monthly limit of
+// the organisation defined in the scenario data
+func (w *World) ThatOrganisationHasAMonthlyLimitOf(limit string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Data.OrganisationData.MonthlyLimit = limit
+		return nil
+	})
+}
+
+// ThatOrganisationAllowsPaymentsA sets how many payments the
+// organisation defined in the scenario data can create a day,
+// or a month
+func (w *World) ThatOrganisationAllowsPaymentsA(count int, period string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		if period == "day" {
+			w.Data.OrganisationData.DailyCountLimit = count
+		} else {
+			w.Data.OrganisationData.MonthlyCountLimit = count
+		}
+		return nil
+	})
+}
+
+// ThatOrganisationAllowsPaymentsOfUpTo sets the maximum amount of
+// a single payment of the organisation defined in the scenario data
+func (w *World) ThatOrganisationAllowsPaymentsOfUpTo(amount string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Data.OrganisationData.MaxPaymentAmount = amount
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+)
+
+// ICreateAMandateForAccount sends a POST request for a new
+// mandate with the given id, that allows org1 to collect payments
+// from the given account
+func (w *World) ICreateAMandateForAccount(id string, account string) error {
+	w.Client.Post(w.versionedPath("/mandates"), fmt.Sprintf(`{
+		"data": {
+			"id": "%s",
+			"type": "Mandate",
+			"organisation_id": "org1",
+			"attributes": {
+				"reference": "REF-%s",
+				"debtor_name": "John Doe",
+				"debtor_account_number": "%s",
+				"debtor_bank_id": "400300"
+			}
+		}
+	}`, id, account, account))
+	return nil
+}
+
+// ICreatedAMandateForAccount combines logic from previous steps
+// in order to provide a convenience Given step for mandates
+func (w *World) ICreatedAMandateForAccount(id string, account string) error {
+	return DoThen(w.ICreateAMandateForAccount(id, account), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// IActivateMandate sends a POST request in order
+// to activate the mandate with the given id
+func (w *World) IActivateMandate(id string) error {
+	w.Client.Post(w.versionedPath(fmt.Sprintf("/mandates/%s/activate", id)), "")
+	return nil
+}
+
+// IActivatedMandate combines logic from previous steps
+// in order to provide a convenience Given step for mandates
+func (w *World) IActivatedMandate(id string) error {
+	return DoThen(w.IActivateMandate(id), func() error {
+		return w.IShouldHaveStatusCode(200)
+	})
+}
+
+// ICancelMandateWithReasonCode sends a POST request in order to
+// cancel the mandate with the given id, with the given reason code
+func (w *World) ICancelMandateWithReasonCode(id string, code string) error {
+	w.Client.Post(w.versionedPath(fmt.Sprintf("/mandates/%s/cancel", id)), fmt.Sprintf(`{
+		"data": {
+			"reason_code": "%s"
+		}
+	}`, code))
+	return nil
+}
+
+// IGetMandate sends a GET request for
+// the mandate with the given id
+func (w *World) IGetMandate(id string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/mandates/%s", id)))
+	return nil
+}
+
+// ThatPaymentIsCollectedAgainstMandateFromAccount makes the payment
+// defined in the scenario data a Bacs direct debit, collected against
+// the given mandate from the given account
+func (w *World) ThatPaymentIsCollectedAgainstMandateFromAccount(mandate string, account string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.Scheme = "BACS"
+		w.Data.PaymentData.Mandate = mandate
+		w.Data.PaymentData.DebtorAccountNumber = account
+		return nil
+	})
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+)
+
+// ThereIsAnActiveOrganisation makes sure the given organisation
+// exists, with no particular settings, so that payments can be
+// made on its behalf
+func (w *World) ThereIsAnActiveOrganisation(id string) error {
+	o := &OrganisationData{Id: id, Status: "active"}
+	w.Client.Post(w.versionedPath("/organisations"), o.ToJSON())
+	return w.IShouldHaveStatusCode(201)
+}
+
+// AnOrganisationWithId defines a new, active organisation in the
+// current scenario context, with the given id and no settings
+func (w *World) AnOrganisationWithId(id string) error {
+	w.Data.OrganisationData = &OrganisationData{
+		Id:     id,
+		Status: "active",
+	}
+	return nil
+}
+
+// ThatOrganisationIsInactive marks the organisation defined in
+// the scenario data as inactive
+func (w *World) ThatOrganisationIsInactive() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Data.OrganisationData.Status = "inactive"
+		return nil
+	})
+}
+
+// ThatOrganisationOnlyAllowsCurrencies restricts the currencies of
+// the organisation defined in the scenario data, given as a comma
+// separated list
+func (w *World) ThatOrganisationOnlyAllowsCurrencies(currencies string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Data.OrganisationData.AllowedCurrencies = currencies
+		return nil
+	})
+}
+
+// ThatOrganisationHasADailyLimitOf sets the daily limit of the
+// organisation defined in the scenario data
+func (w *World) ThatOrganisationHasADailyLimitOf(limit string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Data.OrganisationData.DailyLimit = limit
+		return nil
+	})
+}
+
+// ThatOrganisationHasDefaultScheme sets the default scheme of the
+// organisation defined in the scenario data
+func (w *World) ThatOrganisationHasDefaultScheme(scheme string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Data.OrganisationData.DefaultScheme = scheme
+		return nil
+	})
+}
+
+// ThatOrganisationRejectsNonProcessingDays makes the organisation
+// defined in the scenario data reject payments whose processing date
+// is not a business day, instead of rolling it forward
+func (w *World) ThatOrganisationRejectsNonProcessingDays() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Data.OrganisationData.ProcessingDatePolicy = "reject"
+		return nil
+	})
+}
+
+// ICreateThatOrganisation creates the organisation defined in the
+// scenario data, by posting it to the organisations endpoint, as json
+func (w *World) ICreateThatOrganisation() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Client.Post(w.versionedPath("/organisations"), w.Data.OrganisationData.ToJSON())
+		return nil
+	})
+}
+
+// ICreatedThatOrganisation combines logic from previous steps in order
+// to provide a convenience Given step for organisation fixtures
+func (w *World) ICreatedThatOrganisation() error {
+	return DoThen(w.ICreateThatOrganisation(), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// IUpdateThatOrganisation sends a PUT request with the organisation
+// defined in the scenario data
+func (w *World) IUpdateThatOrganisation() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		o := w.Data.OrganisationData
+		w.Client.Put(w.versionedPath(fmt.Sprintf("/organisations/%s", o.Id)), o.ToJSON())
+		return nil
+	})
+}
+
+// IGetThatOrganisation sends a GET request for the organisation
+// defined in the scenario data
+func (w *World) IGetThatOrganisation() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Client.Get(w.versionedPath(fmt.Sprintf("/organisations/%s", w.Data.OrganisationData.Id)))
+		return nil
+	})
+}
+
+// IDeleteThatOrganisation sends a DELETE request for the organisation
+// defined in the scenario data, and its current version
+func (w *World) IDeleteThatOrganisation() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		o := w.Data.OrganisationData
+		w.Client.Delete(w.versionedPath(fmt.Sprintf("/organisations/%s?version=%v", o.Id, o.Version)))
+		return nil
+	})
+}
+
+// APaymentWithIdForThatOrganisation defines a new payment in the current
+// scenario context, with the given id, on behalf of the organisation
+// defined in the scenario data
+func (w *World) APaymentWithIdForThatOrganisation(id string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		return DoThen(w.APaymentWithId(id), func() error {
+			w.Data.PaymentData.Organisation = w.Data.OrganisationData.Id
+			return nil
+		})
+	})
+}
+
+// ThatPaymentBelongsToOrganisation sets the organisation of
+// the payment defined in the scenario data
+func (w *World) ThatPaymentBelongsToOrganisation(organisation string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.Organisation = organisation
+		return nil
+	})
+}
+
+// ThatPaymentIsInCurrency sets the currency of the payment
+// defined in the scenario data
+func (w *World) ThatPaymentIsInCurrency(currency string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.Currency = currency
+		return nil
+	})
+}
+
+// ThatPaymentHasAmount sets the amount of the payment
+// defined in the scenario data
+func (w *World) ThatPaymentHasAmount(amount string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.Amount = amount
+		return nil
+	})
+}
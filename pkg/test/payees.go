@@ -0,0 +1,30 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+)
+
+// ICheckPayeeForAccount sends a POST request in order to
+// confirm the given name against the name the given account
+// is registered with
+func (w *World) ICheckPayeeForAccount(name string, account string) error {
+	w.Client.Post(w.versionedPath("/payee-checks"), fmt.Sprintf(`{
+		"data": {
+			"name": "%s",
+			"account_number": "%s",
+			"bank_id": "400300"
+		}
+	}`, name, account))
+	return nil
+}
+
+// ThatOrganisationHandlesPayeeMismatches sets the payee check
+// policy of the organisation defined in the scenario data: either
+// warn or reject
+func (w *World) ThatOrganisationHandlesPayeeMismatches(policy string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.OrganisationData), func() error {
+		w.Data.OrganisationData.PayeeCheckPolicy = policy
+		return nil
+	})
+}
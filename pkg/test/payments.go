@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"github.com/mdaverde/jsonpath"
 	. "github.com/smartystreets/assertions"
+	"net/url"
 	"reflect"
+	"sync"
+	"time"
 )
 
 // TheServiceIsUp checks the health check is reponding propertly
@@ -24,17 +27,22 @@ func (w *World) ThereAreNoPayments() error {
 	})
 }
 
-// IDeleteAllData use the admin endpoints in order to delete all data
+// IDeleteAllData use the admin endpoints in order to delete all
+// data, once confirmed
 func (w *World) IDeleteAllData() error {
-	w.Client.Delete("/admin/repo")
-	return nil
+	return DoThen(w.IRequestAConfirmationToDeleteAllData(), func() error {
+		return DoThen(w.IShouldHaveStatusCode(201), func() error {
+			return w.IDeleteAllDataWithThatConfirmation()
+		})
+	})
 }
 
 // IGetTheRepoInfo uses the admin endpoints in order to get the
 // current repository info
 func (w *World) IGetTheRepoInfo() error {
-	w.Client.Get("/admin/repo")
-	return nil
+	return w.asAdmin(func() {
+		w.Client.Get("/admin/repo")
+	})
 }
 
 // TheRepoShouldHaveItems uses the admin repo info endpoint
@@ -79,6 +87,13 @@ func (w *World) IGetPaymentsFromTo(from int, to int) error {
 	return nil
 }
 
+// IGetAllPaymentsOfOrganisation fetches payments 0 to 19
+// of the given organisation
+func (w *World) IGetAllPaymentsOfOrganisation(organisation string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/payments?organisation_id=%s&from=0&to=20", url.QueryEscape(organisation))))
+	return nil
+}
+
 // iQueryTheMetricsEndpoint performs a GET on the metrics
 // endpoint and stores the response details in the World
 // context
@@ -189,6 +204,18 @@ func (w *World) ThatJsonShouldHaveA(path string) error {
 	})
 }
 
+// ThatJsonShouldNotHaveA checks the given path
+// is not set in the json of the last response
+func (w *World) ThatJsonShouldNotHaveA(path string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.Subject), func() error {
+		actual, err := jsonpath.Get(w.Data.Subject, path)
+		if err != nil {
+			return nil
+		}
+		return Expect(ShouldBeNil(actual))
+	})
+}
+
 // APaymentWithId defines a new payment in the current scenario context
 // with the given id, and default values for the organisation and amount
 func (w *World) APaymentWithId(id string) error {
@@ -272,6 +299,43 @@ func (w *World) IGetThatPayment() error {
 	})
 }
 
+// IRememberTheCurrentTime stores the current time in the scenario
+// data. We leave some time before and after, so that changes made by
+// previous and next steps are not recorded at the very same time
+func (w *World) IRememberTheCurrentTime() error {
+	time.Sleep(10 * time.Millisecond)
+	w.Data.Time = time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	return nil
+}
+
+// IGetThatPaymentAsOfTheRememberedTime sends a GET request for the
+// payment defined in the scenario data, as it was at the remembered time
+func (w *World) IGetThatPaymentAsOfTheRememberedTime() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		return w.IGetThatPaymentAsOf(w.Data.Time.Format(time.RFC3339Nano))
+	})
+}
+
+// IGetThatPaymentAsOf sends a GET request for the payment defined
+// in the scenario data, with the given as_of query param
+func (w *World) IGetThatPaymentAsOf(asOf string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		p := w.Data.PaymentData
+		path := w.versionedPath(fmt.Sprintf("/payments/%s?as_of=%s", p.Id, url.QueryEscape(asOf)))
+		w.Client.Get(path)
+		return nil
+	})
+}
+
+// IGetAllPaymentsAsOfTheRememberedTime fetches payments 0 to 19, as
+// they were at the remembered time
+func (w *World) IGetAllPaymentsAsOfTheRememberedTime() error {
+	asOf := url.QueryEscape(w.Data.Time.Format(time.RFC3339Nano))
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/payments?from=0&to=20&as_of=%s", asOf)))
+	return nil
+}
+
 // ICreatedANewPaymentWithId combines logic from previous steps in order
 // to provide a convenience Given step for payment fixtures in more complex
 // scenarios
@@ -354,6 +418,51 @@ func (w *World) IUpdatedThatPayment() error {
 	})
 }
 
+// IUpdatedThatPaymentTimes updates the payment defined in the scenario
+// data as many times as given, one version after another. Every
+// version has its own reference (eg. update 3), so that scenarios can
+// tell them apart
+func (w *World) IUpdatedThatPaymentTimes(count int) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		for i := 1; i <= count; i++ {
+			w.Data.PaymentData.Reference = fmt.Sprintf("update %d", i)
+			if err := w.IUpdatedThatPayment(); err != nil {
+				return err
+			}
+			w.Data.PaymentData.Version++
+		}
+		return nil
+	})
+}
+
+// IUpdateThatPaymentTimesAtOnce sends as many updates of the same
+// version of the payment defined in the scenario data as given, all
+// at once, and remembers the status code of every request
+func (w *World) IUpdateThatPaymentTimesAtOnce(count int) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.StatusCodes = make([]int, count)
+
+		var wg sync.WaitGroup
+		for i := 0; i < count; i++ {
+			p := *w.Data.PaymentData
+			p.Reference = fmt.Sprintf("update %d", i)
+			client := w.Client.Clone()
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				client.Put(w.versionedPath(fmt.Sprintf("/payments/%s", p.Id)), p.ToJSON())
+				if client.Resp != nil {
+					w.Data.StatusCodes[i] = client.Resp.StatusCode
+				}
+			}(i)
+		}
+
+		wg.Wait()
+		return nil
+	})
+}
+
 // IShouldHavePayments fetches a list of payments and ensure the number
 // of items returned is the expected
 func (w *World) IShouldHavePayments(expected int) error {
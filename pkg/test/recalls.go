@@ -0,0 +1,73 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+)
+
+// IRecallThatPaymentWithReason requests a recall, with the given id
+// and reason code, of the payment defined in the scenario data
+func (w *World) IRecallThatPaymentWithReason(id string, reason string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		path := w.versionedPath(fmt.Sprintf("/payments/%s/recalls", w.Data.PaymentData.Id))
+		w.Client.Post(path, fmt.Sprintf(`{
+			"data": {
+				"id": "%s",
+				"type": "Recall",
+				"attributes": {
+					"reason_code": "%s"
+				}
+			}
+		}`, id, reason))
+		return nil
+	})
+}
+
+// IRecalledThatPaymentWithReason combines logic from previous steps
+// in order to provide a convenience Given step for recalled payments
+func (w *World) IRecalledThatPaymentWithReason(id string, reason string) error {
+	return DoThen(w.IRecallThatPaymentWithReason(id, reason), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// IMoveVersionOfRecallToStatus moves the given version of a recall
+// of the payment defined in the scenario data to the given status
+func (w *World) IMoveVersionOfRecallToStatus(version int, id string, status string) error {
+	return w.updateRecall(version, id, status, "")
+}
+
+// IMoveVersionOfRecallToRejected rejects the given version of a recall
+// of the payment defined in the scenario data, with the given reason code
+func (w *World) IMoveVersionOfRecallToRejected(version int, id string, rejection string) error {
+	return w.updateRecall(version, id, "rejected", rejection)
+}
+
+// updateRecall sends a PUT request for the given version of a
+// recall of the payment defined in the scenario data
+func (w *World) updateRecall(version int, id string, status string, rejection string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		path := w.versionedPath(fmt.Sprintf("/payments/%s/recalls/%s", w.Data.PaymentData.Id, id))
+		w.Client.Put(path, fmt.Sprintf(`{
+			"data": {
+				"id": "%s",
+				"type": "Recall",
+				"version": %v,
+				"attributes": {
+					"status": "%s",
+					"rejection_code": "%s"
+				}
+			}
+		}`, id, version, status, rejection))
+		return nil
+	})
+}
+
+// IGetTheRecallsOfThatPayment sends a GET request for the recalls
+// of the payment defined in the scenario data
+func (w *World) IGetTheRecallsOfThatPayment() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Client.Get(w.versionedPath(fmt.Sprintf("/payments/%s/recalls", w.Data.PaymentData.Id)))
+		return nil
+	})
+}
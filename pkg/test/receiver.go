@@ -0,0 +1,61 @@
+package test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Received is a simplified representation of a http
+// request captured by a Receiver
+type Received struct {
+	Header http.Header
+	Body   []byte
+}
+
+// Receiver is a stand-in webhook receiver, that runs inside
+// the test process, records every request it gets and responds
+// with a configurable status code
+type Receiver struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	status   int
+	received []*Received
+}
+
+// NewReceiver starts a new receiver that responds
+// with the given status code
+func NewReceiver(status int) *Receiver {
+	r := &Receiver{status: status}
+	r.server = httptest.NewServer(http.HandlerFunc(r.handle))
+	return r
+}
+
+// Url returns the url the receiver is listening at
+func (r *Receiver) Url() string {
+	return r.server.URL
+}
+
+// Close stops the receiver
+func (r *Receiver) Close() {
+	r.server.Close()
+}
+
+// Received returns a copy of all requests received so far
+func (r *Receiver) Received() []*Received {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]*Received{}, r.received...)
+}
+
+// handle records the incoming request
+func (r *Receiver) handle(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.mutex.Lock()
+	r.received = append(r.received, &Received{Header: req.Header, Body: body})
+	r.mutex.Unlock()
+
+	w.WriteHeader(r.status)
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+)
+
+// IReturnOfThatPaymentWithReason posts a return of the given amount
+// and reason code, for the payment defined in the scenario data
+func (w *World) IReturnOfThatPaymentWithReason(amount string, reason string) error {
+	return w.returnThatPayment("", amount, reason)
+}
+
+// IReturnOfThatPaymentAsWithReason posts a return with the given id,
+// amount and reason code, for the payment defined in the scenario data
+func (w *World) IReturnOfThatPaymentAsWithReason(amount string, id string, reason string) error {
+	return w.returnThatPayment(id, amount, reason)
+}
+
+// IReturnedOfThatPaymentWithReason combines logic from previous steps
+// in order to provide a convenience Given step for returned payments
+func (w *World) IReturnedOfThatPaymentWithReason(amount string, reason string) error {
+	return DoThen(w.IReturnOfThatPaymentWithReason(amount, reason), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// IReverseThatPaymentWithReason posts a reversal, with the given
+// reason code, for the payment defined in the scenario data
+func (w *World) IReverseThatPaymentWithReason(reason string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		path := w.versionedPath(fmt.Sprintf("/payments/%s/reversals", w.Data.PaymentData.Id))
+		w.Client.Post(path, fmt.Sprintf(`{
+			"data": {
+				"type": "Reversal",
+				"attributes": {
+					"reason_code": "%s"
+				}
+			}
+		}`, reason))
+		return nil
+	})
+}
+
+// IGetTheReturnsOfThatPayment sends a GET request for the returns
+// of the payment defined in the scenario data
+func (w *World) IGetTheReturnsOfThatPayment() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Client.Get(w.versionedPath(fmt.Sprintf("/payments/%s/returns", w.Data.PaymentData.Id)))
+		return nil
+	})
+}
+
+// IGetTheReversalsOfThatPayment sends a GET request for the reversals
+// of the payment defined in the scenario data
+func (w *World) IGetTheReversalsOfThatPayment() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Client.Get(w.versionedPath(fmt.Sprintf("/payments/%s/reversals", w.Data.PaymentData.Id)))
+		return nil
+	})
+}
+
+// returnThatPayment posts a return with the given id, if any, amount
+// and reason code, for the payment defined in the scenario data
+func (w *World) returnThatPayment(id string, amount string, reason string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		path := w.versionedPath(fmt.Sprintf("/payments/%s/returns", w.Data.PaymentData.Id))
+		w.Client.Post(path, fmt.Sprintf(`{
+			"data": {
+				"id": "%s",
+				"type": "Return",
+				"attributes": {
+					"amount": "%s",
+					"reason_code": "%s"
+				}
+			}
+		}`, id, amount, reason))
+		return nil
+	})
+}
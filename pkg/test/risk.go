@@ -0,0 +1,30 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+)
+
+// ThatPaymentIsMadeToABeneficiaryIn sets the country of the
+// beneficiary of the payment defined in the scenario data
+func (w *World) ThatPaymentIsMadeToABeneficiaryIn(country string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.BeneficiaryCountry = country
+		return nil
+	})
+}
+
+// IReviewThatPaymentRisk sends a POST request in order to release
+// or reject the payment defined in the scenario data, once held
+// because of its fraud risk score
+func (w *World) IReviewThatPaymentRisk(decision string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Client.Post(w.versionedPath(fmt.Sprintf("/payments/%s/risk-review", w.Data.PaymentData.Id)), fmt.Sprintf(`{
+			"data": {
+				"decision": "%s",
+				"comment": "Reviewed in BDDs"
+			}
+		}`, decision))
+		return nil
+	})
+}
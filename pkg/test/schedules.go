@@ -0,0 +1,171 @@
+package test
+
+import (
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/util"
+	"strings"
+	"time"
+)
+
+// relativeDay returns the calendar date of today,
+// tomorrow or yesterday
+func relativeDay(day string) time.Time {
+	today := time.Now().UTC()
+	switch day {
+	case "tomorrow":
+		return today.AddDate(0, 0, 1)
+	case "yesterday":
+		return today.AddDate(0, 0, -1)
+	default:
+		return today
+	}
+}
+
+// debtorAccount returns the id of the account defined
+// in the scenario data, if any
+func (w *World) debtorAccount() string {
+	if w.Data.AccountData == nil {
+		return ""
+	}
+	return w.Data.AccountData.Id
+}
+
+// APaymentWithTheIdOfScheduleFor defines a new payment in the current
+// scenario context, with the id the given schedule would give to its
+// payment on the given day
+func (w *World) APaymentWithTheIdOfScheduleFor(id string, day string) error {
+	date := strings.Replace(util.FormatDate(relativeDay(day)), "-", "", -1)
+	return w.APaymentWithId(fmt.Sprintf("%s-%s", id, date))
+}
+
+// IScheduleAPaymentFor sends a POST request for a new schedule with
+// the given id, that creates a one-off payment of the given amount on
+// the given day. Payments are debited from the account defined in the
+// scenario data, if any
+func (w *World) IScheduleAPaymentFor(id string, amount string, day string) error {
+	w.Client.Post(w.versionedPath("/schedules"), fmt.Sprintf(`{
+		"data": {
+			"id": "%s",
+			"type": "Schedule",
+			"organisation_id": "org1",
+			"attributes": {
+				"payment": {
+					"amount": "%s",
+					"currency": "GBP",
+					"debtor_account_id": "%s"
+				},
+				"processing_date": "%s"
+			}
+		}
+	}`, id, amount, w.debtorAccount(), util.FormatDate(relativeDay(day))))
+	return nil
+}
+
+// IScheduledAPaymentFor combines logic from previous steps
+// in order to provide a convenience Given step for schedules
+func (w *World) IScheduledAPaymentFor(id string, amount string, day string) error {
+	return DoThen(w.IScheduleAPaymentFor(id, amount, day), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// IScheduleARecurringPaymentStarting sends a POST request for a new
+// schedule with the given id and frequency, that creates payments of
+// the given amount from the given day
+func (w *World) IScheduleARecurringPaymentStarting(frequency string, id string, amount string, day string) error {
+	w.Client.Post(w.versionedPath("/schedules"), fmt.Sprintf(`{
+		"data": {
+			"id": "%s",
+			"type": "Schedule",
+			"organisation_id": "org1",
+			"attributes": {
+				"payment": {
+					"amount": "%s",
+					"currency": "GBP",
+					"debtor_account_id": "%s"
+				},
+				"recurrence": {
+					"frequency": "%s",
+					"start_date": "%s"
+				}
+			}
+		}
+	}`, id, amount, w.debtorAccount(), frequency, util.FormatDate(relativeDay(day))))
+	return nil
+}
+
+// IScheduledARecurringPaymentStarting combines logic from previous
+// steps in order to provide a convenience Given step for recurring
+// schedules
+func (w *World) IScheduledARecurringPaymentStarting(frequency string, id string, amount string, day string) error {
+	return DoThen(w.IScheduleARecurringPaymentStarting(frequency, id, amount, day), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// IMoveSchedule pauses, resumes or cancels the given schedule
+func (w *World) IMoveSchedule(action string, id string) error {
+	w.Client.Post(w.versionedPath(fmt.Sprintf("/schedules/%s/%s", id, action)), "")
+	return nil
+}
+
+// IGetSchedule sends a GET request for the given schedule
+func (w *World) IGetSchedule(id string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/schedules/%s", id)))
+	return nil
+}
+
+// IGetThePaymentOfScheduleFor sends a GET request for the payment
+// the given schedule creates on the given day
+func (w *World) IGetThePaymentOfScheduleFor(id string, day string) error {
+	date := strings.Replace(util.FormatDate(relativeDay(day)), "-", "", -1)
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/payments/%s-%s", id, date)))
+	return nil
+}
+
+// ThePaymentOfScheduleForShouldBeCreated waits for the scheduler to
+// create the payment of the given schedule for the given day
+func (w *World) ThePaymentOfScheduleForShouldBeCreated(id string, day string) error {
+	return DoEventually(func() error {
+		return DoThen(w.IGetThePaymentOfScheduleFor(id, day), func() error {
+			return DoThen(w.IShouldHaveStatusCode(200), func() error {
+				return w.IShouldHaveAJson()
+			})
+		})
+	}, 20, 250*time.Millisecond)
+}
+
+// ThePaymentOfScheduleForShouldNotBeCreated gives the scheduler some
+// time, and checks it did not create the payment of the given
+// schedule for the given day
+func (w *World) ThePaymentOfScheduleForShouldNotBeCreated(id string, day string) error {
+	time.Sleep(time.Second)
+	return DoThen(w.IGetThePaymentOfScheduleFor(id, day), func() error {
+		return w.IShouldHaveStatusCode(404)
+	})
+}
+
+// ScheduleShouldBeDueInDays waits for the given schedule to move
+// forward, so that its next payment is due in the given number of days
+func (w *World) ScheduleShouldBeDueInDays(id string, days int) error {
+	expected := util.FormatDate(time.Now().UTC().AddDate(0, 0, days))
+	return DoEventually(func() error {
+		return DoThen(w.IGetSchedule(id), func() error {
+			return DoThen(w.IShouldHaveAJson(), func() error {
+				return w.ThatJsonShouldHaveString("data.attributes.next_date", expected)
+			})
+		})
+	}, 20, 250*time.Millisecond)
+}
+
+// ScheduleShouldFail waits for the scheduler to record
+// an error in the given schedule
+func (w *World) ScheduleShouldFail(id string) error {
+	return DoEventually(func() error {
+		return DoThen(w.IGetSchedule(id), func() error {
+			return DoThen(w.IShouldHaveAJson(), func() error {
+				return w.ThatJsonShouldHaveA("data.attributes.last_error")
+			})
+		})
+	}, 20, 250*time.Millisecond)
+}
@@ -0,0 +1,37 @@
+package test
+
+import (
+	"fmt"
+	. "github.com/smartystreets/assertions"
+)
+
+// ThatPaymentIsMadeTo sets the name of the beneficiary
+// of the payment defined in the scenario data
+func (w *World) ThatPaymentIsMadeTo(name string) error {
+	return w.ThatPaymentIsMadeToAt(name, "")
+}
+
+// ThatPaymentIsMadeToAt sets the name and address of the
+// beneficiary of the payment defined in the scenario data
+func (w *World) ThatPaymentIsMadeToAt(name string, address string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.BeneficiaryName = name
+		w.Data.PaymentData.BeneficiaryAddress = address
+		return nil
+	})
+}
+
+// IReviewThatPayment sends a POST request in order to release
+// or reject the payment defined in the scenario data, once held
+// because of its sanctions screening hits
+func (w *World) IReviewThatPayment(decision string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Client.Post(w.versionedPath(fmt.Sprintf("/payments/%s/screening-review", w.Data.PaymentData.Id)), fmt.Sprintf(`{
+			"data": {
+				"decision": "%s",
+				"comment": "Reviewed in BDDs"
+			}
+		}`, decision))
+		return nil
+	})
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/apikeys"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Signer signs the requests of a client with the private key of an
+// api key, as per draft-cavage-http-signatures. Signatures cover the
+// method and path, date, host, and digest of the body of requests
+type Signer struct {
+	KeyId string
+	Key   crypto.Signer
+
+	// How long ago requests are dated, if at all
+	Age time.Duration
+}
+
+// Sign returns the headers that sign a request with the given
+// method, url and body. Requests without a body, such as GET
+// requests, have no digest
+func (s *Signer) Sign(method string, rawUrl string, body string) map[string]string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return map[string]string{}
+	}
+
+	headers := map[string]string{
+		"Date": time.Now().Add(-s.Age).UTC().Format(http.TimeFormat),
+	}
+
+	lines := []string{
+		fmt.Sprintf("(request-target): %s %s", strings.ToLower(method), u.RequestURI()),
+		fmt.Sprintf("date: %s", headers["Date"]),
+		fmt.Sprintf("host: %s", u.Host),
+	}
+	names := "(request-target) date host"
+
+	if method != "GET" && method != "DELETE" {
+		headers[apikeys.DigestHeader] = apikeys.Digest([]byte(body))
+		lines = append(lines, fmt.Sprintf("digest: %s", headers[apikeys.DigestHeader]))
+		names = fmt.Sprintf("%s digest", names)
+	}
+
+	algorithm := apikeys.AlgorithmRSA
+	if _, ok := s.Key.(*ecdsa.PrivateKey); ok {
+		algorithm = apikeys.AlgorithmECDSA
+	}
+
+	digest := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	signature, err := s.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return headers
+	}
+
+	headers["Signature"] = fmt.Sprintf(`keyId="%s",algorithm="%s",headers="%s",signature="%s"`,
+		s.KeyId, algorithm, names, base64.StdEncoding.EncodeToString(signature))
+	return headers
+}
+
+// IRegisterASigningKey sends a POST request for a new api key with
+// the given id, for org1, with the public key of a new key pair of the
+// given type, and the given comma separated permissions. The private key
+// is remembered by id
+func (w *World) IRegisterASigningKey(keyType string, id string, permissions string) error {
+	key, err := newSigningKey(keyType)
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+
+	return DoThen(w.registerPublicKey(id, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), permissions), func() error {
+		w.Data.SigningKeys[id] = key
+		return nil
+	})
+}
+
+// IRegisteredASigningKey combines logic from previous steps
+// in order to provide a convenience Given step for signing keys
+func (w *World) IRegisteredASigningKey(keyType string, id string, permissions string) error {
+	return DoThen(w.IRegisterASigningKey(keyType, id, permissions), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+// IRegisterAnInvalidPublicKey sends a POST request for a new
+// api key with the given id, with something that is not a public key
+func (w *World) IRegisterAnInvalidPublicKey(id string) error {
+	return w.registerPublicKey(id, "not a public key", "read")
+}
+
+// ISignRequestsWithKey signs the next requests with the
+// private key of the signing key with the given id
+func (w *World) ISignRequestsWithKey(id string) error {
+	w.Client.Signer = &Signer{KeyId: id, Key: w.Data.SigningKeys[id]}
+	return nil
+}
+
+// ISignRequestsWithKeyDatedMinutesAgo signs the next requests with
+// the private key of the signing key with the given id, dating
+// them the given number of minutes ago
+func (w *World) ISignRequestsWithKeyDatedMinutesAgo(id string, minutes int) error {
+	w.Client.Signer = &Signer{KeyId: id, Key: w.Data.SigningKeys[id], Age: time.Duration(minutes) * time.Minute}
+	return nil
+}
+
+// ISignRequestsWithAnotherKeyAs signs the next requests with a
+// new private key, under the id of the given signing key
+func (w *World) ISignRequestsWithAnotherKeyAs(id string) error {
+	key, err := newSigningKey("ECDSA")
+	if err != nil {
+		return err
+	}
+
+	w.Client.Signer = &Signer{KeyId: id, Key: key}
+	return nil
+}
+
+// IStopSigningRequests makes the next requests unsigned
+func (w *World) IStopSigningRequests() error {
+	w.Client.Signer = nil
+	return nil
+}
+
+// registerPublicKey sends a POST request for a new api key
+// with the given id, for org1, with the given public key
+func (w *World) registerPublicKey(id string, publicKey string, permissions string) error {
+	encoded, err := json.Marshal(publicKey)
+	if err != nil {
+		return err
+	}
+
+	w.Client.Post(w.versionedPath("/api-keys"), fmt.Sprintf(`{
+		"data": {
+			"id": "%s",
+			"type": "ApiKey",
+			"organisation_id": "org1",
+			"attributes": {
+				"permissions": ["%s"],
+				"public_key": %s
+			}
+		}
+	}`, id, strings.Join(strings.Split(permissions, ","), `","`), encoded))
+	return nil
+}
+
+// newSigningKey generates a new RSA or ECDSA private key
+func newSigningKey(keyType string) (crypto.Signer, error) {
+	if keyType == "RSA" {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
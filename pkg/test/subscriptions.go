@@ -0,0 +1,181 @@
+package test
+
+import (
+	"fmt"
+	"github.com/pedro-gutierrez/form3/pkg/subscriptions"
+	. "github.com/smartystreets/assertions"
+	"time"
+)
+
+// AWebhookReceiverRespondingWith starts a stand-in webhook receiver
+// in the current scenario, that responds with the given status code
+func (w *World) AWebhookReceiverRespondingWith(status int) error {
+	w.Data.Receiver = NewReceiver(status)
+	return nil
+}
+
+// ASubscriptionForEvents defines a new subscription in the current scenario
+// context, with the given id and event types, pointing at the scenario's
+// webhook receiver
+func (w *World) ASubscriptionForEvents(id string, eventTypes string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.Receiver), func() error {
+		w.Data.SubscriptionData = &SubscriptionData{
+			Id:           id,
+			Organisation: "org1",
+			CallbackUri:  w.Data.Receiver.Url(),
+			EventTypes:   eventTypes,
+			Secret:       "secret",
+		}
+		return nil
+	})
+}
+
+// ICreateThatSubscription creates the subscription defined in the
+// scenario data, by posting it to the subscriptions endpoint, as json
+func (w *World) ICreateThatSubscription() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.SubscriptionData), func() error {
+		w.Client.Post(w.versionedPath("/subscriptions"), w.Data.SubscriptionData.ToJSON())
+		return nil
+	})
+}
+
+// IGetThatSubscription sends a GET request for the
+// subscription defined in the scenario data
+func (w *World) IGetThatSubscription() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.SubscriptionData), func() error {
+		w.Client.Get(w.versionedPath(fmt.Sprintf("/subscriptions/%s", w.Data.SubscriptionData.Id)))
+		return nil
+	})
+}
+
+// IGetAllSubscriptions sends a GET request for all subscriptions
+func (w *World) IGetAllSubscriptions() error {
+	w.Client.Get(w.versionedPath("/subscriptions"))
+	return nil
+}
+
+// IUpdateThatSubscription sends a PUT request with the
+// subscription defined in the scenario data
+func (w *World) IUpdateThatSubscription() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.SubscriptionData), func() error {
+		path := fmt.Sprintf("/subscriptions/%s", w.Data.SubscriptionData.Id)
+		w.Client.Put(w.versionedPath(path), w.Data.SubscriptionData.ToJSON())
+		return nil
+	})
+}
+
+// IUpdateThatSubscriptionWithoutItsSecret sends a PUT request with the
+// subscription defined in the scenario data, leaving its secret out
+func (w *World) IUpdateThatSubscriptionWithoutItsSecret() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.SubscriptionData), func() error {
+		data := *w.Data.SubscriptionData
+		data.Secret = ""
+		w.Client.Put(w.versionedPath(fmt.Sprintf("/subscriptions/%s", data.Id)), data.ToJSON())
+		return nil
+	})
+}
+
+// ICreatedASubscriptionForEvents combines logic from previous steps in order
+// to provide a convenience Given step for subscription fixtures
+func (w *World) ICreatedASubscriptionForEvents(id string, eventTypes string) error {
+	return DoThen(w.ASubscriptionForEvents(id, eventTypes), func() error {
+		return DoThen(w.ICreateThatSubscription(), func() error {
+			return w.IShouldHaveStatusCode(201)
+		})
+	})
+}
+
+// IGetTheDeliveriesOfThatSubscription sends a GET request for the delivery
+// attempt log of the subscription defined in the scenario data
+func (w *World) IGetTheDeliveriesOfThatSubscription() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.SubscriptionData), func() error {
+		path := fmt.Sprintf("/subscriptions/%s/deliveries", w.Data.SubscriptionData.Id)
+		w.Client.Get(w.versionedPath(path))
+		return nil
+	})
+}
+
+// IGetTheDeadLettersOfThatSubscription sends a GET request for the dead
+// letter list of the subscription defined in the scenario data
+func (w *World) IGetTheDeadLettersOfThatSubscription() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.SubscriptionData), func() error {
+		path := fmt.Sprintf("/subscriptions/%s/dead-letters", w.Data.SubscriptionData.Id)
+		w.Client.Get(w.versionedPath(path))
+		return nil
+	})
+}
+
+// TheReceiverShouldGetEvents waits for the scenario's webhook receiver
+// to get the expected number of requests. Every request should carry
+// the given event type and a valid signature
+func (w *World) TheReceiverShouldGetEvents(expected int, eventType string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.Receiver), func() error {
+		return DoEventually(func() error {
+			received := w.Data.Receiver.Received()
+			return ExpectThen(ShouldEqual(len(received), expected), func() error {
+				for _, r := range received {
+					if msg := ShouldEqual(r.Header.Get(subscriptions.EventTypeHeader), eventType); msg != "" {
+						return Expect(msg)
+					}
+
+					signature := subscriptions.Sign(w.Data.SubscriptionData.Secret, r.Body)
+					if msg := ShouldEqual(r.Header.Get(subscriptions.SignatureHeader), signature); msg != "" {
+						return Expect(msg)
+					}
+				}
+				return nil
+			})
+		}, 20, 250*time.Millisecond)
+	})
+}
+
+// ThatSubscriptionShouldHaveDeadLetters waits for the dead letter list of
+// the subscription defined in the scenario data to have the expected
+// number of items
+func (w *World) ThatSubscriptionShouldHaveDeadLetters(expected int) error {
+	return DoEventually(func() error {
+		return DoThen(w.IGetTheDeadLettersOfThatSubscription(), func() error {
+			return DoThen(w.IShouldHaveStatusCode(200), func() error {
+				return DoThen(w.IShouldHaveAJson(), func() error {
+					return w.ThatJsonShouldHaveItems(expected)
+				})
+			})
+		})
+	}, 20, 250*time.Millisecond)
+}
+
+// ThatSubscriptionHasNoCallback removes the callback uri from the
+// subscription defined in the scenario data
+func (w *World) ThatSubscriptionHasNoCallback() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.SubscriptionData), func() error {
+		w.Data.SubscriptionData.CallbackUri = ""
+		return nil
+	})
+}
+
+// ThatSubscriptionHasOrganisation changes the organisation of the
+// subscription defined in the scenario data
+func (w *World) ThatSubscriptionHasOrganisation(organisation string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.SubscriptionData), func() error {
+		w.Data.SubscriptionData.Organisation = organisation
+		return nil
+	})
+}
+
+// ThatSubscriptionHasSecret changes the secret of the
+// subscription defined in the scenario data
+func (w *World) ThatSubscriptionHasSecret(secret string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.SubscriptionData), func() error {
+		w.Data.SubscriptionData.Secret = secret
+		return nil
+	})
+}
+
+// ThatSubscriptionHasVersion changes the version of the
+// subscription defined in the scenario data
+func (w *World) ThatSubscriptionHasVersion(version int) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.SubscriptionData), func() error {
+		w.Data.SubscriptionData.Version = version
+		return nil
+	})
+}
@@ -0,0 +1,19 @@
+package test
+
+import (
+	"fmt"
+)
+
+// IGetAll sends a GET request for all the items of the
+// given resource, eg. accounts or mandates
+func (w *World) IGetAll(resource string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/%s", resource)))
+	return nil
+}
+
+// IGetAllOfOrganisation sends a GET request for the items of
+// the given resource that belong to the given organisation
+func (w *World) IGetAllOfOrganisation(resource string, organisation string) error {
+	w.Client.Get(w.versionedPath(fmt.Sprintf("/%s?organisation_id=%s", resource, organisation)))
+	return nil
+}
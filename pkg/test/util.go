@@ -1,8 +1,11 @@
 package test
 
 import (
+	"crypto"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // expectThen is a convenience function that helps to chain
@@ -51,21 +54,80 @@ func DoSequence(step func(it int) error, count int) error {
 	return nil
 }
 
+// DoEventually retries the given step until it succeeds, or
+// the given number of attempts, separated by the given delay, is
+// exhausted. This is useful for asynchronous behaviours, such as
+// webhook deliveries
+func DoEventually(step func() error, attempts int, delay time.Duration) error {
+	err := step()
+	for i := 1; i < attempts && err != nil; i++ {
+		time.Sleep(delay)
+		err = step()
+	}
+	return err
+}
+
 // PaymentData is a simplified representation of
 // a payment, to be used in BDDs. Most of fields will be set
 // by default, but here we declare the ones that are
 // really significant in our tests
 type PaymentData struct {
-	Id           string
-	Version      int
-	Organisation string
-	Amount       string
+	Id                  string
+	Version             int
+	Organisation        string
+	Amount              string
+	Currency            string
+	Scheme              string
+	ProcessingDate      string
+	Account             string
+	Mandate             string
+	DebtorAccountNumber string
+	Quote               string
+	Reference           string
+	BeneficiaryName     string
+	BeneficiaryAddress  string
+	BeneficiaryCountry  string
+	Beneficiary         string
 }
 
 // ToJSON returns a json string from the payment data
 // Most values that are not critical for our tests
 // will be set to arbitrary defaults
 func (p *PaymentData) ToJSON() string {
+	// Optional attributes, only sent when set
+	optional := ""
+	if p.Mandate != "" {
+		optional = fmt.Sprintf(`,
+				"mandate_id": "%s",
+				"debtor_party": {
+					"account_number": "%s",
+					"bank_id": "400300"
+				}`, p.Mandate, p.DebtorAccountNumber)
+	}
+
+	if p.BeneficiaryName != "" || p.BeneficiaryCountry != "" {
+		optional = fmt.Sprintf(`%s,
+				"beneficiary_party": {
+					"name": "%s",
+					"address": "%s",
+					"country": "%s",
+					"account_number": "87654321",
+					"bank_id": "400300"
+				}`, optional, p.BeneficiaryName, p.BeneficiaryAddress, p.BeneficiaryCountry)
+	}
+
+	if p.Beneficiary != "" {
+		optional = fmt.Sprintf(`%s,
+				"beneficiary_id": "%s"`, optional, p.Beneficiary)
+	}
+
+	if p.Quote != "" {
+		optional = fmt.Sprintf(`%s,
+				"fx": {
+					"quote_id": "%s"
+				}`, optional, p.Quote)
+	}
+
 	return fmt.Sprintf(`{ 
 		"data": {
 			"id": "%s",
@@ -73,10 +135,133 @@ func (p *PaymentData) ToJSON() string {
 			"version": %v,
 			"organisation_id": "%s",
 			"attributes": {
-				"amount": "%s"
+				"amount": "%s",
+				"currency": "%s",
+				"scheme": "%s",
+				"reference": "%s",
+				"processing_date": "%s",
+				"debtor_account_id": "%s"%s
+			}
+		}
+	}`, p.Id, p.Version, p.Organisation, p.Amount, p.Currency, p.Scheme, p.Reference, p.ProcessingDate, p.Account, optional)
+}
+
+// AccountData is a simplified representation of
+// a bank account, to be used in BDDs
+type AccountData struct {
+	Id             string
+	Version        int
+	Organisation   string
+	Currency       string
+	OpeningBalance string
+}
+
+// ToJSON returns a json string from the account data
+func (a *AccountData) ToJSON() string {
+	return fmt.Sprintf(`{
+		"data": {
+			"id": "%s",
+			"type": "Account",
+			"version": %v,
+			"organisation_id": "%s",
+			"attributes": {
+				"account_number": "12345678",
+				"bank_id": "400300",
+				"bank_id_code": "GBDSC",
+				"currency": "%s",
+				"opening_balance": "%s"
 			}
 		}
-	}`, p.Id, p.Version, p.Organisation, p.Amount)
+	}`, a.Id, a.Version, a.Organisation, a.Currency, a.OpeningBalance)
+}
+
+// OrganisationData is a simplified representation of
+// an organisation, to be used in BDDs
+type OrganisationData struct {
+	Id                   string
+	Version              int
+	Status               string
+	DefaultScheme        string
+	AllowedCurrencies    string
+	DailyLimit           string
+	MonthlyLimit         string
+	DailyCountLimit      int
+	MonthlyCountLimit    int
+	MaxPaymentAmount     string
+	ProcessingDatePolicy string
+	DuplicatePolicy      string
+	PayeeCheckPolicy     string
+	ApprovalThreshold    string
+}
+
+// ToJSON returns a json string from the organisation data. Allowed
+// currencies are given as a comma separated list
+func (o *OrganisationData) ToJSON() string {
+	currencies := []string{}
+	for _, c := range strings.Split(o.AllowedCurrencies, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			currencies = append(currencies, fmt.Sprintf(`"%s"`, c))
+		}
+	}
+
+	return fmt.Sprintf(`{
+		"data": {
+			"id": "%s",
+			"type": "Organisation",
+			"version": %v,
+			"attributes": {
+				"name": "Organisation %s",
+				"status": "%s",
+				"settings": {
+					"default_scheme": "%s",
+					"allowed_currencies": [%s],
+					"daily_limit": "%s",
+					"monthly_limit": "%s",
+					"daily_count_limit": %v,
+					"monthly_count_limit": %v,
+					"max_payment_amount": "%s",
+					"processing_date_policy": "%s",
+					"duplicate_policy": "%s",
+					"payee_check_policy": "%s",
+					"approval_threshold": "%s"
+				}
+			}
+		}
+	}`, o.Id, o.Version, o.Id, o.Status, o.DefaultScheme, strings.Join(currencies, ","), o.DailyLimit, o.MonthlyLimit, o.DailyCountLimit, o.MonthlyCountLimit, o.MaxPaymentAmount, o.ProcessingDatePolicy, o.DuplicatePolicy, o.PayeeCheckPolicy, o.ApprovalThreshold)
+}
+
+// SubscriptionData is a simplified representation of
+// a webhook subscription, to be used in BDDs
+type SubscriptionData struct {
+	Id           string
+	Version      int
+	Organisation string
+	CallbackUri  string
+	EventTypes   string
+	Secret       string
+}
+
+// ToJSON returns a json string from the subscription data. Event
+// types are given as a comma separated list
+func (s *SubscriptionData) ToJSON() string {
+	types := []string{}
+	for _, t := range strings.Split(s.EventTypes, ",") {
+		types = append(types, fmt.Sprintf(`"%s"`, strings.TrimSpace(t)))
+	}
+
+	return fmt.Sprintf(`{
+		"data": {
+			"id": "%s",
+			"type": "Subscription",
+			"version": %v,
+			"organisation_id": "%s",
+			"attributes": {
+				"callback_uri": "%s",
+				"event_types": [%s],
+				"secret": "%s"
+			}
+		}
+	}`, s.Id, s.Version, s.Organisation, s.CallbackUri, strings.Join(types, ","), s.Secret)
 }
 
 // a ScenarioData struct is data for a particular scenario
@@ -86,6 +271,43 @@ type ScenarioData struct {
 	// Holds a simplified representation of a Payment
 	PaymentData *PaymentData
 
+	// Holds a simplified representation of an Organisation
+	OrganisationData *OrganisationData
+
+	// Holds a simplified representation of an Account
+	AccountData *AccountData
+
+	// Holds a simplified representation of a webhook Subscription
+	SubscriptionData *SubscriptionData
+
+	// A stand-in webhook receiver
+	Receiver *Receiver
+
+	// A point in time, remembered by a previous step
+	Time time.Time
+
+	// The api keys created by previous steps, by id, and
+	// the keys they had before they were last rotated
+	ApiKeys         map[string]string
+	PreviousApiKeys map[string]string
+
+	// The private keys of the signing keys registered
+	// by previous steps, by id
+	SigningKeys map[string]crypto.Signer
+
+	// The key admin requests are made with, and the last
+	// confirmation token requested by a previous step
+	AdminKey     string
+	Confirmation string
+
+	// The status codes of the requests a previous
+	// step sent at once
+	StatusCodes []int
+
+	// How far into the events file a previous step
+	// started following it
+	EventsOffset int64
+
 	// Generic datastructure where steps might store data
 	// and read from it
 	Subject interface{}
@@ -95,22 +317,35 @@ type ScenarioData struct {
 type World struct {
 	serverUrl  string
 	apiVersion string
+	eventsFile string
 	Client     *Client
 	Data       *ScenarioData
 }
 
 // Return a new World container for the given server
-// url and api version.
-func NewWorld(serverUrl string, apiVersion string) *World {
+// url and api version. Payment events are expected to be
+// published to the given file
+func NewWorld(serverUrl string, apiVersion string, eventsFile string) *World {
 	return &World{
 		serverUrl:  serverUrl,
 		apiVersion: apiVersion,
+		eventsFile: eventsFile,
 	}
 }
 
-// NewData creates a new, blank scenario data structure
+// NewData creates a new, blank scenario data structure. Resources
+// held by the previous scenario are released
 func (w *World) NewData() {
-	w.Data = &ScenarioData{}
+	if w.Data != nil && w.Data.Receiver != nil {
+		w.Data.Receiver.Close()
+	}
+
+	w.Data = &ScenarioData{
+		ApiKeys:         map[string]string{},
+		PreviousApiKeys: map[string]string{},
+		SigningKeys:     map[string]crypto.Signer{},
+		AdminKey:        adminKey,
+	}
 	w.Client = NewClient(w.serverUrl)
 }
 
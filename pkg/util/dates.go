@@ -0,0 +1,31 @@
+// util provides with simple utility types and functions so that
+// our main application package is less cluttered
+package util
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+// DateLayout is the layout of the calendar dates we
+// accept and render (eg. processing dates)
+const DateLayout = "2006-01-02"
+
+// ParseDate parses a calendar date (eg. 2019-04-01), in UTC
+func ParseDate(date string) (time.Time, error) {
+	t, err := time.Parse(DateLayout, date)
+	if err != nil {
+		return t, errors.Wrap(err, "Invalid date")
+	}
+	return t, nil
+}
+
+// FormatDate renders the calendar date of the given time
+func FormatDate(t time.Time) string {
+	return t.UTC().Format(DateLayout)
+}
+
+// Today returns the current calendar date, in UTC
+func Today() string {
+	return FormatDate(time.Now())
+}
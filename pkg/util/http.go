@@ -6,8 +6,13 @@ import (
 	"github.com/pedro-gutierrez/form3/pkg/logger"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
+// UserHeader is the header clients use to tell which
+// of their users a request is made on behalf of
+const UserHeader = "X-User-Id"
+
 // HttpService is a simple base type for Http services
 // Provides with some convenience functions that can be
 // reused by more concrete implementations
@@ -21,6 +26,9 @@ func (s *HttpService) UrlFor(path string) string {
 	return fmt.Sprintf("%s%s", s.BaseUrl, path)
 }
 
+// A simple type to add restful links to our responses
+type Links map[string]string
+
 // EmptyResponse represents an empty JSON response
 type EmptyResponse struct{}
 
@@ -52,6 +60,12 @@ func RenderNoContent(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// UserFromRequest returns the user the given request is
+// made on behalf of, if any
+func UserFromRequest(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get(UserHeader))
+}
+
 // IntFromString tries to parse the given string, as an int.
 // In case of error, the default int value is returned instead
 func IntFromStringOrDefault(actual string, defaultValue int) int {
@@ -0,0 +1,25 @@
+// util provides with simple utility types and functions so that
+// our main application package is less cluttered
+package util
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// NewId returns a new random identifier, formatted
+// as a version 4 uuid
+func NewId() string {
+	b := make([]byte, 16)
+
+	// crypto/rand only fails if the operating system
+	// cannot provide with randomness, in which case there
+	// is nothing sensible we can do
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,121 @@
+// util provides with simple utility types and functions so that
+// our main application package is less cluttered
+package util
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// LedgerExternal is the ledger account that stands for money held
+// outside of our accounts (eg. at other banks). Money paid out of our
+// accounts is credited to it, and opening balances are debited from
+// it, so its balance is allowed to go below zero
+const LedgerExternal = "external"
+
+// LedgerTransfer moves an amount of money from one ledger account
+// to another. It is recorded as two ledger entries, that always add up
+// to zero (double entry)
+type LedgerTransfer struct {
+	// Unique id of the transfer. Posting the same transfer
+	// twice fails with a conflict
+	Id string
+
+	// The accounts to debit and credit
+	Debit  string
+	Credit string
+
+	// The amount to transfer, in minor units (eg. cents)
+	Amount int64
+
+	// The id of the resource that caused the transfer
+	// (eg. a payment), and a human readable description
+	Reference   string
+	Description string
+}
+
+// LedgerEntry is one side of a transfer, as seen from a
+// ledger account. Debits have negative amounts
+type LedgerEntry struct {
+	Id          string `db:"id"`
+	Transfer    string `db:"transfer"`
+	Account     string `db:"account"`
+	Amount      int64  `db:"amount"`
+	Reference   string `db:"reference"`
+	Description string `db:"description"`
+	Created     int64  `db:"created"`
+}
+
+// Ledger is a double entry ledger, that keeps track of the
+// balance of accounts
+type Ledger interface {
+	// Prepare the ledger, before it is used
+	Init() error
+
+	// Post the given transfer. Accounts other than LedgerExternal
+	// cannot be debited more than their balance
+	Transfer(t *LedgerTransfer) error
+
+	// Return the current balance of the given account, in minor units
+	Balance(account string) (int64, error)
+
+	// Return a finite list of entries of the given account, oldest first
+	Entries(account string, offset int, limit int) ([]*LedgerEntry, error)
+
+	// Hard delete all entries and balances. Use with care
+	DeleteAll() error
+
+	// Returns true if the transfer was rejected because the
+	// debited account did not have enough funds
+	IsInsufficientFunds(err error) bool
+
+	// Returns true if the transfer was already posted
+	IsConflict(err error) bool
+}
+
+// NewLedger returns a new ledger that shares the database of the
+// given repo, and stores its entries and balances in the
+// <schema>_entries and <schema>_balances tables
+func NewLedger(repo Repo, schema string) (Ledger, error) {
+	provider, ok := repo.(interface{ sqlRepo() *SqlRepo })
+	if !ok {
+		return nil, fmt.Errorf("ledger not supported by repo: %s", repo.Description())
+	}
+
+	return &SqlLedger{db: provider.sqlRepo().db, schema: schema}, nil
+}
+
+// amountPattern is the only form amounts are accepted in: digits,
+// and then at most two decimal places. No signs, exponents or spaces
+var amountPattern = regexp.MustCompile(`^(\d+)(?:\.(\d{1,2}))?$`)
+
+// ParseAmount converts the given decimal amount (eg. "10.50")
+// into minor units (eg. 1050). Amounts are expected to have
+// at most two decimal places, and fit in minor units
+func ParseAmount(amount string) (int64, error) {
+	m := amountPattern.FindStringSubmatch(amount)
+	if m == nil {
+		return 0, fmt.Errorf("Invalid amount: %s", amount)
+	}
+
+	units, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil || units > (math.MaxInt64-99)/100 {
+		return 0, fmt.Errorf("Amount too large: %s", amount)
+	}
+
+	cents, _ := strconv.ParseInt((m[2] + "00")[:2], 10, 64)
+	return units*100 + cents, nil
+}
+
+// FormatAmount converts the given amount in minor units (eg. -1050)
+// into a decimal amount (eg. "-10.50")
+func FormatAmount(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
@@ -0,0 +1,201 @@
+package util
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+var (
+	addEntryStmtTemplate       string
+	entriesStmtTemplate        string
+	addBalanceStmtTemplate     string
+	balanceStmtTemplate        string
+	debitStmtTemplate          string
+	debitFundedStmtTemplate    string
+	creditStmtTemplate         string
+	deleteEntriesStmtTemplate  string
+	deleteBalancesStmtTemplate string
+)
+
+func init() {
+	addEntryStmtTemplate = "INSERT INTO %s_entries (id, transfer, account, amount, reference, description, created) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	entriesStmtTemplate = "SELECT id, transfer, account, amount, reference, description, created FROM %s_entries WHERE account = $1 ORDER BY created, id LIMIT $2 OFFSET $3"
+	addBalanceStmtTemplate = "INSERT INTO %s_balances (account, balance) VALUES ($1, 0) ON CONFLICT (account) DO NOTHING"
+	balanceStmtTemplate = "SELECT balance FROM %s_balances WHERE account = $1"
+	debitStmtTemplate = "UPDATE %s_balances SET balance = balance - $1 WHERE account = $2"
+	debitFundedStmtTemplate = "UPDATE %s_balances SET balance = balance - $1 WHERE account = $2 AND balance >= $1"
+	creditStmtTemplate = "UPDATE %s_balances SET balance = balance + $1 WHERE account = $2"
+	deleteEntriesStmtTemplate = "DELETE FROM %s_entries"
+	deleteBalancesStmtTemplate = "DELETE FROM %s_balances"
+}
+
+// SqlLedger is a ledger stored in a sql database. Every transfer
+// writes its two entries, and updates the running balance of both
+// accounts, in a single transaction.
+//
+// Overdrafts are prevented by a conditional update on the balance of
+// the debited account, so that concurrent transfers cannot both spend
+// the same funds
+type SqlLedger struct {
+	db     *sql.DB
+	schema string
+
+	addEntryStmt       string
+	entriesStmt        string
+	addBalanceStmt     string
+	balanceStmt        string
+	debitStmt          string
+	debitFundedStmt    string
+	creditStmt         string
+	deleteEntriesStmt  string
+	deleteBalancesStmt string
+}
+
+// Init initializes all sql statements with the proper database tables
+func (l *SqlLedger) Init() error {
+	if l.schema == "" {
+		return fmt.Errorf("no schema defined")
+	}
+
+	l.addEntryStmt = fmt.Sprintf(addEntryStmtTemplate, l.schema)
+	l.entriesStmt = fmt.Sprintf(entriesStmtTemplate, l.schema)
+	l.addBalanceStmt = fmt.Sprintf(addBalanceStmtTemplate, l.schema)
+	l.balanceStmt = fmt.Sprintf(balanceStmtTemplate, l.schema)
+	l.debitStmt = fmt.Sprintf(debitStmtTemplate, l.schema)
+	l.debitFundedStmt = fmt.Sprintf(debitFundedStmtTemplate, l.schema)
+	l.creditStmt = fmt.Sprintf(creditStmtTemplate, l.schema)
+	l.deleteEntriesStmt = fmt.Sprintf(deleteEntriesStmtTemplate, l.schema)
+	l.deleteBalancesStmt = fmt.Sprintf(deleteBalancesStmtTemplate, l.schema)
+	return nil
+}
+
+// Transfer posts the given transfer. Returns INSUFFICIENT_FUNDS if
+// the debited account does not have enough funds, and DB_CONFLICT if
+// the transfer was already posted
+func (l *SqlLedger) Transfer(t *LedgerTransfer) error {
+	if t.Amount <= 0 {
+		return fmt.Errorf("DB_ERROR: invalid transfer amount: %v", t.Amount)
+	}
+
+	if t.Debit == t.Credit {
+		return fmt.Errorf("DB_ERROR: cannot transfer to the same account: %s", t.Debit)
+	}
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "DB_ERROR")
+	}
+
+	// This is a no-op once the transaction is commited
+	defer tx.Rollback()
+
+	now := time.Now().UnixNano()
+	for _, e := range []*LedgerEntry{
+		{Account: t.Debit, Amount: -t.Amount},
+		{Account: t.Credit, Amount: t.Amount},
+	} {
+		_, err := tx.Exec(l.addEntryStmt, NewId(), t.Id, e.Account, e.Amount, t.Reference, t.Description, now)
+		if err != nil {
+			errorCode := "DB_ERROR"
+			if strings.Contains(strings.ToLower(err.Error()), "unique constraint") {
+				errorCode = "DB_CONFLICT"
+			}
+			return errors.Wrap(err, errorCode)
+		}
+
+		if _, err := tx.Exec(l.addBalanceStmt, e.Account); err != nil {
+			return errors.Wrap(err, "DB_ERROR")
+		}
+	}
+
+	// Only the external account can go below zero
+	debitStmt := l.debitFundedStmt
+	if t.Debit == LedgerExternal {
+		debitStmt = l.debitStmt
+	}
+
+	res, err := tx.Exec(debitStmt, t.Amount, t.Debit)
+	if err != nil {
+		return errors.Wrap(err, "DB_ERROR")
+	}
+
+	if err := expectOneRow(res, "INSUFFICIENT_FUNDS"); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(l.creditStmt, t.Amount, t.Credit); err != nil {
+		return errors.Wrap(err, "DB_ERROR")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "DB_ERROR")
+	}
+
+	return nil
+}
+
+// Balance returns the current balance of the given account. Accounts
+// with no entries have a zero balance
+func (l *SqlLedger) Balance(account string) (int64, error) {
+	var balance int64
+	err := l.db.QueryRow(l.balanceStmt, account).Scan(&balance)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, errors.Wrap(err, l.balanceStmt)
+	}
+
+	return balance, nil
+}
+
+// Entries returns a list of entries of the given account,
+// oldest first
+func (l *SqlLedger) Entries(account string, offset int, limit int) ([]*LedgerEntry, error) {
+	entries := []*LedgerEntry{}
+
+	rows, err := l.db.Query(l.entriesStmt, account, limit, offset)
+	if err != nil {
+		return entries, errors.Wrap(err, l.entriesStmt)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &LedgerEntry{}
+		err := rows.Scan(&e.Id, &e.Transfer, &e.Account, &e.Amount, &e.Reference, &e.Description, &e.Created)
+		if err != nil {
+			return entries, errors.Wrap(err, "Error parsing database row")
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// DeleteAll hard deletes all entries and balances. This operation
+// cannot be recovered, so use with care
+func (l *SqlLedger) DeleteAll() error {
+	for _, stmt := range []string{l.deleteEntriesStmt, l.deleteBalancesStmt} {
+		if _, err := l.db.Exec(stmt); err != nil {
+			return errors.Wrap(err, "DB_ERROR")
+		}
+	}
+	return nil
+}
+
+// IsInsufficientFunds returns true if the given error was caused
+// by a debit over the balance of the account
+func (l *SqlLedger) IsInsufficientFunds(err error) bool {
+	return strings.Contains(err.Error(), "INSUFFICIENT_FUNDS")
+}
+
+// IsConflict returns true if the given error was caused
+// by a transfer that was already posted
+func (l *SqlLedger) IsConflict(err error) bool {
+	return strings.Contains(err.Error(), "DB_CONFLICT")
+}
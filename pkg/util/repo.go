@@ -4,6 +4,7 @@ package util
 
 import (
 	"fmt"
+	"time"
 )
 
 // RepoItem represents a generic repo item record
@@ -12,7 +13,33 @@ type RepoItem struct {
 	Id           string `db:"id"`
 	Version      int    `db:"version"`
 	Organisation string `db:"organisation"`
+	Parent       string `db:"parent"`
 	Attributes   string `db:"attributes"`
+
+	// Messages to be written to the outbox
+	// along with the item
+	Outbox []*OutboxMessage `db:"-"`
+}
+
+// OutboxMessage is a message written to the outbox, in the same
+// transaction as the change to the repo item it relates to. It is up to
+// a relay to read messages from the outbox and deliver them
+type OutboxMessage struct {
+	Id      string `db:"id"`
+	Type    string `db:"type"`
+	Created int64  `db:"created"`
+	Payload string `db:"payload"`
+}
+
+// RepoFilter narrows down the items returned by a repo. Empty
+// fields are ignored, so that a zero value filter matches every item
+type RepoFilter struct {
+	// Only return items owned by this organisation
+	Organisation string
+
+	// Only return items that belong to this parent item
+	// (eg. the deliveries of a subscription)
+	Parent string
 }
 
 // Basic repository live information
@@ -28,6 +55,17 @@ type RepoConfig struct {
 	Uri        string
 	Migrations string
 	Schema     string
+	Outbox     string
+
+	// Record every version of the items, so that
+	// they can be read as they were at any point in time
+	Versioned bool
+
+	// Store items as an append-only log of events, instead
+	// of just their current state. A snapshot of the item
+	// is taken every SnapshotEvery events
+	EventSourced  bool
+	SnapshotEvery int
 }
 
 // Repo is a small abstraction of a database
@@ -55,11 +93,17 @@ type Repo interface {
 	// Return a finite list of db items
 	List(offset int, limit int) ([]*RepoItem, error)
 
-	// Create a new database item
+	// Return a finite list of db items matching
+	// the given filter
+	Find(filter RepoFilter, offset int, limit int) ([]*RepoItem, error)
+
+	// Create a new database item. Outbox messages
+	// are saved atomically with the item
 	Create(item *RepoItem) (*RepoItem, error)
 
 	// Update an existing database item
-	// and return the new version
+	// and return the new version. Outbox messages
+	// are saved atomically with the item
 	Update(item *RepoItem) (*RepoItem, error)
 
 	// Get all the information for the given
@@ -69,12 +113,28 @@ type Repo interface {
 	// identification data (id, version,etc..)
 	Fetch(item *RepoItem) (*RepoItem, error)
 
-	// Delete a single repo item
+	// Get the version of the given item that was
+	// valid at the given time
+	FetchAt(item *RepoItem, at time.Time) (*RepoItem, error)
+
+	// Return a finite list of db items matching
+	// the given filter, as they were at the given time
+	FindAt(filter RepoFilter, offset int, limit int, at time.Time) ([]*RepoItem, error)
+
+	// Delete a single repo item. Outbox messages
+	// are saved atomically with the deletion
 	Delete(item *RepoItem) error
 
 	// Delete all items from this repo
 	DeleteAll() error
 
+	// Return the oldest messages from the outbox
+	Outbox(limit int) ([]*OutboxMessage, error)
+
+	// Remove a message from the outbox, once
+	// it has been delivered
+	AckOutbox(m *OutboxMessage) error
+
 	// Defines an abstract way of determining
 	// whether the given error represents a database
 	// conflict
@@ -91,12 +151,19 @@ type Repo interface {
 // closing the repo when it is no longer needed.
 func NewRepo(config RepoConfig) (Repo, error) {
 	var db Repo
+	var err error
 	switch config.Driver {
 	case "sqlite3":
-		return NewSqlite3Repo(config)
+		db, err = NewSqlite3Repo(config)
 	case "postgres":
-		return NewPostgresRepo(config)
+		db, err = NewPostgresRepo(config)
 	default:
 		return db, fmt.Errorf("repo driver not supported: %v", config.Driver)
 	}
+
+	if err != nil || !config.EventSourced {
+		return db, err
+	}
+
+	return NewEventRepo(db, config)
 }
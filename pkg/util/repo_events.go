@@ -0,0 +1,339 @@
+// util provides with simple utility types and functions so that
+// our main application package is less cluttered
+package util
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// The types of events stored by an event sourced repo
+const (
+	ItemCreated           = "Created"
+	ItemAttributesChanged = "AttributesChanged"
+	ItemDeleted           = "Deleted"
+)
+
+var (
+	appendEventStmtTemplate    string
+	eventsStmtTemplate         string
+	addSnapshotStmtTemplate    string
+	snapshotStmtTemplate       string
+	deleteEventsStmtTemplate   string
+	deleteSnapshotStmtTemplate string
+	listEventsAtStmtTemplate   string
+)
+
+func init() {
+	appendEventStmtTemplate = "INSERT INTO %s_events (item_id, version, type, organisation, parent, attributes, created) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	eventsStmtTemplate = "SELECT version, type, organisation, parent, attributes FROM %s_events WHERE item_id = $1 AND version > $2 AND created <= $3 ORDER BY version"
+	addSnapshotStmtTemplate = "INSERT INTO %s_snapshots (item_id, version, organisation, parent, attributes, created) VALUES ($1, $2, $3, $4, $5, $6)"
+	snapshotStmtTemplate = "SELECT version, organisation, parent, attributes FROM %s_snapshots WHERE item_id = $1 AND created <= $2 ORDER BY version DESC LIMIT 1"
+	deleteEventsStmtTemplate = "DELETE FROM %s_events"
+	deleteSnapshotStmtTemplate = "DELETE FROM %s_snapshots"
+	listEventsAtStmtTemplate = "SELECT item_id, version, organisation, parent, attributes FROM %[1]s_events e WHERE type <> 'Deleted' AND version = (SELECT MAX(version) FROM %[1]s_events WHERE item_id = e.item_id AND created <= $1) AND (organisation = $2 OR $2 = '') AND (parent = $3 OR $3 = '') ORDER BY item_id LIMIT $4 OFFSET $5"
+}
+
+// EventRepo stores items as an append-only log of events
+// (Created, AttributesChanged, Deleted), in a <schema>_events table. The
+// current state of an item is rebuilt from its events on Fetch, starting
+// from its latest snapshot, if any.
+//
+// The regular <schema> table is kept as a projection of the current state
+// of all items, updated in the same transaction as the events, so that
+// List, Find and Info work as in any other sql repo
+type EventRepo struct {
+	Repo
+	sql           *SqlRepo
+	snapshotEvery int
+
+	appendEventStmt    string
+	eventsStmt         string
+	addSnapshotStmt    string
+	snapshotStmt       string
+	deleteEventsStmt   string
+	deleteSnapshotStmt string
+	listEventsAtStmt   string
+}
+
+// NewEventRepo wraps the given sql repo into an event
+// sourced repo
+func NewEventRepo(repo Repo, config RepoConfig) (Repo, error) {
+	provider, ok := repo.(interface{ sqlRepo() *SqlRepo })
+	if !ok {
+		return repo, fmt.Errorf("event sourcing not supported by repo: %s", repo.Description())
+	}
+
+	// The event log already records every version
+	// of every item
+	sqlRepo := provider.sqlRepo()
+	sqlRepo.versioned = false
+
+	return &EventRepo{
+		Repo:          repo,
+		sql:           sqlRepo,
+		snapshotEvery: config.SnapshotEvery,
+	}, nil
+}
+
+// Init initializes the wrapped repo, and all sql
+// statements related to events and snapshots
+func (repo *EventRepo) Init() error {
+	if err := repo.Repo.Init(); err != nil {
+		return err
+	}
+
+	repo.appendEventStmt = repo.sql.fmtTemplate(appendEventStmtTemplate)
+	repo.eventsStmt = repo.sql.fmtTemplate(eventsStmtTemplate)
+	repo.addSnapshotStmt = repo.sql.fmtTemplate(addSnapshotStmtTemplate)
+	repo.snapshotStmt = repo.sql.fmtTemplate(snapshotStmtTemplate)
+	repo.deleteEventsStmt = repo.sql.fmtTemplate(deleteEventsStmtTemplate)
+	repo.deleteSnapshotStmt = repo.sql.fmtTemplate(deleteSnapshotStmtTemplate)
+	repo.listEventsAtStmt = repo.sql.fmtTemplate(listEventsAtStmtTemplate)
+	return nil
+}
+
+// Description returns this database storage type
+func (repo *EventRepo) Description() string {
+	return fmt.Sprintf("%s, event sourced", repo.Repo.Description())
+}
+
+// Create appends a Created event, and adds the item to
+// the projection
+func (repo *EventRepo) Create(item *RepoItem) (*RepoItem, error) {
+	tx, err := repo.sql.db.Begin()
+	if err != nil {
+		return item, errors.Wrap(err, "DB_ERROR")
+	}
+
+	// This is a no-op once the transaction is commited
+	defer tx.Rollback()
+
+	_, err = tx.Exec(repo.sql.createStmt, item.Id, 0, item.Organisation, item.Parent, item.Attributes)
+	if err != nil {
+		errorCode := "DB_ERROR"
+		if strings.Contains(strings.ToLower(err.Error()), "unique constraint") {
+			errorCode = "DB_CONFLICT"
+		}
+		return item, errors.Wrap(err, errorCode)
+	}
+
+	item.Version = 0
+	if err := repo.append(tx, ItemCreated, item); err != nil {
+		return item, err
+	}
+
+	return item, repo.sql.commit(tx, item)
+}
+
+// Update appends an AttributesChanged event, and updates
+// the projection. Optimistic locking is done on the projection, as
+// in any other sql repo
+func (repo *EventRepo) Update(item *RepoItem) (*RepoItem, error) {
+	tx, err := repo.sql.db.Begin()
+	if err != nil {
+		return item, errors.Wrap(err, "DB_ERROR")
+	}
+
+	// This is a no-op once the transaction is commited
+	defer tx.Rollback()
+
+	newVersion := item.Version + 1
+	res, err := tx.Exec(repo.sql.updateStmt, item.Attributes, newVersion, item.Id, item.Version)
+	if err != nil {
+		return item, errors.Wrap(err, "DB_ERROR")
+	}
+
+	if err := expectOneRow(res, "DB_CONFLICT"); err != nil {
+		return item, err
+	}
+
+	changed := *item
+	changed.Version = newVersion
+	if err := repo.append(tx, ItemAttributesChanged, &changed); err != nil {
+		return item, err
+	}
+
+	if err := repo.sql.commit(tx, item); err != nil {
+		return item, err
+	}
+
+	item.Version = newVersion
+	return item, nil
+}
+
+// Delete appends a Deleted event, and marks the item as
+// deleted in the projection
+func (repo *EventRepo) Delete(item *RepoItem) error {
+	tx, err := repo.sql.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "DB_ERROR")
+	}
+
+	// This is a no-op once the transaction is commited
+	defer tx.Rollback()
+
+	res, err := tx.Exec(repo.sql.deleteOneStmt, item.Id, item.Version)
+	if err != nil {
+		return errors.Wrap(err, "DB_ERROR")
+	}
+
+	if err := expectOneRow(res, "DB_NOT_FOUND"); err != nil {
+		return err
+	}
+
+	// The deletion is an event on its own, so it
+	// gets a new version in the log
+	deleted := *item
+	deleted.Version = item.Version + 1
+	if err := repo.append(tx, ItemDeleted, &deleted); err != nil {
+		return err
+	}
+
+	return repo.sql.commit(tx, item)
+}
+
+// Fetch rebuilds the current state of the item from
+// its events
+func (repo *EventRepo) Fetch(item *RepoItem) (*RepoItem, error) {
+	return repo.FetchAt(item, time.Now())
+}
+
+// FetchAt rebuilds the state of the item at the given time, from
+// its latest snapshot taken before that time, and the events that
+// followed. Returns DB_NOT_FOUND if the item did not exist at
+// that time, or was already deleted
+func (repo *EventRepo) FetchAt(item *RepoItem, at time.Time) (*RepoItem, error) {
+	found := &RepoItem{Id: item.Id, Version: -1}
+	deleted := false
+
+	err := repo.sql.db.QueryRow(repo.snapshotStmt, item.Id, at.UnixNano()).Scan(
+		&found.Version, &found.Organisation, &found.Parent, &found.Attributes)
+	if err != nil && err != sql.ErrNoRows {
+		return found, errors.Wrap(err, repo.snapshotStmt)
+	}
+
+	rows, err := repo.sql.db.Query(repo.eventsStmt, item.Id, found.Version, at.UnixNano())
+	if err != nil {
+		return found, errors.Wrap(err, repo.eventsStmt)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventType string
+		e := &RepoItem{}
+		err := rows.Scan(&e.Version, &eventType, &e.Organisation, &e.Parent, &e.Attributes)
+		if err != nil {
+			return found, errors.Wrap(err, "Error parsing database row")
+		}
+
+		switch eventType {
+		case ItemCreated:
+			found.Organisation = e.Organisation
+			found.Parent = e.Parent
+			found.Attributes = e.Attributes
+			found.Version = e.Version
+			deleted = false
+		case ItemAttributesChanged:
+			found.Attributes = e.Attributes
+			found.Version = e.Version
+		case ItemDeleted:
+			deleted = true
+		}
+	}
+
+	if found.Version < 0 || deleted {
+		return found, fmt.Errorf("DB_NOT_FOUND")
+	}
+
+	return found, nil
+}
+
+// FindAt returns a list of items matching the given filter, as they
+// were at the given time. Every Created or AttributesChanged event holds
+// the whole item, so we only need the latest event of each item before
+// that time
+func (repo *EventRepo) FindAt(filter RepoFilter, offset int, limit int, at time.Time) ([]*RepoItem, error) {
+	items := []*RepoItem{}
+
+	rows, err := repo.sql.db.Query(repo.listEventsAtStmt, at.UnixNano(), filter.Organisation, filter.Parent, limit, offset)
+	if err != nil {
+		return items, errors.Wrap(err, repo.listEventsAtStmt)
+	}
+
+	defer rows.Close()
+
+	return scanItems(rows)
+}
+
+// DeleteAll hard deletes all events, snapshots and the
+// projection. This operation cannot be recovered, so use with care
+func (repo *EventRepo) DeleteAll() error {
+	for _, stmt := range []string{repo.deleteEventsStmt, repo.deleteSnapshotStmt} {
+		if _, err := repo.sql.db.Exec(stmt); err != nil {
+			return errors.Wrap(err, "DB_ERROR")
+		}
+	}
+	return repo.Repo.DeleteAll()
+}
+
+// append adds a new event to the log of the given item. Items
+// are snapshotted every few events, so that rebuilding their state
+// does not require reading their whole history
+func (repo *EventRepo) append(tx *sql.Tx, eventType string, item *RepoItem) error {
+	now := time.Now().UnixNano()
+
+	// Updates do not always carry the organisation and the parent
+	// so we read them from the projection, so that every event holds
+	// the whole item
+	if eventType == ItemAttributesChanged {
+		current := &RepoItem{}
+		err := tx.QueryRow(repo.sql.fetchStmt, item.Id).Scan(&current.Id, &current.Version, &current.Organisation, &current.Parent, &current.Attributes)
+		if err != nil {
+			return errors.Wrap(err, repo.sql.fetchStmt)
+		}
+		item.Organisation = current.Organisation
+		item.Parent = current.Parent
+	}
+
+	_, err := tx.Exec(repo.appendEventStmt, item.Id, item.Version, eventType, item.Organisation, item.Parent, item.Attributes, now)
+	if err != nil {
+		errorCode := "DB_ERROR"
+		if strings.Contains(strings.ToLower(err.Error()), "unique constraint") {
+			errorCode = "DB_CONFLICT"
+		}
+		return errors.Wrap(err, errorCode)
+	}
+
+	if eventType == ItemDeleted || repo.snapshotEvery <= 0 || item.Version == 0 || item.Version%repo.snapshotEvery != 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(repo.addSnapshotStmt, item.Id, item.Version, item.Organisation, item.Parent, item.Attributes, now)
+	if err != nil {
+		return errors.Wrap(err, "DB_ERROR")
+	}
+	return nil
+}
+
+// expectOneRow translates the number of rows affected by
+// a statement into the given error code if no rows were affected
+func expectOneRow(res sql.Result, errorCode string) error {
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "DB_ERROR")
+	}
+
+	switch rowsAffected {
+	case 0:
+		return errors.New(errorCode)
+	case 1:
+		return nil
+	default:
+		return fmt.Errorf("DB_ERROR: more than 1 row affected: %v", rowsAffected)
+	}
+}
@@ -28,7 +28,9 @@ func NewPostgresRepo(config RepoConfig) (Repo, error) {
 	// configuration
 	repo := &PosgresRepo{
 		SqlRepo: SqlRepo{
-			schema: config.Schema,
+			schema:    config.Schema,
+			outbox:    config.Outbox,
+			versioned: config.Versioned,
 		},
 		uri: config.Uri,
 	}
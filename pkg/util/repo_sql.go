@@ -9,40 +9,71 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
 	"strings"
+	"time"
 )
 
 var (
-	countStmtTemplate     string
-	deleteAllStmtTemplate string
-	listStmtTemplate      string
-	fetchStmtTemplate     string
-	createStmtTemplate    string
-	updateStmtTemplate    string
-	deleteOneStmtTemplate string
+	countStmtTemplate      string
+	deleteAllStmtTemplate  string
+	listStmtTemplate       string
+	findStmtTemplate       string
+	fetchStmtTemplate      string
+	createStmtTemplate     string
+	updateStmtTemplate     string
+	deleteOneStmtTemplate  string
+	outboxAddStmtTemplate  string
+	outboxStmtTemplate     string
+	outboxAckStmtTemplate  string
+	addVersionStmtTemplate string
+	fetchAtStmtTemplate    string
+	listAtStmtTemplate     string
+	deleteVersionsTemplate string
 )
 
 func init() {
 	countStmtTemplate = "SELECT COUNT(*) FROM %s WHERE deleted = 0"
 	deleteAllStmtTemplate = "DELETE FROM %s"
-	listStmtTemplate = "SELECT id, version, organisation, attributes FROM %s  WHERE deleted = 0 LIMIT $1 OFFSET $2"
-	fetchStmtTemplate = "SELECT id, version, organisation, attributes FROM %s WHERE id = $1 AND deleted = 0"
-	createStmtTemplate = "INSERT INTO %s (id, version, organisation, attributes) VALUES ($1, $2, $3, $4)"
+	listStmtTemplate = "SELECT id, version, organisation, parent, attributes FROM %s  WHERE deleted = 0 ORDER BY id LIMIT $1 OFFSET $2"
+	findStmtTemplate = "SELECT id, version, organisation, parent, attributes FROM %s WHERE deleted = 0 AND (organisation = $1 OR $1 = '') AND (parent = $2 OR $2 = '') ORDER BY id LIMIT $3 OFFSET $4"
+	fetchStmtTemplate = "SELECT id, version, organisation, parent, attributes FROM %s WHERE id = $1 AND deleted = 0"
+	createStmtTemplate = "INSERT INTO %s (id, version, organisation, parent, attributes) VALUES ($1, $2, $3, $4, $5)"
 	updateStmtTemplate = "UPDATE %s SET attributes=$1, version=$2 WHERE id=$3 AND version=$4"
 	deleteOneStmtTemplate = "UPDATE %s SET deleted=1 WHERE id=$1 AND version=$2"
+	outboxAddStmtTemplate = "INSERT INTO %s (id, type, created, payload) VALUES ($1, $2, $3, $4)"
+	outboxStmtTemplate = "SELECT id, type, created, payload FROM %s ORDER BY created, id LIMIT $1"
+	outboxAckStmtTemplate = "DELETE FROM %s WHERE id=$1"
+	addVersionStmtTemplate = "INSERT INTO %[1]s_versions (id, version, organisation, parent, attributes, deleted, valid_from) SELECT id, version, organisation, parent, attributes, deleted, $1 FROM %[1]s WHERE id = $2"
+	fetchAtStmtTemplate = "SELECT id, version, organisation, parent, attributes, deleted FROM %s_versions WHERE id = $1 AND valid_from <= $2 ORDER BY valid_from DESC LIMIT 1"
+	listAtStmtTemplate = "SELECT id, version, organisation, parent, attributes FROM %[1]s_versions v WHERE deleted = 0 AND valid_from = (SELECT MAX(valid_from) FROM %[1]s_versions WHERE id = v.id AND valid_from <= $1) AND (organisation = $2 OR $2 = '') AND (parent = $3 OR $3 = '') ORDER BY id LIMIT $4 OFFSET $5"
+	deleteVersionsTemplate = "DELETE FROM %s_versions"
 }
 
 // A Generic SQL rep. Defines the schema it operates on (a database table)
-// and the set of sql statement it executes
+// and the set of sql statement it executes. Outbox messages are written to
+// the outbox table, if any. Versioned repos also record every version of
+// their items, along with the time it became valid, in the <schema>_versions
+// table
 type SqlRepo struct {
-	db            *sql.DB
-	schema        string
-	countStmt     string
-	deleteAllStmt string
-	listStmt      string
-	fetchStmt     string
-	createStmt    string
-	updateStmt    string
-	deleteOneStmt string
+	db                 *sql.DB
+	schema             string
+	outbox             string
+	versioned          bool
+	countStmt          string
+	deleteAllStmt      string
+	listStmt           string
+	findStmt           string
+	fetchStmt          string
+	createStmt         string
+	updateStmt         string
+	deleteOneStmt      string
+	outboxAddStmt      string
+	outboxStmt         string
+	outboxAckStmt      string
+	outboxClearStmt    string
+	addVersionStmt     string
+	fetchAtStmt        string
+	listAtStmt         string
+	deleteVersionsStmt string
 }
 
 // fmtTemplate formats the given template and returns a statement sql
@@ -60,13 +91,31 @@ func (repo *SqlRepo) Init() error {
 	repo.countStmt = repo.fmtTemplate(countStmtTemplate)
 	repo.deleteAllStmt = repo.fmtTemplate(deleteAllStmtTemplate)
 	repo.listStmt = repo.fmtTemplate(listStmtTemplate)
+	repo.findStmt = repo.fmtTemplate(findStmtTemplate)
 	repo.fetchStmt = repo.fmtTemplate(fetchStmtTemplate)
 	repo.createStmt = repo.fmtTemplate(createStmtTemplate)
 	repo.updateStmt = repo.fmtTemplate(updateStmtTemplate)
 	repo.deleteOneStmt = repo.fmtTemplate(deleteOneStmtTemplate)
+	repo.addVersionStmt = repo.fmtTemplate(addVersionStmtTemplate)
+	repo.fetchAtStmt = repo.fmtTemplate(fetchAtStmtTemplate)
+	repo.listAtStmt = repo.fmtTemplate(listAtStmtTemplate)
+	repo.deleteVersionsStmt = repo.fmtTemplate(deleteVersionsTemplate)
+
+	if repo.outbox != "" {
+		repo.outboxAddStmt = fmt.Sprintf(outboxAddStmtTemplate, repo.outbox)
+		repo.outboxStmt = fmt.Sprintf(outboxStmtTemplate, repo.outbox)
+		repo.outboxAckStmt = fmt.Sprintf(outboxAckStmtTemplate, repo.outbox)
+		repo.outboxClearStmt = fmt.Sprintf(deleteAllStmtTemplate, repo.outbox)
+	}
 	return nil
 }
 
+// sqlRepo gives access to the generic sql repo embedded
+// in vendor specific repos
+func (repo *SqlRepo) sqlRepo() *SqlRepo {
+	return repo
+}
+
 // Close the database
 func (repo *SqlRepo) Close() error {
 	return repo.db.Close()
@@ -89,9 +138,31 @@ func (repo *SqlRepo) List(offset int, limit int) ([]*RepoItem, error) {
 
 	defer rows.Close()
 
+	return scanItems(rows)
+}
+
+// Find returns a list of db items matching the given
+// filter. Items marked as deleted are ignored too
+func (repo *SqlRepo) Find(filter RepoFilter, offset int, limit int) ([]*RepoItem, error) {
+	items := []*RepoItem{}
+
+	rows, err := repo.db.Query(repo.findStmt, filter.Organisation, filter.Parent, limit, offset)
+	if err != nil {
+		return items, errors.Wrap(err, repo.findStmt)
+	}
+
+	defer rows.Close()
+
+	return scanItems(rows)
+}
+
+// scanItems reads all repo items from the given
+// database rows
+func scanItems(rows *sql.Rows) ([]*RepoItem, error) {
+	items := []*RepoItem{}
 	for rows.Next() {
 		item := &RepoItem{}
-		err := rows.Scan(&item.Id, &item.Version, &item.Organisation, &item.Attributes)
+		err := rows.Scan(&item.Id, &item.Version, &item.Organisation, &item.Parent, &item.Attributes)
 		if err != nil {
 			return items, errors.Wrap(err, "Error parsing database row")
 		}
@@ -114,7 +185,7 @@ func (repo *SqlRepo) Fetch(item *RepoItem) (*RepoItem, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		err := rows.Scan(&found.Id, &found.Version, &found.Organisation, &found.Attributes)
+		err := rows.Scan(&found.Id, &found.Version, &found.Organisation, &found.Parent, &found.Attributes)
 		if err != nil {
 			return found, errors.Wrap(err, "Error parsing database row")
 		}
@@ -128,9 +199,18 @@ func (repo *SqlRepo) Fetch(item *RepoItem) (*RepoItem, error) {
 	return found, fmt.Errorf("DB_NOT_FOUND")
 }
 
-// Create a new item in the database
+// Create a new item in the database, along with its outbox
+// messages, in a single transaction
 func (repo *SqlRepo) Create(item *RepoItem) (*RepoItem, error) {
-	stmt, err := repo.db.Prepare(repo.createStmt)
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return item, errors.Wrap(err, "DB_ERROR")
+	}
+
+	// This is a no-op once the transaction is commited
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(repo.createStmt)
 	if err != nil {
 		return item, errors.Wrap(err, repo.createStmt)
 	}
@@ -139,7 +219,7 @@ func (repo *SqlRepo) Create(item *RepoItem) (*RepoItem, error) {
 
 	// We ignore the version number from the repo item
 	// and we set it to 0
-	_, err = stmt.Exec(item.Id, 0, item.Organisation, item.Attributes)
+	_, err = stmt.Exec(item.Id, 0, item.Organisation, item.Parent, item.Attributes)
 	if err != nil {
 		// inspect the underlying database error
 		// and translate it into something higher level
@@ -152,6 +232,10 @@ func (repo *SqlRepo) Create(item *RepoItem) (*RepoItem, error) {
 		return item, errors.Wrap(err, errorCode)
 	}
 
+	if err := repo.commit(tx, item); err != nil {
+		return item, err
+	}
+
 	// This is a new item, we force its version to be 1
 	item.Version = 0
 
@@ -160,10 +244,19 @@ func (repo *SqlRepo) Create(item *RepoItem) (*RepoItem, error) {
 	return item, nil
 }
 
-// Update an existing item in the database. Returns the updated
+// Update an existing item in the database, along with its outbox
+// messages, in a single transaction. Returns the updated
 // db item, or an error
 func (repo *SqlRepo) Update(item *RepoItem) (*RepoItem, error) {
-	stmt, err := repo.db.Prepare(repo.updateStmt)
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return item, errors.Wrap(err, "DB_ERROR")
+	}
+
+	// This is a no-op once the transaction is commited
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(repo.updateStmt)
 	if err != nil {
 		return item, errors.Wrap(err, repo.updateStmt)
 	}
@@ -197,6 +290,9 @@ func (repo *SqlRepo) Update(item *RepoItem) (*RepoItem, error) {
 	case 0:
 		return item, errors.New("DB_CONFLICT")
 	case 1:
+		if err := repo.commit(tx, item); err != nil {
+			return item, err
+		}
 		item.Version = newVersion
 		return item, nil
 	default:
@@ -208,9 +304,18 @@ func (repo *SqlRepo) Update(item *RepoItem) (*RepoItem, error) {
 
 // Delete deletes the item from the repo. In this implementation,
 // We simply mark the item as deleted. This is to make sure
-// it's id is not reused by future payments
+// it's id is not reused by future payments. Outbox messages
+// are written in the same transaction
 func (repo *SqlRepo) Delete(item *RepoItem) error {
-	stmt, err := repo.db.Prepare(repo.deleteOneStmt)
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "DB_ERROR")
+	}
+
+	// This is a no-op once the transaction is commited
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(repo.deleteOneStmt)
 	if err != nil {
 		return errors.Wrap(err, repo.deleteOneStmt)
 	}
@@ -243,7 +348,7 @@ func (repo *SqlRepo) Delete(item *RepoItem) error {
 		return errors.New("DB_NOT_FOUND")
 	case 1:
 		// Everything went fine
-		return nil
+		return repo.commit(tx, item)
 	default:
 		// This should not happen, as we should be hitting
 		// the primary key, still  we treat the case
@@ -283,6 +388,23 @@ func (repo *SqlRepo) DeleteAll() error {
 		return errors.Wrap(err, errorCode)
 	}
 
+	// Versions are gone too
+	if repo.versioned {
+		_, err = repo.db.Exec(repo.deleteVersionsStmt)
+		if err != nil {
+			return errors.Wrap(err, "DB_ERROR")
+		}
+	}
+
+	// And so are the events about them that
+	// were not published yet
+	if repo.outbox != "" {
+		_, err = repo.db.Exec(repo.outboxClearStmt)
+		if err != nil {
+			return errors.Wrap(err, "DB_ERROR")
+		}
+	}
+
 	return nil
 }
 
@@ -308,3 +430,118 @@ func (repo *SqlRepo) Info() (RepoInfo, error) {
 
 	return RepoInfo{Count: count}, nil
 }
+
+// commit records the new version of the given item, if the repo
+// is versioned, writes its outbox messages, and commits the transaction
+func (repo *SqlRepo) commit(tx *sql.Tx, item *RepoItem) error {
+	if repo.versioned {
+		_, err := tx.Exec(repo.addVersionStmt, time.Now().UnixNano(), item.Id)
+		if err != nil {
+			return errors.Wrap(err, "DB_ERROR")
+		}
+	}
+
+	if len(item.Outbox) > 0 {
+		if repo.outbox == "" {
+			return fmt.Errorf("DB_ERROR: no outbox defined for %s", repo.schema)
+		}
+
+		stmt, err := tx.Prepare(repo.outboxAddStmt)
+		if err != nil {
+			return errors.Wrap(err, repo.outboxAddStmt)
+		}
+
+		defer stmt.Close()
+
+		for _, m := range item.Outbox {
+			_, err := stmt.Exec(m.Id, m.Type, m.Created, m.Payload)
+			if err != nil {
+				return errors.Wrap(err, "DB_ERROR")
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "DB_ERROR")
+	}
+
+	return nil
+}
+
+// Outbox returns the oldest messages from the outbox, in
+// the order they were written
+func (repo *SqlRepo) Outbox(limit int) ([]*OutboxMessage, error) {
+	messages := []*OutboxMessage{}
+	if repo.outbox == "" {
+		return messages, nil
+	}
+
+	rows, err := repo.db.Query(repo.outboxStmt, limit)
+	if err != nil {
+		return messages, errors.Wrap(err, repo.outboxStmt)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		m := &OutboxMessage{}
+		err := rows.Scan(&m.Id, &m.Type, &m.Created, &m.Payload)
+		if err != nil {
+			return messages, errors.Wrap(err, "Error parsing database row")
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, nil
+}
+
+// AckOutbox removes the given message from the outbox
+func (repo *SqlRepo) AckOutbox(m *OutboxMessage) error {
+	_, err := repo.db.Exec(repo.outboxAckStmt, m.Id)
+	if err != nil {
+		return errors.Wrap(err, "DB_ERROR")
+	}
+	return nil
+}
+
+// FetchAt returns the version of the item that was valid at
+// the given time. Returns an error if not found, or if the item was
+// already deleted at that time
+func (repo *SqlRepo) FetchAt(item *RepoItem, at time.Time) (*RepoItem, error) {
+	found := &RepoItem{}
+	if !repo.versioned {
+		return found, fmt.Errorf("DB_ERROR: %s is not versioned", repo.schema)
+	}
+
+	var deleted int
+	err := repo.db.QueryRow(repo.fetchAtStmt, item.Id, at.UnixNano()).Scan(
+		&found.Id, &found.Version, &found.Organisation, &found.Parent, &found.Attributes, &deleted)
+	if err == sql.ErrNoRows || deleted != 0 {
+		return found, fmt.Errorf("DB_NOT_FOUND")
+	}
+
+	if err != nil {
+		return found, errors.Wrap(err, repo.fetchAtStmt)
+	}
+
+	return found, nil
+}
+
+// FindAt returns a list of items matching the given filter, as they
+// were at the given time. Items that did not exist yet, or were already
+// deleted at that time, are ignored
+func (repo *SqlRepo) FindAt(filter RepoFilter, offset int, limit int, at time.Time) ([]*RepoItem, error) {
+	items := []*RepoItem{}
+	if !repo.versioned {
+		return items, fmt.Errorf("DB_ERROR: %s is not versioned", repo.schema)
+	}
+
+	rows, err := repo.db.Query(repo.listAtStmt, at.UnixNano(), filter.Organisation, filter.Parent, limit, offset)
+	if err != nil {
+		return items, errors.Wrap(err, repo.listAtStmt)
+	}
+
+	defer rows.Close()
+
+	return scanItems(rows)
+}
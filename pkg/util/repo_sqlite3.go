@@ -34,7 +34,9 @@ func NewSqlite3Repo(config RepoConfig) (Repo, error) {
 	// configuration
 	repo := &Sqlite3Repo{
 		SqlRepo: SqlRepo{
-			schema: config.Schema,
+			schema:    config.Schema,
+			outbox:    config.Outbox,
+			versioned: config.Versioned,
 		},
 		backend: backend,
 	}
@@ -46,6 +48,12 @@ func NewSqlite3Repo(config RepoConfig) (Repo, error) {
 		return repo, errors.Wrap(err, "Unable to connect to the database")
 	}
 
+	// Sqlite3 locks whole tables, and we now write
+	// to several tables in a single transaction (eg. the outbox). Use a
+	// single connection, so that concurrent writers queue up instead of
+	// failing with locking errors
+	database.SetMaxOpenConns(1)
+
 	// maybe migrate the database
 	if config.Migrations != "" {
 		driver, err := sqlite3.WithInstance(database, &sqlite3.Config{})
@@ -0,0 +1,3 @@
+ALTER TABLE payments DROP COLUMN parent;
+DROP TABLE IF EXISTS deliveries;
+DROP TABLE IF EXISTS subscriptions;
@@ -0,0 +1,17 @@
+ALTER TABLE payments ADD COLUMN parent VARCHAR(255) NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS subscriptions(
+    id VARCHAR(255) PRIMARY KEY NOT NULL,
+    version INT NOT NULL DEFAULT 0,
+    organisation VARCHAR(255) NOT NULL,
+    parent VARCHAR(255) NOT NULL DEFAULT '',
+    deleted INT DEFAULT 0,
+    attributes TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS deliveries(
+    id VARCHAR(255) PRIMARY KEY NOT NULL,
+    version INT NOT NULL DEFAULT 0,
+    organisation VARCHAR(255) NOT NULL,
+    parent VARCHAR(255) NOT NULL DEFAULT '',
+    deleted INT DEFAULT 0,
+    attributes TEXT NOT NULL
+);
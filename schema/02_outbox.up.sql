@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS outbox(
+    id VARCHAR(255) PRIMARY KEY NOT NULL,
+    type VARCHAR(255) NOT NULL,
+    created BIGINT NOT NULL,
+    payload TEXT NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS payments_snapshots;
+DROP TABLE IF EXISTS payments_events;
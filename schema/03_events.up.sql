@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS payments_events(
+    item_id VARCHAR(255) NOT NULL,
+    version INT NOT NULL,
+    type VARCHAR(255) NOT NULL,
+    organisation VARCHAR(255) NOT NULL,
+    parent VARCHAR(255) NOT NULL DEFAULT '',
+    attributes TEXT NOT NULL,
+    created BIGINT NOT NULL,
+    PRIMARY KEY (item_id, version)
+);
+CREATE TABLE IF NOT EXISTS payments_snapshots(
+    item_id VARCHAR(255) NOT NULL,
+    version INT NOT NULL,
+    organisation VARCHAR(255) NOT NULL,
+    parent VARCHAR(255) NOT NULL DEFAULT '',
+    attributes TEXT NOT NULL,
+    created BIGINT NOT NULL,
+    PRIMARY KEY (item_id, version)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS payments_versions(
+    id VARCHAR(255) NOT NULL,
+    version INT NOT NULL,
+    organisation VARCHAR(255) NOT NULL,
+    parent VARCHAR(255) NOT NULL DEFAULT '',
+    deleted INT DEFAULT 0,
+    attributes TEXT NOT NULL,
+    valid_from BIGINT NOT NULL,
+    PRIMARY KEY (id, valid_from)
+);
+INSERT INTO payments_versions (id, version, organisation, parent, deleted, attributes, valid_from)
+    SELECT id, version, organisation, parent, deleted, attributes, 0 FROM payments;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS organisations(
+    id VARCHAR(255) PRIMARY KEY NOT NULL,
+    version INT NOT NULL DEFAULT 0,
+    organisation VARCHAR(255) NOT NULL,
+    parent VARCHAR(255) NOT NULL DEFAULT '',
+    deleted INT DEFAULT 0,
+    attributes TEXT NOT NULL
+);
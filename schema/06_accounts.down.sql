@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS ledger_balances;
+DROP INDEX IF EXISTS ledger_entries_account;
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS accounts;
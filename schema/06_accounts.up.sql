@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS accounts(
+    id VARCHAR(255) PRIMARY KEY NOT NULL,
+    version INT NOT NULL DEFAULT 0,
+    organisation VARCHAR(255) NOT NULL,
+    parent VARCHAR(255) NOT NULL DEFAULT '',
+    deleted INT DEFAULT 0,
+    attributes TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS ledger_entries(
+    id VARCHAR(255) PRIMARY KEY NOT NULL,
+    transfer VARCHAR(255) NOT NULL,
+    account VARCHAR(255) NOT NULL,
+    amount BIGINT NOT NULL,
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created BIGINT NOT NULL,
+    UNIQUE (transfer, account)
+);
+CREATE INDEX IF NOT EXISTS ledger_entries_account ON ledger_entries (account, created);
+CREATE TABLE IF NOT EXISTS ledger_balances(
+    account VARCHAR(255) PRIMARY KEY NOT NULL,
+    balance BIGINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS reversals;
+DROP TABLE IF EXISTS returns;
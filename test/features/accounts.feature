@@ -0,0 +1,87 @@
+Feature: Accounts and balances
+  In order to know how much money organisations have
+  As a product owner
+  I need payments to be debited from organisation accounts
+
+  Scenario: Create an account
+    Given an account with id acc and opening balance 100.00
+    When I create that account
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.balance equal to 100.00
+
+  Scenario: Account for an unknown organisation
+    Given an organisation with id acme
+    And an account with id acc and opening balance 100.00
+    And that account belongs to that organisation
+    When I create that account
+    Then I should have status code 400
+
+  Scenario: Submit a payment
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 60.00
+    And that payment is debited from that account
+    And I create that payment
+    When I submit that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to submitted
+    And that account should have balance 40.00
+
+  Scenario: Insufficient funds
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 100.01
+    And that payment is debited from that account
+    And I create that payment
+    When I submit that payment
+    Then I should have status code 422
+    And that account should have balance 100.00
+
+  Scenario: Payment without debtor account
+    Given I created a new payment with id abc
+    When I submit that payment
+    Then I should have status code 400
+
+  Scenario: Unknown debtor account
+    Given a payment with id abc
+    And an account with id acc and opening balance 100.00
+    And that payment is debited from that account
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Payment already submitted
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 10.00
+    And that payment is debited from that account
+    And I create that payment
+    And I submitted that payment
+    When I submit that payment
+    Then I should have status code 409
+    And that account should have balance 90.00
+
+  Scenario: Submitted payments cannot be changed
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 10.00
+    And that payment is debited from that account
+    And I create that payment
+    And I submitted that payment
+    When I update that payment
+    Then I should have status code 409
+
+  Scenario: Statement
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 10.00
+    And that payment is debited from that account
+    And I create that payment
+    And I submitted that payment
+    When I get the transactions of that account
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 2 items
+    And that json should have string at data[1].attributes.amount equal to -10.00
+    And that json should have string at data[1].attributes.payment_id equal to abc
+
+  Scenario: Accounts with funds cannot be deleted
+    Given I created an account with id acc and opening balance 100.00
+    When I delete that account
+    Then I should have status code 409
@@ -0,0 +1,50 @@
+Feature: Admin endpoints
+  In order to keep the data of our customers safe
+  As a product owner
+  I need the admin endpoints to only be used with the admin key, and deleting all data to be confirmed
+
+  Background:
+    Given I created a new payment with id abc
+
+  Scenario: Admin requests are authenticated with the admin key
+    When I get the repo info
+    Then I should have status code 200
+
+  Scenario: Admin requests without the admin key are rejected
+    Given I use no admin key
+    When I get the repo info
+    Then I should have status code 401
+
+  Scenario: Admin requests with an invalid admin key are rejected
+    Given I use an invalid admin key
+    When I get the repo info
+    Then I should have status code 401
+
+  Scenario: Api keys are no admin keys
+    Given I created an api key as admin with permissions admin
+    And I use api key admin
+    And I use no admin key
+    When I get the repo info
+    Then I should have status code 401
+
+  Scenario: Deleting all data has to be confirmed
+    When I delete all data without confirmation
+    Then I should have status code 428
+    And I should have 1 payment(s)
+
+  Scenario: Delete all data
+    Given I request a confirmation to delete all data
+    When I delete all data with that confirmation
+    Then I should have status code 204
+    And I should have 0 payment(s)
+
+  Scenario: Confirmations are only used once
+    Given I request a confirmation to delete all data
+    And I delete all data with that confirmation
+    When I delete all data with that confirmation
+    Then I should have status code 428
+
+  Scenario: Confirmations are only issued with the admin key
+    Given I use no admin key
+    When I request a confirmation to delete all data
+    Then I should have status code 401
@@ -0,0 +1,98 @@
+Feature: Api keys
+  In order to know who is calling the api, and what they can do
+  As a product owner
+  I need clients to authenticate with api keys, scoped to their organisation
+
+  Scenario: Create an api key
+    When I create an api key as ci with permissions read,write
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to active
+    And that json should have a data.attributes.key
+
+  Scenario: Invalid permissions
+    When I create an api key as ci with permissions root
+    Then I should have status code 400
+
+  Scenario: Duplicate api key
+    Given I created an api key as ci with permissions read
+    When I create an api key as ci with permissions write
+    Then I should have status code 409
+
+  Scenario: Requests are authenticated with api keys
+    Given I created an api key as ci with permissions read
+    And I use api key ci
+    When I get all payments
+    Then I should have status code 200
+
+  Scenario: Invalid api keys are rejected
+    Given I use an invalid api key
+    When I get all payments
+    Then I should have status code 401
+
+  Scenario: Read only api keys cannot make changes
+    Given I created an api key as ci with permissions read
+    And I use api key ci
+    And a payment with id abc
+    When I create that payment
+    Then I should have status code 403
+
+  Scenario: Write api keys can make changes
+    Given I created an api key as ci with permissions write
+    And I use api key ci
+    And a payment with id abc
+    When I create that payment
+    Then I should have status code 201
+
+  Scenario: Only admin api keys manage api keys
+    Given I created an api key as ci with permissions write
+    And I use api key ci
+    When I create an api key as other with permissions read
+    Then I should have status code 403
+
+  Scenario: Admin api keys manage api keys
+    Given I created an api key as admin with permissions admin
+    And I use api key admin
+    When I create an api key as ci with permissions read
+    Then I should have status code 201
+
+  Scenario: Api keys record when they were last used
+    Given I created an api key as ci with permissions read
+    And I use api key ci
+    And I get all payments
+    And I use no api key
+    When I get api key ci
+    Then I should have status code 200
+    And I should have a json
+    And that json should have a data.attributes.last_used_on
+
+  Scenario: Rotate an api key
+    Given I created an api key as ci with permissions read
+    When I rotate api key ci
+    Then I should have status code 200
+    And I should have a json
+    And that json should have a data.attributes.rotated_on
+    And that json should have a data.attributes.key
+
+  Scenario: Rotated keys stop working
+    Given I created an api key as ci with permissions read
+    And I rotate api key ci
+    And I use the previous key of api key ci
+    When I get all payments
+    Then I should have status code 401
+    And I use api key ci
+    And I get all payments
+    And I should have status code 200
+
+  Scenario: Revoked keys stop working
+    Given I created an api key as ci with permissions read
+    And I revoke api key ci
+    And I use api key ci
+    When I get all payments
+    Then I should have status code 401
+
+  Scenario: Revoked keys cannot be revoked again
+    Given I created an api key as ci with permissions read
+    And I revoke api key ci
+    When I revoke api key ci
+    Then I should have status code 409
@@ -0,0 +1,147 @@
+Feature: Payment approvals
+  In order to prevent fraud and mistakes on large payments
+  As a product owner
+  I need payments above a threshold to be approved by a second user
+
+  Background:
+    Given an organisation with id org2
+    And that organisation requires approval above 1000.00
+    And I created that organisation
+    And an account with id acc and opening balance 5000.00
+    And that account belongs to that organisation
+    And I create that account
+
+  Scenario: Payments above the threshold await approval
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And a payment with id abc for that organisation
+    And that payment has amount 1500.00
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.created_by equal to alice
+    And that json should have string at data.attributes.approval.status equal to pending
+    And that json should have string at data.attributes.approval.requested_by equal to alice
+
+  Scenario: Payments up to the threshold need no approval
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And a payment with id abc for that organisation
+    And that payment has amount 1000.00
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to created
+
+  Scenario: Payments above the threshold need an authenticated user
+    Given I act as user alice
+    And a payment with id abc for that organisation
+    And that payment has amount 1500.00
+    When I create that payment
+    Then I should have status code 403
+
+  Scenario: Payments awaiting approval cannot be submitted
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And a payment with id abc for that organisation
+    And that payment has amount 1500.00
+    And that payment is debited from that account
+    And I created that payment
+    When I submit that payment
+    Then I should have status code 409
+
+  Scenario: Creators cannot approve their own payments
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And a payment with id abc for that organisation
+    And that payment has amount 1500.00
+    And I created that payment
+    And I use a RS256 token as alice for organisation org2 with roles write
+    When I approve that payment
+    Then I should have status code 403
+
+  Scenario: Creators cannot approve their own payments by telling they are someone else
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And I act as user mallory
+    And a payment with id abc for that organisation
+    And that payment has amount 1500.00
+    And I created that payment
+    And I should have a json
+    And that json should have string at data.attributes.created_by equal to alice
+    And that json should have string at data.attributes.approval.requested_by equal to alice
+    When I approve that payment
+    Then I should have status code 403
+    And I get that payment
+    And I should have a json
+    And that json should have string at data.attributes.approval.status equal to pending
+
+  Scenario: Approvers have to authenticate as themselves
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And a payment with id abc for that organisation
+    And that payment has amount 1500.00
+    And I created that payment
+    And I use no token
+    And I act as user bob
+    When I approve that payment
+    Then I should have status code 403
+    And I get that payment
+    And I should have a json
+    And that json should have string at data.attributes.approval.status equal to pending
+
+  Scenario: Approved payments can be submitted
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And a payment with id abc for that organisation
+    And that payment has amount 1500.00
+    And that payment is debited from that account
+    And I created that payment
+    And I use a RS256 token as bob for organisation org2 with roles write
+    When I approve that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.approval.status equal to approved
+    And that json should have string at data.attributes.approval.decided_by equal to bob
+    When I submit that payment
+    Then I should have status code 201
+
+  Scenario: Rejected payments cannot be submitted
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And a payment with id abc for that organisation
+    And that payment has amount 1500.00
+    And that payment is debited from that account
+    And I created that payment
+    And I use a RS256 token as bob for organisation org2 with roles write
+    When I reject that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.status equal to rejected
+    When I submit that payment
+    Then I should have status code 409
+
+  Scenario: Approved payments changed afterwards await approval again
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And a payment with id abc for that organisation
+    And that payment has amount 1500.00
+    And that payment is debited from that account
+    And I created that payment
+    And I use a RS256 token as bob for organisation org2 with roles write
+    And I approve that payment
+    And I should have status code 200
+    And I use a RS256 token as alice for organisation org2 with roles write
+    And that payment has reference another
+    And that payment has version 1
+    When I update that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.approval.status equal to pending
+    And that json should have string at data.attributes.approval.requested_by equal to alice
+    When I submit that payment
+    Then I should have status code 409
+
+  Scenario: Payments cannot skip approval by telling another organisation
+    Given a payment with id abc for that organisation
+    And that payment has amount 500.00
+    And I created that payment
+    And that payment belongs to organisation org1
+    And that payment has amount 1500.00
+    When I update that payment
+    Then I should have status code 400
+    And I get that payment
+    And I should have a json
+    And that json should have string at data.organisation_id equal to org2
+    And that json should have string at data.attributes.amount equal to 500.00
@@ -0,0 +1,56 @@
+Feature: Bearer tokens
+  In order to let users of our platform call the api with the access tokens they already have
+  As a product owner
+  I need requests to be authenticated with bearer tokens, scoped to organisations and roles
+
+  Scenario: Requests are authenticated with RS256 tokens
+    Given I use a RS256 token as alice for organisation org1 with roles read
+    When I get all payments
+    Then I should have status code 200
+
+  Scenario: Requests are authenticated with ES256 tokens
+    Given I use an ES256 token as alice for organisation org1 with roles read
+    When I get all payments
+    Then I should have status code 200
+
+  Scenario: Payments are made on behalf of the subject of the token
+    Given I use a RS256 token as alice for organisation org1 with roles write
+    And I act as user bob
+    And a payment with id abc
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.created_by equal to alice
+
+  Scenario: Read only roles cannot make changes
+    Given I use a RS256 token as alice for organisation org1 with roles read
+    And a payment with id abc
+    When I create that payment
+    Then I should have status code 403
+
+  Scenario: Unknown roles grant nothing
+    Given I use a RS256 token as alice for organisation org1 with roles superuser
+    When I get all payments
+    Then I should have status code 403
+
+  Scenario: Tokens only manage api keys of their organisations
+    Given an organisation with id org2
+    And I created that organisation
+    And I use a RS256 token as alice for organisation org2 with roles admin
+    When I create an api key as ci with permissions read
+    Then I should have status code 403
+
+  Scenario: Expired tokens are rejected
+    Given I use an expired token as alice for organisation org1 with roles read
+    When I get all payments
+    Then I should have status code 401
+
+  Scenario: Tokens for another audience are rejected
+    Given I use a token for another audience as alice for organisation org1 with roles read
+    When I get all payments
+    Then I should have status code 401
+
+  Scenario: Tokens signed with unknown keys are rejected
+    Given I use a token signed with an unknown key as alice for organisation org1 with roles read
+    When I get all payments
+    Then I should have status code 401
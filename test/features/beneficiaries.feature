@@ -0,0 +1,109 @@
+Feature: Beneficiary address book
+  In order to not re-enter the same beneficiary details for every payment
+  As a product owner
+  I need organisations to save their beneficiaries, and payments to refer to them
+
+  Scenario: Save a beneficiary
+    When I create a beneficiary as b1 for account 12345678
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.name equal to Jane Doe
+    And that json should have string at data.organisation_id equal to org1
+
+  Scenario: Duplicate beneficiary
+    Given I created a beneficiary as b1 for account 12345678
+    When I create a beneficiary as b1 for account 87654321
+    Then I should have status code 409
+
+  Scenario: Get a beneficiary
+    Given I created a beneficiary as b1 for account 12345678
+    When I get beneficiary b1
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.account_number equal to 12345678
+
+  Scenario: Payments are made to saved beneficiaries
+    Given I created a beneficiary as b1 for account 12345678
+    And a payment with id abc
+    And that payment is made to beneficiary b1
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.beneficiary_id equal to b1
+    And that json should have string at data.attributes.beneficiary_party.name equal to Jane Doe
+    And that json should have string at data.attributes.beneficiary_party.account_number equal to 12345678
+    And that json should have string at data.attributes.beneficiary_party.country equal to GB
+
+  Scenario: Payments to unknown beneficiaries
+    Given a payment with id abc
+    And that payment is made to beneficiary b1
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Payments to beneficiaries of other organisations
+    Given I created a beneficiary as b1 for account 12345678
+    And an organisation with id org2
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is made to beneficiary b1
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Payments to new beneficiaries are flagged
+    Given I created a beneficiary as b1 for account 12345678
+    And a payment with id abc
+    And that payment is made to beneficiary b1
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have a data.attributes.new_beneficiary
+
+  Scenario: Payments to known beneficiaries are not flagged
+    Given I created a beneficiary as b1 for account 12345678
+    And a payment with id abc
+    And that payment is made to beneficiary b1
+    And I created that payment
+    And a payment with id def
+    And that payment is made to beneficiary b1
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have int at data.attributes.risk.score equal to 0
+
+  Scenario: Principals only list the beneficiaries of their organisations
+    Given I created a beneficiary as b1 for account 12345678
+    And I use a RS256 token as alice for organisation org2 with roles read
+    When I get all beneficiaries
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 0 items
+
+  Scenario: Principals cannot ask for beneficiaries of other organisations
+    Given I created a beneficiary as b1 for account 12345678
+    And I use a RS256 token as alice for organisation org2 with roles read
+    When I get beneficiaries of organisation org1
+    Then I should have status code 403
+
+  Scenario: Beneficiaries of other organisations are not found
+    Given I created a beneficiary as b1 for account 12345678
+    And I use a RS256 token as alice for organisation org2 with roles write
+    When I get beneficiary b1
+    Then I should have status code 404
+    And I update beneficiary b1 for account 87654321
+    And I should have status code 404
+    And I delete beneficiary b1
+    And I should have status code 404
+
+  Scenario: Beneficiaries cannot be saved for other organisations
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    When I create a beneficiary as b1 for account 12345678
+    Then I should have status code 400
+
+  Scenario: Principals manage the beneficiaries of their organisations
+    Given I created a beneficiary as b1 for account 12345678
+    And I use a RS256 token as alice for organisation org1 with roles write
+    When I update beneficiary b1 for account 87654321
+    Then I should have status code 200
+    And I get all beneficiaries
+    And I should have a json
+    And that json should have 1 items
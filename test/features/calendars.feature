@@ -0,0 +1,67 @@
+Feature: Business day calendars
+  In order to process payments on the right day
+  As a product owner
+  I need processing dates to skip weekends and bank holidays
+
+  Scenario: Next business day after a bank holiday
+    When I get the next business day of scheme BACS from 2026-12-25
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.date equal to 2026-12-29
+    And that json should have a links.calendar
+
+  Scenario: Bank holidays differ per scheme
+    When I get the next business day of scheme SEPA from 2026-12-25
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.date equal to 2026-12-28
+
+  Scenario: Business days are their own next business day
+    When I get the next business day of scheme BACS from 2026-12-29
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.date equal to 2026-12-29
+
+  Scenario: Weekends are skipped
+    When I get the next business day of scheme FPS from 2026-10-24
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.date equal to 2026-10-26
+
+  Scenario: Unknown scheme
+    When I get the next business day of scheme ABC from 2026-12-25
+    Then I should have status code 404
+
+  Scenario: Get a calendar
+    When I get the calendar of scheme BACS
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.country equal to GB
+
+  Scenario: Processing dates are rolled forward
+    Given a payment with id abc
+    And that payment uses scheme BACS
+    And that payment is to be processed on 2026-12-25
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.processing_date equal to 2026-12-29
+
+  Scenario: Processing dates on business days are kept
+    Given a payment with id abc
+    And that payment uses scheme BACS
+    And that payment is to be processed on 2026-12-29
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.processing_date equal to 2026-12-29
+
+  Scenario: Processing dates on non-processing days are rejected
+    Given an organisation with id org2
+    And that organisation rejects payments on non-processing days
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment uses scheme BACS
+    And that payment is to be processed on 2026-12-25
+    When I create that payment
+    Then I should have status code 400
@@ -0,0 +1,112 @@
+Feature: Duplicate payments
+  In order to avoid paying the same thing twice
+  As a product owner
+  I need payments that look like recent ones to be flagged, or rejected
+
+  Scenario: Duplicates are rejected
+    Given an organisation with id org2
+    And that organisation rejects duplicate payments
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has reference rent
+    And I created that payment
+    And a payment with id def for that organisation
+    And that payment has reference rent
+    When I create that payment
+    Then I should have status code 409
+
+  Scenario: Duplicates can be explicitly allowed
+    Given an organisation with id org2
+    And that organisation rejects duplicate payments
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has reference rent
+    And I created that payment
+    And a payment with id def for that organisation
+    And that payment has reference rent
+    When I create that payment, allowing duplicates
+    Then I should have status code 201
+    And I should have a json
+    And that json should have a links.duplicate_of
+
+  Scenario: Duplicates are flagged
+    Given an organisation with id org2
+    And that organisation warns duplicate payments
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has reference rent
+    And I created that payment
+    And a payment with id def for that organisation
+    And that payment has reference rent
+    When I create that payment
+    Then I should have status code 201
+    And I should have a warning
+    And I should have a json
+    And that json should have a links.duplicate_of
+
+  Scenario: Payments with a different reference are not duplicates
+    Given an organisation with id org2
+    And that organisation rejects duplicate payments
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has reference rent
+    And I created that payment
+    And a payment with id def for that organisation
+    And that payment has reference bills
+    When I create that payment
+    Then I should have status code 201
+    And I should have no warning
+
+  Scenario: Duplicates created at once are rejected
+    Given an organisation with id org2
+    And that organisation rejects duplicate payments
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has reference rent
+    When I create 5 copies of that payment at once
+    Then 1 of them should have status code 201
+    And 4 of them should have status code 409
+
+  Scenario: Payments that cannot be created are not duplicated
+    Given an organisation with id org2
+    And that organisation rejects duplicate payments
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And I created that payment
+    And that payment has reference rent
+    And I create that payment
+    And I should have status code 409
+    And a payment with id def for that organisation
+    And that payment has reference rent
+    When I create that payment
+    Then I should have status code 201
+    And I should have no warning
+
+  Scenario: Duplicates are not looked for by default
+    Given a payment with id abc
+    And I created that payment
+    And a payment with id def
+    When I create that payment
+    Then I should have status code 201
+    And I should have no warning
+
+  Scenario: Payments of batches are fingerprinted, but never rejected
+    Given an organisation with id org1
+    And that organisation rejects duplicate payments
+    And I update that organisation
+    And I should have status code 200
+    And I uploaded a batch as b1 of 1 payments
+    And batch b1 should be validated
+    And I approve batch b1
+    And batch b1 should be approved
+    And I uploaded a batch as b2 of 1 payments
+    And batch b2 should be validated
+    And I approve batch b2
+    And batch b2 should be approved
+    And that json should have string at data.attributes.payment_ids[0] equal to b2-2
+    And a payment with id abc
+    And that payment is made to "Jane Doe"
+    And that payment is in currency GBP
+    And that payment has reference invoice 1
+    When I create that payment
+    Then I should have status code 409
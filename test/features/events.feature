@@ -0,0 +1,47 @@
+Feature: Payment events
+  In order to let other systems know about our payments
+  As a product owner
+  I need every change to a payment to be published once it is saved, and only then
+
+  Background:
+    Given I follow the events file
+
+  Scenario: Publish created payments
+    When I created a new payment with id abc
+    Then the events file should get 1 event(s) of type payment.created for payment abc
+
+  Scenario: Publish updated payments
+    Given I created a new payment with id abc
+    When I updated that payment
+    Then the events file should get 1 event(s) of type payment.updated for payment abc
+
+  Scenario: Publish deleted payments
+    Given I created a new payment with id abc
+    When I deleted that payment
+    Then the events file should get 1 event(s) of type payment.deleted for payment abc
+
+  Scenario: Existing payments are not published again
+    Given I created a new payment with id abc
+    When I create that payment
+    Then I should have status code 409
+    And I created a new payment with id def
+    And the events file should get 1 event(s) of type payment.created for payment def
+    And the events file should get 1 event(s) of type payment.created for payment abc
+
+  Scenario: Obsolete versions are not published
+    Given I created a new payment with id abc
+    And I updated that payment
+    When I update version 0 of that payment
+    Then I should have status code 409
+    And I created a new payment with id def
+    And the events file should get 1 event(s) of type payment.created for payment def
+    And the events file should get 1 event(s) of type payment.updated for payment abc
+
+  Scenario: Payments deleted with an obsolete version are not published
+    Given I created a new payment with id abc
+    And I updated that payment
+    When I delete version 0 of that payment
+    Then I should have status code 409
+    And I created a new payment with id def
+    And the events file should get 1 event(s) of type payment.created for payment def
+    And the events file should get 0 event(s) of type payment.deleted for payment abc
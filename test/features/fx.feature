@@ -0,0 +1,55 @@
+Feature: FX quotes
+  In order to make cross-currency payments
+  As a product owner
+  I need payments to be converted at a rate locked for a while
+
+  Scenario: Quote a rate
+    When I request a fx quote as q1 to sell GBP for USD
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.exchange_rate equal to 1.265
+    And that json should have a data.attributes.contract_reference
+    And that json should have a data.attributes.expires_on
+
+  Scenario: Quote the inverse rate
+    When I request a fx quote as q1 to sell USD for GBP
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.exchange_rate equal to 0.790514
+
+  Scenario: No rate for the currency pair
+    When I request a fx quote as q1 to sell GBP for JPY
+    Then I should have status code 400
+
+  Scenario: Convert a payment
+    Given I requested a fx quote as q1 to sell GBP for USD
+    And a payment with id abc and amount 100.00
+    And that payment is in GBP converted at fx quote q1
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.fx.converted_amount equal to 126.50
+    And that json should have string at data.attributes.fx.converted_currency equal to USD
+    And that json should have string at data.attributes.fx.exchange_rate equal to 1.265
+    And that json should have a data.attributes.fx.contract_reference
+
+  Scenario: Payments must be in the currency the quote sells
+    Given I requested a fx quote as q1 to sell GBP for USD
+    And a payment with id abc and amount 100.00
+    And that payment is in EUR converted at fx quote q1
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Expired quotes cannot be used
+    Given I requested a fx quote as q1 to sell GBP for USD
+    And I wait for fx quote q1 to expire
+    And a payment with id abc and amount 100.00
+    And that payment is in GBP converted at fx quote q1
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Unknown quote
+    Given a payment with id abc and amount 100.00
+    And that payment is in GBP converted at fx quote q1
+    When I create that payment
+    Then I should have status code 400
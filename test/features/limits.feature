@@ -0,0 +1,152 @@
+Feature: Payment limits
+  In order to contain the damage of fraud and mistakes
+  As a product owner
+  I need the value and number of payments of an organisation to be limited
+
+  Scenario: Payment over the maximum amount
+    Given an organisation with id org2
+    And that organisation allows payments of up to 50.00
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has amount 50.01
+    When I create that payment
+    Then I should have status code 422
+
+  Scenario: Payments over the daily limit
+    Given an organisation with id org2
+    And that organisation has a daily limit of 100.00
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has amount 60.00
+    And I created that payment
+    And a payment with id def for that organisation
+    And that payment has amount 40.01
+    When I create that payment
+    Then I should have status code 422
+
+  Scenario: Payments up to the daily limit
+    Given an organisation with id org2
+    And that organisation has a daily limit of 100.00
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has amount 60.00
+    And I created that payment
+    And a payment with id def for that organisation
+    And that payment has amount 40.00
+    When I create that payment
+    Then I should have status code 201
+
+  Scenario: Payments over the monthly limit
+    Given an organisation with id org2
+    And that organisation has a monthly limit of 100.00
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has amount 60.00
+    And I created that payment
+    And a payment with id def for that organisation
+    And that payment has amount 60.00
+    When I create that payment
+    Then I should have status code 422
+
+  Scenario: Too many payments in a day
+    Given an organisation with id org2
+    And that organisation allows 2 payments a day
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And I created that payment
+    And a payment with id def for that organisation
+    And I created that payment
+    And a payment with id ghi for that organisation
+    When I create that payment
+    Then I should have status code 422
+
+  Scenario: Too many payments in a month
+    Given an organisation with id org2
+    And that organisation allows 1 payments a month
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And I created that payment
+    And a payment with id def for that organisation
+    When I create that payment
+    Then I should have status code 422
+
+  Scenario: Updates over the daily limit
+    Given an organisation with id org2
+    And that organisation has a daily limit of 100.00
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has amount 60.00
+    And I created that payment
+    And a payment with id def for that organisation
+    And that payment has amount 30.00
+    And I created that payment
+    And that payment has amount 40.01
+    When I update that payment
+    Then I should have status code 422
+
+  Scenario: Usage of the limits
+    Given an organisation with id org2
+    And that organisation has a daily limit of 100.00
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has amount 60.00
+    And that payment is in currency GBP
+    And I created that payment
+    When I get that organisation
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.usage.daily.amounts[0].currency equal to GBP
+    And that json should have string at data.attributes.usage.daily.amounts[0].amount equal to 60.00
+    And that json should have int at data.attributes.usage.daily.count equal to 1
+    And that json should have string at data.attributes.usage.monthly.amounts[0].amount equal to 60.00
+
+  Scenario: Limits apply to each currency
+    Given an organisation with id org2
+    And that organisation has a daily limit of 100.00
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has amount 60.00
+    And that payment is in currency GBP
+    And I created that payment
+    And a payment with id def for that organisation
+    And that payment has amount 60.00
+    And that payment is in currency USD
+    When I create that payment
+    Then I should have status code 201
+    When I get that organisation
+    Then I should have a json
+    And that json should have string at data.attributes.usage.daily.amounts[0].currency equal to GBP
+    And that json should have string at data.attributes.usage.daily.amounts[0].amount equal to 60.00
+    And that json should have string at data.attributes.usage.daily.amounts[1].currency equal to USD
+    And that json should have string at data.attributes.usage.daily.amounts[1].amount equal to 60.00
+    And that json should have int at data.attributes.usage.daily.count equal to 2
+
+  Scenario: Decreases are not given back
+    Given an organisation with id org2
+    And that organisation has a daily limit of 100.00
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has amount 60.00
+    And I created that payment
+    And that payment has amount 10.00
+    And I updated that payment
+    And a payment with id def for that organisation
+    And that payment has amount 40.01
+    When I create that payment
+    Then I should have status code 422
+
+  Scenario: Payments with an amount that overflows do not reset the usage
+    Given an organisation with id org2
+    And that organisation has a daily limit of 100.00
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has amount 60.00
+    And I created that payment
+    And a payment with id def for that organisation
+    And that payment has amount 1e30
+    And I create that payment
+    And I should have status code 400
+    And a payment with id ghi for that organisation
+    And that payment has amount 40.01
+    When I create that payment
+    Then I should have status code 422
@@ -0,0 +1,86 @@
+Feature: Direct debit mandates
+  In order to collect payments via Bacs Direct Debit
+  As a product owner
+  I need payments to be collected only against active mandates of the right payer
+
+  Scenario: New mandates are pending
+    When I create a mandate as m1 for account 12345678
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to pending
+
+  Scenario: Invalid mandate
+    When I create a mandate as m1 for account 1234
+    Then I should have status code 400
+
+  Scenario: Activate a mandate
+    Given I created a mandate as m1 for account 12345678
+    When I activate mandate m1
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.status equal to active
+
+  Scenario: Cancel a mandate
+    Given I created a mandate as m1 for account 12345678
+    And I activated mandate m1
+    When I cancel mandate m1 with reason code 1
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.status equal to cancelled
+    And that json should have string at data.attributes.reason_code equal to 1
+    And that json should have string at data.attributes.reason equal to Instruction cancelled by payer
+
+  Scenario: Cancel a mandate with an unknown reason code
+    Given I created a mandate as m1 for account 12345678
+    When I cancel mandate m1 with reason code Z
+    Then I should have status code 400
+
+  Scenario: Cancelled mandates cannot be activated
+    Given I created a mandate as m1 for account 12345678
+    And I cancel mandate m1 with reason code 6
+    When I activate mandate m1
+    Then I should have status code 409
+
+  Scenario: Unknown mandate
+    When I get mandate m1
+    Then I should have status code 404
+
+  Scenario: Collect a payment against an active mandate
+    Given I created a mandate as m1 for account 12345678
+    And I activated mandate m1
+    And a payment with id abc
+    And that payment is collected against mandate m1 from account 12345678
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.mandate_id equal to m1
+
+  Scenario: Payments cannot be collected against pending mandates
+    Given I created a mandate as m1 for account 12345678
+    And a payment with id abc
+    And that payment is collected against mandate m1 from account 12345678
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Payments cannot be collected against cancelled mandates
+    Given I created a mandate as m1 for account 12345678
+    And I activated mandate m1
+    And I cancel mandate m1 with reason code B
+    And a payment with id abc
+    And that payment is collected against mandate m1 from account 12345678
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Payments must be collected from the payer of the mandate
+    Given I created a mandate as m1 for account 12345678
+    And I activated mandate m1
+    And a payment with id abc
+    And that payment is collected against mandate m1 from account 87654321
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Payments cannot be collected against unknown mandates
+    Given a payment with id abc
+    And that payment is collected against mandate m1 from account 12345678
+    When I create that payment
+    Then I should have status code 400
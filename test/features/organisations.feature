@@ -0,0 +1,88 @@
+Feature: Organisations
+  In order to control who payments are made on behalf of
+  As a product owner
+  I need to manage organisations and their settings
+
+  Scenario: Create an organisation
+    Given an organisation with id acme
+    When I create that organisation
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to active
+
+  Scenario: Existing organisation
+    Given an organisation with id acme
+    And I created that organisation
+    When I create that organisation
+    Then I should have status code 409
+
+  Scenario: Invalid settings
+    Given an organisation with id acme
+    And that organisation has a daily limit of -1
+    When I create that organisation
+    Then I should have status code 400
+
+  Scenario: Delete an organisation
+    Given an organisation with id acme
+    And I created that organisation
+    When I delete that organisation
+    Then I should have status code 204
+
+  Scenario: Payment for an unknown organisation
+    Given an organisation with id acme
+    And a payment with id abc for that organisation
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Payment for an inactive organisation
+    Given an organisation with id acme
+    And that organisation is inactive
+    And I created that organisation
+    And a payment with id abc for that organisation
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Payment for a deleted organisation
+    Given an organisation with id acme
+    And I created that organisation
+    And I delete that organisation
+    And a payment with id abc for that organisation
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Payment in an allowed currency
+    Given an organisation with id acme
+    And that organisation only allows currencies GBP, EUR
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is in currency EUR
+    When I create that payment
+    Then I should have status code 201
+
+  Scenario: Payment in a currency not allowed
+    Given an organisation with id acme
+    And that organisation only allows currencies GBP
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is in currency USD
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Payment over the daily limit
+    Given an organisation with id acme
+    And that organisation has a daily limit of 100.00
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment has amount 100.01
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Default scheme
+    Given an organisation with id acme
+    And that organisation has default scheme FPS
+    And I created that organisation
+    And a payment with id abc for that organisation
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.scheme equal to FPS
@@ -0,0 +1,75 @@
+Feature: Confirmation of payee
+  In order to not pay the wrong person
+  As a product owner
+  I need the beneficiary names of UK payments to be checked against their registered account names
+
+  Scenario: Exact match
+    When I check payee "jane doe" for account 87654321
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.result.match equal to match
+
+  Scenario: Close match
+    When I check payee "Jane Do" for account 87654321
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.result.match equal to close_match
+    And that json should have string at data.result.account_name equal to Jane Doe
+
+  Scenario: No match
+    When I check payee "John Smith" for account 87654321
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.result.match equal to no_match
+    And that json should have string at data.result.reason equal to name_mismatch
+
+  Scenario: Unknown account
+    When I check payee "Jane Doe" for account 99999999
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.result.match equal to no_match
+    And that json should have string at data.result.reason equal to account_not_found
+
+  Scenario: Mismatches are rejected
+    Given an organisation with id org2
+    And that organisation rejects payee mismatches
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is in currency GBP
+    And that payment is made to "Jane Do"
+    When I create that payment
+    Then I should have status code 422
+
+  Scenario: Matches are let through
+    Given an organisation with id org2
+    And that organisation rejects payee mismatches
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is in currency GBP
+    And that payment is made to "Jane Doe"
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.payee_check.match equal to match
+
+  Scenario: Mismatches are flagged
+    Given an organisation with id org2
+    And that organisation warns payee mismatches
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is in currency GBP
+    And that payment is made to "Jane Do"
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.payee_check.match equal to close_match
+
+  Scenario: Only UK payments are checked
+    Given an organisation with id org2
+    And that organisation rejects payee mismatches
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is in currency EUR
+    And that payment is made to "Jane Do"
+    When I create that payment
+    Then I should have status code 201
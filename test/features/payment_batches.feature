@@ -0,0 +1,60 @@
+Feature: Payment batches
+  In order to make many payments at once
+  As a product owner
+  I need organisations to upload files of payments, and approve them as a whole
+
+  Scenario: Upload a batch
+    When I upload a batch as b1 of 3 payments
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to uploaded
+    And that json should have int at data.attributes.progress.total equal to 3
+
+  Scenario: Duplicate batch
+    Given I uploaded a batch as b1 of 3 payments
+    When I upload a batch as b1 of 2 payments
+    Then I should have status code 409
+
+  Scenario: Batches are validated in the background
+    Given I uploaded a batch as b1 of 3 payments
+    Then batch b1 should be validated
+    And that json should have int at data.attributes.payment_count equal to 3
+    And that json should have string at data.attributes.total_amount equal to 3.00
+    And that json should have int at data.attributes.error_count equal to 0
+
+  Scenario: Errors are reported along with their line
+    Given I uploaded a batch as b1 of 3 payments, the last one invalid
+    Then batch b1 should be invalid
+    And that json should have int at data.attributes.error_count equal to 1
+    And that json should have int at data.attributes.errors[0].line equal to 4
+
+  Scenario: Invalid batches cannot be approved
+    Given I uploaded a batch as b1 of 3 payments, the last one invalid
+    And batch b1 should be invalid
+    When I approve batch b1
+    Then I should have status code 409
+
+  Scenario: Approve a batch
+    Given I uploaded a batch as b1 of 3 payments
+    And batch b1 should be validated
+    When I approve batch b1
+    Then I should have status code 202
+    And batch b1 should be approved
+    And that json should have string at data.attributes.payment_ids[0] equal to b1-2
+
+  Scenario: Batches link to the payments they created
+    Given I uploaded a batch as b1 of 3 payments
+    And batch b1 should be validated
+    And I approve batch b1
+    And batch b1 should be approved
+    When I get the payments of batch b1
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 3 items
+    And that json should have string at data[0].attributes.batch_id equal to b1
+
+  Scenario: Upload a pain.001 batch
+    Given I upload a pain.001 batch as b1 of 2 payments
+    And I should have status code 201
+    Then batch b1 should be validated
+    And that json should have int at data.attributes.payment_count equal to 2
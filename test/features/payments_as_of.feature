@@ -0,0 +1,48 @@
+Feature: Point-in-time reads of payments
+  In order to audit payments
+  As a product owner
+  I need to see payments as they were at any point in time
+
+  Scenario: Payment before an update
+    Given I created a new payment with id abc
+    And I remember the current time
+    And I updated that payment
+    When I get that payment as of the remembered time
+    Then I should have status code 200
+    And I should have a json
+    And that json should have int at data.version equal to 0
+
+  Scenario: Payment not created yet
+    Given a payment with id abc
+    And I remember the current time
+    And I create that payment
+    When I get that payment as of the remembered time
+    Then I should have status code 404
+
+  Scenario: Payment deleted since
+    Given I created a new payment with id abc
+    And I remember the current time
+    And I deleted that payment
+    When I get that payment as of the remembered time
+    Then I should have status code 200
+
+  Scenario: Payment already deleted
+    Given I created a new payment with id abc
+    And I deleted that payment
+    And I remember the current time
+    When I get that payment as of the remembered time
+    Then I should have status code 404
+
+  Scenario: Collection of payments
+    Given I created a new payment with id abc
+    And I remember the current time
+    And I created a new payment with id def
+    When I get all payments as of the remembered time
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+
+  Scenario: Invalid time
+    Given I created a new payment with id abc
+    When I get that payment as of "yesterday"
+    Then I should have status code 400
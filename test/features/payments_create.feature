@@ -39,3 +39,33 @@ Feature: Create payments
     When I create that payment
     Then I should have status code 400
     And I should have 0 payment(s)
+    
+  Scenario: Payment with an amount that is not a number
+    Given a payment with id abc and amount NaN
+    When I create that payment
+    Then I should have status code 400
+    And I should have 0 payment(s)
+    
+  Scenario: Payment with an amount that is infinite
+    Given a payment with id abc and amount Inf
+    When I create that payment
+    Then I should have status code 400
+    And I should have 0 payment(s)
+    
+  Scenario: Payment with an amount in scientific notation
+    Given a payment with id abc and amount 1e30
+    When I create that payment
+    Then I should have status code 400
+    And I should have 0 payment(s)
+    
+  Scenario: Payment with an amount that does not fit in minor units
+    Given a payment with id abc and amount 92233720368547758.08
+    When I create that payment
+    Then I should have status code 400
+    And I should have 0 payment(s)
+    
+  Scenario: Payment with an amount with too many decimal places
+    Given a payment with id abc and amount 10.001
+    When I create that payment
+    Then I should have status code 400
+    And I should have 0 payment(s)
@@ -0,0 +1,65 @@
+Feature: Payment versions
+  In order to audit payments
+  As a product owner
+  I need every version of a payment to be kept, whatever the repo it is stored in, and concurrent changes not to overwrite each other
+
+  Scenario: Payment updated many times
+    Given I created a new payment with id abc
+    And I updated that payment 12 times
+    When I get that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have int at data.version equal to 12
+    And that json should have string at data.attributes.reference equal to update 12
+
+  Scenario: Payment as of a version between snapshots
+    Given I created a new payment with id abc
+    And I updated that payment 11 times
+    And I remember the current time
+    And I updated that payment 2 times
+    When I get that payment as of the remembered time
+    Then I should have status code 200
+    And I should have a json
+    And that json should have int at data.version equal to 11
+    And that json should have string at data.attributes.reference equal to update 11
+
+  Scenario: Payment as of a snapshot
+    Given I created a new payment with id abc
+    And I updated that payment 10 times
+    And I remember the current time
+    And I updated that payment
+    When I get that payment as of the remembered time
+    Then I should have status code 200
+    And I should have a json
+    And that json should have int at data.version equal to 10
+    And that json should have string at data.attributes.reference equal to update 10
+
+  Scenario: Payment deleted after many updates
+    Given I created a new payment with id abc
+    And I updated that payment 10 times
+    And I remember the current time
+    And I deleted that payment
+    When I get that payment
+    Then I should have status code 404
+    And I get that payment as of the remembered time
+    And I should have status code 200
+    And I should have a json
+    And that json should have int at data.version equal to 10
+
+  Scenario: Collection of payments updated many times
+    Given I created a new payment with id abc
+    And I updated that payment 12 times
+    When I get all payments
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have int at data[0].version equal to 12
+
+  Scenario: Concurrent updates of the same version
+    Given I created a new payment with id abc
+    When I update that payment 5 times at once
+    Then 1 of them should have status code 200
+    And 4 of them should have status code 409
+    And I get that payment
+    And I should have a json
+    And that json should have int at data.version equal to 1
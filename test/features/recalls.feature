@@ -0,0 +1,84 @@
+Feature: Payment recalls
+  In order to get back payments sent in error
+  As a product owner
+  I need to track recall requests until the receiving bank answers them
+
+  Background:
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 60.00
+    And that payment is debited from that account
+    And I create that payment
+
+  Scenario: Recall a payment that was not submitted
+    When I recall that payment as rec with reason DUPL
+    Then I should have status code 409
+
+  Scenario: Request a recall
+    Given I submitted that payment
+    When I recall that payment as rec with reason DUPL
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to requested
+    And that json should have string at data.attributes.reason equal to Duplicate payment
+    And I get that payment
+    And I should have a json
+    And that json should have a links.recalls
+
+  Scenario: Unknown recall reason code
+    Given I submitted that payment
+    When I recall that payment as rec with reason AC01
+    Then I should have status code 400
+
+  Scenario: Only one open recall at a time
+    Given I submitted that payment
+    And I recalled that payment as rec with reason DUPL
+    When I recall that payment as other with reason CUST
+    Then I should have status code 409
+
+  Scenario: Recalls cannot skip states
+    Given I submitted that payment
+    And I recalled that payment as rec with reason DUPL
+    When I move version 0 of recall rec to accepted
+    Then I should have status code 409
+
+  Scenario: Reject a recall
+    Given I submitted that payment
+    And I recalled that payment as rec with reason DUPL
+    And I move version 0 of recall rec to pending
+    When I move version 1 of recall rec to rejected with reason NOAS
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.status equal to rejected
+    And that account should have balance 40.00
+
+  Scenario: Reject a recall without reason
+    Given I submitted that payment
+    And I recalled that payment as rec with reason DUPL
+    And I move version 0 of recall rec to pending
+    When I move version 1 of recall rec to rejected
+    Then I should have status code 400
+
+  Scenario: Accept a recall
+    Given I submitted that payment
+    And I recalled that payment as rec with reason DUPL
+    And I move version 0 of recall rec to pending
+    When I move version 1 of recall rec to accepted
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.return_id equal to rec
+    And that json should have a links.return
+    And that account should have balance 100.00
+    And I get that payment
+    And I should have a json
+    And that json should have string at data.attributes.status equal to returned
+
+  Scenario: Recall again after a rejection
+    Given I submitted that payment
+    And I recalled that payment as rec with reason DUPL
+    And I move version 0 of recall rec to pending
+    And I move version 1 of recall rec to rejected with reason NOAS
+    When I recall that payment as other with reason CUST
+    Then I should have status code 201
+    And I get the recalls of that payment
+    And I should have a json
+    And that json should have 2 items
@@ -0,0 +1,103 @@
+Feature: Payment returns and reversals
+  In order to know which payments did not reach their beneficiary
+  As a product owner
+  I need to record payments returned by the receiving bank, or reversed by us
+
+  Background:
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 60.00
+    And that payment is debited from that account
+    And I create that payment
+
+  Scenario: Return a payment that was not submitted
+    When I return 10.00 of that payment with reason AC01
+    Then I should have status code 409
+
+  Scenario: Partially return a payment
+    Given I submitted that payment
+    When I return 10.00 of that payment with reason AC01
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.reason equal to Incorrect account number
+    And that account should have balance 50.00
+    And I get that payment
+    And I should have a json
+    And that json should have string at data.attributes.status equal to partially_returned
+    And that json should have string at data.attributes.returned_amount equal to 10.00
+    And that json should have a links.returns
+
+  Scenario: Fully return a payment, in two goes
+    Given I submitted that payment
+    And I returned 10.00 of that payment with reason AC01
+    And I returned 50.00 of that payment with reason AC04
+    When I get that payment
+    Then I should have a json
+    And that json should have string at data.attributes.status equal to returned
+    And that account should have balance 100.00
+    And I get the returns of that payment
+    And I should have a json
+    And that json should have 2 items
+
+  Scenario: Return more than the payment amount
+    Given I submitted that payment
+    And I returned 10.00 of that payment with reason AC01
+    When I return 50.01 of that payment with reason AC01
+    Then I should have status code 400
+    And that account should have balance 50.00
+
+  Scenario: Return a payment again, with the same return
+    Given I submitted that payment
+    And I return 10.00 of that payment as rt1 with reason AC01
+    And I should have status code 201
+    When I return 10.00 of that payment as rt1 with reason AC01
+    Then I should have status code 201
+    And that account should have balance 50.00
+    And I get that payment
+    And I should have a json
+    And that json should have string at data.attributes.returned_amount equal to 10.00
+    And that json should have string at data.attributes.return_amounts.rt1 equal to 10.00
+    And I get the returns of that payment
+    And I should have a json
+    And that json should have 1 items
+
+  Scenario: Return a payment again, with the same return and another amount
+    Given I submitted that payment
+    And I return 10.00 of that payment as rt1 with reason AC01
+    When I return 20.00 of that payment as rt1 with reason AC01
+    Then I should have status code 409
+    And that account should have balance 50.00
+
+  Scenario: Unknown return reason code
+    Given I submitted that payment
+    When I return 10.00 of that payment with reason 5
+    Then I should have status code 400
+
+  Scenario: Reverse a payment
+    Given I submitted that payment
+    When I reverse that payment with reason AM05
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.amount equal to 60.00
+    And that account should have balance 100.00
+    And I get that payment
+    And I should have a json
+    And that json should have string at data.attributes.status equal to reversed
+    And I get the reversals of that payment
+    And I should have a json
+    And that json should have 1 items
+
+  Scenario: Reverse a payment twice
+    Given I submitted that payment
+    And I reverse that payment with reason AM05
+    When I reverse that payment with reason AM05
+    Then I should have status code 409
+    And that account should have balance 100.00
+    And I get the reversals of that payment
+    And I should have a json
+    And that json should have 1 items
+
+  Scenario: Reverse a returned payment
+    Given I submitted that payment
+    And I returned 10.00 of that payment with reason AC01
+    When I reverse that payment with reason AM05
+    Then I should have status code 409
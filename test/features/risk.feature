@@ -0,0 +1,117 @@
+Feature: Fraud risk scoring
+  In order to stop fraudulent payments before they leave
+  As a product owner
+  I need payments to be scored for fraud, and high risk ones to be held
+
+  Scenario: Payments are scored when created
+    Given an organisation with id org2
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is made to "Jane Doe"
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to created
+    And that json should have int at data.attributes.risk.score equal to 20
+    And that json should have string at data.attributes.risk.rules[0] equal to new_beneficiary
+    And that json should have string at data.attributes.risk.stage equal to create
+
+  Scenario: Known beneficiaries are not new
+    Given an organisation with id org2
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is made to "Jane Doe"
+    And I created that payment
+    And a payment with id def for that organisation
+    And that payment is made to "Jane Doe"
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have int at data.attributes.risk.score equal to 0
+
+  Scenario: High risk payments are held
+    Given an organisation with id org2
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is made to a beneficiary in KP
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to held
+    And that json should have int at data.attributes.risk.score equal to 100
+    And that json should have string at data.attributes.risk.rules[1] equal to high_risk_country
+
+  Scenario: Held payments cannot be submitted
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 60.00
+    And that payment is debited from that account
+    And that payment is made to a beneficiary in KP
+    And I created that payment
+    When I submit that payment
+    Then I should have status code 409
+
+  Scenario: Released payments can be submitted
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 60.00
+    And that payment is debited from that account
+    And that payment is made to a beneficiary in KP
+    And I created that payment
+    When I release that payment on risk review
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.status equal to created
+    And that json should have string at data.attributes.risk.decision equal to released
+    When I submit that payment
+    Then I should have status code 201
+
+  Scenario: Rejected payments cannot be submitted
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 60.00
+    And that payment is debited from that account
+    And that payment is made to a beneficiary in KP
+    And I created that payment
+    When I reject that payment on risk review
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.status equal to rejected
+    When I submit that payment
+    Then I should have status code 409
+
+  Scenario: Only held payments can be reviewed
+    Given an organisation with id org2
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And I created that payment
+    When I release that payment on risk review
+    Then I should have status code 409
+
+  Scenario: Risk reviews need the admin permission
+    Given I created an api key as maker with permissions write
+    And I use api key maker
+    And a payment with id abc
+    And that payment is made to a beneficiary in KP
+    And I created that payment
+    When I release that payment on risk review
+    Then I should have status code 403
+
+  Scenario: Payments cannot be released on risk review by the api key they were created with
+    Given I created an api key as ops with permissions admin
+    And I use api key ops
+    And a payment with id abc
+    And that payment is made to a beneficiary in KP
+    And I created that payment
+    When I release that payment on risk review
+    Then I should have status code 403
+
+  Scenario: Payments are released on risk review by another admin
+    Given I created an api key as maker with permissions write
+    And I created an api key as checker with permissions admin
+    And I use api key maker
+    And a payment with id abc
+    And that payment is made to a beneficiary in KP
+    And I created that payment
+    And I use api key checker
+    When I release that payment on risk review
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.risk.reviewed_by equal to checker
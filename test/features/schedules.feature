@@ -0,0 +1,76 @@
+Feature: Scheduled and recurring payments
+  In order to pay on the right day without being there
+  As a product owner
+  I need payments to be created from schedules, once they are due
+
+  Background:
+    Given I created an account with id acc and opening balance 100.00
+
+  Scenario: Schedule a payment for today
+    When I schedule a payment as sched of amount 10.00 for today
+    Then I should have status code 201
+    And the payment of schedule sched for today should be created
+    And that json should have string at data.attributes.schedule_id equal to sched
+    And that json should have string at data.attributes.status equal to created
+    And that json should have string at data.attributes.debtor_account_id equal to acc
+    And I get schedule sched
+    And I should have a json
+    And that json should have string at data.attributes.status equal to completed
+    And that json should have a links.last_payment
+
+  Scenario: Payments with the id of a schedule are not taken as its own
+    Given a payment with the id of schedule sched for today
+    And I created that payment
+    When I schedule a payment as sched of amount 10.00 for today
+    Then I should have status code 201
+    And schedule sched should fail
+    And that json should have string at data.attributes.status equal to active
+    And schedule sched should be due in 0 days
+
+  Scenario: Schedule a payment for tomorrow
+    When I schedule a payment as sched of amount 10.00 for tomorrow
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to active
+    And the payment of schedule sched for tomorrow should not be created
+
+  Scenario: Schedule a payment in the past
+    When I schedule a payment as sched of amount 10.00 for yesterday
+    Then I should have status code 400
+
+  Scenario: Schedule a weekly payment
+    When I schedule a weekly payment as sched of amount 10.00 starting today
+    Then I should have status code 201
+    And the payment of schedule sched for today should be created
+    And schedule sched should be due in 7 days
+    And that json should have string at data.attributes.status equal to active
+
+  Scenario: Unknown frequency
+    When I schedule a yearly payment as sched of amount 10.00 starting today
+    Then I should have status code 400
+
+  Scenario: Pause and resume a schedule
+    Given I scheduled a weekly payment as sched of amount 10.00 starting tomorrow
+    When I pause schedule sched
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.status equal to paused
+    And I pause schedule sched
+    And I should have status code 409
+    And I resume schedule sched
+    And I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.status equal to active
+
+  Scenario: Cancel a schedule
+    Given I scheduled a payment as sched of amount 10.00 for tomorrow
+    When I cancel schedule sched
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.status equal to cancelled
+    And I resume schedule sched
+    And I should have status code 409
+
+  Scenario: Schedule not found
+    When I pause schedule other
+    Then I should have status code 404
@@ -0,0 +1,124 @@
+Feature: Sanctions screening
+  In order to comply with sanctions regulations
+  As a product owner
+  I need payments to sanctioned parties to be held until reviewed
+
+  Scenario: Payments to sanctioned parties are held
+    Given an organisation with id org2
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is made to "Sidorov, Ivan Petrovich"
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to held
+    And that json should have string at data.attributes.screening.hits[0].party equal to beneficiary
+    And that json should have string at data.attributes.screening.hits[0].entry_id equal to SAMPLE-1
+
+  Scenario: Addresses are screened too
+    Given an organisation with id org2
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is made to "John Smith" at "PO Box 1234, Georgetown"
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to held
+    And that json should have string at data.attributes.screening.hits[0].field equal to address
+
+  Scenario: Payments to other parties are not held
+    Given an organisation with id org2
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is made to "John Smith"
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.status equal to created
+
+  Scenario: Held payments cannot be updated
+    Given an organisation with id org2
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And that payment is made to "Ivan Sidorov Petrovich"
+    And I created that payment
+    When I update that payment
+    Then I should have status code 409
+
+  Scenario: Released payments can be submitted
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 60.00
+    And that payment is debited from that account
+    And that payment is made to "Ivan Petrovich Sidorov"
+    And I created that payment
+    When I release that payment on review
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.status equal to created
+    And that json should have string at data.attributes.screening.decision equal to released
+    When I submit that payment
+    Then I should have status code 201
+
+  Scenario: Rejected payments cannot be submitted
+    Given I created an account with id acc and opening balance 100.00
+    And a payment with id abc and amount 60.00
+    And that payment is debited from that account
+    And that payment is made to "Ivan Petrovich Sidorov"
+    And I created that payment
+    When I reject that payment on review
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.status equal to rejected
+    When I submit that payment
+    Then I should have status code 409
+
+  Scenario: Only held payments can be reviewed
+    Given an organisation with id org2
+    And I created that organisation
+    And a payment with id abc for that organisation
+    And I created that payment
+    When I release that payment on review
+    Then I should have status code 409
+
+  Scenario: Reviews need the admin permission
+    Given I created an api key as maker with permissions write
+    And I use api key maker
+    And a payment with id abc
+    And that payment is made to "Ivan Petrovich Sidorov"
+    And I created that payment
+    When I release that payment on review
+    Then I should have status code 403
+
+  Scenario: Payments cannot be reviewed by the api key they were created with
+    Given I created an api key as ops with permissions admin
+    And I use api key ops
+    And a payment with id abc
+    And that payment is made to "Ivan Petrovich Sidorov"
+    And I created that payment
+    When I release that payment on review
+    Then I should have status code 403
+
+  Scenario: Payments cannot be reviewed by the user they were created by
+    Given I use a RS256 token as alice for organisation org1 with roles write
+    And a payment with id abc
+    And that payment is made to "Ivan Petrovich Sidorov"
+    And I created that payment
+    And I use a RS256 token as alice for organisation org1 with roles admin
+    And I act as user bob
+    When I release that payment on review
+    Then I should have status code 403
+
+  Scenario: Payments are reviewed by another admin
+    Given I created an api key as maker with permissions write
+    And I created an api key as checker with permissions admin
+    And I use api key maker
+    And a payment with id abc
+    And that payment is made to "Ivan Petrovich Sidorov"
+    And I created that payment
+    And I use api key checker
+    When I release that payment on review
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.created_with equal to maker
+    And that json should have string at data.attributes.screening.reviewed_by equal to checker
+    And that json should have string at data.attributes.status equal to created
@@ -0,0 +1,59 @@
+Feature: Signed requests
+  In order to authenticate requests without sending a secret over the wire
+  As a product owner
+  I need clients to sign their requests with the private key of a public key they registered
+
+  Scenario: Register a public key
+    When I register a RSA signing key as ci with permissions read
+    Then I should have status code 201
+    And I should have a json
+    And that json should have a data.attributes.public_key
+    And that json should have string at data.attributes.status equal to active
+
+  Scenario: Invalid public keys
+    When I register an invalid public key as ci
+    Then I should have status code 400
+
+  Scenario: Public keys cannot be rotated
+    Given I registered an ECDSA signing key as ci with permissions read
+    When I rotate api key ci
+    Then I should have status code 409
+
+  Scenario: Requests are authenticated with RSA signatures
+    Given I registered a RSA signing key as ci with permissions read
+    And I sign requests with key ci
+    When I get all payments
+    Then I should have status code 200
+
+  Scenario: Requests with a body are authenticated with ECDSA signatures
+    Given I registered an ECDSA signing key as ci with permissions write
+    And I sign requests with key ci
+    And a payment with id abc
+    When I create that payment
+    Then I should have status code 201
+
+  Scenario: Signed requests are authorised as per the permissions of their key
+    Given I registered an ECDSA signing key as ci with permissions read
+    And I sign requests with key ci
+    And a payment with id abc
+    When I create that payment
+    Then I should have status code 403
+
+  Scenario: Old requests cannot be replayed
+    Given I registered an ECDSA signing key as ci with permissions read
+    And I sign requests with key ci, dated 10 minutes ago
+    When I get all payments
+    Then I should have status code 401
+
+  Scenario: Requests signed with another key are rejected
+    Given I registered an ECDSA signing key as ci with permissions read
+    And I sign requests with another key as ci
+    When I get all payments
+    Then I should have status code 401
+
+  Scenario: Requests signed with a revoked key are rejected
+    Given I registered an ECDSA signing key as ci with permissions read
+    And I revoke api key ci
+    And I sign requests with key ci
+    When I get all payments
+    Then I should have status code 401
@@ -0,0 +1,102 @@
+Feature: Webhook subscriptions
+  In order to react to changes in payments
+  As an integrator
+  I need to be notified via signed http callbacks
+
+  Scenario: Create a subscription
+    Given a webhook receiver responding with status 200
+    And a subscription with id sub1 for events payment.created
+    When I create that subscription
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.id equal to sub1
+    And that json should have a links.deliveries
+    And that json should have a links.dead_letters
+
+  Scenario: Subscription without a callback
+    Given a webhook receiver responding with status 200
+    And a subscription with id sub1 for events payment.created
+    And that subscription has no callback
+    When I create that subscription
+    Then I should have status code 400
+
+  Scenario: Deliver a payment event
+    Given a webhook receiver responding with status 200
+    And I created a subscription with id sub1 for events payment.created
+    When I created a new payment with id abc
+    Then the receiver should get 1 event(s) of type payment.created
+    When I get the deliveries of that subscription
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].attributes.status equal to delivered
+
+  Scenario: Ignore events the subscription is not interested in
+    Given a webhook receiver responding with status 200
+    And I created a subscription with id sub1 for events payment.deleted
+    And I created a new payment with id abc
+    And I deleted that payment
+    Then the receiver should get 1 event(s) of type payment.deleted
+
+  Scenario: Dead letters
+    Given a webhook receiver responding with status 500
+    And I created a subscription with id sub1 for events payment.created
+    When I created a new payment with id abc
+    Then that subscription should have 1 dead letters
+
+  Scenario: Secrets are never sent back
+    Given a webhook receiver responding with status 200
+    And a subscription with id sub1 for events payment.created
+    When I create that subscription
+    Then I should have status code 201
+    And I should have a json
+    And that json should not have a data.attributes.secret
+    And I get that subscription
+    And I should have status code 200
+    And I should have a json
+    And that json should not have a data.attributes.secret
+    And I get all subscriptions
+    And I should have status code 200
+    And I should have a json
+    And that json should not have a data[0].attributes.secret
+
+  Scenario: Subscriptions updated without a secret keep theirs
+    Given a webhook receiver responding with status 200
+    And I created a subscription with id sub1 for events payment.created
+    When I update that subscription without its secret
+    Then I should have status code 200
+    And I created a new payment with id abc
+    And the receiver should get 1 event(s) of type payment.created
+
+  Scenario: Subscriptions updated with a new secret sign with it
+    Given a webhook receiver responding with status 200
+    And I created a subscription with id sub1 for events payment.created
+    And that subscription has secret other
+    When I update that subscription
+    Then I should have status code 200
+    And I created a new payment with id abc
+    And the receiver should get 1 event(s) of type payment.created
+
+  Scenario: Subscriptions stay with their organisation
+    Given a webhook receiver responding with status 200
+    And I created a subscription with id sub1 for events payment.created
+    And that subscription has organisation org2
+    When I update that subscription
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.organisation_id equal to org1
+
+  Scenario: Principals only list the subscriptions of their organisations
+    Given a webhook receiver responding with status 200
+    And I created a subscription with id sub1 for events payment.created
+    And a subscription with id sub2 for events payment.created
+    And that subscription has organisation org2
+    And I create that subscription
+    And I should have status code 201
+    And I created an api key as reader with permissions read
+    And I use api key reader
+    When I get all subscriptions
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to sub1
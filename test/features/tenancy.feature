@@ -0,0 +1,245 @@
+Feature: Tenancy
+  In order to keep the data of our customers private to them
+  As a product owner
+  I need principals to only ever see the data of the organisations they can access
+
+  Background:
+    Given an organisation with id org2
+    And I created that organisation
+    And I created a new payment with id abc
+
+  Scenario: Principals only list payments of their organisations
+    Given I use a RS256 token as alice for organisation org1 with roles read
+    Then I should have 1 payment(s)
+
+  Scenario: Principals do not list payments of other organisations
+    Given I use a RS256 token as alice for organisation org2 with roles read
+    Then I should have 0 payment(s)
+
+  Scenario: Principals cannot ask for payments of other organisations
+    Given I use a RS256 token as alice for organisation org2 with roles read
+    When I get all payments of organisation org1
+    Then I should have status code 403
+
+  Scenario: Payments of other organisations are not listed in the past either
+    Given I remember the current time
+    And I use a RS256 token as alice for organisation org2 with roles read
+    When I get all payments as of the remembered time
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 0 items
+
+  Scenario: Principals get payments of their organisations
+    Given I use a RS256 token as alice for organisation org1 with roles read
+    When I get that payment
+    Then I should have status code 200
+
+  Scenario: Payments of other organisations are not found
+    Given I use a RS256 token as alice for organisation org2 with roles read
+    When I get that payment
+    Then I should have status code 404
+
+  Scenario: Deleted payments of other organisations are not found in the past
+    Given I remember the current time
+    And I deleted that payment
+    And I use a RS256 token as alice for organisation org2 with roles read
+    When I get that payment as of the remembered time
+    Then I should have status code 404
+
+  Scenario: Payments of other organisations cannot be updated
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    When I update that payment
+    Then I should have status code 404
+
+  Scenario: Payments of other organisations cannot be deleted
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    When I delete that payment
+    Then I should have status code 404
+
+  Scenario: Payments of other organisations cannot be submitted
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    When I submit that payment
+    Then I should have status code 404
+
+  Scenario: Returns of payments of other organisations are not found
+    Given I use a RS256 token as alice for organisation org2 with roles read
+    When I get the returns of that payment
+    Then I should have status code 404
+
+  Scenario: Principals cannot create payments for other organisations
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And a payment with id def
+    When I create that payment
+    Then I should have status code 400
+
+  Scenario: Principals create payments for their organisations
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And a payment with id def for that organisation
+    When I create that payment
+    Then I should have status code 201
+
+  Scenario: Api keys only see payments of their organisation
+    Given I created an api key as ci with permissions read
+    And I use api key ci
+    When I get all payments of organisation org2
+    Then I should have status code 403
+
+  Scenario: Principals only list their organisations
+    Given I use a RS256 token as alice for organisation org2 with roles read
+    When I get all organisations
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to org2
+
+  Scenario: Principals cannot ask for other organisations
+    Given I use a RS256 token as alice for organisation org2 with roles read
+    When I get all organisations of organisation org1
+    Then I should have status code 403
+
+  Scenario: Other organisations are not found
+    Given I use a RS256 token as alice for organisation org1 with roles admin
+    When I get that organisation
+    Then I should have status code 404
+    And I update that organisation
+    And I should have status code 404
+    And I delete that organisation
+    And I should have status code 404
+
+  Scenario: Organisation settings require the admin permission
+    Given I created an api key as ci with permissions read,write
+    And I use api key ci
+    And an organisation with id org1
+    And that organisation has a daily limit of 1000000
+    When I update that organisation
+    Then I should have status code 403
+
+  Scenario: Admins change the settings of their organisation
+    Given I use a RS256 token as alice for organisation org2 with roles admin
+    And that organisation has a daily limit of 1000000
+    When I update that organisation
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.settings.daily_limit equal to 1000000
+
+  Scenario: Principals cannot create other organisations
+    Given I use a RS256 token as alice for organisation org2 with roles admin
+    And an organisation with id acme
+    When I create that organisation
+    Then I should have status code 403
+
+  Scenario: Accounts of other organisations are not listed
+    Given I created an account with id acc1 and opening balance 100.00
+    And I use a RS256 token as alice for organisation org2 with roles read
+    When I get all accounts
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 0 items
+    And I get all accounts of organisation org1
+    And I should have status code 403
+
+  Scenario: Accounts of other organisations are not found
+    Given I created an account with id acc1 and opening balance 100.00
+    And I use a RS256 token as alice for organisation org2 with roles write
+    When I get that account
+    Then I should have status code 404
+    And I get the transactions of that account
+    And I should have status code 404
+    And I delete that account
+    And I should have status code 404
+
+  Scenario: Principals cannot open accounts for other organisations
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    And an account with id acc1 and opening balance 100.00
+    When I create that account
+    Then I should have status code 400
+
+  Scenario: Principals get the accounts of their organisations
+    Given I created an account with id acc1 and opening balance 100.00
+    And I use a RS256 token as alice for organisation org1 with roles read
+    When I get all accounts
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that account should have balance 100.00
+
+  Scenario: Mandates of other organisations are not listed
+    Given I created a mandate as m1 for account 12345678
+    And I use a RS256 token as alice for organisation org2 with roles read
+    When I get all mandates
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 0 items
+
+  Scenario: Mandates of other organisations are not found
+    Given I created a mandate as m1 for account 12345678
+    And I use a RS256 token as alice for organisation org2 with roles write
+    When I get mandate m1
+    Then I should have status code 404
+    And I activate mandate m1
+    And I should have status code 404
+
+  Scenario: Principals cannot create mandates for other organisations
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    When I create a mandate as m1 for account 12345678
+    Then I should have status code 400
+
+  Scenario: Schedules of other organisations are not listed
+    Given I scheduled a payment as sched of amount 10.00 for tomorrow
+    And I use a RS256 token as alice for organisation org2 with roles read
+    When I get all schedules
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 0 items
+
+  Scenario: Schedules of other organisations are not found
+    Given I scheduled a payment as sched of amount 10.00 for tomorrow
+    And I use a RS256 token as alice for organisation org2 with roles write
+    When I get schedule sched
+    Then I should have status code 404
+    And I cancel schedule sched
+    And I should have status code 404
+
+  Scenario: Principals cannot schedule payments for other organisations
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    When I schedule a payment as sched of amount 10.00 for tomorrow
+    Then I should have status code 400
+
+  Scenario: Fx quotes of other organisations are not listed
+    Given I requested a fx quote as q1 to sell GBP for EUR
+    And I use a RS256 token as alice for organisation org2 with roles read
+    When I get all fx-quotes
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 0 items
+
+  Scenario: Fx quotes of other organisations are not found
+    Given I requested a fx quote as q1 to sell GBP for EUR
+    And I use a RS256 token as alice for organisation org2 with roles read
+    When I get fx quote q1
+    Then I should have status code 404
+
+  Scenario: Principals cannot request fx quotes for other organisations
+    Given I use a RS256 token as alice for organisation org2 with roles write
+    When I request a fx quote as q1 to sell GBP for EUR
+    Then I should have status code 400
+
+  Scenario: Subscriptions of other organisations are not found
+    Given a webhook receiver responding with status 200
+    And I created a subscription with id sub1 for events payment.created
+    And I use a RS256 token as alice for organisation org2 with roles write
+    When I get that subscription
+    Then I should have status code 404
+    And I update that subscription
+    And I should have status code 404
+    And I get the deliveries of that subscription
+    And I should have status code 404
+    And I get the dead letters of that subscription
+    And I should have status code 404
+
+  Scenario: Principals cannot subscribe to events of other organisations
+    Given a webhook receiver responding with status 200
+    And I use a RS256 token as alice for organisation org2 with roles write
+    And a subscription with id sub1 for events payment.created
+    When I create that subscription
+    Then I should have status code 400
@@ -14,11 +14,13 @@ var (
 	opt        = godog.Options{Output: colors.Colored(os.Stdout)}
 	serverUrl  *string
 	apiVersion *string
+	eventsFile *string
 )
 
 func init() {
 	serverUrl = flag.String("server-url", "http://localhost:8080", "the payments server url to test against")
 	apiVersion = flag.String("api-version", "v1", "the api version")
+	eventsFile = flag.String("events-file", "/tmp/form3-events.jsonl", "the file the payments server publishes events to")
 	godog.BindFlags("godog.", flag.CommandLine, &opt)
 }
 
@@ -43,7 +45,7 @@ func TestMain(m *testing.M) {
 func FeatureContext(s *godog.Suite) {
 
 	// Build a new World. This instance will be shared accross all scenarios
-	w := NewWorld(*serverUrl, *apiVersion)
+	w := NewWorld(*serverUrl, *apiVersion, *eventsFile)
 
 	// Make sure our scenario data is reset before each scenario
 	// so that we do not incurr into side effects
@@ -54,9 +56,12 @@ func FeatureContext(s *godog.Suite) {
 
 		// Also ensure the service is up, and there is no data
 		// from previous scenarios or run
-		// All the existing data will be lost, so use with care
+		// All the existing data will be lost, so use with care. Payment
+		// fixtures belong to the org1 organisation
 		err := DoThen(w.TheServiceIsUp(), func() error {
-			return w.ThereAreNoPayments()
+			return DoThen(w.ThereAreNoPayments(), func() error {
+				return w.ThereIsAnActiveOrganisation("org1")
+			})
 		})
 
 		// Best effort.
@@ -79,6 +84,7 @@ func FeatureContext(s *godog.Suite) {
 	s.Step(`^that json should have (\d+) items$`, w.ThatJsonShouldHaveItems)
 	s.Step(`^that json should have an (.*)$`, w.ThatJsonShouldHaveA)
 	s.Step(`^that json should have a (.*)$`, w.ThatJsonShouldHaveA)
+	s.Step(`^that json should not have a (.*)$`, w.ThatJsonShouldNotHaveA)
 	s.Step(`^that text should match (.*)$`, w.ThatTextShouldMatch)
 	s.Step(`^I get all payments$`, w.IGetAllPayments)
 	s.Step(`^I get payments (\d+) to (\d+)$`, w.IGetPaymentsFromTo)
@@ -95,8 +101,165 @@ func FeatureContext(s *godog.Suite) {
 	s.Step(`^I should have (\d+) payment\(s\)$`, w.IShouldHavePayments)
 	s.Step(`^I deleted that payment$`, w.IDeletedThatPayment)
 	s.Step(`^I updated that payment$`, w.IUpdatedThatPayment)
+	s.Step(`^I updated that payment (\d+) times$`, w.IUpdatedThatPaymentTimes)
+	s.Step(`^I update that payment (\d+) times at once$`, w.IUpdateThatPaymentTimesAtOnce)
 	s.Step(`^I delete version (\d+) of that payment$`, w.IDeleteVersionOfThatPayment)
 	s.Step(`^I delete that payment, without saying which version$`, w.IDeleteThatPaymentWithoutSayingWhichVersion)
 	s.Step(`^I update version (\d+) of that payment$`, w.IUpdateVersionOfThatPayment)
 	s.Step(`^that payment has version (\d+)$`, w.ThatPaymentHasVersion)
+	s.Step(`^I remember the current time$`, w.IRememberTheCurrentTime)
+	s.Step(`^I get that payment as of the remembered time$`, w.IGetThatPaymentAsOfTheRememberedTime)
+	s.Step(`^I get that payment as of "(.*)"$`, w.IGetThatPaymentAsOf)
+	s.Step(`^I get all payments as of the remembered time$`, w.IGetAllPaymentsAsOfTheRememberedTime)
+	s.Step(`^I get all payments of organisation ([a-z0-9]+)$`, w.IGetAllPaymentsOfOrganisation)
+	s.Step(`^I get all (organisations|accounts|mandates|schedules|fx-quotes)$`, w.IGetAll)
+	s.Step(`^I get all (organisations|accounts|mandates|schedules|fx-quotes) of organisation ([a-z0-9]+)$`, w.IGetAllOfOrganisation)
+	s.Step(`^an organisation with id ([a-z0-9]+)$`, w.AnOrganisationWithId)
+	s.Step(`^that organisation is inactive$`, w.ThatOrganisationIsInactive)
+	s.Step(`^that organisation only allows currencies (.*)$`, w.ThatOrganisationOnlyAllowsCurrencies)
+	s.Step(`^that organisation has a daily limit of (.*)$`, w.ThatOrganisationHasADailyLimitOf)
+	s.Step(`^that organisation has default scheme (.*)$`, w.ThatOrganisationHasDefaultScheme)
+	s.Step(`^that organisation rejects payments on non-processing days$`, w.ThatOrganisationRejectsNonProcessingDays)
+	s.Step(`^I create that organisation$`, w.ICreateThatOrganisation)
+	s.Step(`^I created that organisation$`, w.ICreatedThatOrganisation)
+	s.Step(`^I update that organisation$`, w.IUpdateThatOrganisation)
+	s.Step(`^I get that organisation$`, w.IGetThatOrganisation)
+	s.Step(`^I delete that organisation$`, w.IDeleteThatOrganisation)
+	s.Step(`^a payment with id ([a-z]+) for that organisation$`, w.APaymentWithIdForThatOrganisation)
+	s.Step(`^that payment is in currency (.*)$`, w.ThatPaymentIsInCurrency)
+	s.Step(`^that payment has amount (.*)$`, w.ThatPaymentHasAmount)
+	s.Step(`^that payment belongs to organisation ([a-z0-9]+)$`, w.ThatPaymentBelongsToOrganisation)
+	s.Step(`^an account with id ([a-z0-9]+) and opening balance (.*)$`, w.AnAccountWithOpeningBalance)
+	s.Step(`^that account belongs to that organisation$`, w.ThatAccountBelongsToThatOrganisation)
+	s.Step(`^I create that account$`, w.ICreateThatAccount)
+	s.Step(`^I created an account with id ([a-z0-9]+) and opening balance (.*)$`, w.ICreatedAnAccountWithOpeningBalance)
+	s.Step(`^I get that account$`, w.IGetThatAccount)
+	s.Step(`^I delete that account$`, w.IDeleteThatAccount)
+	s.Step(`^I get the transactions of that account$`, w.IGetTheTransactionsOfThatAccount)
+	s.Step(`^that account should have balance (.*)$`, w.ThatAccountShouldHaveBalance)
+	s.Step(`^that payment is debited from that account$`, w.ThatPaymentIsDebitedFromThatAccount)
+	s.Step(`^I submit that payment$`, w.ISubmitThatPayment)
+	s.Step(`^I submitted that payment$`, w.ISubmittedThatPayment)
+	s.Step(`^I return (.*) of that payment as ([a-z0-9]+) with reason (.*)$`, w.IReturnOfThatPaymentAsWithReason)
+	s.Step(`^I return (.*) of that payment with reason (.*)$`, w.IReturnOfThatPaymentWithReason)
+	s.Step(`^I returned (.*) of that payment with reason (.*)$`, w.IReturnedOfThatPaymentWithReason)
+	s.Step(`^I reverse that payment with reason (.*)$`, w.IReverseThatPaymentWithReason)
+	s.Step(`^I get the returns of that payment$`, w.IGetTheReturnsOfThatPayment)
+	s.Step(`^I get the reversals of that payment$`, w.IGetTheReversalsOfThatPayment)
+	s.Step(`^I recall that payment as ([a-z0-9]+) with reason (.*)$`, w.IRecallThatPaymentWithReason)
+	s.Step(`^I recalled that payment as ([a-z0-9]+) with reason (.*)$`, w.IRecalledThatPaymentWithReason)
+	s.Step(`^I move version (\d+) of recall ([a-z0-9]+) to (requested|pending|accepted|rejected)$`, w.IMoveVersionOfRecallToStatus)
+	s.Step(`^I move version (\d+) of recall ([a-z0-9]+) to rejected with reason (.*)$`, w.IMoveVersionOfRecallToRejected)
+	s.Step(`^I get the recalls of that payment$`, w.IGetTheRecallsOfThatPayment)
+	s.Step(`^I schedule a payment as ([a-z0-9]+) of amount (.*) for (today|tomorrow|yesterday)$`, w.IScheduleAPaymentFor)
+	s.Step(`^I scheduled a payment as ([a-z0-9]+) of amount (.*) for (today|tomorrow|yesterday)$`, w.IScheduledAPaymentFor)
+	s.Step(`^I schedule a (weekly|monthly|last_business_day|yearly) payment as ([a-z0-9]+) of amount (.*) starting (today|tomorrow|yesterday)$`, w.IScheduleARecurringPaymentStarting)
+	s.Step(`^I scheduled a (weekly|monthly|last_business_day) payment as ([a-z0-9]+) of amount (.*) starting (today|tomorrow|yesterday)$`, w.IScheduledARecurringPaymentStarting)
+	s.Step(`^I (pause|resume|cancel) schedule ([a-z0-9]+)$`, w.IMoveSchedule)
+	s.Step(`^I get schedule ([a-z0-9]+)$`, w.IGetSchedule)
+	s.Step(`^I get the payment of schedule ([a-z0-9]+) for (today|tomorrow|yesterday)$`, w.IGetThePaymentOfScheduleFor)
+	s.Step(`^the payment of schedule ([a-z0-9]+) for (today|tomorrow|yesterday) should be created$`, w.ThePaymentOfScheduleForShouldBeCreated)
+	s.Step(`^the payment of schedule ([a-z0-9]+) for (today|tomorrow|yesterday) should not be created$`, w.ThePaymentOfScheduleForShouldNotBeCreated)
+	s.Step(`^schedule ([a-z0-9]+) should be due in (\d+) days$`, w.ScheduleShouldBeDueInDays)
+	s.Step(`^schedule ([a-z0-9]+) should fail$`, w.ScheduleShouldFail)
+	s.Step(`^a payment with the id of schedule ([a-z0-9]+) for (today|tomorrow|yesterday)$`, w.APaymentWithTheIdOfScheduleFor)
+	s.Step(`^I get the next business day of scheme ([A-Za-z0-9]+) from (\d{4}-\d{2}-\d{2})$`, w.IGetTheNextBusinessDayOfSchemeFrom)
+	s.Step(`^I get the calendar of scheme ([A-Za-z0-9]+)$`, w.IGetTheCalendarOfScheme)
+	s.Step(`^that payment uses scheme ([A-Za-z0-9]+)$`, w.ThatPaymentUsesScheme)
+	s.Step(`^that payment is to be processed on (\d{4}-\d{2}-\d{2})$`, w.ThatPaymentIsToBeProcessedOn)
+	s.Step(`^I create a mandate as ([a-z0-9]+) for account (\d+)$`, w.ICreateAMandateForAccount)
+	s.Step(`^I created a mandate as ([a-z0-9]+) for account (\d{8})$`, w.ICreatedAMandateForAccount)
+	s.Step(`^I activate mandate ([a-z0-9]+)$`, w.IActivateMandate)
+	s.Step(`^I activated mandate ([a-z0-9]+)$`, w.IActivatedMandate)
+	s.Step(`^I cancel mandate ([a-z0-9]+) with reason code ([A-Z0-9]+)$`, w.ICancelMandateWithReasonCode)
+	s.Step(`^I get mandate ([a-z0-9]+)$`, w.IGetMandate)
+	s.Step(`^that payment is collected against mandate ([a-z0-9]+) from account (\d{8})$`, w.ThatPaymentIsCollectedAgainstMandateFromAccount)
+	s.Step(`^I request a fx quote as ([a-z0-9]+) to sell ([A-Z]{3}) for ([A-Z]{3})$`, w.IRequestAFxQuoteToSellFor)
+	s.Step(`^I requested a fx quote as ([a-z0-9]+) to sell ([A-Z]{3}) for ([A-Z]{3})$`, w.IRequestedAFxQuoteToSellFor)
+	s.Step(`^I get fx quote ([a-z0-9]+)$`, w.IGetFxQuote)
+	s.Step(`^I wait for fx quote ([a-z0-9]+) to expire$`, w.IWaitForFxQuoteToExpire)
+	s.Step(`^that payment is in ([A-Z]{3}) converted at fx quote ([a-z0-9]+)$`, w.ThatPaymentIsConvertedAtFxQuote)
+	s.Step(`^that organisation (warn|reject)s duplicate payments$`, w.ThatOrganisationHandlesDuplicatePayments)
+	s.Step(`^that payment has reference (.*)$`, w.ThatPaymentHasReference)
+	s.Step(`^I created that payment$`, w.ICreatedThatPayment)
+	s.Step(`^I create that payment, allowing duplicates$`, w.ICreateThatPaymentAllowingDuplicates)
+	s.Step(`^I create (\d+) copies of that payment at once$`, w.ICreateCopiesOfThatPaymentAtOnce)
+	s.Step(`^(\d+) of them should have status code (\d+)$`, w.OfThemShouldHaveStatusCode)
+	s.Step(`^I should have a warning$`, w.IShouldHaveAWarning)
+	s.Step(`^I should have no warning$`, w.IShouldHaveNoWarning)
+	s.Step(`^that payment is made to "([^"]*)"$`, w.ThatPaymentIsMadeTo)
+	s.Step(`^that payment is made to "([^"]*)" at "([^"]*)"$`, w.ThatPaymentIsMadeToAt)
+	s.Step(`^I (release|reject) that payment on review$`, w.IReviewThatPayment)
+	s.Step(`^that organisation requires approval above (.*)$`, w.ThatOrganisationRequiresApprovalAbove)
+	s.Step(`^I act as user ([a-z]+)$`, w.IActAsUser)
+	s.Step(`^I approve that payment$`, w.IApproveThatPayment)
+	s.Step(`^I reject that payment$`, w.IRejectThatPayment)
+	s.Step(`^that organisation has a monthly limit of (.*)$`, w.ThatOrganisationHasAMonthlyLimitOf)
+	s.Step(`^that organisation allows (\d+) payments a (day|month)$`, w.ThatOrganisationAllowsPaymentsA)
+	s.Step(`^that organisation allows payments of up to (.*)$`, w.ThatOrganisationAllowsPaymentsOfUpTo)
+	s.Step(`^that payment is made to a beneficiary in ([A-Z]{2})$`, w.ThatPaymentIsMadeToABeneficiaryIn)
+	s.Step(`^I (release|reject) that payment on risk review$`, w.IReviewThatPaymentRisk)
+	s.Step(`^I create a beneficiary as ([a-z0-9]+) for account (\d{8})$`, w.ICreateABeneficiaryForAccount)
+	s.Step(`^I created a beneficiary as ([a-z0-9]+) for account (\d{8})$`, w.ICreatedABeneficiaryForAccount)
+	s.Step(`^I get beneficiary ([a-z0-9]+)$`, w.IGetBeneficiary)
+	s.Step(`^I update beneficiary ([a-z0-9]+) for account (\d{8})$`, w.IUpdateBeneficiaryForAccount)
+	s.Step(`^I delete beneficiary ([a-z0-9]+)$`, w.IDeleteBeneficiary)
+	s.Step(`^I get all beneficiaries$`, w.IGetAllBeneficiaries)
+	s.Step(`^I get beneficiaries of organisation ([a-z0-9]+)$`, w.IGetBeneficiariesOfOrganisation)
+	s.Step(`^that payment is made to beneficiary ([a-z0-9]+)$`, w.ThatPaymentIsMadeToBeneficiary)
+	s.Step(`^I check payee "([^"]*)" for account (\d{8})$`, w.ICheckPayeeForAccount)
+	s.Step(`^that organisation (warn|reject)s payee mismatches$`, w.ThatOrganisationHandlesPayeeMismatches)
+	s.Step(`^I upload a batch as ([a-z0-9]+) of (\d+) payments(, the last one invalid)?$`, w.IUploadABatchOfPayments)
+	s.Step(`^I uploaded a batch as ([a-z0-9]+) of (\d+) payments(, the last one invalid)?$`, w.IUploadedABatchOfPayments)
+	s.Step(`^I upload a pain\.001 batch as ([a-z0-9]+) of (\d+) payments$`, w.IUploadAPain001BatchOfPayments)
+	s.Step(`^I get batch ([a-z0-9]+)$`, w.IGetBatch)
+	s.Step(`^I approve batch ([a-z0-9]+)$`, w.IApproveBatch)
+	s.Step(`^I get the payments of batch ([a-z0-9]+)$`, w.IGetThePaymentsOfBatch)
+	s.Step(`^batch ([a-z0-9]+) should be (validated|invalid|approved)$`, w.BatchShouldBe)
+	s.Step(`^I create an api key as ([a-z0-9]+) with permissions (.*)$`, w.ICreateAnApiKeyWithPermissions)
+	s.Step(`^I created an api key as ([a-z0-9]+) with permissions (.*)$`, w.ICreatedAnApiKeyWithPermissions)
+	s.Step(`^I get api key ([a-z0-9]+)$`, w.IGetApiKey)
+	s.Step(`^I rotate api key ([a-z0-9]+)$`, w.IRotateApiKey)
+	s.Step(`^I revoke api key ([a-z0-9]+)$`, w.IRevokeApiKey)
+	s.Step(`^I use api key ([a-z0-9]+)$`, w.IUseApiKey)
+	s.Step(`^I use the previous key of api key ([a-z0-9]+)$`, w.IUseThePreviousKeyOfApiKey)
+	s.Step(`^I use an invalid api key$`, w.IUseAnInvalidApiKey)
+	s.Step(`^I use no api key$`, w.IUseNoApiKey)
+	s.Step(`^I use an? (RS256|ES256) token as ([a-z0-9]+) for organisation ([a-z0-9]+) with roles (.*)$`, w.IUseATokenFor)
+	s.Step(`^I use an expired token as ([a-z0-9]+) for organisation ([a-z0-9]+) with roles (.*)$`, w.IUseAnExpiredTokenFor)
+	s.Step(`^I use a token for another audience as ([a-z0-9]+) for organisation ([a-z0-9]+) with roles (.*)$`, w.IUseATokenForAnotherAudience)
+	s.Step(`^I use a token signed with an unknown key as ([a-z0-9]+) for organisation ([a-z0-9]+) with roles (.*)$`, w.IUseATokenSignedWithAnUnknownKey)
+	s.Step(`^I use no token$`, w.IUseNoToken)
+	s.Step(`^I register an? (RSA|ECDSA) signing key as ([a-z0-9]+) with permissions (.*)$`, w.IRegisterASigningKey)
+	s.Step(`^I registered an? (RSA|ECDSA) signing key as ([a-z0-9]+) with permissions (.*)$`, w.IRegisteredASigningKey)
+	s.Step(`^I register an invalid public key as ([a-z0-9]+)$`, w.IRegisterAnInvalidPublicKey)
+	s.Step(`^I sign requests with key ([a-z0-9]+)$`, w.ISignRequestsWithKey)
+	s.Step(`^I sign requests with key ([a-z0-9]+), dated (\d+) minutes ago$`, w.ISignRequestsWithKeyDatedMinutesAgo)
+	s.Step(`^I sign requests with another key as ([a-z0-9]+)$`, w.ISignRequestsWithAnotherKeyAs)
+	s.Step(`^I stop signing requests$`, w.IStopSigningRequests)
+	s.Step(`^I use an invalid admin key$`, w.IUseAnInvalidAdminKey)
+	s.Step(`^I use no admin key$`, w.IUseNoAdminKey)
+	s.Step(`^I get the repo info$`, w.IGetTheRepoInfo)
+	s.Step(`^I request a confirmation to delete all data$`, w.IRequestAConfirmationToDeleteAllData)
+	s.Step(`^I delete all data with that confirmation$`, w.IDeleteAllDataWithThatConfirmation)
+	s.Step(`^I delete all data without confirmation$`, w.IDeleteAllDataWithoutConfirmation)
+	s.Step(`^I delete all data$`, w.IDeleteAllData)
+	s.Step(`^a webhook receiver responding with status (\d+)$`, w.AWebhookReceiverRespondingWith)
+	s.Step(`^a subscription with id ([a-z0-9]+) for events (.*)$`, w.ASubscriptionForEvents)
+	s.Step(`^that subscription has no callback$`, w.ThatSubscriptionHasNoCallback)
+	s.Step(`^that subscription has organisation ([a-z0-9]+)$`, w.ThatSubscriptionHasOrganisation)
+	s.Step(`^that subscription has secret ([a-z0-9]+)$`, w.ThatSubscriptionHasSecret)
+	s.Step(`^that subscription has version (\d+)$`, w.ThatSubscriptionHasVersion)
+	s.Step(`^I get that subscription$`, w.IGetThatSubscription)
+	s.Step(`^I get all subscriptions$`, w.IGetAllSubscriptions)
+	s.Step(`^I update that subscription$`, w.IUpdateThatSubscription)
+	s.Step(`^I update that subscription without its secret$`, w.IUpdateThatSubscriptionWithoutItsSecret)
+	s.Step(`^I create that subscription$`, w.ICreateThatSubscription)
+	s.Step(`^I created a subscription with id ([a-z0-9]+) for events (.*)$`, w.ICreatedASubscriptionForEvents)
+	s.Step(`^I get the deliveries of that subscription$`, w.IGetTheDeliveriesOfThatSubscription)
+	s.Step(`^I get the dead letters of that subscription$`, w.IGetTheDeadLettersOfThatSubscription)
+	s.Step(`^the receiver should get (\d+) event\(s\) of type (.*)$`, w.TheReceiverShouldGetEvents)
+	s.Step(`^I follow the events file$`, w.IFollowTheEventsFile)
+	s.Step(`^the events file should get (\d+) event\(s\) of type ([a-z.]+) for payment ([a-z0-9]+)$`, w.TheEventsFileShouldGetEventsOfTypeForPayment)
+	s.Step(`^that subscription should have (\d+) dead letters$`, w.ThatSubscriptionShouldHaveDeadLetters)
 }